@@ -43,6 +43,7 @@ import (
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server"
 	"github.com/cloudwan/gohan/server/middleware"
+	gohan_sync "github.com/cloudwan/gohan/sync"
 	sync_util "github.com/cloudwan/gohan/sync/util"
 	"github.com/cloudwan/gohan/util"
 )
@@ -70,6 +71,7 @@ func Run(name, usage, version string) {
 		getTestExtesionsCommand(),
 		getMigrateCommand(),
 		getResyncCommand(),
+		getDeadLettersCommand(),
 		getTemplateCommand(),
 		getRunCommand(),
 		getTestCommand(),
@@ -260,9 +262,9 @@ Gohan convert can be used to migrate Gohan resources between different types of
 Setting meta-schema option will additionally convert meta-schema table with schema resources.
 Useful for development purposes.`,
 		Flags: []cli.Flag{
-			cli.StringFlag{Name: "in-type, it", Value: "", Usage: "Input db type (yaml, json, sqlite3, mysql)"},
+			cli.StringFlag{Name: "in-type, it", Value: "", Usage: "Input db type (yaml, json, sqlite3, mysql, postgres)"},
 			cli.StringFlag{Name: "in, i", Value: "", Usage: "Input db connection spec (or filename)"},
-			cli.StringFlag{Name: "out-type, ot", Value: "", Usage: "Output db type (yaml, json, sqlite3, mysql)"},
+			cli.StringFlag{Name: "out-type, ot", Value: "", Usage: "Output db type (yaml, json, sqlite3, mysql, postgres)"},
 			cli.StringFlag{Name: "out, o", Value: "", Usage: "Output db connection spec (or filename)"},
 			cli.StringFlag{Name: "schema, s", Value: "", Usage: "Schema file"},
 			cli.StringFlag{Name: "meta-schema, m", Value: "embed://etc/schema/gohan.json", Usage: "Meta-schema file (optional)"},
@@ -354,6 +356,83 @@ func getResyncCommand() cli.Command {
 	}
 }
 
+func loadSyncFromConfig(configFile string) gohan_sync.Sync {
+	config := util.GetConfig()
+	if configFile == "" {
+		log.Fatal("Need to provide server config file")
+	}
+	if err := config.ReadConfig(configFile); err != nil {
+		log.Fatalf("Error while loading server config file: %s", err)
+	}
+	sync, err := sync_util.CreateFromConfig(config)
+	if err != nil {
+		log.Fatalf("Failed to create sync, err: %s", err)
+	}
+	if sync == nil {
+		log.Fatal("No sync backend specified in configuration")
+	}
+	return sync
+}
+
+func getDeadLettersCommand() cli.Command {
+	return cli.Command{
+		Name:  "dead-letters",
+		Usage: "Manage sync watch events which failed in at-least-once mode",
+		Subcommands: []cli.Command{
+			{
+				Name:  "list",
+				Usage: "List dead letters",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "config-file", Value: defaultConfigFile, Usage: "Server config File"},
+				},
+				Action: func(c *cli.Context) {
+					sync := loadSyncFromConfig(c.String("config-file"))
+					deadLetters, err := server.ListSyncDeadLetters(sync)
+					if err != nil {
+						log.Fatal(err)
+					}
+					for _, deadLetter := range deadLetters {
+						fmt.Printf("%s\t%s\t%s\t%d\t%s\t%s\n", deadLetter.ID, deadLetter.Action, deadLetter.Key,
+							deadLetter.Attempts, deadLetter.FailedAt.Format(time.RFC3339), deadLetter.Error)
+					}
+				},
+			},
+			{
+				Name:        "replay",
+				Usage:       "Replay dead letters",
+				Description: "Hand dead letters with given IDs (or all of them with --all) to the running sync watcher",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "config-file", Value: defaultConfigFile, Usage: "Server config File"},
+					cli.BoolFlag{Name: "all", Usage: "Replay all dead letters"},
+				},
+				Action: func(c *cli.Context) {
+					sync := loadSyncFromConfig(c.String("config-file"))
+					ids := []string(c.Args())
+					if c.Bool("all") {
+						deadLetters, err := server.ListSyncDeadLetters(sync)
+						if err != nil {
+							log.Fatal(err)
+						}
+						ids = []string{}
+						for _, deadLetter := range deadLetters {
+							ids = append(ids, deadLetter.ID)
+						}
+					}
+					if len(ids) == 0 {
+						log.Fatal("Need to provide dead letter IDs or --all")
+					}
+					for _, id := range ids {
+						if err := server.ReplaySyncDeadLetter(sync, id); err != nil {
+							log.Fatal(err)
+						}
+						log.Info("Dead letter %s replayed", id)
+					}
+				},
+			},
+		},
+	}
+}
+
 func getServerCommand() cli.Command {
 	return cli.Command{
 		Name:        "server",
@@ -385,6 +464,9 @@ documentation for detail information about writing tests.`,
 			cli.StringFlag{Name: "config-file,c", Value: "", Usage: "Config file path"},
 			cli.StringFlag{Name: "run-test,r", Value: "", Usage: "Run only tests matching specified regex"},
 			cli.IntFlag{Name: "parallel, p", Value: runtime.NumCPU(), Usage: "Allow parallel execution of test functions"},
+			cli.StringSliceFlag{Name: "report", Usage: "Write test results to a report given as format=path, supported formats: junit, json"},
+			cli.BoolFlag{Name: "coverage", Usage: "Measure coverage of tested extensions"},
+			cli.StringFlag{Name: "coverage-dir", Value: "coverage", Usage: "Directory for lcov and HTML coverage reports"},
 		},
 		Action: framework.TestExtensions,
 	}
@@ -484,7 +566,7 @@ func getMigrateSubcommandWithPostMigrateEvent(subcmd, usage string) cli.Command
 				}
 				pluralURL := s.GetPluralURL()
 
-				if _, ok := environmentManager.GetEnvironment(s.ID); !ok {
+				if !environmentManager.HasEnvironment(s.ID) {
 					env := otto.NewEnvironment("post-migration-env", dbConn, identity, sync)
 					eventTimeout := context.Duration(POST_MIGRATION_EVENT_TIMEOUT_FLAG)
 					env.SetEventTimeLimit(POST_MIGRATION_EVENT, eventTimeout)
@@ -576,7 +658,7 @@ func getCreateInitialMigrationCommand() cli.Command {
 			path := filepath.Join(c.String("path"), version)
 			var sqlString = bytes.NewBuffer(make([]byte, 0, 100))
 			fmt.Printf("Generating goose migration file to %s ...\n", path)
-			sqlDB := sql.NewDB()
+			sqlDB := sql.NewDBWithType(util.GetConfig().GetString("database/type", "sqlite3"))
 			schemas := manager.OrderedSchemas()
 			sqlString.WriteString("\n")
 			sqlString.WriteString("-- +goose Up\n")
@@ -16,9 +16,11 @@
 package cloud
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/cloudwan/gohan/schema"
 	"github.com/rackspace/gophercloud"
@@ -31,6 +33,9 @@ import (
 
 const maxReauthAttempts = 3
 
+//ErrInvalidToken is returned when keystone rejects the token
+var ErrInvalidToken = errors.New("Invalid token")
+
 //KeystoneIdentity middleware
 type KeystoneIdentity struct {
 	Client KeystoneClient
@@ -187,11 +192,14 @@ func NewKeystoneV3Client(authURL, userName, password, domainName, tenantName str
 func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization, error) {
 	tokenResult := v3tokens.Get(client.client, token)
 	if tokenResult.Err != nil {
+		if isTokenRejected(tokenResult.Err) {
+			return nil, ErrInvalidToken
+		}
 		return nil, fmt.Errorf("Error during verifying token: %s", tokenResult.Err.Error())
 	}
-	_, err := tokenResult.Extract()
+	tokenInfo, err := tokenResult.Extract()
 	if err != nil {
-		return nil, fmt.Errorf("Invalid token")
+		return nil, ErrInvalidToken
 	}
 	tokenBody := tokenResult.Body.(map[string]interface{})["token"]
 	roles := tokenBody.(map[string]interface{})["roles"]
@@ -207,6 +215,11 @@ func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization,
 	project := projectObj.(map[string]interface{})
 	tenantID := project["id"].(string)
 	tenantName := project["name"].(string)
+	userID, userName := "", ""
+	if user, ok := tokenBodyMap["user"].(map[string]interface{}); ok {
+		userID, _ = user["id"].(string)
+		userName, _ = user["name"].(string)
+	}
 	catalogList, ok := tokenBodyMap["catalog"].([]interface{})
 	catalogObj := []*schema.Catalog{}
 	if ok {
@@ -224,7 +237,16 @@ func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization,
 			catalogObj = append(catalogObj, schema.NewCatalog(catalog["name"].(string), catalog["type"].(string), endPoints))
 		}
 	}
-	return schema.NewAuthorization(tenantID, tenantName, token, roleIDs, catalogObj), nil
+	return schema.NewUserAuthorization(userID, userName, tenantID, tenantName, token, roleIDs, catalogObj).WithExpiry(tokenInfo.ExpiresAt), nil
+}
+
+//isTokenRejected tells whether keystone responded that the token is not valid
+func isTokenRejected(err error) bool {
+	responseErr, ok := err.(*gophercloud.UnexpectedResponseCodeError)
+	if !ok {
+		return false
+	}
+	return responseErr.Actual == http.StatusNotFound || responseErr.Actual == http.StatusUnauthorized
 }
 
 // GetTenantID maps the given v3.0 project ID to the projects's name
@@ -269,12 +291,14 @@ func (client *keystoneV3Client) GetClient() *gophercloud.ServiceClient {
 func (client *keystoneV2Client) VerifyToken(token string) (schema.Authorization, error) {
 	tokenResult, err := verifyV2Token(client.client, token)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid token")
+		return nil, ErrInvalidToken
 	}
 	fmt.Printf("%v", tokenResult)
 	tokenBody := tokenResult.(map[string]interface{})["access"]
 	userBody := tokenBody.(map[string]interface{})["user"]
 	roles := userBody.(map[string]interface{})["roles"]
+	userID, _ := userBody.(map[string]interface{})["id"].(string)
+	userName, _ := userBody.(map[string]interface{})["name"].(string)
 	roleIDs := []string{}
 	for _, roleBody := range roles.([]interface{}) {
 		roleIDs = append(roleIDs, roleBody.(map[string]interface{})["name"].(string))
@@ -287,6 +311,8 @@ func (client *keystoneV2Client) VerifyToken(token string) (schema.Authorization,
 	tenant := tenantObj.(map[string]interface{})
 	tenantID := tenant["id"].(string)
 	tenantName := tenant["name"].(string)
+	rawExpiresAt, _ := tokenBodyMap["token"].(map[string]interface{})["expires"].(string)
+	expiresAt, _ := time.Parse(time.RFC3339, rawExpiresAt)
 	catalogList := tokenBodyMap["serviceCatalog"].([]interface{})
 	catalogObj := []*schema.Catalog{}
 	for _, rawCatalog := range catalogList {
@@ -314,7 +340,7 @@ func (client *keystoneV2Client) VerifyToken(token string) (schema.Authorization,
 		}
 		catalogObj = append(catalogObj, schema.NewCatalog(catalog["name"].(string), catalog["type"].(string), endPoints))
 	}
-	return schema.NewAuthorization(tenantID, tenantName, token, roleIDs, catalogObj), nil
+	return schema.NewUserAuthorization(userID, userName, tenantID, tenantName, token, roleIDs, catalogObj).WithExpiry(expiresAt), nil
 }
 
 // GetTenantID maps the given v2.0 project name to the tenant's id
@@ -17,8 +17,10 @@ package db_test
 
 import (
 	"os"
+	"time"
 
 	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/util"
@@ -118,6 +120,10 @@ var _ = Describe("Database operation test", func() {
 
 		JustBeforeEach(func() {
 			os.Remove(conn)
+			if dbType == "postgres" {
+				// postgres database is shared by the tests
+				Expect(db.InitDBWithSchemas(dbType, conn, true, false, true)).To(Succeed())
+			}
 			dataStore, err = db.ConnectDB(dbType, conn, db.DefaultMaxOpenConn)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -138,6 +144,9 @@ var _ = Describe("Database operation test", func() {
 				if os.Getenv("MYSQL_TEST") == "true" {
 					conn = "root@/gohan_test"
 					dbType = "mysql"
+				} else if os.Getenv("POSTGRES_TEST") == "true" {
+					conn = "postgres://gohan@localhost/gohan_test?sslmode=disable"
+					dbType = "postgres"
 				} else {
 					conn = "./test.db"
 					dbType = "sqlite3"
@@ -343,6 +352,24 @@ var _ = Describe("Database operation test", func() {
 					Expect(tx.Commit()).To(Succeed())
 				})
 
+				Context("Using ResourceVersion", func() {
+					It("Returns config version for schemas with state versioning", func() {
+						version, err := transaction.ResourceVersion(tx, networkResource1)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(version).To(Equal("1"))
+
+						Expect(tx.Update(networkResource1)).To(Succeed())
+						version, err = transaction.ResourceVersion(tx, networkResource1)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(version).To(Equal("2"))
+
+						Expect(transaction.CheckResourceVersion(tx, networkResource1, []string{"1"})).To(Equal(transaction.ErrVersionMismatch))
+						Expect(transaction.CheckResourceVersion(tx, networkResource1, []string{"1", "2"})).To(Succeed())
+						Expect(transaction.CheckResourceVersion(tx, networkResource1, []string{transaction.AnyVersion})).To(Succeed())
+						Expect(tx.Commit()).To(Succeed())
+					})
+				})
+
 				Context("Using StateFetch", func() {
 					It("Returns the defaults", func() {
 						beforeState, err := tx.StateFetch(networkSchema, transaction.IDFilter(networkResource1.ID()))
@@ -359,6 +386,410 @@ var _ = Describe("Database operation test", func() {
 		})
 	})
 
+	Describe("Filtering and pagination", func() {
+		var (
+			tx           transaction.Transaction
+			testSchema   *schema.Schema
+			testResource []*schema.Resource
+		)
+
+		BeforeEach(func() {
+			Expect(manager.LoadSchemaFromFile("../tests/test_abstract_schema.yaml")).To(Succeed())
+			Expect(manager.LoadSchemaFromFile("../tests/test_schema.yaml")).To(Succeed())
+			testSchema, ok = manager.Schema("test")
+			Expect(ok).To(BeTrue())
+
+			testResource = nil
+			for _, data := range []map[string]interface{}{
+				{"id": "test1", "tenant_id": "red", "test_string": "web-1", "test_integer": 1, "test_bool": true},
+				{"id": "test2", "tenant_id": "blue", "test_string": "web-2", "test_integer": 10, "test_bool": false},
+				{"id": "test3", "tenant_id": "green", "test_string": nil, "test_integer": 5, "test_bool": false},
+			} {
+				resource, err := manager.LoadResource("test", data)
+				Expect(err).ToNot(HaveOccurred())
+				testResource = append(testResource, resource)
+			}
+		})
+
+		JustBeforeEach(func() {
+			os.Remove(conn)
+			if dbType == "postgres" {
+				// postgres database is shared by the tests
+				Expect(db.InitDBWithSchemas(dbType, conn, true, false, true)).To(Succeed())
+			}
+			dataStore, err = db.ConnectDB(dbType, conn, db.DefaultMaxOpenConn)
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, s := range manager.Schemas() {
+				Expect(dataStore.RegisterTable(s, false, true)).To(Succeed())
+			}
+
+			tx, err = dataStore.Begin()
+			Expect(err).ToNot(HaveOccurred())
+			for _, resource := range testResource {
+				Expect(tx.Create(resource)).To(Succeed())
+			}
+			Expect(tx.Commit()).To(Succeed())
+			tx.Close()
+			tx, err = dataStore.Begin()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			tx.Close()
+		})
+
+		listIDs := func(filter transaction.Filter) []string {
+			list, num, err := tx.List(testSchema, filter, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(num).To(Equal(uint64(len(list))))
+			ids := []string{}
+			for _, resource := range list {
+				ids = append(ids, resource.ID())
+			}
+			return ids
+		}
+
+		itFiltersResources := func() {
+			It("Filters using LIKE", func() {
+				Expect(listIDs(transaction.Filter{
+					"test_string": transaction.Condition{Operator: transaction.Like, Value: "web%"},
+				})).To(ConsistOf("test1", "test2"))
+				Expect(listIDs(transaction.Filter{
+					"test_string": map[string]interface{}{"like": "%_2"},
+				})).To(ConsistOf("test2"))
+			})
+
+			It("Filters using ranges", func() {
+				Expect(listIDs(transaction.Filter{
+					"test_integer": []transaction.Condition{
+						{Operator: transaction.GreaterThan, Value: 1},
+						{Operator: transaction.LessOrEqual, Value: 10},
+					},
+				})).To(ConsistOf("test2", "test3"))
+				Expect(listIDs(transaction.Filter{
+					"test_integer": map[string]interface{}{"gte": "5", "lt": "10"},
+				})).To(ConsistOf("test3"))
+				Expect(listIDs(transaction.Filter{
+					"tenant_id": map[string]interface{}{"gt": "green"},
+				})).To(ConsistOf("test1"))
+			})
+
+			It("Filters using NOT and IN", func() {
+				Expect(listIDs(transaction.Filter{
+					"tenant_id": transaction.Condition{Operator: transaction.NotEqual, Value: []string{"red", "blue"}},
+				})).To(ConsistOf("test3"))
+				Expect(listIDs(transaction.Filter{
+					"id": map[string]interface{}{"in": []interface{}{"test1", "test3"}},
+				})).To(ConsistOf("test1", "test3"))
+			})
+
+			It("Filters using IS NULL", func() {
+				Expect(listIDs(transaction.Filter{
+					"test_string": map[string]interface{}{"isnull": true},
+				})).To(ConsistOf("test3"))
+				Expect(listIDs(transaction.Filter{
+					"test_string": transaction.Condition{Operator: transaction.IsNull, Value: false},
+				})).To(ConsistOf("test1", "test2"))
+			})
+
+			It("Combines operators with plain filters", func() {
+				Expect(listIDs(transaction.Filter{
+					"tenant_id":    []string{"red", "green"},
+					"test_integer": map[string]interface{}{"gt": 2},
+				})).To(ConsistOf("test3"))
+				Expect(listIDs(transaction.Filter{
+					"test_bool": map[string]interface{}{"ne": "true"},
+				})).To(ConsistOf("test2", "test3"))
+			})
+
+			It("Returns an error for unknown operators", func() {
+				_, _, err := tx.List(testSchema, transaction.Filter{
+					"test_string": map[string]interface{}{"near": "web"},
+				}, nil, nil)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("Returns an error for non boolean IS NULL values", func() {
+				_, _, err := tx.List(testSchema, transaction.Filter{
+					"test_string": transaction.Condition{Operator: transaction.IsNull, Value: "yes"},
+				}, nil, nil)
+				Expect(err).To(HaveOccurred())
+			})
+		}
+
+		itDeletesResources := func() {
+			It("Deletes resources in batch", func() {
+				Expect(tx.BatchDelete(testSchema, []interface{}{"test1", "test3", "unknown"})).To(Succeed())
+				Expect(listIDs(nil)).To(ConsistOf("test2"))
+			})
+		}
+
+		listPages := func(sort string, limit uint64) [][]string {
+			pages := [][]string{}
+			var cursor *pagination.Cursor
+			for {
+				keys, err := pagination.ParseSortKeys(sort)
+				Expect(err).ToNot(HaveOccurred())
+				pg, err := pagination.NewPaginatorWithKeys(testSchema, keys, limit, 0)
+				Expect(err).ToNot(HaveOccurred())
+				if cursor != nil {
+					// cursor goes through the client, so use decoded one
+					decoded, err := pagination.DecodeCursor(cursor.Encode())
+					Expect(err).ToNot(HaveOccurred())
+					Expect(pg.SetCursor(decoded)).To(Succeed())
+				}
+				list, _, err := tx.List(testSchema, nil, nil, pg)
+				Expect(err).ToNot(HaveOccurred())
+				page := []string{}
+				data := []map[string]interface{}{}
+				for _, resource := range list {
+					page = append(page, resource.ID())
+					data = append(data, resource.Data())
+				}
+				pages = append(pages, page)
+				cursor = pg.NextCursor(data)
+				if cursor == nil || len(pages) > 3 {
+					return pages
+				}
+			}
+		}
+
+		itPaginatesResources := func() {
+			It("Lists pages using cursor", func() {
+				Expect(listPages("test_integer", 2)).To(Equal([][]string{
+					{"test1", "test3"}, {"test2"},
+				}))
+				Expect(listPages("-test_integer", 1)).To(Equal([][]string{
+					{"test2"}, {"test3"}, {"test1"}, {},
+				}))
+				Expect(listPages("-id", 3)).To(Equal([][]string{
+					{"test3", "test2", "test1"}, {},
+				}))
+			})
+
+			It("Lists pages using cursor with null and duplicate values", func() {
+				Expect(listPages("test_string", 1)).To(Equal([][]string{
+					{"test3"}, {"test1"}, {"test2"}, {},
+				}))
+				Expect(listPages("-test_string", 2)).To(Equal([][]string{
+					{"test2", "test1"}, {"test3"},
+				}))
+				Expect(listPages("test_bool", 1)).To(Equal([][]string{
+					{"test2"}, {"test3"}, {"test1"}, {},
+				}))
+			})
+
+			It("Lists pages sorted by multiple keys", func() {
+				Expect(listPages("test_bool,-test_integer", 0)).To(Equal([][]string{
+					{"test2", "test3", "test1"},
+				}))
+				Expect(listPages("test_bool,-test_integer", 1)).To(Equal([][]string{
+					{"test2"}, {"test3"}, {"test1"}, {},
+				}))
+				Expect(listPages("-test_bool,test_string", 2)).To(Equal([][]string{
+					{"test1", "test3"}, {"test2"},
+				}))
+			})
+
+			It("Skips counting resources", func() {
+				list, total, err := tx.List(testSchema, nil, &transaction.ListOptions{Details: true, SkipCount: true}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(list).To(HaveLen(3))
+				if dbType != "yaml" {
+					Expect(total).To(Equal(uint64(0)))
+				}
+			})
+		}
+
+		Describe("Using sql", func() {
+			BeforeEach(func() {
+				if os.Getenv("MYSQL_TEST") == "true" {
+					conn = "root@/gohan_test"
+					dbType = "mysql"
+				} else if os.Getenv("POSTGRES_TEST") == "true" {
+					conn = "postgres://gohan@localhost/gohan_test?sslmode=disable"
+					dbType = "postgres"
+				} else {
+					conn = "./test.db"
+					dbType = "sqlite3"
+				}
+			})
+
+			itFiltersResources()
+			itPaginatesResources()
+			itDeletesResources()
+		})
+
+		Describe("Using file", func() {
+			BeforeEach(func() {
+				conn = "./test.yaml"
+				dbType = "yaml"
+			})
+
+			itFiltersResources()
+			itPaginatesResources()
+			itDeletesResources()
+		})
+	})
+
+	Describe("Soft delete", func() {
+		var (
+			tx             transaction.Transaction
+			folderSchema   *schema.Schema
+			documentSchema *schema.Schema
+		)
+
+		BeforeEach(func() {
+			Expect(manager.LoadSchemaFromFile("../tests/test_soft_delete_schema.yaml")).To(Succeed())
+			folderSchema, ok = manager.Schema("folder")
+			Expect(ok).To(BeTrue())
+			documentSchema, ok = manager.Schema("document")
+			Expect(ok).To(BeTrue())
+		})
+
+		JustBeforeEach(func() {
+			os.Remove(conn)
+			if dbType == "postgres" {
+				Expect(db.InitDBWithSchemas(dbType, conn, true, false, true)).To(Succeed())
+			}
+			dataStore, err = db.ConnectDB(dbType, conn, db.DefaultMaxOpenConn)
+			Expect(err).ToNot(HaveOccurred())
+			for _, s := range manager.Schemas() {
+				Expect(dataStore.RegisterTable(s, false, true)).To(Succeed())
+			}
+
+			tx, err = dataStore.Begin()
+			Expect(err).ToNot(HaveOccurred())
+			for _, data := range []map[string]interface{}{
+				{"id": "folder1", "name": "Folder 1", "tenant_id": "red"},
+				{"id": "folder2", "name": "Folder 2", "tenant_id": "red"},
+			} {
+				resource, err := manager.LoadResource("folder", data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tx.Create(resource)).To(Succeed())
+			}
+			for _, data := range []map[string]interface{}{
+				{"id": "document1", "name": "Document 1", "tenant_id": "red", "folder_id": "folder1"},
+				{"id": "document2", "name": "Document 2", "tenant_id": "red", "folder_id": "folder1"},
+				{"id": "document3", "name": "Document 3", "tenant_id": "red", "folder_id": "folder2"},
+			} {
+				resource, err := manager.LoadResource("document", data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tx.Create(resource)).To(Succeed())
+			}
+			Expect(tx.Commit()).To(Succeed())
+			tx.Close()
+			tx, err = dataStore.Begin()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			tx.Close()
+		})
+
+		listIDs := func(s *schema.Schema, options *transaction.ListOptions) []string {
+			list, num, err := tx.List(s, nil, options, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(num).To(Equal(uint64(len(list))))
+			ids := []string{}
+			for _, resource := range list {
+				ids = append(ids, resource.ID())
+			}
+			return ids
+		}
+
+		itSoftDeletesResources := func() {
+			It("Adds deleted_at property", func() {
+				_, err := folderSchema.GetPropertyByID(schema.DeletedAtPropertyID)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("Hides deleted resources and their children", func() {
+				Expect(tx.Delete(folderSchema, "folder1")).To(Succeed())
+
+				Expect(listIDs(folderSchema, nil)).To(ConsistOf("folder2"))
+				Expect(listIDs(documentSchema, nil)).To(ConsistOf("document3"))
+				_, err := tx.Fetch(folderSchema, transaction.IDFilter("folder1"))
+				Expect(err).To(Equal(transaction.ErrResourceNotFound))
+
+				Expect(listIDs(folderSchema, &transaction.ListOptions{Deleted: true})).To(ConsistOf("folder1", "folder2"))
+				list, _, err := tx.List(documentSchema, transaction.IDFilter("document1"), &transaction.ListOptions{Deleted: true}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(list).To(HaveLen(1))
+				Expect(list[0].Get(schema.DeletedAtPropertyID)).ToNot(BeNil())
+				Expect(tx.Commit()).To(Succeed())
+			})
+
+			It("Deletes resources in batch", func() {
+				Expect(tx.BatchDelete(folderSchema, []interface{}{"folder1", "folder2", "unknown"})).To(Succeed())
+				Expect(tx.BatchDelete(folderSchema, []interface{}{})).To(Succeed())
+
+				Expect(listIDs(folderSchema, nil)).To(BeEmpty())
+				Expect(listIDs(documentSchema, nil)).To(BeEmpty())
+				Expect(listIDs(folderSchema, &transaction.ListOptions{Deleted: true})).To(ConsistOf("folder1", "folder2"))
+				Expect(tx.Restore(folderSchema, "folder2")).To(Succeed())
+				Expect(listIDs(documentSchema, nil)).To(ConsistOf("document3"))
+				Expect(tx.Commit()).To(Succeed())
+			})
+
+			It("Restores resources deleted together", func() {
+				Expect(tx.Delete(documentSchema, "document2")).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+				tx.Close()
+
+				tx, err = dataStore.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tx.Delete(folderSchema, "folder1")).To(Succeed())
+				Expect(tx.Restore(folderSchema, "folder1")).To(Succeed())
+
+				Expect(listIDs(folderSchema, nil)).To(ConsistOf("folder1", "folder2"))
+				Expect(listIDs(documentSchema, nil)).To(ConsistOf("document1", "document3"))
+				Expect(tx.Restore(folderSchema, "folder1")).To(Equal(transaction.ErrResourceNotFound))
+				Expect(tx.Commit()).To(Succeed())
+			})
+
+			It("Purges resources deleted before given time", func() {
+				Expect(tx.Delete(folderSchema, "folder1")).To(Succeed())
+				Expect(tx.Purge(documentSchema, time.Now().Add(-time.Hour))).To(Succeed())
+				Expect(tx.Purge(folderSchema, time.Now().Add(-time.Hour))).To(Succeed())
+				Expect(listIDs(folderSchema, &transaction.ListOptions{Deleted: true})).To(ConsistOf("folder1", "folder2"))
+
+				Expect(tx.Purge(documentSchema, time.Now().Add(time.Hour))).To(Succeed())
+				Expect(tx.Purge(folderSchema, time.Now().Add(time.Hour))).To(Succeed())
+				Expect(listIDs(folderSchema, &transaction.ListOptions{Deleted: true})).To(ConsistOf("folder2"))
+				Expect(listIDs(documentSchema, &transaction.ListOptions{Deleted: true})).To(ConsistOf("document3"))
+				Expect(tx.Commit()).To(Succeed())
+			})
+		}
+
+		Describe("Using sql", func() {
+			BeforeEach(func() {
+				if os.Getenv("MYSQL_TEST") == "true" {
+					conn = "root@/gohan_test"
+					dbType = "mysql"
+				} else if os.Getenv("POSTGRES_TEST") == "true" {
+					conn = "postgres://gohan@localhost/gohan_test?sslmode=disable"
+					dbType = "postgres"
+				} else {
+					conn = "./test.db"
+					dbType = "sqlite3"
+				}
+			})
+
+			itSoftDeletesResources()
+		})
+
+		Describe("Using file", func() {
+			BeforeEach(func() {
+				conn = "./test.yaml"
+				dbType = "yaml"
+			})
+
+			itSoftDeletesResources()
+		})
+	})
+
 	Context("Initialization", func() {
 		BeforeEach(func() {
 			conn = "test.db"
@@ -17,8 +17,11 @@ package file
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 
@@ -166,13 +169,26 @@ func (tx *Transaction) StateUpdate(resource *schema.Resource, _ *transaction.Res
 
 //Delete delete resource from db
 func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
+	return tx.BatchDelete(s, []interface{}{resourceID})
+}
+
+//BatchDelete deletes resources with any of the IDs
+func (tx *Transaction) BatchDelete(s *schema.Schema, resourceIDs []interface{}) error {
 	db := tx.db
 	db.load()
+	if s.SoftDelete {
+		deletedAt := time.Now().UTC().Format(deletedAtFormat)
+		db.setDeletedAt(s, func(data map[string]interface{}) bool {
+			return interfaceInSlice(data["id"], resourceIDs)
+		}, nil, deletedAt)
+		db.write()
+		return nil
+	}
 	table := db.getTable(s)
 	newTable := []interface{}{}
 	for _, rawDataInDB := range table {
 		dataInDB := rawDataInDB.(map[string]interface{})
-		if dataInDB["id"] != resourceID {
+		if !interfaceInSlice(dataInDB["id"], resourceIDs) {
 			newTable = append(newTable, dataInDB)
 		}
 	}
@@ -181,6 +197,91 @@ func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
 	return nil
 }
 
+//deletedAtFormat is fixed width, so deletion times are ordered as strings
+const deletedAtFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+//setDeletedAt changes deletion time of matching resources from one value to other,
+//and does the same for resources of soft deleted schemas cascading deletion from them
+func (db *DB) setDeletedAt(s *schema.Schema, match func(data map[string]interface{}) bool, from, to interface{}) {
+	changed := []map[string]interface{}{}
+	for _, rawDataInDB := range db.getTable(s) {
+		dataInDB := rawDataInDB.(map[string]interface{})
+		if match(dataInDB) && dataInDB[schema.DeletedAtPropertyID] == from {
+			dataInDB[schema.DeletedAtPropertyID] = to
+			changed = append(changed, dataInDB)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	for _, child := range schema.GetManager().OrderedSchemas() {
+		if !child.SoftDelete || child.IsAbstract() {
+			continue
+		}
+		for _, property := range child.Properties {
+			if property.Relation != s.ID {
+				continue
+			}
+			if !property.OnDeleteCascade && !(property.Relation == child.Parent && child.OnParentDeleteCascade) {
+				continue
+			}
+			column := "id"
+			if property.RelationColumn != "" {
+				column = property.RelationColumn
+			}
+			values := []interface{}{}
+			for _, data := range changed {
+				values = append(values, data[column])
+			}
+			propertyID := property.ID
+			db.setDeletedAt(child, func(data map[string]interface{}) bool {
+				return interfaceInSlice(data[propertyID], values)
+			}, from, to)
+		}
+	}
+}
+
+//Restore restores soft deleted resource together with resources deleted by cascade with it
+func (tx *Transaction) Restore(s *schema.Schema, resourceID interface{}) error {
+	if !s.SoftDelete {
+		return fmt.Errorf("Schema %s does not support soft delete", s.ID)
+	}
+	db := tx.db
+	db.load()
+	isResource := func(data map[string]interface{}) bool {
+		return data["id"] == resourceID
+	}
+	for _, rawDataInDB := range db.getTable(s) {
+		dataInDB := rawDataInDB.(map[string]interface{})
+		deletedAt := dataInDB[schema.DeletedAtPropertyID]
+		if isResource(dataInDB) && deletedAt != nil {
+			db.setDeletedAt(s, isResource, deletedAt, nil)
+			return db.write()
+		}
+	}
+	return transaction.ErrResourceNotFound
+}
+
+//Purge removes resources soft deleted before given time
+func (tx *Transaction) Purge(s *schema.Schema, before time.Time) error {
+	if !s.SoftDelete {
+		return fmt.Errorf("Schema %s does not support soft delete", s.ID)
+	}
+	db := tx.db
+	db.load()
+	purgedBefore := before.UTC().Format(deletedAtFormat)
+	newTable := []interface{}{}
+	for _, rawDataInDB := range db.getTable(s) {
+		dataInDB := rawDataInDB.(map[string]interface{})
+		deletedAt, ok := dataInDB[schema.DeletedAtPropertyID].(string)
+		if !ok || deletedAt >= purgedBefore {
+			newTable = append(newTable, dataInDB)
+		}
+	}
+	db.data[s.GetDbTableName()] = newTable
+	return db.write()
+}
+
 type byPaginator struct {
 	data []*schema.Resource
 	pg   *pagination.Paginator
@@ -193,26 +294,85 @@ func (s byPaginator) Swap(i, j int) {
 	s.data[i], s.data[j] = s.data[j], s.data[i]
 }
 func (s byPaginator) Less(i, j int) bool {
-	key := s.pg.Key
-	vi := s.data[i].Get(key)
-	vj := s.data[j].Get(key)
-	var less bool
+	return comparePosition(s.pg, resourceSortValues(s.pg, s.data[i]), s.data[i].ID(), resourceSortValues(s.pg, s.data[j]), s.data[j].ID()) < 0
+}
 
-	switch vi.(type) {
-	case int:
-		less = vi.(int) < vj.(int)
-	case float64:
-		less = vi.(float64) < vj.(float64)
-	case string:
-		less = vi.(string) < vj.(string)
-	default:
-		panic(fmt.Sprintf("uncomparable type %T", vi))
+func resourceSortValues(pg *pagination.Paginator, resource *schema.Resource) []interface{} {
+	values := make([]interface{}, len(pg.Keys))
+	for i, key := range pg.Keys {
+		values[i] = resource.Get(key.Key)
+	}
+	return values
+}
+
+//comparePosition compares sort key values of two resources in the paginator order,
+//using id as a tie breaker. Null values are sorted first in ascending order.
+func comparePosition(pg *pagination.Paginator, values []interface{}, id string, otherValues []interface{}, otherID string) int {
+	order := pagination.ASC
+	for i, key := range pg.Keys {
+		order = key.Order
+		c := compareSortValues(values[i], otherValues[i])
+		if order == pagination.DESC {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	c := strings.Compare(id, otherID)
+	if order == pagination.DESC {
+		return -c
 	}
+	return c
+}
 
-	if s.pg.Order == pagination.DESC {
-		return !less
+func compareSortValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if _, isString := a.(string); !isString {
+		fa, okA := toFloat(a)
+		fb, okB := toFloat(b)
+		if okA && okB {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
 	}
-	return less
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func paginate(list []*schema.Resource, pg *pagination.Paginator) []*schema.Resource {
+	sort.Sort(byPaginator{list, pg})
+	if pg.Cursor != nil {
+		start := len(list)
+		for i, resource := range list {
+			if comparePosition(pg, resourceSortValues(pg, resource), resource.ID(), pg.Cursor.Values, pg.Cursor.ID) > 0 {
+				start = i
+				break
+			}
+		}
+		list = list[start:]
+	}
+	if pg.Offset > 0 {
+		if pg.Offset >= uint64(len(list)) {
+			return nil
+		}
+		list = list[pg.Offset:]
+	}
+	if pg.Limit > 0 && pg.Limit < uint64(len(list)) {
+		list = list[:pg.Limit]
+	}
+	return list
 }
 
 //List resources in the db
@@ -220,8 +380,12 @@ func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options
 	db := tx.db
 	db.load()
 	table := db.getTable(s)
+	listDeleted := options != nil && options.Deleted
 	for _, rawData := range table {
 		data := rawData.(map[string]interface{})
+		if s.SoftDelete && !listDeleted && data[schema.DeletedAtPropertyID] != nil {
+			continue
+		}
 		var resource *schema.Resource
 		resource, err = schema.NewResource(s, data)
 		if err != nil {
@@ -231,13 +395,24 @@ func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options
 		valid := true
 		if filter != nil {
 			for key, value := range filter {
-				if data[key] == nil {
-					continue
-				}
 				property, err := s.GetPropertyByID(key)
 				if err != nil {
 					continue
 				}
+				if transaction.HasConditions(value) {
+					var matched bool
+					matched, err = matchConditions(property, data[key], value)
+					if err != nil {
+						return nil, 0, err
+					}
+					if !matched {
+						valid = false
+					}
+					continue
+				}
+				if data[key] == nil {
+					continue
+				}
 				switch value.(type) {
 				case string:
 					if property.Type == "boolean" {
@@ -269,15 +444,11 @@ func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options
 		if valid {
 			list = append(list, resource)
 		}
-
-		if pg != nil {
-			sort.Sort(byPaginator{list, pg})
-			if pg.Limit > 0 {
-				list = list[:pg.Limit]
-			}
-		}
 	}
 	total = uint64(len(list))
+	if pg != nil {
+		list = paginate(list, pg)
+	}
 	return
 }
 
@@ -338,6 +509,15 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
+func interfaceInSlice(a interface{}, list []interface{}) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
 func boolInSlice(a bool, list []string) bool {
 	for _, b := range list {
 		v, _ := strconv.ParseBool(b)
@@ -347,3 +527,132 @@ func boolInSlice(a bool, list []string) bool {
 	}
 	return false
 }
+
+func matchConditions(property *schema.Property, data, value interface{}) (bool, error) {
+	conditions, err := transaction.Conditions(value)
+	if err != nil {
+		return false, err
+	}
+	for _, condition := range conditions {
+		matched, err := matchCondition(property, data, condition)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchCondition(property *schema.Property, data interface{}, condition transaction.Condition) (bool, error) {
+	switch condition.Operator {
+	case transaction.IsNull:
+		isNull, ok := condition.Value.(bool)
+		if !ok {
+			return false, fmt.Errorf("Filter operator %s expects boolean value, got %v", condition.Operator, condition.Value)
+		}
+		return (data == nil) == isNull, nil
+	case transaction.Equal, transaction.In:
+		return data != nil && valueInSlice(property, data, condition.Values()), nil
+	case transaction.NotEqual:
+		return data != nil && !valueInSlice(property, data, condition.Values()), nil
+	}
+	if data == nil {
+		return false, nil
+	}
+	single, err := condition.Single()
+	if err != nil {
+		return false, err
+	}
+	if condition.Operator == transaction.Like {
+		return likeToRegexp(fmt.Sprint(single)).MatchString(fmt.Sprint(data)), nil
+	}
+	cmp, ok := compareValues(property, data, single)
+	if !ok {
+		return false, nil
+	}
+	switch condition.Operator {
+	case transaction.GreaterThan:
+		return cmp > 0, nil
+	case transaction.GreaterOrEqual:
+		return cmp >= 0, nil
+	case transaction.LessThan:
+		return cmp < 0, nil
+	case transaction.LessOrEqual:
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("Unknown filter operator %s", condition.Operator)
+}
+
+func valueInSlice(property *schema.Property, data interface{}, values []interface{}) bool {
+	for _, value := range values {
+		if property.Type == "boolean" {
+			dataBool, err1 := strconv.ParseBool(fmt.Sprint(data))
+			valueBool, err2 := strconv.ParseBool(fmt.Sprint(value))
+			if err1 == nil && err2 == nil && dataBool == valueBool {
+				return true
+			}
+			continue
+		}
+		if cmp, ok := compareValues(property, data, value); ok && cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//compareValues compares values of numeric properties numerically and other values as strings
+func compareValues(property *schema.Property, a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if property.Type != "number" && property.Type != "integer" {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+	}
+	fa, ok := toFloat(a)
+	if !ok {
+		return 0, false
+	}
+	fb, ok := toFloat(b)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case fa < fb:
+		return -1, true
+	case fa > fb:
+		return 1, true
+	}
+	return 0, true
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//likeToRegexp converts SQL LIKE pattern to regular expression
+func likeToRegexp(pattern string) *regexp.Regexp {
+	var expr []string
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr = append(expr, ".*")
+		case '_':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.MustCompile("(?s)^" + strings.Join(expr, "") + "$")
+}
@@ -16,9 +16,12 @@
 package pagination
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/cloudwan/gohan/schema"
 )
@@ -33,12 +36,118 @@ const (
 	defaultSortOrder = ASC
 )
 
+//SortKey is a single sorting key with its order
+type SortKey struct {
+	Key   string
+	Order string
+}
+
+//String returns the sort key in sort query parameter format, e.g. -name for descending order
+func (k SortKey) String() string {
+	if k.Order == DESC {
+		return "-" + k.Key
+	}
+	return k.Key
+}
+
+//ParseSortKeys parses comma separated list of keys, e.g. tenant_id,-created_at,name.
+//Keys prefixed with - are sorted in descending order, the others in ascending order.
+func ParseSortKeys(sort string) ([]SortKey, error) {
+	keys := []SortKey{}
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		order := ASC
+		if strings.HasPrefix(key, "-") {
+			order = DESC
+			key = key[1:]
+		} else {
+			key = strings.TrimPrefix(key, "+")
+		}
+		if key == "" {
+			return nil, fmt.Errorf("Empty sort key in %s", sort)
+		}
+		keys = append(keys, SortKey{Key: key, Order: order})
+	}
+	return keys, nil
+}
+
 //Paginator stores pagination data
 type Paginator struct {
-	Key    string
-	Order  string
+	Keys   []SortKey
 	Limit  uint64
 	Offset uint64
+	Cursor *Cursor
+}
+
+//Cursor points at the last resource of previously listed page.
+//Next page starts right after the resource in the paginator order,
+//so rows don't shift between pages while resources are modified.
+type Cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     string        `json:"id"`
+}
+
+//NewCursor creates cursor pointing at given resource data
+func NewCursor(pg *Paginator, data map[string]interface{}) *Cursor {
+	values := make([]interface{}, len(pg.Keys))
+	for i, key := range pg.Keys {
+		values[i] = data[key.Key]
+	}
+	return &Cursor{
+		Sort:   pg.Sort(),
+		Values: values,
+		ID:     fmt.Sprint(data["id"]),
+	}
+}
+
+//Encode returns opaque cursor token
+func (c *Cursor) Encode() string {
+	bytes, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+//DecodeCursor decodes opaque cursor token
+func DecodeCursor(token string) (*Cursor, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor %s", token)
+	}
+	cursor := &Cursor{}
+	if err := json.Unmarshal(bytes, cursor); err != nil || cursor.Sort == "" {
+		return nil, fmt.Errorf("Invalid cursor %s", token)
+	}
+	return cursor, nil
+}
+
+//Sort returns sort keys in sort query parameter format
+func (pg *Paginator) Sort() string {
+	keys := make([]string, len(pg.Keys))
+	for i, key := range pg.Keys {
+		keys[i] = key.String()
+	}
+	return strings.Join(keys, ",")
+}
+
+//SetCursor sets cursor to continue listing from, replacing offset
+func (pg *Paginator) SetCursor(cursor *Cursor) error {
+	if cursor.Sort != pg.Sort() || len(cursor.Values) != len(pg.Keys) {
+		return fmt.Errorf("Cursor was created for sort %s, not %s", cursor.Sort, pg.Sort())
+	}
+	if pg.Offset > 0 {
+		return fmt.Errorf("Cursor can't be used together with offset")
+	}
+	pg.Cursor = cursor
+	return nil
+}
+
+//NextCursor returns cursor pointing after the last listed resource
+//or nil if the list is the last page
+func (pg *Paginator) NextCursor(list []map[string]interface{}) *Cursor {
+	if pg.Limit == 0 || uint64(len(list)) < pg.Limit {
+		return nil
+	}
+	return NewCursor(pg, list[len(list)-1])
 }
 
 //NewPaginator create Paginator
@@ -49,34 +158,43 @@ func NewPaginator(s *schema.Schema, key, order string, limit, offset uint64) (*P
 	if order == "" {
 		order = defaultSortOrder
 	}
-	if order != ASC && order != DESC {
-		return nil, fmt.Errorf("Unknown sort order %s", order)
+	return NewPaginatorWithKeys(s, []SortKey{{Key: key, Order: order}}, limit, offset)
+}
+
+//NewPaginatorWithKeys create Paginator sorting by multiple keys.
+//Resources are sorted by the first key, then by the next keys if the values are equal.
+func NewPaginatorWithKeys(s *schema.Schema, keys []SortKey, limit, offset uint64) (*Paginator, error) {
+	if len(keys) == 0 {
+		keys = []SortKey{{Key: defaultSortKey, Order: defaultSortOrder}}
 	}
-	if s != nil {
+	for _, key := range keys {
+		if key.Order != ASC && key.Order != DESC {
+			return nil, fmt.Errorf("Unknown sort order %s", key.Order)
+		}
+		if s == nil {
+			continue
+		}
 		found := false
 		for _, p := range s.Properties {
-			if p.ID == key {
+			if p.ID == key.Key {
 				found = true
 				break
 			}
 		}
 		if !found {
-			return nil, fmt.Errorf("Schema %s has no property %s which can used as sorting key", s.ID, key)
+			return nil, fmt.Errorf("Schema %s has no property %s which can used as sorting key", s.ID, key.Key)
 		}
 	}
 	return &Paginator{
-		Key:    key,
-		Order:  order,
+		Keys:   keys,
 		Limit:  limit,
 		Offset: offset,
 	}, nil
 }
 
-//FromURLQuery create Paginator from Query params
+//FromURLQuery create Paginator from Query params.
+//Sorting is specified either by sort or by sort_key and sort_order.
 func FromURLQuery(s *schema.Schema, values url.Values) (pg *Paginator, err error) {
-	sortKey := values.Get("sort_key")
-	sortOrder := values.Get("sort_order")
-
 	var limit uint64
 	var offset uint64
 
@@ -94,5 +212,32 @@ func FromURLQuery(s *schema.Schema, values url.Values) (pg *Paginator, err error
 		}
 	}
 
-	return NewPaginator(s, sortKey, sortOrder, limit, offset)
+	if sort := values.Get("sort"); sort != "" {
+		if values.Get("sort_key") != "" || values.Get("sort_order") != "" {
+			return nil, fmt.Errorf("sort can't be used together with sort_key or sort_order")
+		}
+		var keys []SortKey
+		keys, err = ParseSortKeys(sort)
+		if err != nil {
+			return nil, err
+		}
+		pg, err = NewPaginatorWithKeys(s, keys, limit, offset)
+	} else {
+		pg, err = NewPaginator(s, values.Get("sort_key"), values.Get("sort_order"), limit, offset)
+	}
+	if err != nil {
+		return
+	}
+
+	if c := values.Get("cursor"); c != "" {
+		var cursor *Cursor
+		cursor, err = DecodeCursor(c)
+		if err != nil {
+			return nil, err
+		}
+		if err = pg.SetCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+	return
 }
@@ -33,8 +33,7 @@ func TestNewPaginatorDefaults(t *testing.T) {
 	RegisterTestingT(t)
 	pg, err := NewPaginator(nil, "", "", 0, 0)
 	Expect(err).ToNot(HaveOccurred())
-	Expect(pg.Key).To(Equal(defaultSortKey))
-	Expect(pg.Order).To(Equal(ASC))
+	Expect(pg.Keys).To(Equal([]SortKey{{Key: defaultSortKey, Order: ASC}}))
 }
 
 func TestUnknownSortOrder(t *testing.T) {
@@ -55,8 +54,7 @@ func TestFromURLQuery(t *testing.T) {
 	pg, err := FromURLQuery(nil, values)
 	Expect(err).ToNot(HaveOccurred())
 	expected := &Paginator{
-		Key:    "asd",
-		Order:  "asc",
+		Keys:   []SortKey{{Key: "asd", Order: "asc"}},
 		Limit:  123,
 		Offset: 456,
 	}
@@ -87,3 +85,100 @@ func TestFromURLQueryErrors(t *testing.T) {
 	pg, err = FromURLQuery(s, values)
 	Expect(err).To(HaveOccurred(), "Got %v", pg)
 }
+
+func TestCursor(t *testing.T) {
+	RegisterTestingT(t)
+	pg, err := NewPaginator(nil, "name", "asc", 2, 0)
+	Expect(err).ToNot(HaveOccurred())
+
+	list := []map[string]interface{}{
+		{"id": "a", "name": "first"},
+		{"id": "b", "name": "second"},
+	}
+	cursor := pg.NextCursor(list)
+	Expect(cursor).To(Equal(&Cursor{Sort: "name", Values: []interface{}{"second"}, ID: "b"}))
+	Expect(pg.NextCursor(list[:1])).To(BeNil())
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(decoded).To(Equal(cursor))
+
+	_, err = DecodeCursor("bad")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestFromURLQueryCursor(t *testing.T) {
+	RegisterTestingT(t)
+	cursor := &Cursor{Sort: "asd", Values: []interface{}{"value"}, ID: "id"}
+	values := url.Values{
+		"limit":    []string{"10"},
+		"sort_key": []string{"asd"},
+		"cursor":   []string{cursor.Encode()},
+	}
+	pg, err := FromURLQuery(nil, values)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(pg.Cursor).To(Equal(cursor))
+
+	values.Set("offset", "10")
+	pg, err = FromURLQuery(nil, values)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+
+	values.Del("offset")
+	values.Set("sort_key", "other")
+	pg, err = FromURLQuery(nil, values)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+}
+
+func TestParseSortKeys(t *testing.T) {
+	RegisterTestingT(t)
+	keys, err := ParseSortKeys("tenant_id,-created_at,+name")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(keys).To(Equal([]SortKey{
+		{Key: "tenant_id", Order: ASC},
+		{Key: "created_at", Order: DESC},
+		{Key: "name", Order: ASC},
+	}))
+
+	_, err = ParseSortKeys("tenant_id,,name")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestFromURLQuerySort(t *testing.T) {
+	RegisterTestingT(t)
+	s := schema.NewSchema("foo", "foos", "Foo", "", "foo")
+	for _, id := range []string{"id", "name", "tenant_id"} {
+		s.Properties = append(s.Properties, schema.NewProperty(id, "", "", "string", "", "", "", "", "", false, true, false, map[string]interface{}{}, "", false))
+	}
+
+	values := url.Values{
+		"sort":  []string{"tenant_id,-name"},
+		"limit": []string{"10"},
+	}
+	pg, err := FromURLQuery(s, values)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(pg.Keys).To(Equal([]SortKey{
+		{Key: "tenant_id", Order: ASC},
+		{Key: "name", Order: DESC},
+	}))
+	Expect(pg.Sort()).To(Equal("tenant_id,-name"))
+
+	cursor := &Cursor{Sort: "tenant_id,-name", Values: []interface{}{"t", "n"}, ID: "id"}
+	values.Set("cursor", cursor.Encode())
+	pg, err = FromURLQuery(s, values)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(pg.Cursor).To(Equal(cursor))
+
+	values.Set("sort", "tenant_id,name")
+	pg, err = FromURLQuery(s, values)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+
+	values.Del("cursor")
+	values.Set("sort", "tenant_id,-bad_key")
+	pg, err = FromURLQuery(s, values)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+
+	values.Set("sort", "tenant_id")
+	values.Set("sort_key", "name")
+	pg, err = FromURLQuery(s, values)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+}
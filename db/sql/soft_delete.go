@@ -0,0 +1,193 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"fmt"
+	"time"
+
+	sq "github.com/lann/squirrel"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+)
+
+//deletedAtFormat is fixed width, so deletion times are ordered as strings
+const deletedAtFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+//softDeleteChild is a relation cascading soft deletion from referenced schema
+type softDeleteChild struct {
+	schema   *schema.Schema
+	property schema.Property
+	column   string
+}
+
+//softDeleteChildren returns relations of soft deleted schemas cascading deletion of s
+func softDeleteChildren(s *schema.Schema) []softDeleteChild {
+	children := []softDeleteChild{}
+	for _, child := range schema.GetManager().OrderedSchemas() {
+		if !child.SoftDelete || child.IsAbstract() {
+			continue
+		}
+		for _, property := range child.Properties {
+			if property.Relation != s.ID {
+				continue
+			}
+			if !property.OnDeleteCascade && !(property.Relation == child.Parent && child.OnParentDeleteCascade) {
+				continue
+			}
+			column := "id"
+			if property.RelationColumn != "" {
+				column = property.RelationColumn
+			}
+			children = append(children, softDeleteChild{child, property, column})
+		}
+	}
+	return children
+}
+
+//deletedCondition matches not deleted resources, or resources deleted at given time
+func deletedCondition(deletedAt interface{}) sq.Sqlizer {
+	return sq.Eq{quote(schema.DeletedAtPropertyID): deletedAt}
+}
+
+//addSoftDeleteToQuery hides soft deleted resources unless they are requested
+func addSoftDeleteToQuery(s *schema.Schema, q sq.SelectBuilder, join, deleted bool) sq.SelectBuilder {
+	if !s.SoftDelete || deleted {
+		return q
+	}
+	column := quote(schema.DeletedAtPropertyID)
+	if join {
+		column = quote(s.GetDbTableName()) + "." + column
+	}
+	return q.Where(sq.Eq{column: nil})
+}
+
+//setDeletedAt changes deletion time of resources matching where from one value to other,
+//and does the same for resources of soft deleted schemas cascading deletion from them
+func (tx *Transaction) setDeletedAt(s *schema.Schema, where sq.Sqlizer, from, to interface{}) error {
+	table := quote(s.GetDbTableName())
+	children := softDeleteChildren(s)
+	columns := []string{"id"}
+	for _, child := range children {
+		if !util.ContainsString(columns, child.column) {
+			columns = append(columns, child.column)
+		}
+	}
+	sql, args, err := sq.Select(quoteAll(columns)...).From(table).Where(where).Where(deletedCondition(from)).ToSql()
+	if err != nil {
+		return err
+	}
+	tx.logQuery(sql, args...)
+	rows, err := tx.transaction.Queryx(tx.db.rebind(sql), args...)
+	if err != nil {
+		return err
+	}
+	values := map[string][]interface{}{}
+	for rows.Next() {
+		data := map[string]interface{}{}
+		if err := rows.MapScan(data); err != nil {
+			rows.Close()
+			return err
+		}
+		for _, column := range columns {
+			value := data[column]
+			// bytes would be expanded to a list by squirrel
+			if text, ok := decodeText(value); ok {
+				value = text
+			}
+			values[column] = append(values[column], value)
+		}
+	}
+	rows.Close()
+	if len(values["id"]) == 0 {
+		return nil
+	}
+
+	sql, args, err = sq.Update(table).
+		Set(quote(schema.DeletedAtPropertyID), to).
+		Where(sq.Eq{"id": values["id"]}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if err := tx.Exec(sql, args...); err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		childWhere := sq.Eq{quote(child.property.ID): values[child.column]}
+		if err := tx.setDeletedAt(child.schema, childWhere, from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//softDelete marks resources matching where as deleted
+func (tx *Transaction) softDelete(s *schema.Schema, where sq.Sqlizer) error {
+	deletedAt := time.Now().UTC().Format(deletedAtFormat)
+	return tx.setDeletedAt(s, where, nil, deletedAt)
+}
+
+//Restore restores soft deleted resource together with resources deleted by cascade with it
+func (tx *Transaction) Restore(s *schema.Schema, resourceID interface{}) error {
+	if !s.SoftDelete {
+		return fmt.Errorf("Schema %s does not support soft delete", s.ID)
+	}
+	sql, args, err := sq.Select(quote(schema.DeletedAtPropertyID)).
+		From(quote(s.GetDbTableName())).
+		Where(sq.Eq{"id": resourceID}).
+		Where(sq.NotEq{quote(schema.DeletedAtPropertyID): nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	tx.logQuery(sql, args...)
+	data := map[string]interface{}{}
+	err = tx.transaction.QueryRowx(tx.db.rebind(sql), args...).MapScan(data)
+	if err != nil {
+		return transaction.ErrResourceNotFound
+	}
+	deletedAt, ok := decodeText(data[schema.DeletedAtPropertyID])
+	if !ok {
+		return transaction.ErrResourceNotFound
+	}
+	return tx.setDeletedAt(s, sq.Eq{"id": resourceID}, deletedAt, nil)
+}
+
+//Purge removes resources soft deleted before given time
+func (tx *Transaction) Purge(s *schema.Schema, before time.Time) error {
+	if !s.SoftDelete {
+		return fmt.Errorf("Schema %s does not support soft delete", s.ID)
+	}
+	sql, args, err := sq.Delete(quote(s.GetDbTableName())).
+		Where(quote(schema.DeletedAtPropertyID)+" < ?", before.UTC().Format(deletedAtFormat)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	return tx.Exec(sql, args...)
+}
+
+func quoteAll(columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quote(column)
+	}
+	return quoted
+}
@@ -16,6 +16,7 @@
 package sql
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -26,7 +27,8 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	sq "github.com/lann/squirrel"
-	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 	_ "github.com/nati/go-fakedb"
 
 	"context"
@@ -40,6 +42,18 @@ import (
 const retryDB = 50
 const retryDBWait = 10
 
+//sqliteDriver enables foreign keys on every connection, as the pragma applies only to the connection it is run on
+const sqliteDriver = "sqlite3_with_foreign_keys"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec("PRAGMA foreign_keys = ON;", nil)
+			return err
+		},
+	})
+}
+
 const (
 	configVersionColumnName   = "config_version"
 	stateVersionColumnName    = "state_version"
@@ -95,6 +109,102 @@ func NewDB() *DB {
 	return &DB{handlers: handlers}
 }
 
+//NewDBWithType creates DB generating sql for given database type, without connecting to it
+func NewDBWithType(sqlType string) *DB {
+	db := NewDB()
+	db.setType(sqlType)
+	return db
+}
+
+func (db *DB) setType(sqlType string) {
+	db.sqlType = sqlType
+	if sqlType == "postgres" {
+		db.handlers["object"] = &jsonbHandler{}
+		db.handlers["array"] = &jsonbHandler{}
+	}
+}
+
+//rebind converts sql generated with backtick quoting and ? placeholders to the database dialect.
+//On postgres ?? stands for a literal ?, such as the jsonb ? and ?| operators
+func (db *DB) rebind(sql string) string {
+	if db.sqlType != "postgres" {
+		return sql
+	}
+	var buf bytes.Buffer
+	placeholders := 0
+	inLiteral := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			inLiteral = !inLiteral
+			buf.WriteByte(c)
+		case inLiteral:
+			buf.WriteByte(c)
+		case c == '`':
+			buf.WriteByte('"')
+		case c == '?' && i+1 < len(sql) && sql[i+1] == '?':
+			buf.WriteByte('?')
+			i++
+		case c == '?':
+			placeholders++
+			buf.WriteString("$" + strconv.Itoa(placeholders))
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+//postgresSQLTypes maps mysql column types to postgres ones
+var postgresSQLTypes = map[string]string{
+	"tinytext":   "text",
+	"mediumtext": "text",
+	"longtext":   "text",
+	"tinyblob":   "bytea",
+	"blob":       "bytea",
+	"mediumblob": "bytea",
+	"longblob":   "bytea",
+	"datetime":   "timestamp",
+	"double":     "double precision",
+}
+
+//dialectSQLType converts a column definition given by the sql property of a schema,
+//written for mysql, to the database dialect
+func (db *DB) dialectSQLType(sqlType string) string {
+	switch db.sqlType {
+	case "sqlite3":
+		return strings.Replace(sqlType, "auto_increment", "autoincrement", 1)
+	case "postgres":
+		words := strings.Fields(sqlType)
+		if len(words) == 0 {
+			return sqlType
+		}
+		autoIncrement := false
+		converted := make([]string, 0, len(words))
+		for _, word := range words {
+			if strings.ToLower(word) == "auto_increment" {
+				autoIncrement = true
+				continue
+			}
+			converted = append(converted, word)
+		}
+		dataType := strings.ToLower(converted[0])
+		if postgresType, ok := postgresSQLTypes[dataType]; ok {
+			converted[0] = postgresType
+		}
+		if autoIncrement {
+			if dataType == "bigint" {
+				converted[0] = "bigserial"
+			} else {
+				converted[0] = "serial"
+			}
+		}
+		return strings.Join(converted, " ")
+	}
+	return sqlType
+}
+
 //propertyHandler for each propertys
 type propertyHandler interface {
 	encode(*schema.Property, interface{}) (interface{}, error)
@@ -251,6 +361,14 @@ func (handler *jsonHandler) dataType(property *schema.Property) string {
 	return "text"
 }
 
+type jsonbHandler struct {
+	jsonHandler
+}
+
+func (handler *jsonbHandler) dataType(property *schema.Property) string {
+	return "jsonb"
+}
+
 func quote(str string) string {
 	return fmt.Sprintf("`%s`", str)
 }
@@ -266,9 +384,13 @@ func foreignKeyName(fromTable, fromProperty, toTable, toProperty string) string
 
 //Connect connects to the db
 func (db *DB) Connect(sqlType, conn string, maxOpenConn int) (err error) {
-	db.sqlType = sqlType
+	db.setType(sqlType)
 	db.connectionString = conn
-	rawDB, err := sql.Open(db.sqlType, db.connectionString)
+	driverName := db.sqlType
+	if db.sqlType == "sqlite3" {
+		driverName = sqliteDriver
+	}
+	rawDB, err := sql.Open(driverName, db.connectionString)
 	if err != nil {
 		return err
 	}
@@ -276,10 +398,6 @@ func (db *DB) Connect(sqlType, conn string, maxOpenConn int) (err error) {
 	rawDB.SetMaxIdleConns(maxOpenConn)
 	db.DB = sqlx.NewDb(rawDB, db.sqlType)
 
-	if db.sqlType == "sqlite3" {
-		db.DB.Exec("PRAGMA foreign_keys = ON;")
-	}
-
 	for i := 0; i < retryDB; i++ {
 		err = db.DB.Ping()
 		if err == nil {
@@ -349,11 +467,8 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 			continue
 		}
 		handler := db.handlers[property.Type]
-		sqlDataType := property.SQLType
+		sqlDataType := db.dialectSQLType(property.SQLType)
 		sqlDataProperties := ""
-		if db.sqlType == "sqlite3" {
-			sqlDataType = strings.Replace(sqlDataType, "auto_increment", "autoincrement", 1)
-		}
 		if sqlDataType == "" {
 			sqlDataType = handler.dataType(&property)
 			if property.ID == "id" {
@@ -397,7 +512,7 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 
 		if property.Indexed {
 			prefix := ""
-			if sqlDataType == "text" {
+			if sqlDataType == "text" && db.sqlType != "postgres" {
 				prefix = "(255)"
 			}
 			indices = append(indices, fmt.Sprintf("CREATE INDEX %s_%s_idx ON `%s`(`%s`%s);", s.Plural, property.ID,
@@ -411,8 +526,8 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 			quotedColumns[i] = quote(column)
 		}
 
-		if db.sqlType == "sqlite3" && (index.Type == schema.Spatial || index.Type == schema.FullText) {
-			log.Error("index %s won't be created since sqlite doesn't support spatial and fulltext index types", index.Name)
+		if db.sqlType != "mysql" && (index.Type == schema.Spatial || index.Type == schema.FullText) {
+			log.Error("index %s won't be created since %s doesn't support spatial and fulltext index types", index.Name, db.sqlType)
 			continue
 		}
 
@@ -427,7 +542,7 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 //AlterTableDef generates alter table sql
 func (db *DB) AlterTableDef(s *schema.Schema, cascade bool) (string, []string, error) {
 	var existing []string
-	rows, err := db.DB.Query(fmt.Sprintf("select * from `%s` limit 1;", s.GetDbTableName()))
+	rows, err := db.DB.Query(db.rebind(fmt.Sprintf("select * from `%s` limit 1;", s.GetDbTableName())))
 	if err == nil {
 		defer rows.Close()
 		existing, err = rows.Columns()
@@ -444,6 +559,14 @@ func (db *DB) AlterTableDef(s *schema.Schema, cascade bool) (string, []string, e
 		return "", nil, nil
 	}
 	alterTable := fmt.Sprintf("alter table`%s` add (%s);\n", s.GetDbTableName(), strings.Join(cols, ","))
+	if db.sqlType == "postgres" {
+		// postgres requires separate add clause for each column and constraint
+		for i, col := range cols {
+			cols[i] = "add " + col
+		}
+		alterTable = fmt.Sprintf("alter table `%s` %s;\n", s.GetDbTableName(), strings.Join(cols, ","))
+	}
+	alterTable, indices = db.rebind(alterTable), db.rebindAll(indices)
 	log.Debug("Altering table: " + alterTable)
 	log.Debug("Altering indices: " + strings.Join(indices, ""))
 	return alterTable, indices, nil
@@ -462,12 +585,20 @@ func (db *DB) GenTableDef(s *schema.Schema, cascade bool) (string, []string) {
 	}
 
 	cols = append(cols, relations...)
-	tableSQL := fmt.Sprintf("create table `%s` (%s);\n", s.GetDbTableName(), strings.Join(cols, ","))
+	tableSQL := db.rebind(fmt.Sprintf("create table `%s` (%s);\n", s.GetDbTableName(), strings.Join(cols, ",")))
+	indices = db.rebindAll(indices)
 	log.Debug("Creating table: " + tableSQL)
 	log.Debug("Creating indices: " + strings.Join(indices, ""))
 	return tableSQL, indices
 }
 
+func (db *DB) rebindAll(sqls []string) []string {
+	for i, sql := range sqls {
+		sqls[i] = db.rebind(sql)
+	}
+	return sqls
+}
+
 //RegisterTable creates table in the db
 func (db *DB) RegisterTable(s *schema.Schema, cascade, migrate bool) error {
 	if s.IsAbstract() {
@@ -503,7 +634,7 @@ func (db *DB) DropTable(s *schema.Schema) error {
 		return nil
 	}
 	sql := fmt.Sprintf("drop table if exists %s\n", quote(s.GetDbTableName()))
-	_, err := db.DB.Exec(sql)
+	_, err := db.DB.Exec(db.rebind(sql))
 	return err
 }
 
@@ -520,7 +651,7 @@ func (tx *Transaction) logQuery(sql string, args ...interface{}) {
 // Exec executes sql in transaction
 func (tx *Transaction) Exec(sql string, args ...interface{}) error {
 	tx.logQuery(sql, args...)
-	_, err := tx.transaction.Exec(sql, args...)
+	_, err := tx.transaction.Exec(tx.db.rebind(sql), args...)
 	return err
 }
 
@@ -612,8 +743,11 @@ func (tx *Transaction) StateUpdate(resource *schema.Resource, state *transaction
 	return tx.Exec(sql, args...)
 }
 
-//Delete delete resource from db
+//Delete delete resource from db, resources of schemas with soft delete are marked as deleted
 func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
+	if s.SoftDelete {
+		return tx.softDelete(s, sq.Eq{"id": resourceID})
+	}
 	sql, args, err := sq.Delete(quote(s.GetDbTableName())).Where(sq.Eq{"id": resourceID}).ToSql()
 	if err != nil {
 		return err
@@ -621,6 +755,24 @@ func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
 	return tx.Exec(sql, args...)
 }
 
+//BatchDelete deletes resources with any of the IDs using one statement.
+//Resources of schemas with soft delete are marked as deleted at the same time
+func (tx *Transaction) BatchDelete(s *schema.Schema, resourceIDs []interface{}) error {
+	if len(resourceIDs) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(resourceIDs)), ",")
+	where := sq.Expr(quote("id")+" IN ("+placeholders+")", resourceIDs...)
+	if s.SoftDelete {
+		return tx.softDelete(s, where)
+	}
+	sql, args, err := sq.Delete(quote(s.GetDbTableName())).Where(where).ToSql()
+	if err != nil {
+		return err
+	}
+	return tx.Exec(sql, args...)
+}
+
 func (db *DB) handler(property *schema.Property) propertyHandler {
 	handler, ok := db.handlers[property.Type]
 	if ok {
@@ -706,24 +858,32 @@ func decodeState(data map[string]interface{}, state *transaction.ResourceState)
 	if !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateVersionColumnName)
 	}
-	stateError, ok := data[stateErrorColumnName].([]byte)
+	state.Error, ok = decodeText(data[stateErrorColumnName])
 	if !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateErrorColumnName)
 	}
-	state.Error = string(stateError)
-	stateState, ok := data[stateColumnName].([]byte)
+	state.State, ok = decodeText(data[stateColumnName])
 	if !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateColumnName)
 	}
-	state.State = string(stateState)
-	stateMonitoring, ok := data[stateMonitoringColumnName].([]byte)
+	state.Monitoring, ok = decodeText(data[stateMonitoringColumnName])
 	if !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateMonitoringColumnName)
 	}
-	state.Monitoring = string(stateMonitoring)
 	return nil
 }
 
+//decodeText decodes text column, which is returned as bytes by mysql and sqlite3 and as string by postgres
+func decodeText(data interface{}) (string, bool) {
+	switch t := data.(type) {
+	case []byte:
+		return string(t), true
+	case string:
+		return t, true
+	}
+	return "", false
+}
+
 //normFields runs normFields on all the fields.
 func normFields(fields []string, s *schema.Schema) []string {
 	if fields != nil {
@@ -748,6 +908,9 @@ type selectContext struct {
 	fields    []string
 	join      bool
 	paginator *pagination.Paginator
+	skipCount bool
+	deleted   bool
+	sqlType   string
 }
 
 func buildSelect(sc *selectContext) (string, []interface{}, error) {
@@ -759,17 +922,9 @@ func buildSelect(sc *selectContext) (string, []interface{}, error) {
 	if err != nil {
 		return "", nil, err
 	}
+	q = addSoftDeleteToQuery(sc.schema, q, sc.join, sc.deleted)
 	if sc.paginator != nil {
-		property, err := sc.schema.GetPropertyByID(sc.paginator.Key)
-		if err == nil {
-			q = q.OrderBy(makeColumn(t, *property) + " " + sc.paginator.Order)
-			if sc.paginator.Limit > 0 {
-				q = q.Limit(sc.paginator.Limit)
-			}
-			if sc.paginator.Offset > 0 {
-				q = q.Offset(sc.paginator.Offset)
-			}
-		}
+		q = addPaginationToQuery(sc.schema, q, t, sc.paginator, sc.sqlType)
 	}
 	if sc.join {
 		q = makeJoin(sc.schema, t, q)
@@ -777,9 +932,94 @@ func buildSelect(sc *selectContext) (string, []interface{}, error) {
 	return q.ToSql()
 }
 
+func addPaginationToQuery(s *schema.Schema, q sq.SelectBuilder, t string, pg *pagination.Paginator, sqlType string) sq.SelectBuilder {
+	columns := make([]string, len(pg.Keys))
+	sortedByID := false
+	for i, key := range pg.Keys {
+		property, err := s.GetPropertyByID(key.Key)
+		if err != nil {
+			return q
+		}
+		columns[i] = makeColumn(t, *property)
+		sortedByID = sortedByID || key.Key == "id"
+	}
+	for i, column := range columns {
+		q = q.OrderBy(orderBy(column, pg.Keys[i].Order, sqlType))
+	}
+	idColumn := ""
+	if idProperty, err := s.GetPropertyByID("id"); err == nil && !sortedByID {
+		// id is used as a tie breaker, so that the order is stable
+		// and cursor always points at a single row
+		idColumn = makeColumn(t, *idProperty)
+		q = q.OrderBy(orderBy(idColumn, pg.Keys[len(pg.Keys)-1].Order, sqlType))
+	}
+	if pg.Cursor != nil {
+		q = q.Where(cursorToSQL(columns, idColumn, pg))
+	}
+	if pg.Limit > 0 {
+		q = q.Limit(pg.Limit)
+	}
+	if pg.Offset > 0 {
+		q = q.Offset(pg.Offset)
+	}
+	return q
+}
+
+//orderBy returns order by clause for the column.
+//Null values are sorted first in ascending order, as in mysql and sqlite3.
+func orderBy(column, order, sqlType string) string {
+	if sqlType != "postgres" {
+		return column + " " + order
+	}
+	if order == pagination.DESC {
+		return column + " " + order + " NULLS LAST"
+	}
+	return column + " " + order + " NULLS FIRST"
+}
+
+//cursorToSQL returns condition selecting rows after the cursor,
+//i.e. rows with equal values of the first n keys and a value after the cursor for the next key.
+//Null values are sorted first in ascending order.
+func cursorToSQL(columns []string, idColumn string, pg *pagination.Paginator) sq.Sqlizer {
+	cursor := pg.Cursor
+	after := sq.Or{}
+	equal := sq.And{}
+	for i, column := range columns {
+		value := cursor.Values[i]
+		if condition := afterValueToSQL(column, pg.Keys[i].Order, value); condition != nil {
+			after = append(after, append(append(sq.And{}, equal...), condition))
+		}
+		equal = append(equal, sq.Eq{column: value})
+	}
+	if idColumn != "" {
+		op := ">"
+		if pg.Keys[len(pg.Keys)-1].Order == pagination.DESC {
+			op = "<"
+		}
+		after = append(after, append(append(sq.And{}, equal...), sq.Expr(idColumn+" "+op+" ?", cursor.ID)))
+	}
+	if len(after) == 0 {
+		return sq.Expr("1 = 0")
+	}
+	return after
+}
+
+func afterValueToSQL(column, order string, value interface{}) sq.Sqlizer {
+	if order == pagination.DESC {
+		if value == nil {
+			return nil
+		}
+		return sq.Or{sq.Expr(column+" < ?", value), sq.Eq{column: nil}}
+	}
+	if value == nil {
+		return sq.NotEq{column: nil}
+	}
+	return sq.Expr(column+" > ?", value)
+}
+
 func (tx *Transaction) executeSelect(sc *selectContext, sql string, args []interface{}) (list []*schema.Resource, total uint64, err error) {
 	tx.logQuery(sql, args...)
-	rows, err := tx.transaction.Queryx(sql, args...)
+	rows, err := tx.transaction.Queryx(tx.db.rebind(sql), args...)
 	if err != nil {
 		return
 	}
@@ -789,7 +1029,10 @@ func (tx *Transaction) executeSelect(sc *selectContext, sql string, args []inter
 	if err != nil {
 		return nil, 0, err
 	}
-	total, err = tx.count(sc.schema, sc.filter)
+	if sc.skipCount {
+		return
+	}
+	total, err = tx.count(sc.schema, sc.filter, sc.deleted)
 	return
 }
 
@@ -800,10 +1043,13 @@ func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options
 		filter:    filter,
 		join:      true,
 		paginator: pg,
+		sqlType:   tx.db.sqlType,
 	}
 	if options != nil {
 		sc.fields = normFields(options.Fields, s)
 		sc.join = options.Details
+		sc.skipCount = options.SkipCount
+		sc.deleted = options.Deleted
 	}
 
 	sql, args, err := buildSelect(sc)
@@ -835,10 +1081,13 @@ func (tx *Transaction) LockList(s *schema.Schema, filter transaction.Filter, opt
 		filter:    filter,
 		join:      policyJoin,
 		paginator: pg,
+		sqlType:   tx.db.sqlType,
 	}
 	if options != nil {
 		sc.fields = normFields(options.Fields, s)
 		sc.join = policyJoin && options.Details
+		sc.skipCount = options.SkipCount
+		sc.deleted = options.Deleted
 	}
 
 	sql, args, err := buildSelect(sc)
@@ -846,8 +1095,12 @@ func (tx *Transaction) LockList(s *schema.Schema, filter transaction.Filter, opt
 		return nil, 0, err
 	}
 
-	if tx.db.sqlType == "mysql" {
+	switch tx.db.sqlType {
+	case "mysql":
 		sql += " FOR UPDATE"
+	case "postgres":
+		// postgres can't lock rows of the nullable side of outer joins
+		sql += " FOR UPDATE OF " + quote(s.GetDbTableName())
 	}
 
 	// update join for recursive
@@ -863,7 +1116,7 @@ func (tx *Transaction) LockList(s *schema.Schema, filter transaction.Filter, opt
 // Query with raw sql string
 func (tx *Transaction) Query(s *schema.Schema, query string, arguments []interface{}) (list []*schema.Resource, err error) {
 	tx.logQuery(query, arguments...)
-	rows, err := tx.transaction.Queryx(query, arguments...)
+	rows, err := tx.transaction.Queryx(tx.db.rebind(query), arguments...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to run query: %s", query)
 	}
@@ -923,16 +1176,17 @@ func (tx *Transaction) decode(s *schema.Schema, tableName string, skipNil, recur
 }
 
 //count count all matching resources in the db
-func (tx *Transaction) count(s *schema.Schema, filter transaction.Filter) (res uint64, err error) {
+func (tx *Transaction) count(s *schema.Schema, filter transaction.Filter, deleted bool) (res uint64, err error) {
 	q := sq.Select("Count(id) as count").From(quote(s.GetDbTableName()))
 	//Filter get already tested
 	q, _ = addFilterToQuery(s, q, filter, false)
+	q = addSoftDeleteToQuery(s, q, false, deleted)
 	sql, args, err := q.ToSql()
 	if err != nil {
 		return
 	}
 	result := map[string]interface{}{}
-	err = tx.transaction.QueryRowx(sql, args...).MapScan(result)
+	err = tx.transaction.QueryRowx(tx.db.rebind(sql), args...).MapScan(result)
 	if err != nil {
 		return
 	}
@@ -980,12 +1234,13 @@ func (tx *Transaction) StateFetch(s *schema.Schema, filter transaction.Filter) (
 	cols := makeStateColumns(s)
 	q := sq.Select(cols...).From(quote(s.GetDbTableName()))
 	q, _ = addFilterToQuery(s, q, filter, true)
+	q = addSoftDeleteToQuery(s, q, true, false)
 	sql, args, err := q.ToSql()
 	if err != nil {
 		return
 	}
 	tx.logQuery(sql, args...)
-	rows, err := tx.transaction.Queryx(sql, args...)
+	rows, err := tx.transaction.Queryx(tx.db.rebind(sql), args...)
 	if err != nil {
 		return
 	}
@@ -1062,20 +1317,86 @@ func addFilterToQuery(s *schema.Schema, q sq.SelectBuilder, filter map[string]in
 			column = quote(key)
 		}
 
-		queryValues, ok := value.([]string)
-		if ok && property.Type == "boolean" {
-			v := make([]bool, len(queryValues))
-			for i, j := range queryValues {
-				v[i], _ = strconv.ParseBool(j)
+		conditions, err := transaction.Conditions(value)
+		if err != nil {
+			return q, err
+		}
+		for _, condition := range conditions {
+			where, err := conditionToSQL(property, column, condition)
+			if err != nil {
+				return q, err
 			}
-			q = q.Where(sq.Eq{column: v})
-		} else {
-			q = q.Where(sq.Eq{column: value})
+			q = q.Where(where)
 		}
 	}
 	return q, nil
 }
 
+func conditionToSQL(property *schema.Property, column string, condition transaction.Condition) (sq.Sqlizer, error) {
+	value := filterValue(property, condition.Value)
+	switch condition.Operator {
+	case transaction.Equal:
+		return sq.Eq{column: value}, nil
+	case transaction.NotEqual:
+		return sq.NotEq{column: value}, nil
+	case transaction.In:
+		return sq.Eq{column: filterValues(property, condition.Values())}, nil
+	case transaction.IsNull:
+		isNull, ok := condition.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("Filter operator %s expects boolean value, got %v", condition.Operator, condition.Value)
+		}
+		if isNull {
+			return sq.Eq{column: nil}, nil
+		}
+		return sq.NotEq{column: nil}, nil
+	}
+	single, err := condition.Single()
+	if err != nil {
+		return nil, err
+	}
+	single = filterValue(property, single)
+	switch condition.Operator {
+	case transaction.GreaterThan:
+		return sq.Expr(column+" > ?", single), nil
+	case transaction.GreaterOrEqual:
+		return sq.Expr(column+" >= ?", single), nil
+	case transaction.LessThan:
+		return sq.Expr(column+" < ?", single), nil
+	case transaction.LessOrEqual:
+		return sq.Expr(column+" <= ?", single), nil
+	case transaction.Like:
+		return sq.Expr(column+" LIKE ?", single), nil
+	}
+	return nil, fmt.Errorf("Unknown filter operator %s", condition.Operator)
+}
+
+//filterValue converts query string values of boolean properties
+func filterValue(property *schema.Property, value interface{}) interface{} {
+	if property.Type != "boolean" {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	case []string:
+		values := make([]bool, len(v))
+		for i, j := range v {
+			values[i], _ = strconv.ParseBool(j)
+		}
+		return values
+	}
+	return value
+}
+
+func filterValues(property *schema.Property, values []interface{}) []interface{} {
+	for i, value := range values {
+		values[i] = filterValue(property, value)
+	}
+	return values
+}
+
 //SetMaxOpenConns limit maximum connections
 func (db *DB) SetMaxOpenConns(maxIdleConns int) {
 	// db.DB.SetMaxOpenConns(maxIdleConns)
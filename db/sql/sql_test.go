@@ -45,6 +45,9 @@ var _ = Describe("Sql", func() {
 		if os.Getenv("MYSQL_TEST") == "true" {
 			conn = "gohan:gohan@/gohan_test"
 			dbType = "mysql"
+		} else if os.Getenv("POSTGRES_TEST") == "true" {
+			conn = "postgres://gohan@localhost/gohan_test?sslmode=disable"
+			dbType = "postgres"
 		} else {
 			conn = "./test.db"
 			dbType = "sqlite3"
@@ -200,6 +203,22 @@ var _ = Describe("Sql", func() {
 		})
 	})
 
+	Describe("Create Table", func() {
+		It("Creates tables of all the schemas", func() {
+			schemas := schema.GetManager().OrderedSchemas()
+			for i := len(schemas) - 1; i >= 0; i-- {
+				if !schemas[i].IsAbstract() {
+					Expect(sqlConn.DropTable(schemas[i])).To(Succeed())
+				}
+			}
+			for _, s := range schemas {
+				if !s.IsAbstract() {
+					Expect(sqlConn.RegisterTable(s, false, false)).To(Succeed(), s.ID)
+				}
+			}
+		})
+	})
+
 	Describe("Generate Table", func() {
 		var server *schema.Schema
 		var subnet *schema.Schema
@@ -216,11 +235,15 @@ var _ = Describe("Sql", func() {
 			Expect(ok).To(BeTrue())
 		})
 
+		networksCascade := forDialect("REFERENCES `networks`(id) on delete cascade);", `REFERENCES "networks"(id) on delete cascade);`)
+
 		Context("Index on multiple columns", func() {
 			It("Should create unique index on tenant_id and id", func() {
 				_, indices := sqlConn.GenTableDef(test, false)
 				Expect(indices).To(HaveLen(2))
-				Expect(indices[1]).To(ContainSubstring("CREATE UNIQUE INDEX unique_id_and_tenant_id ON `tests`(`id`,`tenant_id`);"))
+				Expect(indices[1]).To(ContainSubstring(forDialect(
+					"CREATE UNIQUE INDEX unique_id_and_tenant_id ON `tests`(`id`,`tenant_id`);",
+					`CREATE UNIQUE INDEX unique_id_and_tenant_id ON "tests"("id","tenant_id");`)))
 			})
 		})
 
@@ -228,14 +251,16 @@ var _ = Describe("Sql", func() {
 			It("Should create index, if schema property should be indexed", func() {
 				_, indices := sqlConn.GenTableDef(test, false)
 				Expect(indices).To(HaveLen(2))
-				Expect(indices[0]).To(ContainSubstring("CREATE INDEX tests_tenant_id_idx ON `tests`(`tenant_id`(255));"))
+				Expect(indices[0]).To(ContainSubstring(forDialect(
+					"CREATE INDEX tests_tenant_id_idx ON `tests`(`tenant_id`(255));",
+					`CREATE INDEX tests_tenant_id_idx ON "tests"("tenant_id");`)))
 			})
 		})
 
 		Context("Relation column name", func() {
 			It("Generate foreign key with default column name when relationColumn not available", func() {
 				table, _ := sqlConn.GenTableDef(server, false)
-				Expect(table).To(ContainSubstring("REFERENCES `networks`(id)"))
+				Expect(table).To(ContainSubstring(forDialect("REFERENCES `networks`(id)", `REFERENCES "networks"(id)`)))
 			})
 
 			It("Generate foreign key with given column same as relationColumn from property", func() {
@@ -258,25 +283,25 @@ var _ = Describe("Sql", func() {
 				))
 				table, _, err := sqlConn.AlterTableDef(server, false)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(table).To(ContainSubstring("REFERENCES `subnets`(cidr)"))
+				Expect(table).To(ContainSubstring(forDialect("REFERENCES `subnets`(cidr)", `REFERENCES "subnets"(cidr)`)))
 			})
 		})
 
 		Context("With default cascade option", func() {
 			It("Generate proper table with cascade delete", func() {
 				table, _ := sqlConn.GenTableDef(server, true)
-				Expect(table).To(ContainSubstring("REFERENCES `networks`(id) on delete cascade);"))
+				Expect(table).To(ContainSubstring(networksCascade))
 				table, _ = sqlConn.GenTableDef(subnet, true)
-				Expect(table).To(ContainSubstring("REFERENCES `networks`(id) on delete cascade);"))
+				Expect(table).To(ContainSubstring(networksCascade))
 			})
 		})
 
 		Context("Without default cascade option", func() {
 			It("Generate proper table with cascade delete", func() {
 				table, _ := sqlConn.GenTableDef(server, false)
-				Expect(table).To(ContainSubstring("REFERENCES `networks`(id) on delete cascade);"))
+				Expect(table).To(ContainSubstring(networksCascade))
 				table, _ = sqlConn.GenTableDef(subnet, false)
-				Expect(table).ToNot(ContainSubstring("REFERENCES `networks`(id) on delete cascade);"))
+				Expect(table).ToNot(ContainSubstring(networksCascade))
 			})
 		})
 
@@ -301,7 +326,9 @@ var _ = Describe("Sql", func() {
 				))
 				table, _, err := sqlConn.AlterTableDef(server, true)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(table).To(ContainSubstring("alter table`servers` add (`test` varchar(255) not null);"))
+				Expect(table).To(ContainSubstring(forDialect(
+					"alter table`servers` add (`test` varchar(255) not null);",
+					`alter table "servers" add "test" varchar(255) not null;`)))
 			})
 
 			It("Create index if property should be indexed", func() {
@@ -325,12 +352,86 @@ var _ = Describe("Sql", func() {
 				_, indices, err := sqlConn.AlterTableDef(server, true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(indices).To(HaveLen(1))
-				Expect(indices[0]).To(ContainSubstring("CREATE INDEX servers_test_idx ON `servers`(`test`);"))
+				Expect(indices[0]).To(ContainSubstring(forDialect(
+					"CREATE INDEX servers_test_idx ON `servers`(`test`);",
+					`CREATE INDEX servers_test_idx ON "servers"("test");`)))
 			})
 		})
 	})
 })
 
+var _ = Describe("Postgres dialect", func() {
+	var (
+		sqlDB   *DB
+		network *schema.Schema
+		test    *schema.Schema
+	)
+
+	BeforeEach(func() {
+		manager := schema.GetManager()
+		Expect(manager.LoadSchemasFromFiles(
+			"../../etc/schema/gohan.json", "../../tests/test_abstract_schema.yaml", "../../tests/test_schema.yaml")).To(Succeed())
+		var ok bool
+		network, ok = manager.Schema("network")
+		Expect(ok).To(BeTrue())
+		test, ok = manager.Schema("test")
+		Expect(ok).To(BeTrue())
+		sqlDB = NewDBWithType("postgres")
+	})
+
+	AfterEach(func() {
+		schema.ClearManager()
+	})
+
+	It("Generates table with double quoted identifiers", func() {
+		table, _ := sqlDB.GenTableDef(network, false)
+		Expect(table).To(HavePrefix(`create table "networks" (`))
+		Expect(table).To(ContainSubstring(`"id" varchar(255) primary key`))
+		Expect(table).NotTo(ContainSubstring("`"))
+	})
+
+	It("Uses jsonb for object and array properties", func() {
+		table, _ := sqlDB.GenTableDef(network, false)
+		Expect(table).To(ContainSubstring(`"providor_networks" jsonb`))
+		Expect(table).To(ContainSubstring(`"route_targets" jsonb`))
+	})
+
+	It("Generates tables of gohan schemas", func() {
+		for _, s := range schema.GetManager().Schemas() {
+			if s.IsAbstract() {
+				continue
+			}
+			table, _ := sqlDB.GenTableDef(s, false)
+			Expect(table).NotTo(ContainSubstring("auto_increment"), s.ID)
+			Expect(table).NotTo(ContainSubstring("longtext"), s.ID)
+		}
+		event, ok := schema.GetManager().Schema("event")
+		Expect(ok).To(BeTrue())
+		table, _ := sqlDB.GenTableDef(event, false)
+		Expect(table).To(ContainSubstring(`"id" serial primary key`))
+	})
+
+	It("Rebinds placeholders and keeps jsonb operators", func() {
+		Expect(Rebind(sqlDB, "select * from `tests` where `id` = ? and `data` ?? ? and `tags` ??| array['a?', 'b''?'] and `name` = ?")).To(Equal(
+			`select * from "tests" where "id" = $1 and "data" ? $2 and "tags" ?| array['a?', 'b''?'] and "name" = $3`))
+	})
+
+	It("Generates indices without prefix length", func() {
+		_, indices := sqlDB.GenTableDef(test, false)
+		Expect(indices).To(HaveLen(2))
+		Expect(indices[0]).To(Equal(`CREATE INDEX tests_tenant_id_idx ON "tests"("tenant_id");`))
+		Expect(indices[1]).To(Equal(`CREATE UNIQUE INDEX unique_id_and_tenant_id ON "tests"("id","tenant_id");`))
+	})
+})
+
+//forDialect returns the statement expected from the tested database
+func forDialect(mysql, postgres string) string {
+	if os.Getenv("POSTGRES_TEST") == "true" {
+		return postgres
+	}
+	return mysql
+}
+
 func readFixtures(path string, v interface{}) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,159 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transaction
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+//Operator represents filter comparison operator
+type Operator string
+
+const (
+	//Equal matches values equal to given value or any of given values
+	Equal Operator = "eq"
+	//NotEqual matches values different than given value or all of given values
+	NotEqual Operator = "ne"
+	//GreaterThan matches values greater than given value
+	GreaterThan Operator = "gt"
+	//GreaterOrEqual matches values greater than or equal to given value
+	GreaterOrEqual Operator = "gte"
+	//LessThan matches values less than given value
+	LessThan Operator = "lt"
+	//LessOrEqual matches values less than or equal to given value
+	LessOrEqual Operator = "lte"
+	//Like matches values against SQL LIKE pattern
+	Like Operator = "like"
+	//In matches values equal to any of given values
+	In Operator = "in"
+	//IsNull matches null values if given value is true and non null values otherwise
+	IsNull Operator = "isnull"
+)
+
+var operators = map[Operator]bool{
+	Equal:          true,
+	NotEqual:       true,
+	GreaterThan:    true,
+	GreaterOrEqual: true,
+	LessThan:       true,
+	LessOrEqual:    true,
+	Like:           true,
+	In:             true,
+	IsNull:         true,
+}
+
+//Condition represents single filtering condition for a property
+type Condition struct {
+	Operator Operator
+	Value    interface{}
+}
+
+//NewCondition creates a condition validating the operator
+func NewCondition(operator string, value interface{}) (Condition, error) {
+	op := Operator(operator)
+	if !operators[op] {
+		return Condition{}, fmt.Errorf("Unknown filter operator %s", operator)
+	}
+	if op == IsNull {
+		isNull, err := parseIsNull(value)
+		if err != nil {
+			return Condition{}, err
+		}
+		value = isNull
+	}
+	return Condition{Operator: op, Value: value}, nil
+}
+
+//Conditions returns conditions represented by the filter value.
+//Plain values are treated as equality, or IN for lists, which is the default filter semantic.
+//Maps are treated as operator to value mapping, e.g. {"gt": 1, "lt": 10}.
+//All conditions returned should be satisfied for the filter to match.
+func Conditions(value interface{}) ([]Condition, error) {
+	switch v := value.(type) {
+	case Condition:
+		return []Condition{v}, nil
+	case []Condition:
+		return v, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		conditions := make([]Condition, 0, len(v))
+		for _, key := range keys {
+			condition, err := NewCondition(key, v[key])
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+		return conditions, nil
+	}
+	return []Condition{{Operator: Equal, Value: value}}, nil
+}
+
+//HasConditions checks if filter value uses operators other than the default one
+func HasConditions(value interface{}) bool {
+	switch value.(type) {
+	case Condition, []Condition, map[string]interface{}:
+		return true
+	}
+	return false
+}
+
+//Values returns list of values for list operators, wrapping single values if needed
+func (c Condition) Values() []interface{} {
+	rv := reflect.ValueOf(c.Value)
+	if c.Value == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return []interface{}{c.Value}
+	}
+	values := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values
+}
+
+//Single returns single value for comparison operators, unwrapping one element lists
+func (c Condition) Single() (interface{}, error) {
+	values := c.Values()
+	if len(values) != 1 {
+		return nil, fmt.Errorf("Filter operator %s expects single value, got %d", c.Operator, len(values))
+	}
+	return values[0], nil
+}
+
+func parseIsNull(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	case []string:
+		if len(v) == 1 {
+			return strconv.ParseBool(v[0])
+		}
+	case []interface{}:
+		if len(v) == 1 {
+			return parseIsNull(v[0])
+		}
+	}
+	return false, fmt.Errorf("Filter operator %s expects boolean value, got %v", IsNull, value)
+}
@@ -4,6 +4,8 @@
 package mocks
 
 import (
+	time "time"
+
 	pagination "github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	schema "github.com/cloudwan/gohan/schema"
@@ -72,6 +74,36 @@ func (_mr *_MockTransactionRecorder) Delete(arg0, arg1 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Delete", arg0, arg1)
 }
 
+func (_m *MockTransaction) BatchDelete(_param0 *schema.Schema, _param1 []interface{}) error {
+	ret := _m.ctrl.Call(_m, "BatchDelete", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTransactionRecorder) BatchDelete(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BatchDelete", arg0, arg1)
+}
+
+func (_m *MockTransaction) Restore(_param0 *schema.Schema, _param1 interface{}) error {
+	ret := _m.ctrl.Call(_m, "Restore", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTransactionRecorder) Restore(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Restore", arg0, arg1)
+}
+
+func (_m *MockTransaction) Purge(_param0 *schema.Schema, _param1 time.Time) error {
+	ret := _m.ctrl.Call(_m, "Purge", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTransactionRecorder) Purge(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Purge", arg0, arg1)
+}
+
 func (_m *MockTransaction) Fetch(_param0 *schema.Schema, _param1 transaction.Filter) (*schema.Resource, error) {
 	ret := _m.ctrl.Call(_m, "Fetch", _param0, _param1)
 	ret0, _ := ret[0].(*schema.Resource)
@@ -17,6 +17,7 @@ package transaction
 
 import (
 	"errors"
+	"time"
 
 	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/schema"
@@ -66,6 +67,11 @@ type ListOptions struct {
 	Details bool
 	// Fields limits list output to only showing selected fields.
 	Fields []string
+	// SkipCount skips counting all the matching resources, which is
+	// expensive on big tables. Total is returned as zero.
+	SkipCount bool
+	// Deleted includes soft deleted resources in the result.
+	Deleted bool
 }
 
 //Transaction is common interface for handling transaction
@@ -74,6 +80,9 @@ type Transaction interface {
 	Update(*schema.Resource) error
 	StateUpdate(*schema.Resource, *ResourceState) error
 	Delete(*schema.Schema, interface{}) error
+	BatchDelete(*schema.Schema, []interface{}) error
+	Restore(*schema.Schema, interface{}) error
+	Purge(*schema.Schema, time.Time) error
 	Fetch(*schema.Schema, Filter) (*schema.Resource, error)
 	LockFetch(*schema.Schema, Filter, schema.LockPolicy) (*schema.Resource, error)
 	StateFetch(*schema.Schema, Filter) (ResourceState, error)
@@ -51,4 +51,29 @@ var _ = Describe("Transaction", func() {
 			Expect(tx.GetIsolationLevel(netSchema, "update")).To(Equal(tx.Serializable))
 		})
 	})
+
+	Describe("ResourceVersion", func() {
+		var manager *schema.Manager
+
+		BeforeEach(func() {
+			manager = schema.GetManager()
+			Expect(manager.LoadSchemaFromFile("../../etc/schema/gohan.json")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			schema.ClearManager()
+		})
+
+		It("Returns content hash for schemas without state versioning", func() {
+			resource, err := manager.LoadResource("namespace", map[string]interface{}{"id": "ns", "name": "ns"})
+			Expect(err).ToNot(HaveOccurred())
+			version, err := tx.ResourceVersion(nil, resource)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(HaveLen(40))
+
+			Expect(tx.CheckResourceVersion(nil, resource, []string{version})).To(Succeed())
+			Expect(resource.Update(map[string]interface{}{"name": "other"})).To(Succeed())
+			Expect(tx.CheckResourceVersion(nil, resource, []string{version})).To(Equal(tx.ErrVersionMismatch))
+		})
+	})
 })
@@ -0,0 +1,68 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transaction
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+//ErrVersionMismatch is returned when resource version is different than expected
+var ErrVersionMismatch = errors.New("resource version mismatch")
+
+//AnyVersion matches any version of existing resource
+const AnyVersion = "*"
+
+//ResourceVersion returns version of the resource used for optimistic concurrency control.
+//It is config version for schemas with state versioning and hash of the resource content otherwise.
+func ResourceVersion(tx Transaction, resource *schema.Resource) (string, error) {
+	s := resource.Schema()
+	if s.StateVersioning() {
+		state, err := tx.StateFetch(s, IDFilter(resource.ID()))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(state.ConfigVersion, 10), nil
+	}
+	data := map[string]interface{}{}
+	for _, property := range s.Properties {
+		data[property.ID] = resource.Get(property.ID)
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha1.Sum(bytes)), nil
+}
+
+//CheckResourceVersion returns ErrVersionMismatch unless the resource version is one of expected versions
+func CheckResourceVersion(tx Transaction, resource *schema.Resource, expected []string) error {
+	version, err := ResourceVersion(tx, resource)
+	if err != nil {
+		return err
+	}
+	for _, e := range expected {
+		if e == AnyVersion || e == version {
+			return nil
+		}
+	}
+	return ErrVersionMismatch
+}
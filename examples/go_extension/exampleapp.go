@@ -42,6 +42,16 @@ func main() {
 			return nil
 		})
 
+	//Register typed go handler for the todo schema
+	golang.RegisterHandler("todo", golang.PreCreate,
+		func(context *golang.Context) error {
+			todo := context.Resource()
+			if todo["name"] == "" {
+				return golang.BadRequest("todo %s must have a name", todo["id"])
+			}
+			return nil
+		})
+
 	exampleModule := &ExampleModule{}
 
 	//Register go based module for javascript
@@ -36,9 +36,19 @@ type Environment interface {
 //This is a singleton class.
 type Manager struct {
 	environments map[string]Environment
+	pools        map[string]*Pool
+	poolConfig   PoolConfig
 	mu           sync.RWMutex
 }
 
+//SetPoolConfig configures pools of environments registered later
+func (manager *Manager) SetPoolConfig(config PoolConfig) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.poolConfig = config
+}
+
 //RegisterEnvironment registers a new environment for the given schema ID
 func (manager *Manager) RegisterEnvironment(schemaID string, env Environment) error {
 	manager.mu.Lock()
@@ -48,6 +58,11 @@ func (manager *Manager) RegisterEnvironment(schemaID string, env Environment) er
 		return fmt.Errorf("Environment already registered for this schema")
 	}
 	manager.environments[schemaID] = env
+	if manager.poolConfig.Size > 0 {
+		pool := NewPool(schemaID, env, manager.poolConfig)
+		manager.pools[schemaID] = pool
+		go pool.Warm()
+	}
 	return nil
 }
 
@@ -60,26 +75,53 @@ func (manager *Manager) UnRegisterEnvironment(schemaID string) error {
 		return fmt.Errorf("No environment registered for this schema")
 	}
 	delete(manager.environments, schemaID)
+	delete(manager.pools, schemaID)
 	return nil
 }
 
-//GetEnvironment returns the environment registered for the given schema ID
-func (manager *Manager) GetEnvironment(schemaID string) (env Environment, ok bool) {
+//HasEnvironment checks if an environment is registered for the given schema ID
+func (manager *Manager) HasEnvironment(schemaID string) bool {
 	manager.mu.RLock()
 	defer manager.mu.RUnlock()
 
+	_, ok := manager.environments[schemaID]
+	return ok
+}
+
+//GetEnvironment returns a clone of the environment registered for the given schema ID,
+//the clone should be given back by ReturnEnvironment after handling events
+func (manager *Manager) GetEnvironment(schemaID string) (env Environment, ok bool) {
+	manager.mu.RLock()
+	pool, pooled := manager.pools[schemaID]
 	env, ok = manager.environments[schemaID]
-	if ok {
+	manager.mu.RUnlock()
+
+	switch {
+	case pooled:
+		env = pool.Get()
+	case ok:
 		env = env.Clone()
 	}
 	return
 }
 
+//ReturnEnvironment gives back the environment returned by GetEnvironment, so it can be reused
+func (manager *Manager) ReturnEnvironment(schemaID string, env Environment) {
+	manager.mu.RLock()
+	pool, pooled := manager.pools[schemaID]
+	manager.mu.RUnlock()
+
+	if pooled {
+		pool.Put(env)
+	}
+}
+
 //GetManager gets manager
 func GetManager() *Manager {
 	return singleton.Get("extension/manager", func() interface{} {
 		return &Manager{
 			environments: map[string]Environment{},
+			pools:        map[string]*Pool{},
 		}
 	}).(*Manager)
 }
@@ -0,0 +1,191 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coverage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/xyproto/otto"
+)
+
+// HitFunction is the name of the function called by instrumented code
+const HitFunction = "__gohan_coverage"
+
+// Coverage collects statement, branch and function coverage of JavaScript files
+// run by multiple VMs
+type Coverage struct {
+	mu     sync.Mutex
+	files  []*File
+	byPath map[string]*File
+}
+
+// File is coverage of a single JavaScript file
+type File struct {
+	Path         string
+	Source       string
+	instrumented string
+	probes       []*probe
+	hits         []int64
+}
+
+// Counts is a number of covered items out of all instrumented items
+type Counts struct {
+	Covered int
+	Total   int
+}
+
+// Percent returns the covered part of items in percents, 100 is returned when there are no items
+func (counts Counts) Percent() float64 {
+	if counts.Total == 0 {
+		return 100
+	}
+	return 100 * float64(counts.Covered) / float64(counts.Total)
+}
+
+// NewCoverage creates an empty coverage collector
+func NewCoverage() *Coverage {
+	return &Coverage{
+		byPath: map[string]*File{},
+	}
+}
+
+// Instrument returns source with calls to HitFunction inserted,
+// instrumentation of the same file is done only once
+func (coverage *Coverage) Instrument(path, source string) (string, error) {
+	coverage.mu.Lock()
+	defer coverage.mu.Unlock()
+	if file, ok := coverage.byPath[path]; ok && file.Source == source {
+		return file.instrumented, nil
+	}
+	instrumented, probes, err := instrument(len(coverage.files), path, source)
+	if err != nil {
+		return "", err
+	}
+	file := &File{
+		Path:         path,
+		Source:       source,
+		instrumented: instrumented,
+		probes:       probes,
+		hits:         make([]int64, len(probes)),
+	}
+	coverage.files = append(coverage.files, file)
+	coverage.byPath[path] = file
+	return instrumented, nil
+}
+
+// SetUp defines HitFunction in the VM
+func (coverage *Coverage) SetUp(vm *otto.Otto) error {
+	return vm.Set(HitFunction, func(call otto.FunctionCall) otto.Value {
+		fileID, _ := call.Argument(0).ToInteger()
+		probeID, _ := call.Argument(1).ToInteger()
+		coverage.hit(int(fileID), int(probeID))
+		return otto.UndefinedValue()
+	})
+}
+
+func (coverage *Coverage) hit(fileID, probeID int) {
+	coverage.mu.Lock()
+	defer coverage.mu.Unlock()
+	if fileID < 0 || fileID >= len(coverage.files) {
+		return
+	}
+	file := coverage.files[fileID]
+	if probeID < 0 || probeID >= len(file.hits) {
+		return
+	}
+	file.hits[probeID]++
+}
+
+// Files returns covered files sorted by path, replaced versions of a file are skipped
+func (coverage *Coverage) Files() []*File {
+	coverage.mu.Lock()
+	defer coverage.mu.Unlock()
+	files := []*File{}
+	for _, file := range coverage.byPath {
+		files = append(files, file.snapshot())
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// Total returns summed counts of all files
+func (coverage *Coverage) Total() (statements, branches, functions Counts) {
+	for _, file := range coverage.Files() {
+		statements = statements.add(file.Statements())
+		branches = branches.add(file.Branches())
+		functions = functions.add(file.Functions())
+	}
+	return
+}
+
+func (counts Counts) add(other Counts) Counts {
+	return Counts{
+		Covered: counts.Covered + other.Covered,
+		Total:   counts.Total + other.Total,
+	}
+}
+
+func (file *File) snapshot() *File {
+	copied := *file
+	copied.hits = append([]int64{}, file.hits...)
+	return &copied
+}
+
+func (file *File) count(kind probeKind) Counts {
+	counts := Counts{}
+	for i, probe := range file.probes {
+		if probe.kind != kind {
+			continue
+		}
+		counts.Total++
+		if file.hits[i] > 0 {
+			counts.Covered++
+		}
+	}
+	return counts
+}
+
+// Statements returns statement coverage of the file
+func (file *File) Statements() Counts {
+	return file.count(statementProbe)
+}
+
+// Branches returns branch coverage of the file
+func (file *File) Branches() Counts {
+	return file.count(branchProbe)
+}
+
+// Functions returns function coverage of the file
+func (file *File) Functions() Counts {
+	return file.count(functionProbe)
+}
+
+// lineHits returns the highest hit count of statements starting at each line
+func (file *File) lineHits() map[int]int64 {
+	lines := map[int]int64{}
+	for i, probe := range file.probes {
+		if probe.kind != statementProbe {
+			continue
+		}
+		if hits, ok := lines[probe.line]; !ok || file.hits[i] > hits {
+			lines[probe.line] = file.hits[i]
+		}
+	}
+	return lines
+}
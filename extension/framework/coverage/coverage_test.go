@@ -0,0 +1,207 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coverage_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/xyproto/otto"
+
+	"github.com/cloudwan/gohan/extension/framework/coverage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Coverage", func() {
+	var testCoverage *coverage.Coverage
+
+	BeforeEach(func() {
+		testCoverage = coverage.NewCoverage()
+	})
+
+	run := func(path, source string) otto.Value {
+		code, err := testCoverage.Instrument(path, source)
+		Expect(err).ToNot(HaveOccurred())
+		vm := otto.New()
+		Expect(testCoverage.SetUp(vm)).To(Succeed())
+		value, err := vm.Run(code)
+		Expect(err).ToNot(HaveOccurred())
+		return value
+	}
+
+	Describe("Instrumentation", func() {
+		DescribeTable("Should keep the semantics of the code",
+			func(source string, expected int) {
+				original, err := otto.New().Run(source)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(original.ToInteger()).To(BeEquivalentTo(expected))
+
+				instrumented := run("test.js", source)
+				Expect(instrumented.ToInteger()).To(BeEquivalentTo(expected))
+			},
+			Entry("if without block", `
+				var x = 1;
+				if (x) x = 2
+				else x = 3
+				x`, 2),
+			Entry("dangling else", `
+				var x = 0;
+				if (true) if (false) x = 1; else x = 2
+				x`, 2),
+			Entry("if without else", `
+				var x = 0;
+				if (false) { x = 1 }
+				if (false) x = 2;
+				x`, 0),
+			Entry("statements without semicolons", `
+				var x = 0
+				x++
+				x += 2
+				x`, 3),
+			Entry("parenthesized statements", `
+				var x = 0;
+				(function() { x = 5 })();
+				((x))`, 5),
+			Entry("labels", `
+				var x = 0;
+				outer: for (var i = 0; i < 3; i++) { for (;;) { x++; continue outer; } }
+				x`, 3),
+			Entry("switch fallthrough", `
+				var x = 0;
+				switch (1) {
+				case 1:
+				case 2:
+					x++;
+				default:
+					x++;
+				}
+				x`, 2),
+			Entry("loops without blocks", `
+				var x = 0;
+				for (var i = 0; i < 3; i++) x++;
+				while (x < 10) x += 2
+				do x--; while (x > 5)
+				x`, 5),
+			Entry("trailing line comment", `
+				var x = 1;
+				if (x) x = 7 // comment`, 7),
+		)
+	})
+
+	Describe("Collecting coverage", func() {
+		const source = `function check(value) {
+  if (value > 0) {
+    return "positive";
+  }
+  return "other";
+}
+
+function unused() {
+  return 1;
+}
+
+check(1);
+`
+
+		It("Should count statements, branches and functions", func() {
+			run("check.js", source)
+
+			files := testCoverage.Files()
+			Expect(files).To(HaveLen(1))
+			Expect(files[0].Path).To(Equal("check.js"))
+			Expect(files[0].Statements()).To(Equal(coverage.Counts{Covered: 3, Total: 5}))
+			Expect(files[0].Branches()).To(Equal(coverage.Counts{Covered: 1, Total: 2}))
+			Expect(files[0].Functions()).To(Equal(coverage.Counts{Covered: 1, Total: 2}))
+		})
+
+		It("Should merge coverage of multiple runs", func() {
+			const sign = `function sign(value) {
+  if (value < 0) {
+    return -1;
+  }
+  return 1;
+}`
+			run("sign.js", sign)
+			for _, value := range []int{1, -1} {
+				code, err := testCoverage.Instrument("sign.js", sign)
+				Expect(err).ToNot(HaveOccurred())
+				vm := otto.New()
+				Expect(testCoverage.SetUp(vm)).To(Succeed())
+				_, err = vm.Run(code)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = vm.Call("sign", nil, value)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			statements, branches, functions := testCoverage.Total()
+			Expect(statements).To(Equal(coverage.Counts{Covered: 3, Total: 3}))
+			Expect(branches).To(Equal(coverage.Counts{Covered: 2, Total: 2}))
+			Expect(functions).To(Equal(coverage.Counts{Covered: 1, Total: 1}))
+		})
+
+		It("Should write lcov", func() {
+			run("check.js", source)
+
+			buffer := &bytes.Buffer{}
+			Expect(testCoverage.WriteLCOV(buffer)).To(Succeed())
+			Expect(buffer.String()).To(Equal(`TN:
+SF:check.js
+FN:1,check
+FN:8,unused
+FNDA:1,check
+FNDA:0,unused
+FNF:2
+FNH:1
+BRDA:2,0,0,1
+BRDA:2,0,1,-
+BRF:2
+BRH:1
+DA:2,1
+DA:3,1
+DA:5,0
+DA:9,0
+DA:12,1
+LF:5
+LH:3
+end_of_record
+`))
+		})
+
+		It("Should write HTML", func() {
+			run("lib/check.js", source)
+
+			dir, err := ioutil.TempDir("", "coverage")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			Expect(testCoverage.WriteHTML(dir)).To(Succeed())
+			index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(index)).To(ContainSubstring(`<a href="lib_check.js.html">lib/check.js</a>`))
+			Expect(string(index)).To(ContainSubstring("60.0% (3/5)"))
+
+			page, err := ioutil.ReadFile(filepath.Join(dir, "lib_check.js.html"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(page)).To(ContainSubstring(`<tr class="partial"><td>2</td><td>1</td><td>&#43; -</td><td>  if (value &gt; 0) {</td></tr>`))
+			Expect(string(page)).To(ContainSubstring(`<tr class="uncovered"><td>9</td><td>0</td><td></td><td>  return 1;</td></tr>`))
+		})
+	})
+})
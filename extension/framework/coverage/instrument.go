@@ -0,0 +1,481 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coverage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xyproto/otto/ast"
+	"github.com/xyproto/otto/parser"
+)
+
+type probeKind int
+
+const (
+	statementProbe probeKind = iota
+	branchProbe
+	functionProbe
+)
+
+// probe is a single counter call inserted into the instrumented code
+type probe struct {
+	kind   probeKind
+	line   int
+	block  int
+	branch int
+	name   string
+}
+
+// insertion is a piece of code inserted at offset of the original source.
+// Openings are placed after closings at the same offset, openings of outer
+// nodes go first and closings of inner nodes go first.
+type insertion struct {
+	offset  int
+	closing bool
+	depth   int
+	seq     int
+	text    string
+}
+
+type instrumenter struct {
+	fileID     int
+	source     string
+	base       int
+	lines      []int
+	probes     []*probe
+	blocks     int
+	functions  int
+	depth      int
+	insertions []*insertion
+}
+
+// instrument parses source and returns it with counter calls inserted before
+// statements, at the beginning of functions and in both branches of if statements
+// and in cases of switch statements.
+// Bodies of loops and if statements which are not blocks are wrapped in blocks when
+// their end can be determined from the surrounding code, otherwise they are not instrumented.
+func instrument(fileID int, path, source string) (string, []*probe, error) {
+	program, err := parser.ParseFile(nil, path, source, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	in := &instrumenter{
+		fileID: fileID,
+		source: source,
+		base:   program.File.Base(),
+		lines:  []int{0},
+	}
+	for i, c := range source {
+		if c == '\n' {
+			in.lines = append(in.lines, i+1)
+		}
+	}
+	in.statements(program.Body, len(source))
+	return in.apply(), in.probes, nil
+}
+
+func (in *instrumenter) apply() string {
+	sort.SliceStable(in.insertions, func(i, j int) bool {
+		a, b := in.insertions[i], in.insertions[j]
+		if a.offset != b.offset {
+			return a.offset < b.offset
+		}
+		if a.closing != b.closing {
+			return a.closing
+		}
+		if a.depth != b.depth {
+			return a.closing == (a.depth > b.depth)
+		}
+		return a.seq < b.seq
+	})
+	var code bytes.Buffer
+	last := 0
+	for _, insertion := range in.insertions {
+		code.WriteString(in.source[last:insertion.offset])
+		code.WriteString(insertion.text)
+		last = insertion.offset
+	}
+	code.WriteString(in.source[last:])
+	return code.String()
+}
+
+func (in *instrumenter) insert(offset int, closing bool, text string) {
+	if closing && offset == len(in.source) {
+		// the source may end with a line comment
+		text = "\n" + text
+	}
+	in.insertions = append(in.insertions, &insertion{
+		offset:  offset,
+		closing: closing,
+		depth:   in.depth,
+		seq:     len(in.insertions),
+		text:    text,
+	})
+}
+
+func (in *instrumenter) insertProbe(offset int, p *probe) {
+	if p.line == 0 {
+		p.line = in.line(offset)
+	}
+	in.insert(offset, false, in.probeCall(p))
+}
+
+func (in *instrumenter) probeCall(p *probe) string {
+	in.probes = append(in.probes, p)
+	return fmt.Sprintf("%s(%d,%d);", HitFunction, in.fileID, len(in.probes)-1)
+}
+
+func (in *instrumenter) line(offset int) int {
+	return sort.Search(len(in.lines), func(i int) bool { return in.lines[i] > offset })
+}
+
+func (in *instrumenter) offset(node ast.Node) int {
+	return int(node.Idx0()) - in.base
+}
+
+// statementStart returns offset of the first character of stmt or -1 if it is unknown.
+// The parser doesn't keep positions of some keywords and of parentheses,
+// so they are looked up in the source before the first known position.
+func (in *instrumenter) statementStart(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return in.keywordStart(in.expressionStart(s.Expression), "", "(")
+	case *ast.IfStatement:
+		return in.keywordStart(in.expressionStart(s.Test), "if", "(")
+	case *ast.WhileStatement:
+		return in.keywordStart(in.expressionStart(s.Test), "while", "(")
+	case *ast.WithStatement:
+		return in.keywordStart(in.expressionStart(s.Object), "with", "(")
+	case *ast.SwitchStatement:
+		return in.keywordStart(in.expressionStart(s.Discriminant), "switch", "(")
+	case *ast.ThrowStatement:
+		return in.keywordStart(in.expressionStart(s.Argument), "throw", "(")
+	case *ast.DoWhileStatement:
+		return in.keywordStart(in.statementStart(s.Body), "do", "")
+	case *ast.ForInStatement:
+		return in.keywordStart(in.expressionStart(s.Into), "for", "(")
+	case *ast.ForStatement:
+		for _, expr := range []ast.Expression{s.Initializer, s.Test, s.Update} {
+			if start := in.expressionStart(expr); start >= 0 {
+				return in.keywordStart(start, "for", "(;")
+			}
+		}
+		return in.keywordStart(in.statementStart(s.Body), "for", "(;)")
+	}
+	return in.offset(stmt)
+}
+
+// keywordStart returns offset of keyword before anchor separated only by whitespace,
+// characters from skip and var declaration, -1 is returned when keyword is not found
+func (in *instrumenter) keywordStart(anchor int, keyword, skip string) int {
+	if anchor < 0 {
+		return -1
+	}
+	start := anchor
+	for {
+		i := in.skipSpaceBackward(start)
+		switch {
+		case i > 0 && strings.IndexByte(skip, in.source[i-1]) >= 0:
+			start = i - 1
+			continue
+		case keyword == "for" && in.wordBefore(i, "var"):
+			start = i - 3
+			continue
+		case keyword == "":
+			return start
+		case in.wordBefore(i, keyword):
+			return i - len(keyword)
+		}
+		return -1
+	}
+}
+
+func (in *instrumenter) wordBefore(offset int, word string) bool {
+	start := offset - len(word)
+	if start < 0 || in.source[start:offset] != word {
+		return false
+	}
+	return start == 0 || !isIdentifierPart(in.source[start-1])
+}
+
+func isIdentifierPart(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// expressionStart returns offset of the first character of expr without enclosing parentheses,
+// -1 is returned for empty expressions
+func (in *instrumenter) expressionStart(expr ast.Expression) int {
+	switch e := expr.(type) {
+	case nil:
+		return -1
+	case *ast.AssignExpression:
+		return in.expressionStart(e.Left)
+	case *ast.BinaryExpression:
+		return in.expressionStart(e.Left)
+	case *ast.BracketExpression:
+		return in.expressionStart(e.Left)
+	case *ast.CallExpression:
+		return in.expressionStart(e.Callee)
+	case *ast.ConditionalExpression:
+		return in.expressionStart(e.Test)
+	case *ast.DotExpression:
+		return in.expressionStart(e.Left)
+	case *ast.SequenceExpression:
+		if len(e.Sequence) == 0 {
+			return -1
+		}
+		return in.expressionStart(e.Sequence[0])
+	case *ast.UnaryExpression:
+		if e.Postfix {
+			return in.expressionStart(e.Operand)
+		}
+	}
+	return in.offset(expr)
+}
+
+func (in *instrumenter) skipSpaceBackward(offset int) int {
+	for offset > 0 && strings.ContainsRune(" \t\r\n", rune(in.source[offset-1])) {
+		offset--
+	}
+	return offset
+}
+
+// elseOffset returns offset of the else keyword preceding alternate or -1 if it can't be found
+func (in *instrumenter) elseOffset(alternate ast.Statement) int {
+	return in.keywordStart(in.statementStart(alternate), "else", "")
+}
+
+// statements instruments a statement list ending at end, end is -1 when unknown
+func (in *instrumenter) statements(list []ast.Statement, end int) {
+	for i, stmt := range list {
+		stmtEnd := end
+		if i+1 < len(list) {
+			stmtEnd = in.statementStart(list[i+1])
+		}
+		in.statement(stmt, stmtEnd)
+	}
+}
+
+func (in *instrumenter) statement(stmt ast.Statement, end int) {
+	switch stmt.(type) {
+	case *ast.FunctionStatement, *ast.EmptyStatement:
+	default:
+		if start := in.statementStart(stmt); start >= 0 {
+			in.insertProbe(start, &probe{kind: statementProbe})
+		}
+	}
+	in.walk(stmt, end)
+}
+
+// walk instruments nested statements and functions of stmt without counting stmt itself
+func (in *instrumenter) walk(stmt ast.Statement, end int) {
+	switch s := stmt.(type) {
+	case *ast.BlockStatement:
+		in.block(s, nil)
+	case *ast.ExpressionStatement:
+		in.expression(s.Expression)
+	case *ast.VariableStatement:
+		in.expressions(s.List)
+	case *ast.ReturnStatement:
+		in.expression(s.Argument)
+	case *ast.ThrowStatement:
+		in.expression(s.Argument)
+	case *ast.FunctionStatement:
+		in.function(s.Function)
+	case *ast.IfStatement:
+		in.ifStatement(s, end)
+	case *ast.SwitchStatement:
+		in.switchStatement(s)
+	case *ast.ForStatement:
+		in.expression(s.Initializer)
+		in.expression(s.Test)
+		in.expression(s.Update)
+		in.body(s.Body, end, nil)
+	case *ast.ForInStatement:
+		in.expression(s.Into)
+		in.expression(s.Source)
+		in.body(s.Body, end, nil)
+	case *ast.WhileStatement:
+		in.expression(s.Test)
+		in.body(s.Body, end, nil)
+	case *ast.DoWhileStatement:
+		in.body(s.Body, -1, nil)
+		in.expression(s.Test)
+	case *ast.WithStatement:
+		in.expression(s.Object)
+		in.body(s.Body, end, nil)
+	case *ast.LabelledStatement:
+		in.walk(s.Statement, end)
+	case *ast.TryStatement:
+		in.body(s.Body, -1, nil)
+		if s.Catch != nil {
+			in.body(s.Catch.Body, -1, nil)
+		}
+		if s.Finally != nil {
+			in.body(s.Finally, -1, nil)
+		}
+	}
+}
+
+func (in *instrumenter) ifStatement(s *ast.IfStatement, end int) {
+	in.expression(s.Test)
+	block := in.blocks
+	in.blocks++
+	line := in.line(in.expressionStart(s.Test))
+
+	consequentEnd := end
+	if s.Alternate != nil {
+		consequentEnd = in.elseOffset(s.Alternate)
+	}
+	in.body(s.Consequent, consequentEnd, &probe{kind: branchProbe, line: line, block: block, branch: 0})
+	if s.Alternate != nil {
+		in.body(s.Alternate, end, &probe{kind: branchProbe, line: line, block: block, branch: 1})
+		return
+	}
+
+	elseOffset := end
+	if consequent, ok := s.Consequent.(*ast.BlockStatement); ok {
+		elseOffset = int(consequent.RightBrace) - in.base + 1
+	}
+	if elseOffset < 0 {
+		return
+	}
+	in.depth++
+	in.insert(elseOffset, true, " else {"+in.probeCall(&probe{kind: branchProbe, line: line, block: block, branch: 1})+"}")
+	in.depth--
+}
+
+func (in *instrumenter) switchStatement(s *ast.SwitchStatement) {
+	in.expression(s.Discriminant)
+	block := in.blocks
+	in.blocks++
+	for i, c := range s.Body {
+		in.expression(c.Test)
+		if len(c.Consequent) == 0 {
+			continue
+		}
+		end := -1
+		if i+1 < len(s.Body) {
+			end = in.offset(s.Body[i+1])
+		}
+		in.depth++
+		if start := in.statementStart(c.Consequent[0]); start >= 0 {
+			in.insertProbe(start, &probe{kind: branchProbe, line: in.line(in.offset(c)), block: block, branch: i})
+		}
+		in.statements(c.Consequent, end)
+		in.depth--
+	}
+}
+
+// body instruments a body of a compound statement, the body is wrapped in a block
+// when it is not a block already
+func (in *instrumenter) body(stmt ast.Statement, end int, branch *probe) {
+	in.depth++
+	defer func() { in.depth-- }()
+
+	if block, ok := stmt.(*ast.BlockStatement); ok {
+		in.block(block, branch)
+		return
+	}
+	start := in.statementStart(stmt)
+	if start < 0 || end < 0 {
+		in.walk(stmt, -1)
+		return
+	}
+	in.insert(start, false, "{")
+	if branch != nil {
+		in.insertProbe(start, branch)
+	}
+	in.statement(stmt, end)
+	in.insert(end, true, "}")
+}
+
+func (in *instrumenter) block(block *ast.BlockStatement, branch *probe) {
+	if branch != nil {
+		in.insertProbe(int(block.LeftBrace)-in.base+1, branch)
+	}
+	in.depth++
+	in.statements(block.List, int(block.RightBrace)-in.base)
+	in.depth--
+}
+
+func (in *instrumenter) function(function *ast.FunctionLiteral) {
+	name := ""
+	if function.Name != nil {
+		name = function.Name.Name
+	}
+	in.functions++
+	if name == "" {
+		name = fmt.Sprintf("(anonymous_%d)", in.functions)
+	}
+	body, ok := function.Body.(*ast.BlockStatement)
+	if !ok {
+		return
+	}
+	in.depth++
+	in.insertProbe(int(body.LeftBrace)-in.base+1, &probe{kind: functionProbe, name: name})
+	in.statements(body.List, int(body.RightBrace)-in.base)
+	in.depth--
+}
+
+func (in *instrumenter) expressions(list []ast.Expression) {
+	for _, expr := range list {
+		in.expression(expr)
+	}
+}
+
+func (in *instrumenter) expression(expr ast.Expression) {
+	switch e := expr.(type) {
+	case *ast.ArrayLiteral:
+		in.expressions(e.Value)
+	case *ast.AssignExpression:
+		in.expression(e.Left)
+		in.expression(e.Right)
+	case *ast.BinaryExpression:
+		in.expression(e.Left)
+		in.expression(e.Right)
+	case *ast.BracketExpression:
+		in.expression(e.Left)
+		in.expression(e.Member)
+	case *ast.CallExpression:
+		in.expression(e.Callee)
+		in.expressions(e.ArgumentList)
+	case *ast.ConditionalExpression:
+		in.expression(e.Test)
+		in.expression(e.Consequent)
+		in.expression(e.Alternate)
+	case *ast.DotExpression:
+		in.expression(e.Left)
+	case *ast.FunctionLiteral:
+		in.function(e)
+	case *ast.NewExpression:
+		in.expression(e.Callee)
+		in.expressions(e.ArgumentList)
+	case *ast.ObjectLiteral:
+		for _, property := range e.Value {
+			in.expression(property.Value)
+		}
+	case *ast.SequenceExpression:
+		in.expressions(e.Sequence)
+	case *ast.UnaryExpression:
+		in.expression(e.Operand)
+	case *ast.VariableExpression:
+		in.expression(e.Initializer)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// WriteLCOV writes coverage in lcov tracefile format
+func (coverage *Coverage) WriteLCOV(w io.Writer) error {
+	buffer := bufio.NewWriter(w)
+	for _, file := range coverage.Files() {
+		fmt.Fprintf(buffer, "TN:\nSF:%s\n", file.Path)
+
+		for _, probe := range file.probes {
+			if probe.kind == functionProbe {
+				fmt.Fprintf(buffer, "FN:%d,%s\n", probe.line, probe.name)
+			}
+		}
+		for i, probe := range file.probes {
+			if probe.kind == functionProbe {
+				fmt.Fprintf(buffer, "FNDA:%d,%s\n", file.hits[i], probe.name)
+			}
+		}
+		functions := file.Functions()
+		fmt.Fprintf(buffer, "FNF:%d\nFNH:%d\n", functions.Total, functions.Covered)
+
+		for _, i := range file.branchIndexes() {
+			probe := file.probes[i]
+			hits := fmt.Sprint(file.hits[i])
+			if file.hits[i] == 0 {
+				hits = "-"
+			}
+			fmt.Fprintf(buffer, "BRDA:%d,%d,%d,%s\n", probe.line, probe.block, probe.branch, hits)
+		}
+		branches := file.Branches()
+		fmt.Fprintf(buffer, "BRF:%d\nBRH:%d\n", branches.Total, branches.Covered)
+
+		lineHits := file.lineHits()
+		lines := make([]int, 0, len(lineHits))
+		covered := 0
+		for line, hits := range lineHits {
+			lines = append(lines, line)
+			if hits > 0 {
+				covered++
+			}
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(buffer, "DA:%d,%d\n", line, lineHits[line])
+		}
+		fmt.Fprintf(buffer, "LF:%d\nLH:%d\nend_of_record\n", len(lines), covered)
+	}
+	return buffer.Flush()
+}
+
+// branchIndexes returns indexes of branch probes ordered by block and branch
+func (file *File) branchIndexes() []int {
+	indexes := []int{}
+	for i, probe := range file.probes {
+		if probe.kind == branchProbe {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		a, b := file.probes[indexes[i]], file.probes[indexes[j]]
+		if a.block != b.block {
+			return a.block < b.block
+		}
+		return a.branch < b.branch
+	})
+	return indexes
+}
+
+// WriteHTML writes index.html with a summary of all files and a page with
+// annotated source of each file to dir
+func (coverage *Coverage) WriteHTML(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files := coverage.Files()
+	index := htmlIndex{}
+	for _, file := range files {
+		page := newHTMLPage(file)
+		if err := writeTemplate(filepath.Join(dir, page.Link), htmlFileTemplate, page); err != nil {
+			return err
+		}
+		index.Files = append(index.Files, page.htmlSummary)
+		index.Total = index.Total.add(page.htmlSummary)
+	}
+	return writeTemplate(filepath.Join(dir, "index.html"), htmlIndexTemplate, index)
+}
+
+type htmlSummary struct {
+	Path       string
+	Link       string
+	Statements Counts
+	Branches   Counts
+	Functions  Counts
+}
+
+func (summary htmlSummary) add(other htmlSummary) htmlSummary {
+	return htmlSummary{
+		Statements: summary.Statements.add(other.Statements),
+		Branches:   summary.Branches.add(other.Branches),
+		Functions:  summary.Functions.add(other.Functions),
+	}
+}
+
+type htmlIndex struct {
+	Files []htmlSummary
+	Total htmlSummary
+}
+
+type htmlPage struct {
+	htmlSummary
+	Lines []htmlLine
+}
+
+type htmlLine struct {
+	Number   int
+	Code     string
+	Hits     string
+	Class    string
+	Branches string
+}
+
+var unsafePathCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func newHTMLPage(file *File) *htmlPage {
+	page := &htmlPage{
+		htmlSummary: htmlSummary{
+			Path:       file.Path,
+			Link:       strings.Trim(unsafePathCharacters.ReplaceAllString(file.Path, "_"), "_.") + ".html",
+			Statements: file.Statements(),
+			Branches:   file.Branches(),
+			Functions:  file.Functions(),
+		},
+	}
+
+	lineHits := file.lineHits()
+	branches := map[int][]string{}
+	for i, probe := range file.probes {
+		if probe.kind != branchProbe {
+			continue
+		}
+		mark := "+"
+		if file.hits[i] == 0 {
+			mark = "-"
+		}
+		branches[probe.line] = append(branches[probe.line], mark)
+	}
+
+	for i, code := range strings.Split(file.Source, "\n") {
+		line := htmlLine{
+			Number:   i + 1,
+			Code:     code,
+			Branches: strings.Join(branches[i+1], " "),
+		}
+		if hits, ok := lineHits[i+1]; ok {
+			line.Hits = fmt.Sprint(hits)
+			line.Class = "covered"
+			if hits == 0 {
+				line.Class = "uncovered"
+			}
+		}
+		if strings.Contains(line.Branches, "-") && line.Class != "uncovered" {
+			line.Class = "partial"
+		}
+		page.Lines = append(page.Lines, line)
+	}
+	return page
+}
+
+func writeTemplate(path string, tmpl *template.Template, data interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+const htmlStyle = `<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 2px 8px; text-align: left; }
+.source td { font-family: monospace; white-space: pre; padding: 0 8px; }
+.covered { background: #dfd; }
+.uncovered { background: #fdd; }
+.partial { background: #ffd; }
+</style>`
+
+var htmlFunctions = template.FuncMap{
+	"percent": func(counts Counts) string {
+		return fmt.Sprintf("%.1f%% (%d/%d)", counts.Percent(), counts.Covered, counts.Total)
+	},
+}
+
+var htmlIndexTemplate = template.Must(template.New("index").Funcs(htmlFunctions).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Extension coverage</title>` + htmlStyle + `</head>
+<body>
+<h1>Extension coverage</h1>
+<table>
+<tr><th>File</th><th>Statements</th><th>Branches</th><th>Functions</th></tr>
+{{range .Files}}<tr><td><a href="{{.Link}}">{{.Path}}</a></td><td>{{percent .Statements}}</td><td>{{percent .Branches}}</td><td>{{percent .Functions}}</td></tr>
+{{end}}<tr><th>Total</th><th>{{percent .Total.Statements}}</th><th>{{percent .Total.Branches}}</th><th>{{percent .Total.Functions}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+var htmlFileTemplate = template.Must(template.New("file").Funcs(htmlFunctions).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Path}}</title>` + htmlStyle + `</head>
+<body>
+<h1>{{.Path}}</h1>
+<p><a href="index.html">All files</a></p>
+<p>Statements: {{percent .Statements}}, branches: {{percent .Branches}}, functions: {{percent .Functions}}</p>
+<table class="source">
+<tr><th>Line</th><th>Hits</th><th>Branches</th><th>Code</th></tr>
+{{range .Lines}}<tr class="{{.Class}}"><td>{{.Number}}</td><td>{{.Hits}}</td><td>{{.Branches}}</td><td>{{.Code}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
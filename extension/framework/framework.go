@@ -21,11 +21,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
 	"sync/atomic"
 
 	"github.com/codegangsta/cli"
 
+	"github.com/cloudwan/gohan/extension/framework/coverage"
 	"github.com/cloudwan/gohan/extension/framework/runner"
 	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/singleton"
@@ -59,15 +61,46 @@ func TestExtensions(c *cli.Context) {
 		}
 	}
 
+	reports, err := parseReports(c.StringSlice("report"))
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	coverageDir := ""
+	if c.Bool("coverage") {
+		coverageDir = c.String("coverage-dir")
+	}
+
 	testFiles := getTestFiles(c.Args())
 
 	//logging from config is a limited printAllLogs option
-	returnCode := RunTests(testFiles, c.Bool("verbose") || config != nil, c.String("run-test"), c.Int("parallel"))
+	returnCode := RunTests(testFiles, c.Bool("verbose") || config != nil, c.String("run-test"), c.Int("parallel"), reports, coverageDir)
 	os.Exit(returnCode)
 }
 
+// parseReports parses report options given as format=path into a map from format to path
+func parseReports(options []string) (map[string]string, error) {
+	formats := runner.ReportFormats()
+	reports := map[string]string{}
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid report option '%s', expected format=path", option)
+		}
+		if !util.ContainsString(formats, parts[0]) {
+			return nil, fmt.Errorf("Unknown report format '%s', supported formats: %s", parts[0], strings.Join(formats, ", "))
+		}
+		reports[parts[0]] = parts[1]
+	}
+	return reports, nil
+}
+
 // RunTests runs extension tests for CLI.
-func RunTests(testFiles []string, printAllLogs bool, testFilter string, workers int) (returnCode int) {
+// Results are additionally written to reports given as a map from report format to file path.
+// When coverageDir is not empty, extensions are instrumented and their coverage is written
+// to the directory in lcov and HTML formats.
+func RunTests(testFiles []string, printAllLogs bool, testFilter string, workers int, reports map[string]string, coverageDir string) (returnCode int) {
 	if !printAllLogs {
 		l.SetUpBasicLogging(l.BufWritter{}, l.DefaultFormat)
 	}
@@ -76,16 +109,20 @@ func RunTests(testFiles []string, printAllLogs bool, testFilter string, workers
 		panic("Workers must be greater than 0")
 	}
 
+	// tests from all the files share one limit, files are only prepared by the workers
+	semaphore := make(chan struct{}, workers)
 	if len(testFiles) < workers {
 		workers = len(testFiles)
 	}
 
 	var (
-		maxIdx         = int64(len(testFiles) - 1)
-		idx      int64 = -1
-		errors         = make(map[string]runner.TestRunnerErrors)
-		errorsMu sync.Mutex
-		wg       sync.WaitGroup
+		maxIdx             = int64(len(testFiles) - 1)
+		idx          int64 = -1
+		errors             = make(map[string]runner.TestRunnerErrors)
+		results            = make([]*runner.TestFileResult, len(testFiles))
+		testCoverage *coverage.Coverage
+		errorsMu     sync.Mutex
+		wg           sync.WaitGroup
 	)
 
 	worker := func() {
@@ -96,10 +133,14 @@ func RunTests(testFiles []string, printAllLogs bool, testFilter string, workers
 			}
 
 			fileName := testFiles[i]
-			testErr := runner.NewTestRunner(fileName, printAllLogs, testFilter).Run()
+			testRunner := runner.NewTestRunner(fileName, printAllLogs, testFilter)
+			testRunner.SetCoverage(testCoverage)
+			testRunner.SetSemaphore(semaphore)
+			testErr := testRunner.Run()
 
 			errorsMu.Lock()
 			errors[fileName] = testErr
+			results[i] = testRunner.Result()
 			errorsMu.Unlock()
 
 			if err, ok := testErr[runner.GeneralError]; ok {
@@ -109,6 +150,10 @@ func RunTests(testFiles []string, printAllLogs bool, testFilter string, workers
 		wg.Done()
 	}
 
+	if coverageDir != "" {
+		testCoverage = coverage.NewCoverage()
+	}
+
 	// force goroutine local manager
 	singleton.SetScope(singleton.ScopeGLSSingleton)
 
@@ -122,12 +167,48 @@ func RunTests(testFiles []string, printAllLogs bool, testFilter string, workers
 	summary := makeSummary(errors)
 	printSummary(summary, printAllLogs)
 
+	for format, path := range reports {
+		if err := runner.WriteReport(format, path, results); err != nil {
+			log.Error(fmt.Sprintf("Failed to write %s report to %s: %v", format, path, err))
+			returnCode = 1
+		}
+	}
+
+	if testCoverage != nil {
+		if err := writeCoverage(testCoverage, coverageDir); err != nil {
+			log.Error(fmt.Sprintf("Failed to write coverage to %s: %v", coverageDir, err))
+			returnCode = 1
+		}
+	}
+
 	for _, err := range summary {
 		if err != nil {
 			return 1
 		}
 	}
-	return 0
+	return
+}
+
+func writeCoverage(testCoverage *coverage.Coverage, dir string) error {
+	if err := testCoverage.WriteHTML(dir); err != nil {
+		return err
+	}
+	lcov, err := os.Create(filepath.Join(dir, "lcov.info"))
+	if err != nil {
+		return err
+	}
+	if err := testCoverage.WriteLCOV(lcov); err != nil {
+		lcov.Close()
+		return err
+	}
+	if err := lcov.Close(); err != nil {
+		return err
+	}
+
+	statements, branches, functions := testCoverage.Total()
+	log.Notice("Coverage: statements %.1f%%, branches %.1f%%, functions %.1f%%, report written to %s",
+		statements.Percent(), branches.Percent(), functions.Percent(), dir)
+	return nil
 }
 
 func makeSummary(errors map[string]runner.TestRunnerErrors) (summary map[string]error) {
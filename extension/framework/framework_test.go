@@ -63,3 +63,20 @@ func TestGetTestFiles(t *testing.T) {
 
 	Expect(tests).To(ConsistOf(testFile1.Name(), testFile2.Name(), testFile3.Name()))
 }
+
+func TestParseReports(t *testing.T) {
+	RegisterTestingT(t)
+
+	reports, err := parseReports([]string{"junit=out/report.xml", "json=report=1.json"})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(reports).To(Equal(map[string]string{
+		"junit": "out/report.xml",
+		"json":  "report=1.json",
+	}))
+
+	_, err = parseReports([]string{"junit"})
+	Expect(err).To(MatchError(ContainSubstring("expected format=path")))
+
+	_, err = parseReports([]string{"html=report.html"})
+	Expect(err).To(MatchError(ContainSubstring("Unknown report format 'html'")))
+}
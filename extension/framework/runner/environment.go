@@ -16,6 +16,7 @@
 package runner
 
 import (
+	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -25,8 +26,10 @@ import (
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/extension/framework/coverage"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/sync/memory"
 	"github.com/cloudwan/gohan/sync/noop"
 	"github.com/xyproto/otto"
 
@@ -41,17 +44,26 @@ const (
 	pathVar           = "PATH"
 	schemasVar        = "SCHEMAS"
 	schemaIncludesVar = "SCHEMA_INCLUDES"
+	fixturesVar       = "FIXTURES"
 )
 
 // Environment of a single test runner
 type Environment struct {
 	*gohan_otto.Environment
 	mockedFunctions []string
+	realFunctions   map[string]otto.Value
+	fakeServers     []*fakeHTTPServer
+	fakeSync        *memory.Sync
 	schemaDir       string
 	testFileName    string
 	testSource      []byte
+	testName        string
+	snapshot        *fileSnapshot
+	dbCopy          *sql.DB
+	fixtures        map[string]map[string]interface{}
 	dbConnection    db.DB
 	dbTransactions  []transaction.Transaction
+	coverage        *coverage.Coverage
 }
 
 // NewEnvironment creates a new test environment based on provided DB connection
@@ -65,8 +77,66 @@ func NewEnvironment(testFileName string, testSource []byte) *Environment {
 	return env
 }
 
+// newTestEnvironment creates an environment for a single test initialized from the file snapshot,
+// each test uses a separate copy of the database
+func newTestEnvironment(snapshot *fileSnapshot, testName string) *Environment {
+	env := NewEnvironment(snapshot.testFileName, snapshot.testSource)
+	env.testName = testName
+	env.snapshot = snapshot
+	return env
+}
+
 // InitializeEnvironment creates new transaction for the test
 func (env *Environment) InitializeEnvironment() error {
+	err := env.initializeVM()
+	if err != nil {
+		return err
+	}
+
+	if env.snapshot != nil {
+		schema.SetManager(env.snapshot.manager.Clone())
+	} else if err = env.loadSchemaFiles(); err != nil {
+		return err
+	}
+
+	err = env.registerEnvironments()
+
+	if err != nil {
+		schema.ClearManager()
+		return fmt.Errorf("Failed to register environments for '%s': %s", env.testFileName, err)
+	}
+
+	err = env.loadExtensions()
+
+	if err != nil {
+		schema.ClearManager()
+		return fmt.Errorf("Failed to load extensions for '%s': %s", env.testFileName, err)
+	}
+
+	if env.snapshot != nil {
+		env.dbCopy, err = env.snapshot.copyDB(env.memoryDbConn())
+		env.fixtures = env.snapshot.fixtures
+	} else {
+		err = db.InitDBWithSchemas("sqlite3", env.memoryDbConn(), true, false, false)
+	}
+	if err != nil {
+		schema.ClearManager()
+		return fmt.Errorf("Failed to init DB: %s", err)
+	}
+
+	if env.snapshot == nil {
+		env.fixtures, err = env.loadFixtures()
+		if err != nil {
+			schema.ClearManager()
+			return fmt.Errorf("Failed to load fixtures for '%s': %s", env.testFileName, err)
+		}
+	}
+
+	return nil
+}
+
+// initializeVM connects to the test database and creates a VM with the test file loaded
+func (env *Environment) initializeVM() error {
 	var err error
 
 	env.dbConnection, err = newDBConnection(env.memoryDbConn())
@@ -81,8 +151,12 @@ func (env *Environment) InitializeEnvironment() error {
 	env.addTestingAPI()
 
 	env.Load(env.testFileName, string(env.testSource))
+	return nil
+}
 
-	err = env.loadSchemaIncludes()
+// loadSchemaFiles loads schema includes and schemas specified in the test file
+func (env *Environment) loadSchemaFiles() error {
+	err := env.loadSchemaIncludes()
 
 	if err != nil {
 		schema.ClearManager()
@@ -95,31 +169,13 @@ func (env *Environment) InitializeEnvironment() error {
 		schema.ClearManager()
 		return fmt.Errorf("Failed to load schemas for '%s': %s", env.testFileName, err)
 	}
-
-	err = env.registerEnvironments()
-
-	if err != nil {
-		schema.ClearManager()
-		return fmt.Errorf("Failed to register environments for '%s': %s", env.testFileName, err)
-	}
-
-	err = env.loadExtensions()
-
-	if err != nil {
-		schema.ClearManager()
-		return fmt.Errorf("Failed to load extensions for '%s': %s", env.testFileName, err)
-	}
-
-	err = db.InitDBWithSchemas("sqlite3", env.memoryDbConn(), true, false, false)
-	if err != nil {
-		schema.ClearManager()
-		return fmt.Errorf("Failed to init DB: %s", err)
-	}
-
 	return nil
 }
 
 func (env *Environment) memoryDbConn() string {
+	if env.testName != "" {
+		return fmt.Sprintf("file:%s:%s?mode=memory&cache=shared", env.testFileName, env.testName)
+	}
 	return fmt.Sprintf("file:%s?mode=memory&cache=shared", env.testFileName)
 }
 
@@ -129,11 +185,23 @@ func (env *Environment) ClearEnvironment() {
 		env.setToOtto(functionName, "requests", [][]otto.Value{})
 		env.setToOtto(functionName, "responses", []otto.Value{})
 	}
+	for _, server := range env.fakeServers {
+		server.close()
+	}
+	env.fakeServers = nil
+	if env.fakeSync != nil {
+		env.fakeSync.Close()
+		env.fakeSync = nil
+	}
 
 	for _, tx := range env.dbTransactions {
 		tx.Close()
 	}
 	env.Environment.ClearEnvironment()
+	if env.dbCopy != nil {
+		env.dbCopy.Close()
+		env.dbCopy = nil
+	}
 	schema.ClearManager()
 }
 
@@ -154,6 +222,16 @@ func (env *Environment) CheckAllMockCallsMade() error {
 	return nil
 }
 
+// CheckFakeServers check if fake HTTP servers received exactly the expected requests
+func (env *Environment) CheckFakeServers() error {
+	for _, server := range env.fakeServers {
+		if err := server.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func newDBConnection(dbfilename string) (db.DB, error) {
 	connection, err := db.ConnectDB("sqlite3", dbfilename, db.DefaultMaxOpenConn)
 	if err != nil {
@@ -220,6 +298,49 @@ func (env *Environment) addTestingAPI() {
 			authorizationValue, _ := call.Otto.ToValue(schema.NewAuthorization("", "", "", []string{}, []*schema.Catalog{}))
 			return authorizationValue
 		},
+		"Fixture": func(call otto.FunctionCall) otto.Value {
+			gohan_otto.VerifyCallArguments(&call, "Fixture", 1)
+			value, err := fixtureToOtto(call.Otto, env.fixtures, call.Argument(0).String())
+			if err != nil {
+				gohan_otto.ThrowOttoException(&call, "%s", err)
+			}
+			return value
+		},
+		"Replay": func(call otto.FunctionCall) otto.Value {
+			gohan_otto.VerifyCallArguments(&call, "Replay", 1)
+			if err := env.Replay(call.Otto, call.Argument(0)); err != nil {
+				panic(err)
+			}
+			return otto.NullValue()
+		},
+		"FakeHTTPServer": func(call otto.FunctionCall) otto.Value {
+			server := newFakeHTTPServer()
+			env.fakeServers = append(env.fakeServers, server)
+			env.restoreFunctions("gohan_http", "gohan_raw_http")
+			return server.toOtto(call.Otto)
+		},
+		"FakeSync": func(call otto.FunctionCall) otto.Value {
+			if env.fakeSync == nil {
+				fakeSync, err := memory.NewSync("")
+				if err != nil {
+					gohan_otto.ThrowOttoException(&call, "%s", err)
+				}
+				env.Environment.Sync.Close()
+				env.Environment.Sync = fakeSync
+				env.fakeSync = fakeSync
+				env.restoreFunctions("gohan_sync_fetch", "gohan_sync_delete", "gohan_sync_watch")
+			}
+			return newFakeSyncObject(call.Otto, env.fakeSync)
+		},
+		"FakeIdentity": func(call otto.FunctionCall) otto.Value {
+			gohan_otto.VerifyCallArguments(&call, "FakeIdentity", 1)
+			identity, err := newFakeIdentity(call.Argument(0))
+			if err != nil {
+				gohan_otto.ThrowOttoException(&call, "%s", err)
+			}
+			env.Environment.Identity = identity
+			return identity.toOtto(call.Otto)
+		},
 	}
 	for name, object := range builtins {
 		env.VM.Set(name, object)
@@ -227,6 +348,8 @@ func (env *Environment) addTestingAPI() {
 	// NOTE: There is no way to return error back to Otto after calling a Go
 	// function, so the following function has to be written in pure JavaScript.
 	env.VM.Otto.Run(`function GohanTrigger(event, context) { gohan_handle_event(event, context); }`)
+	env.mockedFunctions = []string{}
+	env.realFunctions = map[string]otto.Value{}
 	env.mockFunction("gohan_http")
 	env.mockFunction("gohan_raw_http")
 	env.mockFunction("gohan_db_transaction")
@@ -254,6 +377,9 @@ func (env *Environment) getTransaction(isNew bool, options *transaction.TxOption
 }
 
 func (env *Environment) mockFunction(functionName string) {
+	if function, err := env.VM.Get(functionName); err == nil && function.IsFunction() {
+		env.realFunctions[functionName] = function
+	}
 	env.VM.Set(functionName, func(call otto.FunctionCall) otto.Value {
 		responses := env.getFromOtto(functionName, "responses").([]otto.Value)
 		requests := env.getFromOtto(functionName, "requests").([][]otto.Value)
@@ -310,6 +436,24 @@ func (env *Environment) mockFunction(functionName string) {
 	env.mockedFunctions = append(env.mockedFunctions, functionName)
 }
 
+// restoreFunctions replaces mocks with the real functions, used when a fake backs them instead
+func (env *Environment) restoreFunctions(functionNames ...string) {
+	for _, functionName := range functionNames {
+		function, ok := env.realFunctions[functionName]
+		if !ok {
+			continue
+		}
+		env.VM.Set(functionName, function)
+		delete(env.realFunctions, functionName)
+		for i, mocked := range env.mockedFunctions {
+			if mocked == functionName {
+				env.mockedFunctions = append(env.mockedFunctions[:i], env.mockedFunctions[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
 func (env *Environment) checkSpecified(functionName string) error {
 	responses := env.getFromOtto(functionName, "responses").([]otto.Value)
 	requests := env.getFromOtto(functionName, "requests").([][]otto.Value)
@@ -419,6 +563,12 @@ func (env *Environment) loadSchemas() error {
 }
 
 func (env *Environment) schemaPath(s ...string) string {
+	if len(s) > 0 && strings.Contains(s[0], "://") {
+		return strings.Join(s, "/")
+	}
+	if len(s) > 0 && filepath.IsAbs(s[0]) {
+		return filepath.Join(s...)
+	}
 	s = append([]string{env.schemaDir}, s...)
 	return filepath.Join(s...)
 }
@@ -442,5 +592,38 @@ func (env *Environment) loadExtensions() error {
 	}
 	pathString, _ := pathValue.ToString()
 
-	return env.LoadExtensionsForPath(manager.Extensions, manager.TimeLimit, manager.TimeLimits, pathString)
+	extensions := manager.Extensions
+	if env.coverage != nil {
+		extensions, err = env.instrumentExtensions(extensions, pathString)
+		if err != nil {
+			return err
+		}
+	}
+	return env.LoadExtensionsForPath(extensions, manager.TimeLimit, manager.TimeLimits, pathString)
+}
+
+// instrumentExtensions returns copies of javascript extensions matching path with code instrumented for coverage
+func (env *Environment) instrumentExtensions(extensions []*schema.Extension, path string) ([]*schema.Extension, error) {
+	if err := env.coverage.SetUp(env.VM.Otto); err != nil {
+		return nil, err
+	}
+	instrumented := []*schema.Extension{}
+	for _, extension := range extensions {
+		if extension.CodeType != "javascript" || !extension.Match(path) {
+			continue
+		}
+		file := strings.TrimPrefix(extension.URL, "file://")
+		if file == "" {
+			file = extension.ID
+		}
+		code, err := env.coverage.Instrument(file, extension.Code)
+		if err != nil {
+			log.Warning("Failed to instrument extension %s for coverage: %s", extension.ID, err)
+			code = extension.Code
+		}
+		copied := *extension
+		copied.Code = code
+		instrumented = append(instrumented, &copied)
+	}
+	return instrumented, nil
 }
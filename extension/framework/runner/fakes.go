@@ -0,0 +1,385 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rackspace/gophercloud"
+	"github.com/xyproto/otto"
+
+	gohan_otto "github.com/cloudwan/gohan/extension/otto"
+	"github.com/cloudwan/gohan/schema"
+	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/sync/memory"
+)
+
+// fakeHTTPServer is a local HTTP server responding with responses scripted by a test
+type fakeHTTPServer struct {
+	server *httptest.Server
+
+	mu           sync.Mutex
+	expectations []*fakeHTTPExpectation
+	requests     []map[string]interface{}
+	unexpected   []string
+}
+
+type fakeHTTPExpectation struct {
+	method   string
+	path     string
+	body     interface{}
+	hasBody  bool
+	returned bool
+	called   bool
+
+	status          int
+	responseBody    interface{}
+	responseHeaders map[string]interface{}
+}
+
+func (expectation *fakeHTTPExpectation) String() string {
+	return expectation.method + " " + expectation.path
+}
+
+func newFakeHTTPServer() *fakeHTTPServer {
+	server := &fakeHTTPServer{}
+	server.server = httptest.NewServer(server)
+	return server
+}
+
+// ServeHTTP records the request and responds with the first matching expectation
+func (server *fakeHTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rawBody, _ := ioutil.ReadAll(r.Body)
+	var body interface{}
+	if len(rawBody) > 0 {
+		if err := json.Unmarshal(rawBody, &body); err != nil {
+			body = string(rawBody)
+		}
+	}
+	headers := map[string]interface{}{}
+	for key := range r.Header {
+		headers[key] = r.Header.Get(key)
+	}
+
+	server.mu.Lock()
+	server.requests = append(server.requests, map[string]interface{}{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"query":   r.URL.RawQuery,
+		"headers": headers,
+		"body":    body,
+	})
+	expectation := server.match(r, body)
+	if expectation == nil {
+		server.unexpected = append(server.unexpected, fmt.Sprintf("%s %s", r.Method, r.URL.RequestURI()))
+	}
+	server.mu.Unlock()
+
+	if expectation == nil {
+		http.Error(w, fmt.Sprintf("Unexpected request %s %s", r.Method, r.URL.RequestURI()), http.StatusInternalServerError)
+		return
+	}
+	for key, value := range expectation.responseHeaders {
+		w.Header().Set(key, fmt.Sprint(value))
+	}
+	responseBody, isString := expectation.responseBody.(string)
+	if !isString && expectation.responseBody != nil {
+		data, _ := json.Marshal(expectation.responseBody)
+		responseBody = string(data)
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+	w.WriteHeader(expectation.status)
+	w.Write([]byte(responseBody))
+}
+
+func (server *fakeHTTPServer) match(r *http.Request, body interface{}) *fakeHTTPExpectation {
+	for _, expectation := range server.expectations {
+		if expectation.called || !expectation.returned || expectation.method != r.Method {
+			continue
+		}
+		path := r.URL.Path
+		if strings.Contains(expectation.path, "?") {
+			path = r.URL.RequestURI()
+		}
+		if expectation.path != path {
+			continue
+		}
+		if expectation.hasBody && !reflect.DeepEqual(expectation.body, body) {
+			continue
+		}
+		expectation.called = true
+		return expectation
+	}
+	return nil
+}
+
+// check returns an error when requests were unexpected or expected requests were not made
+func (server *fakeHTTPServer) check() error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.unexpected) > 0 {
+		return fmt.Errorf("Unexpected request to fake HTTP server: %s", server.unexpected[0])
+	}
+	for _, expectation := range server.expectations {
+		if !expectation.returned {
+			return fmt.Errorf("Return() should be specified for each request expected by fake HTTP server")
+		}
+		if !expectation.called {
+			return fmt.Errorf("Expected request %s to fake HTTP server, but not made", expectation)
+		}
+	}
+	return nil
+}
+
+func (server *fakeHTTPServer) close() {
+	server.server.Close()
+}
+
+func (server *fakeHTTPServer) toOtto(vm *otto.Otto) otto.Value {
+	object, _ := vm.Object(`({})`)
+	object.Set("URL", func(call otto.FunctionCall) otto.Value {
+		value, _ := otto.ToValue(server.server.URL)
+		return value
+	})
+	object.Set("Expect", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) < 2 || len(call.ArgumentList) > 3 {
+			gohan_otto.ThrowOttoException(&call, "Expect() should be called with method, path and optional body")
+		}
+		expectation := &fakeHTTPExpectation{
+			method:  strings.ToUpper(call.Argument(0).String()),
+			path:    call.Argument(1).String(),
+			hasBody: len(call.ArgumentList) == 3,
+		}
+		if expectation.hasBody {
+			expectation.body = normalizeJSON(call.Argument(2))
+		}
+		server.mu.Lock()
+		server.expectations = append(server.expectations, expectation)
+		server.mu.Unlock()
+
+		response, _ := call.Otto.Object(`({})`)
+		response.Set("Return", func(call otto.FunctionCall) otto.Value {
+			if len(call.ArgumentList) < 1 || len(call.ArgumentList) > 3 {
+				gohan_otto.ThrowOttoException(&call, "Return() should be called with status, optional body and headers")
+			}
+			status, err := call.Argument(0).ToInteger()
+			if err != nil {
+				gohan_otto.ThrowOttoException(&call, "Invalid status: %s", err)
+			}
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			expectation.status = int(status)
+			if len(call.ArgumentList) > 1 {
+				expectation.responseBody = normalizeJSON(call.Argument(1))
+			}
+			if len(call.ArgumentList) > 2 {
+				expectation.responseHeaders, _ = normalizeJSON(call.Argument(2)).(map[string]interface{})
+			}
+			expectation.returned = true
+			return otto.NullValue()
+		})
+		return response.Value()
+	})
+	object.Set("Requests", func(call otto.FunctionCall) otto.Value {
+		server.mu.Lock()
+		requests := make([]interface{}, len(server.requests))
+		for i, request := range server.requests {
+			requests[i] = request
+		}
+		server.mu.Unlock()
+		value, _ := call.Otto.ToValue(requests)
+		return value
+	})
+	return object.Value()
+}
+
+// normalizeJSON converts otto value to plain JSON data types,
+// otto exports arrays to typed slices which can't be compared with decoded JSON
+func normalizeJSON(value otto.Value) interface{} {
+	exported, err := value.Export()
+	if err != nil {
+		return nil
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		return exported
+	}
+	var normalized interface{}
+	json.Unmarshal(data, &normalized)
+	return normalized
+}
+
+// newFakeSyncObject returns an object for setting and asserting contents of the in-memory sync
+func newFakeSyncObject(vm *otto.Otto, sync *memory.Sync) otto.Value {
+	object, _ := vm.Object(`({})`)
+	object.Set("Put", func(call otto.FunctionCall) otto.Value {
+		gohan_otto.VerifyCallArguments(&call, "Put", 2)
+		value, _ := call.Argument(1).Export()
+		jsonString, isString := value.(string)
+		if !isString {
+			data, _ := json.Marshal(normalizeJSON(call.Argument(1)))
+			jsonString = string(data)
+		}
+		if err := sync.Update(call.Argument(0).String(), jsonString); err != nil {
+			gohan_otto.ThrowOttoException(&call, "Failed to put to sync: %s", err)
+		}
+		return otto.NullValue()
+	})
+	object.Set("Get", func(call otto.FunctionCall) otto.Value {
+		gohan_otto.VerifyCallArguments(&call, "Get", 1)
+		node, err := sync.Fetch(call.Argument(0).String())
+		if err != nil {
+			return otto.NullValue()
+		}
+		value, _ := otto.ToValue(node.Value)
+		return value
+	})
+	object.Set("Keys", func(call otto.FunctionCall) otto.Value {
+		gohan_otto.VerifyCallArguments(&call, "Keys", 1)
+		keys := []string{}
+		if node, err := sync.Fetch(call.Argument(0).String()); err == nil {
+			keys = collectSyncKeys(node, keys)
+		}
+		sort.Strings(keys)
+		value, _ := call.Otto.ToValue(keys)
+		return value
+	})
+	object.Set("Delete", func(call otto.FunctionCall) otto.Value {
+		gohan_otto.VerifyCallArguments(&call, "Delete", 1)
+		if err := sync.Delete(call.Argument(0).String(), false); err != nil {
+			gohan_otto.ThrowOttoException(&call, "Failed to delete from sync: %s", err)
+		}
+		return otto.NullValue()
+	})
+	return object.Value()
+}
+
+func collectSyncKeys(node *gohan_sync.Node, keys []string) []string {
+	if node.Revision > 0 {
+		keys = append(keys, node.Key)
+	}
+	for _, child := range node.Children {
+		keys = collectSyncKeys(child, keys)
+	}
+	return keys
+}
+
+type fakeTenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type fakeUser struct {
+	UserID   string   `json:"user_id"`
+	UserName string   `json:"user_name"`
+	TenantID string   `json:"tenant_id"`
+	Roles    []string `json:"roles"`
+}
+
+// fakeIdentity is an identity service with tenants and tokens configured by a test
+type fakeIdentity struct {
+	Tenants      []fakeTenant        `json:"tenants"`
+	Tokens       map[string]fakeUser `json:"tokens"`
+	ServiceToken string              `json:"service_token"`
+}
+
+func newFakeIdentity(config otto.Value) (*fakeIdentity, error) {
+	identity := &fakeIdentity{}
+	data, err := json.Marshal(normalizeJSON(config))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, identity); err != nil {
+		return nil, fmt.Errorf("Invalid fake identity configuration: %s", err)
+	}
+	return identity, nil
+}
+
+// VerifyToken returns authorization of a configured token
+func (identity *fakeIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	user, ok := identity.Tokens[token]
+	if !ok {
+		return nil, fmt.Errorf("authentication error")
+	}
+	tenantName, _ := identity.GetTenantName(user.TenantID)
+	return schema.NewUserAuthorization(user.UserID, user.UserName, user.TenantID, tenantName, token, user.Roles, nil), nil
+}
+
+// GetTenantID maps the given tenant name to the tenant's ID
+func (identity *fakeIdentity) GetTenantID(tenantName string) (string, error) {
+	for _, tenant := range identity.Tenants {
+		if tenant.Name == tenantName {
+			return tenant.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// GetTenantName maps the given tenant ID to the tenant's name
+func (identity *fakeIdentity) GetTenantName(tenantID string) (string, error) {
+	for _, tenant := range identity.Tenants {
+		if tenant.ID == tenantID {
+			return tenant.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// GetServiceAuthorization returns authorization of the configured service token
+func (identity *fakeIdentity) GetServiceAuthorization() (schema.Authorization, error) {
+	return identity.VerifyToken(identity.ServiceToken)
+}
+
+// GetClient returns nil, the fake identity has no keystone client
+func (identity *fakeIdentity) GetClient() *gophercloud.ServiceClient {
+	return nil
+}
+
+func (identity *fakeIdentity) toOtto(vm *otto.Otto) otto.Value {
+	object, _ := vm.Object(`({})`)
+	object.Set("VerifyToken", func(call otto.FunctionCall) otto.Value {
+		gohan_otto.VerifyCallArguments(&call, "VerifyToken", 1)
+		auth, err := identity.VerifyToken(call.Argument(0).String())
+		if err != nil {
+			gohan_otto.ThrowOttoException(&call, "%s", err)
+		}
+		value, _ := call.Otto.ToValue(auth)
+		return value
+	})
+	object.Set("GetTenantID", func(call otto.FunctionCall) otto.Value {
+		gohan_otto.VerifyCallArguments(&call, "GetTenantID", 1)
+		tenantID, _ := identity.GetTenantID(call.Argument(0).String())
+		value, _ := otto.ToValue(tenantID)
+		return value
+	})
+	object.Set("GetTenantName", func(call otto.FunctionCall) otto.Value {
+		gohan_otto.VerifyCallArguments(&call, "GetTenantName", 1)
+		tenantName, _ := identity.GetTenantName(call.Argument(0).String())
+		value, _ := otto.ToValue(tenantName)
+		return value
+	})
+	return object.Value()
+}
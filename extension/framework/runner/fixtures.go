@@ -0,0 +1,190 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"fmt"
+
+	gohan_otto "github.com/cloudwan/gohan/extension/otto"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+	"github.com/twinj/uuid"
+	"github.com/xyproto/otto"
+)
+
+const (
+	// fixtureNameKey names a fixture, so it can be referenced by other fixtures and tests
+	fixtureNameKey = "_name"
+	// fixtureRefKey replaces an object by ID of the fixture with the given name
+	fixtureRefKey = "$ref"
+)
+
+type fixture struct {
+	name string
+	data map[string]interface{}
+}
+
+// loadFixtures creates resources from fixture files specified in the test file,
+// resources are created in order of schemas and named fixtures are returned
+func (env *Environment) loadFixtures() (map[string]map[string]interface{}, error) {
+	fixturesValue, err := env.VM.Get(fixturesVar)
+	if err != nil || fixturesValue.IsUndefined() {
+		return nil, nil
+	}
+	fixtureFilenames, err := gohan_otto.GetStringList(fixturesValue)
+	if err != nil {
+		return nil, fmt.Errorf("Bad type of %s - expected an array of strings but the type is %s",
+			fixturesVar, fixturesValue.Class())
+	}
+
+	manager := schema.GetManager()
+	schemas := manager.OrderedSchemas()
+	tables := map[string]*schema.Schema{}
+	for _, s := range schemas {
+		tables[s.GetDbTableName()] = s
+	}
+
+	fixtures := map[string][]*fixture{}
+	named := map[string]map[string]interface{}{}
+	for _, fixtureFilename := range fixtureFilenames {
+		data, err := util.LoadMap(env.schemaPath(fixtureFilename))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load fixtures from '%s': %s", fixtureFilename, err)
+		}
+		for table, rawResources := range data {
+			s, ok := tables[table]
+			if !ok {
+				return nil, fmt.Errorf("Unknown table '%s' in fixtures '%s'", table, fixtureFilename)
+			}
+			resources, ok := rawResources.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Table '%s' in fixtures '%s' should be a list of resources", table, fixtureFilename)
+			}
+			for _, rawResource := range resources {
+				resource, ok := rawResource.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("Resource in table '%s' in fixtures '%s' should be an object", table, fixtureFilename)
+				}
+				f, err := newFixture(resource)
+				if err != nil {
+					return nil, err
+				}
+				if f.name != "" {
+					if _, ok := named[f.name]; ok {
+						return nil, fmt.Errorf("Duplicate fixture name '%s'", f.name)
+					}
+					named[f.name] = f.data
+				}
+				fixtures[s.ID] = append(fixtures[s.ID], f)
+			}
+		}
+	}
+
+	tx, err := env.dbConnection.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+	for _, s := range schemas {
+		for _, f := range fixtures[s.ID] {
+			data, err := resolveFixtureRefs(f.data, named)
+			if err != nil {
+				return nil, err
+			}
+			resource, err := manager.LoadResource(s.ID, data.(map[string]interface{}))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid fixture of %s: %s", s.ID, err)
+			}
+			resource.PopulateDefaults()
+			if err = tx.Create(resource); err != nil {
+				return nil, fmt.Errorf("Failed to create fixture of %s: %s", s.ID, err)
+			}
+			if f.name != "" {
+				named[f.name] = resource.Data()
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return named, nil
+}
+
+// newFixture returns a fixture of the resource without its name, named fixtures get an ID
+// if they have none, so they can be referenced
+func newFixture(resource map[string]interface{}) (*fixture, error) {
+	f := &fixture{data: map[string]interface{}{}}
+	for key, value := range resource {
+		if key != fixtureNameKey {
+			f.data[key] = value
+			continue
+		}
+		name, ok := value.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("Fixture name should be a non-empty string, got %v", value)
+		}
+		f.name = name
+	}
+	if _, ok := f.data["id"]; !ok && f.name != "" {
+		f.data["id"] = uuid.NewV4().String()
+	}
+	return f, nil
+}
+
+// resolveFixtureRefs returns a copy of the value with references replaced by IDs of referenced fixtures
+func resolveFixtureRefs(value interface{}, named map[string]map[string]interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := value[fixtureRefKey]; ok && len(value) == 1 {
+			name, _ := ref.(string)
+			referenced, ok := named[name]
+			if !ok {
+				return nil, fmt.Errorf("Reference to unknown fixture '%v'", ref)
+			}
+			return referenced["id"], nil
+		}
+		resolved := map[string]interface{}{}
+		for key, item := range value {
+			resolvedItem, err := resolveFixtureRefs(item, named)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = resolvedItem
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(value))
+		for i, item := range value {
+			resolvedItem, err := resolveFixtureRefs(item, named)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = resolvedItem
+		}
+		return resolved, nil
+	}
+	return value, nil
+}
+
+// fixtureToOtto returns a named fixture as a new javascript object, so changes made by a test
+// are not visible in other tests
+func fixtureToOtto(vm *otto.Otto, fixtures map[string]map[string]interface{}, name string) (otto.Value, error) {
+	data, ok := fixtures[name]
+	if !ok {
+		return otto.NullValue(), fmt.Errorf("Unknown fixture '%s'", name)
+	}
+	return jsonToOtto(vm, data)
+}
@@ -0,0 +1,209 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/xyproto/otto"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	gohan_otto "github.com/cloudwan/gohan/extension/otto"
+	"github.com/cloudwan/gohan/extension/recording"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+)
+
+// authorizationKeys are context keys of authorizations, which are recorded by tenant and roles only
+var authorizationKeys = []string{"auth", "service_auth"}
+
+// replay triggers events of a recorded request and serves calls to recorded builtins from the recording
+type replay struct {
+	env       *Environment
+	recording *recording.Recording
+	next      int
+}
+
+// Replay runs the recording given as a javascript object, failing the test when extensions
+// make different calls or leave different contexts than recorded
+func (env *Environment) Replay(vm *otto.Otto, value otto.Value) error {
+	rec := &recording.Recording{}
+	data, err := json.Marshal(normalizeJSON(value))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return fmt.Errorf("Invalid recording: %s", err)
+	}
+
+	r := &replay{env: env, recording: rec}
+	if err := r.setUp(vm); err != nil {
+		return err
+	}
+	for _, event := range rec.Events {
+		if err := r.trigger(vm, event); err != nil {
+			return err
+		}
+	}
+	if r.next < len(rec.Calls) {
+		recorded := rec.Calls[r.next]
+		return fmt.Errorf("Expected call to %s(%v) as recorded, but not made", recorded.Function, recorded.Arguments)
+	}
+	return nil
+}
+
+// setUp replaces all recorded builtins by functions serving calls from the recording
+func (r *replay) setUp(vm *otto.Otto) error {
+	value, err := vm.Run(`Object.keys(this)`)
+	if err != nil {
+		return err
+	}
+	globals, err := gohan_otto.GetStringList(value)
+	if err != nil {
+		return err
+	}
+	for _, name := range globals {
+		if recording.IsRecorded(name) {
+			r.env.restoreFunctions(name)
+			vm.Set(name, r.replayFunction(name))
+		}
+	}
+	return nil
+}
+
+func (r *replay) replayFunction(name string) func(otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		arguments := make([]interface{}, len(call.ArgumentList))
+		for i, argument := range call.ArgumentList {
+			arguments[i] = recordedData(gohan_otto.ConvertOttoToGo(argument))
+		}
+		if r.next >= len(r.recording.Calls) {
+			fail(call, "Unexpected call to %s(%v), all recorded calls were made", name, arguments)
+		}
+		recorded := r.recording.Calls[r.next]
+		r.next++
+		if recorded.Function != name {
+			fail(call, "Unexpected call to %s(%v), expected %s(%v) as recorded",
+				name, arguments, recorded.Function, recorded.Arguments)
+		}
+		if !reflect.DeepEqual(arguments, recordedData(recorded.Arguments)) {
+			fail(call, "Wrong arguments for call %s(%v), recorded %v",
+				name, arguments, recorded.Arguments)
+		}
+		if recorded.Error != "" {
+			gohan_otto.ThrowOttoException(&call, "%s", recorded.Error)
+		}
+		if name == "gohan_db_transaction" {
+			// transactions are not recorded, calls made with them are served from the recording
+			tx, err := r.env.getTransaction(true, &transaction.TxOptions{IsolationLevel: transaction.RepeatableRead})
+			if err != nil {
+				gohan_otto.ThrowOttoException(&call, "%s", err)
+			}
+			value, _ := call.Otto.ToValue(tx)
+			return value
+		}
+		value, err := jsonToOtto(call.Otto, recorded.Result)
+		if err != nil {
+			gohan_otto.ThrowOttoException(&call, "%s", err)
+		}
+		return value
+	}
+}
+
+// trigger handles the event with the recorded context and compares the resulting context with the recording
+func (r *replay) trigger(vm *otto.Otto, event *recording.Event) error {
+	context, err := jsonToOtto(vm, event.ContextIn)
+	if err != nil {
+		return err
+	}
+	for _, key := range authorizationKeys {
+		if auth, ok := event.ContextIn[key].(map[string]interface{}); ok {
+			context.Object().Set(key, recordedAuthorization(auth))
+		}
+	}
+
+	_, err = vm.Call("GohanTrigger", nil, event.Event, context)
+	if err != nil && event.Error == "" {
+		return fmt.Errorf("Event %s failed: %s, but it succeeded when recorded", event.Event, err)
+	}
+	if err == nil && event.Error != "" {
+		return fmt.Errorf("Event %s succeeded, but it failed when recorded: %s", event.Event, event.Error)
+	}
+
+	contextOut, _ := recordedData(gohan_otto.ConvertOttoToGo(context)).(map[string]interface{})
+	recordedOut, _ := recordedData(event.ContextOut).(map[string]interface{})
+	keys := []string{}
+	for key := range contextOut {
+		keys = append(keys, key)
+	}
+	for key := range recordedOut {
+		if _, ok := contextOut[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if util.ContainsString(authorizationKeys, key) {
+			continue
+		}
+		if !reflect.DeepEqual(contextOut[key], recordedOut[key]) {
+			return fmt.Errorf("Context key '%s' after %s differs from recording: got %v, recorded %v",
+				key, event.Event, contextOut[key], recordedOut[key])
+		}
+	}
+	return nil
+}
+
+// fail fails the test, recorded arguments may contain formatting verbs so the message is not used as a format
+func fail(call otto.FunctionCall, format string, args ...interface{}) {
+	call.Otto.Call("Fail", nil, "%s", fmt.Sprintf(format, args...))
+}
+
+// recordedData converts the value to the form it has in a recording file
+func recordedData(value interface{}) interface{} {
+	data, err := json.Marshal(recording.Sanitize(value))
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	json.Unmarshal(data, &decoded)
+	return decoded
+}
+
+func recordedAuthorization(auth map[string]interface{}) schema.Authorization {
+	tenantID, _ := auth["tenant_id"].(string)
+	tenantName, _ := auth["tenant_name"].(string)
+	roles := []string{}
+	rawRoles, _ := auth["roles"].([]interface{})
+	for _, role := range rawRoles {
+		if name, ok := role.(string); ok {
+			roles = append(roles, name)
+		}
+	}
+	return schema.NewAuthorization(tenantID, tenantName, "", roles, nil)
+}
+
+// jsonToOtto returns JSON data as a new javascript value
+func jsonToOtto(vm *otto.Otto, data interface{}) (otto.Value, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return otto.NullValue(), err
+	}
+	return vm.Call("JSON.parse", nil, string(encoded))
+}
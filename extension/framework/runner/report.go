@@ -0,0 +1,267 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// TestResult is a result of a single extension test
+type TestResult struct {
+	Name          string
+	File          string
+	Duration      time.Duration
+	Failure       error
+	SetUpError    error
+	TearDownError error
+	Logs          string
+}
+
+// Passed returns true when the test and its setUp and tearDown succeeded
+func (result *TestResult) Passed() bool {
+	return result.Failure == nil && result.SetUpError == nil && result.TearDownError == nil
+}
+
+// TestFileResult is a result of running extension tests from a single file,
+// Error is set when the file could not be run
+type TestFileResult struct {
+	File     string
+	Duration time.Duration
+	Error    error
+	Tests    []*TestResult
+}
+
+var reportWriters = map[string]func(io.Writer, []*TestFileResult) error{
+	"junit": WriteJUnitReport,
+	"json":  WriteJSONReport,
+}
+
+// ReportFormats returns names of supported report formats
+func ReportFormats() []string {
+	formats := []string{}
+	for format := range reportWriters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// WriteReport writes results to a file at path in a given format
+func WriteReport(format, path string, results []*TestFileResult) error {
+	write, ok := reportWriters[format]
+	if !ok {
+		return fmt.Errorf("Unknown report format '%s'", format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file, results); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string          `xml:"name,attr"`
+	ClassName string          `xml:"classname,attr"`
+	File      string          `xml:"file,attr"`
+	Time      string          `xml:"time,attr"`
+	Failure   *junitProblem   `xml:"failure,omitempty"`
+	Errors    []*junitProblem `xml:"error,omitempty"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func newJUnitProblem(problemType string, err error) *junitProblem {
+	return &junitProblem{
+		Type:    problemType,
+		Message: err.Error(),
+		Body:    err.Error(),
+	}
+}
+
+func junitTime(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+// WriteJUnitReport writes results in JUnit XML format, one test suite per file.
+// Test failures are reported as failures, setUp and tearDown errors as errors
+// and errors preventing the file from running as an error of a test case named after the file.
+func WriteJUnitReport(w io.Writer, results []*TestFileResult) error {
+	report := &junitTestSuites{}
+	var duration time.Duration
+	for _, fileResult := range results {
+		suite := &junitTestSuite{
+			Name: fileResult.File,
+			Time: junitTime(fileResult.Duration),
+		}
+		for _, result := range fileResult.Tests {
+			testCase := &junitTestCase{
+				Name:      result.Name,
+				ClassName: result.File,
+				File:      result.File,
+				Time:      junitTime(result.Duration),
+				SystemOut: result.Logs,
+			}
+			if result.SetUpError != nil {
+				testCase.Errors = append(testCase.Errors, newJUnitProblem("setUp", result.SetUpError))
+			}
+			if result.TearDownError != nil {
+				testCase.Errors = append(testCase.Errors, newJUnitProblem("tearDown", result.TearDownError))
+			}
+			if result.Failure != nil {
+				testCase.Failure = newJUnitProblem("failure", result.Failure)
+				suite.Failures++
+			} else if len(testCase.Errors) > 0 {
+				suite.Errors++
+			}
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+		if fileResult.Error != nil {
+			suite.TestCases = append(suite.TestCases, &junitTestCase{
+				Name:      fileResult.File,
+				ClassName: fileResult.File,
+				File:      fileResult.File,
+				Time:      junitTime(0),
+				Errors:    []*junitProblem{newJUnitProblem("error", fileResult.Error)},
+			})
+			suite.Errors++
+		}
+		suite.Tests = len(suite.TestCases)
+
+		report.Suites = append(report.Suites, suite)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		duration += fileResult.Duration
+	}
+	report.Time = junitTime(duration)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonReport struct {
+	Tests  int               `json:"tests"`
+	Passed int               `json:"passed"`
+	Failed int               `json:"failed"`
+	Errors int               `json:"errors"`
+	Files  []*jsonFileReport `json:"files"`
+}
+
+type jsonFileReport struct {
+	File     string            `json:"file"`
+	Duration float64           `json:"duration"`
+	Error    string            `json:"error,omitempty"`
+	Tests    []*jsonTestReport `json:"tests"`
+}
+
+type jsonTestReport struct {
+	Name          string  `json:"name"`
+	File          string  `json:"file"`
+	Duration      float64 `json:"duration"`
+	Passed        bool    `json:"passed"`
+	Failure       string  `json:"failure,omitempty"`
+	SetUpError    string  `json:"setup_error,omitempty"`
+	TearDownError string  `json:"teardown_error,omitempty"`
+	Logs          string  `json:"logs,omitempty"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// WriteJSONReport writes results as a JSON document, durations are given in seconds
+// and errors counts files which could not be run
+func WriteJSONReport(w io.Writer, results []*TestFileResult) error {
+	report := &jsonReport{Files: []*jsonFileReport{}}
+	for _, fileResult := range results {
+		fileReport := &jsonFileReport{
+			File:     fileResult.File,
+			Duration: fileResult.Duration.Seconds(),
+			Error:    errorString(fileResult.Error),
+			Tests:    []*jsonTestReport{},
+		}
+		for _, result := range fileResult.Tests {
+			fileReport.Tests = append(fileReport.Tests, &jsonTestReport{
+				Name:          result.Name,
+				File:          result.File,
+				Duration:      result.Duration.Seconds(),
+				Passed:        result.Passed(),
+				Failure:       errorString(result.Failure),
+				SetUpError:    errorString(result.SetUpError),
+				TearDownError: errorString(result.TearDownError),
+				Logs:          result.Logs,
+			})
+			report.Tests++
+			if result.Passed() {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+		}
+		if fileResult.Error != nil {
+			report.Errors++
+		}
+		report.Files = append(report.Files, fileReport)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
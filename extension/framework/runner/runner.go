@@ -16,10 +16,12 @@
 package runner
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"regexp"
+	"sync"
 
 	"github.com/xyproto/otto"
 	"github.com/xyproto/otto/ast"
@@ -27,7 +29,10 @@ import (
 
 	"time"
 
+	"github.com/cloudwan/gohan/extension/framework/coverage"
 	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/singleton"
+	"github.com/tylerb/gls"
 )
 
 const (
@@ -43,6 +48,10 @@ type TestRunner struct {
 
 	setUp    bool
 	tearDown bool
+
+	result    *TestFileResult
+	coverage  *coverage.Coverage
+	semaphore chan struct{}
 }
 
 // TestRunnerErrors map[testFunction]error
@@ -62,11 +71,48 @@ func NewTestRunner(testFileName string, printAllLogs bool, testFilter string) *T
 		testFileName: testFileName,
 		printAllLogs: printAllLogs,
 		testFilter:   regexp.MustCompile(testFilter),
+		semaphore:    make(chan struct{}, 1),
+	}
+}
+
+// SetParallel sets the number of tests from the file run at once. Tests are run in parallel
+// only with goroutine local singletons, otherwise they would share the schema manager.
+func (runner *TestRunner) SetParallel(parallel int) {
+	if parallel < 1 {
+		parallel = 1
 	}
+	runner.semaphore = make(chan struct{}, parallel)
+}
+
+// SetSemaphore makes the runner take a slot of the given semaphore for each test,
+// so runners sharing the semaphore run at most its capacity of tests at once in total.
+func (runner *TestRunner) SetSemaphore(semaphore chan struct{}) {
+	runner.semaphore = semaphore
+}
+
+// SetCoverage makes the runner instrument loaded extensions and collect their coverage
+func (runner *TestRunner) SetCoverage(coverage *coverage.Coverage) {
+	runner.coverage = coverage
 }
 
 // Run performs extension tests from the file specified at runner's creation
 func (runner *TestRunner) Run() TestRunnerErrors {
+	runner.result = &TestFileResult{File: runner.testFileName}
+	start := time.Now()
+	errors := runner.run()
+	runner.result.Duration = time.Since(start)
+	if err, ok := errors[GeneralError]; ok {
+		runner.result.Error = err
+	}
+	return errors
+}
+
+// Result returns detailed results of the last Run
+func (runner *TestRunner) Result() *TestFileResult {
+	return runner.result
+}
+
+func (runner *TestRunner) run() TestRunnerErrors {
 	src, err := ioutil.ReadFile(runner.testFileName)
 	if err != nil {
 		return generalError(fmt.Errorf("Failed to read file '%s': %s", runner.testFileName, err.Error()))
@@ -91,25 +137,65 @@ func (runner *TestRunner) Run() TestRunnerErrors {
 		}
 	}
 
-	env := NewEnvironment(runner.testFileName, src)
+	if len(tests) == 0 {
+		return TestRunnerErrors{}
+	}
 
-	errors := TestRunnerErrors{}
-	for _, test := range tests {
-		errors[test] = runner.runTest(test, env)
+	snapshot, err := newFileSnapshot(runner.testFileName, src)
+	if err != nil {
+		return generalError(err)
+	}
+	defer snapshot.close()
+
+	semaphore := runner.semaphore
+	if singleton.GetScope() != singleton.ScopeGLSSingleton {
+		semaphore = make(chan struct{}, 1)
+	}
+
+	var (
+		testErrors = make([]error, len(tests))
+		wg         sync.WaitGroup
+	)
+	for i, test := range tests {
+		result := &TestResult{Name: test, File: runner.testFileName}
+		runner.result.Tests = append(runner.result.Tests, result)
+
+		semaphore <- struct{}{}
+		wg.Add(1)
+		// each test runs in a new goroutine, so it gets its own goroutine local
+		// schema manager and log buffer
+		go func(i int, test string, result *TestResult) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			defer gls.Cleanup()
 
-		if !runner.printAllLogs {
-			w := l.BufWritter{}
-			if errors[test] != nil {
-				w.Dump(os.Stderr)
+			env := newTestEnvironment(snapshot, test)
+			env.coverage = runner.coverage
+			testErrors[i] = runner.runTest(test, env, result)
+
+			if !runner.printAllLogs {
+				w := l.BufWritter{}
+				logs := &bytes.Buffer{}
+				w.Dump(logs)
+				result.Logs = logs.String()
+				if testErrors[i] != nil {
+					logs.WriteTo(os.Stderr)
+				}
+				w.Reset()
 			}
-			w.Reset()
-		}
+		}(i, test, result)
+	}
+	wg.Wait()
 
-		if _, ok := errors[test].(metaError); ok {
-			return generalError(errors[test])
+	errors := TestRunnerErrors{}
+	for i, test := range tests {
+		if _, ok := testErrors[i].(metaError); ok {
+			return generalError(testErrors[i])
 		}
+		errors[test] = testErrors[i]
 	}
-
 	return errors
 }
 
@@ -119,8 +205,10 @@ func generalError(err error) TestRunnerErrors {
 	}
 }
 
-func (runner *TestRunner) runTest(testName string, env *Environment) (err error) {
+func (runner *TestRunner) runTest(testName string, env *Environment, result *TestResult) (err error) {
+	start := time.Now()
 	defer func() {
+		result.Duration = time.Since(start)
 		runner.printTestResult(testName, err)
 	}()
 
@@ -133,6 +221,7 @@ func (runner *TestRunner) runTest(testName string, env *Environment) (err error)
 	if runner.setUp {
 		_, err = env.VM.Call("setUp", nil)
 		if err != nil {
+			result.SetUpError = err
 			return
 		}
 	}
@@ -144,12 +233,14 @@ func (runner *TestRunner) runTest(testName string, env *Environment) (err error)
 			} else {
 				err = fmt.Errorf("%v", failed)
 			}
+			result.Failure = err
 		}
 	}()
 
 	if runner.tearDown {
 		defer func() {
 			_, tearDownError := env.VM.Call("tearDown", nil)
+			result.TearDownError = tearDownError
 			if tearDownError != nil && err == nil {
 				err = tearDownError
 			}
@@ -170,6 +261,11 @@ func (runner *TestRunner) runTest(testName string, env *Environment) (err error)
 	if err == nil {
 		err = mockError
 	}
+	fakeError := env.CheckFakeServers()
+	if err == nil {
+		err = fakeError
+	}
+	result.Failure = err
 	return
 }
 
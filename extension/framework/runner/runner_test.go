@@ -16,7 +16,16 @@
 package runner_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudwan/gohan/extension/framework/coverage"
 	"github.com/cloudwan/gohan/extension/framework/runner"
+	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/singleton"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -349,6 +358,69 @@ var _ = Describe("Runner", func() {
 			})
 		})
 
+		Context("When using fakes", func() {
+			BeforeEach(func() {
+				testFile = "./test_data/fakes.js"
+			})
+
+			It("Should work", func() {
+				Expect(errors).To(HaveLen(5))
+				Expect(errors).To(HaveKeyWithValue("testFakeHTTPServer", BeNil()))
+				Expect(errors).To(HaveKeyWithValue(
+					"testFakeHTTPServerUnexpectedRequest", MatchError("Unexpected request to fake HTTP server: DELETE /v2.0/ports/p1")))
+				Expect(errors).To(HaveKeyWithValue(
+					"testFakeHTTPServerRequestNotMade", MatchError("Expected request GET /v2.0/ports to fake HTTP server, but not made")))
+				Expect(errors).To(HaveKeyWithValue("testFakeSync", BeNil()))
+				Expect(errors).To(HaveKeyWithValue(
+					"testFakeIdentity", MatchError(ContainSubstring("authentication error"))))
+			})
+		})
+
+		Context("When using fixtures", func() {
+			BeforeEach(func() {
+				testFile = "./test_data/fixtures.js"
+			})
+
+			It("Should work", func() {
+				Expect(errors).To(HaveLen(4))
+				Expect(errors).To(HaveKeyWithValue("testFixturesLoaded", BeNil()))
+				Expect(errors).To(HaveKeyWithValue("testFixturesRestored", BeNil()))
+				Expect(errors).To(HaveKeyWithValue("testFixturesRestoredAfterDelete", BeNil()))
+				Expect(errors).To(HaveKeyWithValue(
+					"testUnknownFixture", MatchError(ContainSubstring("Unknown fixture 'unknown'"))))
+			})
+		})
+
+		Context("When a fixture references an unknown fixture", func() {
+			BeforeEach(func() {
+				testFile = "./test_data/fixtures_unknown_ref.js"
+			})
+
+			It("Should return an error", func() {
+				Expect(errors).To(HaveLen(1))
+				Expect(errors).To(HaveKeyWithValue(
+					runner.GeneralError, MatchError(ContainSubstring("Reference to unknown fixture 'tenant1'"))))
+			})
+		})
+
+		Context("When replaying recordings", func() {
+			BeforeEach(func() {
+				testFile = "./test_data/replay.js"
+			})
+
+			It("Should work", func() {
+				Expect(errors).To(HaveLen(5))
+				Expect(errors).To(HaveKeyWithValue("testReplay", BeNil()))
+				Expect(errors).To(HaveKeyWithValue(
+					"testReplayWrongArguments", MatchError(ContainSubstring("Wrong arguments for call gohan_http"))))
+				Expect(errors).To(HaveKeyWithValue(
+					"testReplayDifferentContext", MatchError("Context key 'quota' after pre_create differs from recording: got 10, recorded 5")))
+				Expect(errors).To(HaveKeyWithValue(
+					"testReplayCallNotMade", MatchError("Expected call to gohan_uuid([]) as recorded, but not made")))
+				Expect(errors).To(HaveKeyWithValue("testReplayRecordedError", BeNil()))
+			})
+		})
+
 		Context("When using Gohan builtins", func() {
 			BeforeEach(func() {
 				testFile = "./test_data/gohan_builtins.js"
@@ -441,3 +513,251 @@ var _ = Describe("Runner", func() {
 		})
 	})
 })
+
+var _ = Describe("Isolation", func() {
+	const testFile = "./test_data/isolation.js"
+
+	It("Should run tests on separate databases", func() {
+		errors := runner.NewTestRunner(testFile, true, "").Run()
+		Expect(errors).To(HaveLen(4))
+		for _, err := range errors {
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	Context("When running tests in parallel", func() {
+		BeforeEach(func() {
+			singleton.SetScope(singleton.ScopeGLSSingleton)
+		})
+
+		AfterEach(func() {
+			singleton.SetScope(singleton.ScopeSingleton)
+		})
+
+		It("Should run tests on separate databases", func() {
+			theRunner := runner.NewTestRunner(testFile, true, "")
+			theRunner.SetParallel(4)
+			errors := theRunner.Run()
+			Expect(errors).To(HaveLen(4))
+			for _, err := range errors {
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(theRunner.Result().Tests).To(HaveLen(4))
+			Expect(theRunner.Result().Tests[0].Name).To(Equal("testIsolated1"))
+		})
+
+		It("Should wait for a slot of the shared semaphore", func() {
+			semaphore := make(chan struct{}, 1)
+			semaphore <- struct{}{}
+			theRunner := runner.NewTestRunner(testFile, true, "")
+			theRunner.SetSemaphore(semaphore)
+
+			done := make(chan runner.TestRunnerErrors, 1)
+			go func() {
+				done <- theRunner.Run()
+			}()
+			Consistently(done, "200ms").ShouldNot(Receive())
+
+			<-semaphore
+			var errors runner.TestRunnerErrors
+			Eventually(done, "10s").Should(Receive(&errors))
+			Expect(errors).To(HaveLen(4))
+			for _, err := range errors {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	})
+})
+
+var _ = Describe("Coverage", func() {
+	It("Should collect coverage of loaded extensions", func() {
+		testCoverage := coverage.NewCoverage()
+		theRunner := runner.NewTestRunner("./test_data/extension_loading.js", true, "")
+		theRunner.SetCoverage(testCoverage)
+		errors := theRunner.Run()
+		Expect(errors).To(HaveKeyWithValue("testExtension1Loaded", BeNil()))
+		Expect(errors).To(HaveKeyWithValue("testExtension2NotLoaded", BeNil()))
+
+		files := testCoverage.Files()
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].Path).To(HaveSuffix("extension1.js"))
+		Expect(files[0].Functions().Covered).To(Equal(1))
+		Expect(files[0].Functions().Total).To(BeNumerically(">", 1))
+		Expect(files[0].Statements().Covered).To(BeNumerically(">", 0))
+	})
+})
+
+var _ = Describe("Reports", func() {
+	Describe("Collecting results", func() {
+		It("Should record setUp errors", func() {
+			theRunner := runner.NewTestRunner("./test_data/set_up_error.js", true, "")
+			theRunner.Run()
+
+			result := theRunner.Result()
+			Expect(result.File).To(Equal("./test_data/set_up_error.js"))
+			Expect(result.Error).ToNot(HaveOccurred())
+			Expect(result.Tests).To(HaveLen(1))
+			Expect(result.Tests[0].Name).To(Equal("testSetUpError"))
+			Expect(result.Tests[0].File).To(Equal("./test_data/set_up_error.js"))
+			Expect(result.Tests[0].SetUpError).To(MatchError(ContainSubstring("setUp")))
+			Expect(result.Tests[0].Failure).ToNot(HaveOccurred())
+			Expect(result.Tests[0].Passed()).To(BeFalse())
+		})
+
+		It("Should record tearDown errors separately from failures", func() {
+			theRunner := runner.NewTestRunner("./test_data/tear_down_error_after_error.js", true, "")
+			theRunner.Run()
+
+			result := theRunner.Result()
+			Expect(result.Tests).To(HaveLen(1))
+			Expect(result.Tests[0].Failure).To(MatchError(ContainSubstring("original")))
+			Expect(result.Tests[0].TearDownError).To(MatchError(ContainSubstring("tearDown")))
+			Expect(result.Tests[0].Duration).To(BeNumerically(">", 0))
+		})
+
+		It("Should record general errors", func() {
+			theRunner := runner.NewTestRunner("./test_data/nonexising_file.js", true, "")
+			theRunner.Run()
+
+			result := theRunner.Result()
+			Expect(result.Error).To(MatchError(ContainSubstring("no such file")))
+			Expect(result.Tests).To(BeEmpty())
+		})
+
+		Context("When logs are buffered", func() {
+			BeforeEach(func() {
+				l.SetUpBasicLogging(l.BufWritter{}, l.DefaultFormat)
+			})
+
+			AfterEach(func() {
+				l.SetUpBasicLogging(os.Stderr, l.DefaultFormat)
+			})
+
+			It("Should capture logs of each test", func() {
+				theRunner := runner.NewTestRunner("./test_data/fail.js", false, "")
+				theRunner.Run()
+
+				result := theRunner.Result()
+				Expect(result.Tests).To(HaveLen(2))
+				Expect(result.Tests[0].Logs).To(ContainSubstring("FAIL (./test_data/fail.js:testFail)"))
+				Expect(result.Tests[0].Logs).ToNot(ContainSubstring("testFailNoMessage"))
+				Expect(result.Tests[1].Logs).To(ContainSubstring("FAIL (./test_data/fail.js:testFailNoMessage)"))
+			})
+		})
+	})
+
+	Describe("Writing reports", func() {
+		var results []*runner.TestFileResult
+
+		BeforeEach(func() {
+			results = []*runner.TestFileResult{
+				{
+					File:     "test_a.js",
+					Duration: 1500 * time.Millisecond,
+					Tests: []*runner.TestResult{
+						{
+							Name:     "testPass",
+							File:     "test_a.js",
+							Duration: 250 * time.Millisecond,
+							Logs:     "PASS <ok>",
+						},
+						{
+							Name:          "testFail",
+							File:          "test_a.js",
+							Duration:      time.Second,
+							Failure:       fmt.Errorf("expected 1 & got 2"),
+							TearDownError: fmt.Errorf("tearDown failed"),
+						},
+						{
+							Name:       "testSetUp",
+							File:       "test_a.js",
+							SetUpError: fmt.Errorf("setUp failed"),
+						},
+					},
+				},
+				{
+					File:  "test_b.js",
+					Error: fmt.Errorf("Failed to parse file"),
+				},
+			}
+		})
+
+		It("Should write JUnit XML", func() {
+			buffer := &bytes.Buffer{}
+			Expect(runner.WriteJUnitReport(buffer, results)).To(Succeed())
+			Expect(buffer.String()).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="4" failures="1" errors="2" time="1.500">
+  <testsuite name="test_a.js" tests="3" failures="1" errors="1" time="1.500">
+    <testcase name="testPass" classname="test_a.js" file="test_a.js" time="0.250">
+      <system-out>PASS &lt;ok&gt;</system-out>
+    </testcase>
+    <testcase name="testFail" classname="test_a.js" file="test_a.js" time="1.000">
+      <failure type="failure" message="expected 1 &amp; got 2">expected 1 &amp; got 2</failure>
+      <error type="tearDown" message="tearDown failed">tearDown failed</error>
+    </testcase>
+    <testcase name="testSetUp" classname="test_a.js" file="test_a.js" time="0.000">
+      <error type="setUp" message="setUp failed">setUp failed</error>
+    </testcase>
+  </testsuite>
+  <testsuite name="test_b.js" tests="1" failures="0" errors="1" time="0.000">
+    <testcase name="test_b.js" classname="test_b.js" file="test_b.js" time="0.000">
+      <error type="error" message="Failed to parse file">Failed to parse file</error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`))
+		})
+
+		It("Should write JSON", func() {
+			buffer := &bytes.Buffer{}
+			Expect(runner.WriteJSONReport(buffer, results)).To(Succeed())
+
+			var report map[string]interface{}
+			Expect(json.Unmarshal(buffer.Bytes(), &report)).To(Succeed())
+			Expect(report).To(HaveKeyWithValue("tests", BeNumerically("==", 3)))
+			Expect(report).To(HaveKeyWithValue("passed", BeNumerically("==", 1)))
+			Expect(report).To(HaveKeyWithValue("failed", BeNumerically("==", 2)))
+			Expect(report).To(HaveKeyWithValue("errors", BeNumerically("==", 1)))
+			Expect(report["files"]).To(Equal([]interface{}{
+				map[string]interface{}{
+					"file":     "test_a.js",
+					"duration": 1.5,
+					"tests": []interface{}{
+						map[string]interface{}{
+							"name":     "testPass",
+							"file":     "test_a.js",
+							"duration": 0.25,
+							"passed":   true,
+							"logs":     "PASS <ok>",
+						},
+						map[string]interface{}{
+							"name":           "testFail",
+							"file":           "test_a.js",
+							"duration":       1.0,
+							"passed":         false,
+							"failure":        "expected 1 & got 2",
+							"teardown_error": "tearDown failed",
+						},
+						map[string]interface{}{
+							"name":        "testSetUp",
+							"file":        "test_a.js",
+							"duration":    0.0,
+							"passed":      false,
+							"setup_error": "setUp failed",
+						},
+					},
+				},
+				map[string]interface{}{
+					"file":     "test_b.js",
+					"duration": 0.0,
+					"error":    "Failed to parse file",
+					"tests":    []interface{}{},
+				},
+			}))
+		})
+
+		It("Should reject unknown formats", func() {
+			Expect(runner.WriteReport("html", os.DevNull, results)).To(MatchError(ContainSubstring("Unknown report format")))
+		})
+	})
+})
@@ -0,0 +1,127 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/mattn/go-sqlite3"
+)
+
+// fileSnapshot holds schemas and the database of a test file, which are initialized once
+// and cloned for each test
+type fileSnapshot struct {
+	testFileName string
+	testSource   []byte
+	manager      *schema.Manager
+	fixtures     map[string]map[string]interface{}
+	dbConn       string
+	// db keeps the shared in-memory database alive until the snapshot is closed
+	db *sql.DB
+}
+
+// newFileSnapshot loads schemas specified in the test file, creates their tables in the database
+// and fills them with fixtures
+func newFileSnapshot(testFileName string, testSource []byte) (*fileSnapshot, error) {
+	env := NewEnvironment(testFileName, testSource)
+	if err := env.initializeVM(); err != nil {
+		return nil, err
+	}
+	defer env.ClearEnvironment()
+
+	if err := env.loadSchemaFiles(); err != nil {
+		return nil, err
+	}
+	if err := db.InitDBWithSchemas("sqlite3", env.memoryDbConn(), true, false, false); err != nil {
+		return nil, fmt.Errorf("Failed to init DB: %s", err)
+	}
+	fixtures, err := env.loadFixtures()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load fixtures for '%s': %s", testFileName, err)
+	}
+
+	snapshotDB, err := openSQLite(env.memoryDbConn())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to init DB: %s", err)
+	}
+	return &fileSnapshot{
+		testFileName: testFileName,
+		testSource:   testSource,
+		manager:      schema.GetManager(),
+		fixtures:     fixtures,
+		dbConn:       env.memoryDbConn(),
+		db:           snapshotDB,
+	}, nil
+}
+
+// copyDB copies the snapshot database to the given database using SQLite backup,
+// the returned handle keeps the copy alive until closed
+func (snapshot *fileSnapshot) copyDB(dbConn string) (*sql.DB, error) {
+	copyDB, err := openSQLite(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	if err := backupSQLite(dbConn, snapshot.dbConn); err != nil {
+		copyDB.Close()
+		return nil, err
+	}
+	return copyDB, nil
+}
+
+func (snapshot *fileSnapshot) close() {
+	snapshot.db.Close()
+}
+
+func openSQLite(dbConn string) (*sql.DB, error) {
+	sqliteDB, err := sql.Open("sqlite3", dbConn)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqliteDB.Ping(); err != nil {
+		sqliteDB.Close()
+		return nil, err
+	}
+	return sqliteDB, nil
+}
+
+// backupSQLite copies the source database to the destination one, connections are opened
+// directly with the driver, as database/sql doesn't expose them
+func backupSQLite(dstConn, srcConn string) error {
+	sqliteDriver := &sqlite3.SQLiteDriver{}
+	dst, err := sqliteDriver.Open(dstConn)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	src, err := sqliteDriver.Open(srcConn)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	backup, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		return err
+	}
+	if _, err := backup.Step(-1); err != nil {
+		backup.Close()
+		return err
+	}
+	return backup.Finish()
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+var SCHEMA_INCLUDES = [];
+var SCHEMAS = ["./schema.yaml"];
+var PATH = "/v1.0/networks";
+
+function testFakeHTTPServer() {
+  var server = FakeHTTPServer();
+  server.Expect("POST", "/v2.0/ports", {name: "port"}).Return(201, {id: "p1"});
+  server.Expect("GET", "/v2.0/ports/p1").Return(200, "raw", {"X-Test": "yes"});
+
+  var created = gohan_http("POST", server.URL() + "/v2.0/ports", {}, {name: "port"});
+  if (created.status_code !== "201" || JSON.parse(created.body).id !== "p1") {
+    Fail("Unexpected response: %v", created);
+  }
+  var fetched = gohan_http("GET", server.URL() + "/v2.0/ports/p1?fields=id", {}, null);
+  if (fetched.status_code !== "200" || fetched.body !== "raw") {
+    Fail("Unexpected response: %v", fetched);
+  }
+
+  var requests = server.Requests();
+  if (requests.length !== 2) {
+    Fail("Expected 2 requests, got %d", requests.length);
+  }
+  if (requests[0].method !== "POST" || requests[0].body.name !== "port") {
+    Fail("Unexpected request: %v", requests[0]);
+  }
+  if (requests[1].path !== "/v2.0/ports/p1" || requests[1].query !== "fields=id") {
+    Fail("Unexpected request: %v", requests[1]);
+  }
+}
+
+function testFakeHTTPServerUnexpectedRequest() {
+  var server = FakeHTTPServer();
+  var response = gohan_http("DELETE", server.URL() + "/v2.0/ports/p1", {}, null);
+  if (response.status_code !== "500") {
+    Fail("Unexpected response: %v", response);
+  }
+}
+
+function testFakeHTTPServerRequestNotMade() {
+  var server = FakeHTTPServer();
+  server.Expect("GET", "/v2.0/ports").Return(200, []);
+}
+
+function testFakeSync() {
+  var sync = FakeSync();
+  sync.Put("/config/a", {enabled: true});
+  sync.Put("/config/b", "raw");
+
+  var node = gohan_sync_fetch("/config/a");
+  if (JSON.parse(node.value).enabled !== true) {
+    Fail("Unexpected node: %v", node);
+  }
+  gohan_sync_delete("/config/b");
+
+  var keys = sync.Keys("/config");
+  if (keys.length !== 1 || keys[0] !== "/config/a") {
+    Fail("Unexpected keys: %v", keys);
+  }
+  if (sync.Get("/config/b") !== null) {
+    Fail("Key should be deleted");
+  }
+}
+
+function testFakeIdentity() {
+  var identity = FakeIdentity({
+    tenants: [{id: "t1", name: "demo"}],
+    tokens: {
+      member_token: {user_id: "u1", user_name: "alice", tenant_id: "t1", roles: ["member"]}
+    }
+  });
+  var auth = identity.VerifyToken("member_token");
+  if (auth.TenantID() !== "t1" || auth.TenantName() !== "demo" || auth.Roles()[0].Name !== "member") {
+    Fail("Unexpected authorization");
+  }
+  if (identity.GetTenantID("demo") !== "t1") {
+    Fail("Unexpected tenant ID");
+  }
+  identity.VerifyToken("unknown_token");
+}
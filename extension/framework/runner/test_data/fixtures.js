@@ -0,0 +1,56 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+var SCHEMA_INCLUDES = [];
+var SCHEMAS = ["./schema.yaml"];
+var FIXTURES = ["./fixtures.yaml"];
+var PATH = "/v1.0/networks";
+
+function testFixturesLoaded() {
+  var transaction = MockTransaction();
+  var networks = gohan_db_list(transaction, "network", {});
+  if (networks.length !== 2) {
+    Fail("Expected 2 networks, got %d", networks.length);
+  }
+  var subnet = gohan_db_fetch(transaction, "subnet", Fixture("subnet1").id, "");
+  if (subnet.network_id !== Fixture("net1").id) {
+    Fail("Subnet should reference net1, got %s", subnet.network_id);
+  }
+  if (Fixture("net1").admin_state_up !== false) {
+    Fail("Fixtures should have default values");
+  }
+}
+
+function testFixturesRestored() {
+  var transaction = MockTransaction();
+  gohan_db_delete(transaction, "subnet", Fixture("subnet1").id);
+  CommitMockTransaction();
+  var net = Fixture("net1");
+  net.name = "changed";
+  if (Fixture("net1").name !== "net") {
+    Fail("Fixture should not be changed by a test");
+  }
+}
+
+function testFixturesRestoredAfterDelete() {
+  var subnets = gohan_db_list(MockTransaction(), "subnet", {});
+  if (subnets.length !== 1) {
+    Fail("Expected 1 subnet, got %d", subnets.length);
+  }
+}
+
+function testUnknownFixture() {
+  Fixture("unknown");
+}
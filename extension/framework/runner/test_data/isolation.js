@@ -0,0 +1,55 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+var SCHEMA_INCLUDES = [];
+var SCHEMAS = ["./schema.yaml"];
+var PATH = "/v1.0/networks";
+
+var network = {
+  "id": "abc",
+  "name": "net",
+  "tenant_id": "tenant",
+  "shared": false,
+  "admin_state_up": false
+};
+
+function createNetwork() {
+  var transaction = MockTransaction();
+  if (gohan_db_list(transaction, "network", {}).length !== 0) {
+    Fail("Database should be empty at the beginning of each test");
+  }
+  gohan_db_create(transaction, "network", network);
+  CommitMockTransaction();
+  gohan_sleep(50);
+  if (gohan_db_list(MockTransaction(), "network", {}).length !== 1) {
+    Fail("Database should not be shared with other tests");
+  }
+}
+
+function testIsolated1() {
+  createNetwork();
+}
+
+function testIsolated2() {
+  createNetwork();
+}
+
+function testIsolated3() {
+  createNetwork();
+}
+
+function testIsolated4() {
+  createNetwork();
+}
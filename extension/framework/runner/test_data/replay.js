@@ -0,0 +1,101 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+var SCHEMA_INCLUDES = [];
+var SCHEMAS = ["./replay_schema.yaml"];
+var PATH = "/v1.0/replayeds";
+var RECORDING = {
+  "method": "POST",
+  "url": "/v1.0/replayeds",
+  "path": "/v1.0/replayeds",
+  "request": {"replayed": {"name": "net1", "tenant_id": "t1"}},
+  "events": [
+    {
+      "event": "pre_create",
+      "context_in": {
+        "event_type": "pre_create",
+        "auth": {"tenant_id": "t1", "tenant_name": "tenant", "roles": ["member"]},
+        "resource": {"name": "net1", "tenant_id": "t1"}
+      },
+      "context_out": {
+        "event_type": "pre_create",
+        "auth": {"tenant_id": "t1", "tenant_name": "tenant", "roles": ["member"]},
+        "resource": {"id": "uuid1", "name": "net1", "tenant_id": "t1"},
+        "quota": 10
+      }
+    },
+    {
+      "event": "post_create",
+      "context_in": {
+        "event_type": "post_create",
+        "resource": {"id": "uuid1", "name": "net1", "tenant_id": "t1"}
+      },
+      "context_out": {
+        "event_type": "post_create",
+        "resource": {"id": "uuid1", "name": "net1", "tenant_id": "t1"},
+        "duplicates": 0
+      }
+    }
+  ],
+  "calls": [
+    {"function": "gohan_uuid", "arguments": [], "result": "caller1"},
+    {"function": "gohan_uuid", "arguments": [], "result": "uuid1"},
+    {
+      "function": "gohan_http",
+      "arguments": ["GET", "http://quota.example.com/quota/t1", {}, null],
+      "result": {"status_code": "200", "body": "{\"quota\": 10}"}
+    },
+    {"function": "gohan_uuid", "arguments": [], "result": "caller2"},
+    {"function": "gohan_db_list", "arguments": [null, "replayed", {"name": "net1"}], "result": []}
+  ],
+  "response": {"status": 201, "body": {"replayed": {"id": "uuid1", "name": "net1", "tenant_id": "t1"}}}
+};
+
+function copyRecording() {
+  return JSON.parse(JSON.stringify(RECORDING));
+}
+
+function testReplay() {
+  Replay(RECORDING);
+}
+
+function testReplayWrongArguments() {
+  var recording = copyRecording();
+  recording.calls[2].arguments[1] = "http://quota.example.com/quota/t2";
+  Replay(recording);
+}
+
+function testReplayDifferentContext() {
+  var recording = copyRecording();
+  recording.events[0].context_out.quota = 5;
+  Replay(recording);
+}
+
+function testReplayCallNotMade() {
+  var recording = copyRecording();
+  recording.calls.push({"function": "gohan_uuid", "arguments": [], "result": "uuid2"});
+  Replay(recording);
+}
+
+function testReplayRecordedError() {
+  var recording = copyRecording();
+  recording.calls[2].error = "connection refused";
+  delete recording.calls[2].result;
+  recording.calls.splice(3, 2);
+  recording.events[0].error = "connection refused";
+  delete recording.events[0].context_out.quota;
+  recording.events.pop();
+  Replay(recording);
+}
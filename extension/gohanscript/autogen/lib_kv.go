@@ -0,0 +1,251 @@
+package autogen
+
+// AUTO GENERATED CODE DO NOT MODIFY MANUALLY
+import (
+	"github.com/cloudwan/gohan/extension/gohanscript"
+	"github.com/cloudwan/gohan/extension/gohanscript/lib"
+)
+
+func init() {
+
+	gohanscript.RegisterStmtParser("kv_get",
+		func(stmt *gohanscript.Stmt) (func(*gohanscript.Context) (interface{}, error), error) {
+			return func(context *gohanscript.Context) (interface{}, error) {
+
+				var key string
+				ikey := stmt.Arg("key", context)
+				if ikey != nil {
+					key = ikey.(string)
+				}
+
+				result1,
+					err :=
+					lib.KVGet(
+						key)
+
+				return result1, err
+
+			}, nil
+		})
+	gohanscript.RegisterMiniGoFunc("KVGet",
+		func(vm *gohanscript.VM, args []interface{}) []interface{} {
+
+			key, _ := args[0].(string)
+
+			result1,
+				err :=
+				lib.KVGet(
+					key)
+			return []interface{}{
+				result1,
+				err}
+
+		})
+
+	gohanscript.RegisterStmtParser("kv_set",
+		func(stmt *gohanscript.Stmt) (func(*gohanscript.Context) (interface{}, error), error) {
+			return func(context *gohanscript.Context) (interface{}, error) {
+
+				var key string
+				ikey := stmt.Arg("key", context)
+				if ikey != nil {
+					key = ikey.(string)
+				}
+				var value interface{}
+				ivalue := stmt.Arg("value", context)
+				if ivalue != nil {
+					value = ivalue.(interface{})
+				}
+				var ttl int
+				ittl := stmt.Arg("ttl", context)
+				if ittl != nil {
+					ttl = ittl.(int)
+				}
+
+				err :=
+					lib.KVSet(
+						key, value, ttl)
+
+				return nil, err
+
+			}, nil
+		})
+	gohanscript.RegisterMiniGoFunc("KVSet",
+		func(vm *gohanscript.VM, args []interface{}) []interface{} {
+
+			key, _ := args[0].(string)
+			value, _ := args[0].(interface{})
+			ttl, _ := args[0].(int)
+
+			err :=
+				lib.KVSet(
+					key, value, ttl)
+			return []interface{}{
+				err}
+
+		})
+
+	gohanscript.RegisterStmtParser("kv_compare_and_swap",
+		func(stmt *gohanscript.Stmt) (func(*gohanscript.Context) (interface{}, error), error) {
+			return func(context *gohanscript.Context) (interface{}, error) {
+
+				var key string
+				ikey := stmt.Arg("key", context)
+				if ikey != nil {
+					key = ikey.(string)
+				}
+				var oldValue interface{}
+				ioldValue := stmt.Arg("old_value", context)
+				if ioldValue != nil {
+					oldValue = ioldValue.(interface{})
+				}
+				var newValue interface{}
+				inewValue := stmt.Arg("new_value", context)
+				if inewValue != nil {
+					newValue = inewValue.(interface{})
+				}
+				var ttl int
+				ittl := stmt.Arg("ttl", context)
+				if ittl != nil {
+					ttl = ittl.(int)
+				}
+
+				result1,
+					err :=
+					lib.KVCompareAndSwap(
+						key, oldValue, newValue, ttl)
+
+				return result1, err
+
+			}, nil
+		})
+	gohanscript.RegisterMiniGoFunc("KVCompareAndSwap",
+		func(vm *gohanscript.VM, args []interface{}) []interface{} {
+
+			key, _ := args[0].(string)
+			oldValue, _ := args[0].(interface{})
+			newValue, _ := args[1].(interface{})
+			ttl, _ := args[0].(int)
+
+			result1,
+				err :=
+				lib.KVCompareAndSwap(
+					key, oldValue, newValue, ttl)
+			return []interface{}{
+				result1,
+				err}
+
+		})
+
+	gohanscript.RegisterStmtParser("kv_increment",
+		func(stmt *gohanscript.Stmt) (func(*gohanscript.Context) (interface{}, error), error) {
+			return func(context *gohanscript.Context) (interface{}, error) {
+
+				var key string
+				ikey := stmt.Arg("key", context)
+				if ikey != nil {
+					key = ikey.(string)
+				}
+				var delta int
+				idelta := stmt.Arg("delta", context)
+				if idelta != nil {
+					delta = idelta.(int)
+				}
+				var ttl int
+				ittl := stmt.Arg("ttl", context)
+				if ittl != nil {
+					ttl = ittl.(int)
+				}
+
+				result1,
+					err :=
+					lib.KVIncrement(
+						key, delta, ttl)
+
+				return result1, err
+
+			}, nil
+		})
+	gohanscript.RegisterMiniGoFunc("KVIncrement",
+		func(vm *gohanscript.VM, args []interface{}) []interface{} {
+
+			key, _ := args[0].(string)
+			delta, _ := args[0].(int)
+			ttl, _ := args[1].(int)
+
+			result1,
+				err :=
+				lib.KVIncrement(
+					key, delta, ttl)
+			return []interface{}{
+				result1,
+				err}
+
+		})
+
+	gohanscript.RegisterStmtParser("kv_list",
+		func(stmt *gohanscript.Stmt) (func(*gohanscript.Context) (interface{}, error), error) {
+			return func(context *gohanscript.Context) (interface{}, error) {
+
+				var prefix string
+				iprefix := stmt.Arg("prefix", context)
+				if iprefix != nil {
+					prefix = iprefix.(string)
+				}
+
+				result1,
+					err :=
+					lib.KVList(
+						prefix)
+
+				return result1, err
+
+			}, nil
+		})
+	gohanscript.RegisterMiniGoFunc("KVList",
+		func(vm *gohanscript.VM, args []interface{}) []interface{} {
+
+			prefix, _ := args[0].(string)
+
+			result1,
+				err :=
+				lib.KVList(
+					prefix)
+			return []interface{}{
+				result1,
+				err}
+
+		})
+
+	gohanscript.RegisterStmtParser("kv_delete",
+		func(stmt *gohanscript.Stmt) (func(*gohanscript.Context) (interface{}, error), error) {
+			return func(context *gohanscript.Context) (interface{}, error) {
+
+				var key string
+				ikey := stmt.Arg("key", context)
+				if ikey != nil {
+					key = ikey.(string)
+				}
+
+				err :=
+					lib.KVDelete(
+						key)
+
+				return nil, err
+
+			}, nil
+		})
+	gohanscript.RegisterMiniGoFunc("KVDelete",
+		func(vm *gohanscript.VM, args []interface{}) []interface{} {
+
+			key, _ := args[0].(string)
+
+			err :=
+				lib.KVDelete(
+					key)
+			return []interface{}{
+				err}
+
+		})
+
+}
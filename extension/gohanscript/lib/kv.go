@@ -0,0 +1,56 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lib
+
+import (
+	"time"
+
+	"github.com/cloudwan/gohan/extension/kv"
+)
+
+//KVGet returns value of the key shared by extensions, nil is returned when there is no such key
+func KVGet(key string) (interface{}, error) {
+	value, _, err := kv.Default().Get(key)
+	return value, err
+}
+
+//KVSet sets value of the key shared by extensions, the key expires after ttl seconds unless ttl is zero
+func KVSet(key string, value interface{}, ttl int) error {
+	return kv.Default().Set(key, value, time.Duration(ttl)*time.Second)
+}
+
+//KVCompareAndSwap sets value of the key to newValue when the current value equals to oldValue,
+//nil oldValue means the key must not exist
+func KVCompareAndSwap(key string, oldValue, newValue interface{}, ttl int) (bool, error) {
+	return kv.Default().CompareAndSwap(key, oldValue, newValue, time.Duration(ttl)*time.Second)
+}
+
+//KVIncrement atomically adds delta to the number kept under the key,
+//missing key expires after ttl seconds unless ttl is zero
+func KVIncrement(key string, delta, ttl int) (int, error) {
+	value, err := kv.Default().Increment(key, int64(delta), time.Duration(ttl)*time.Second)
+	return int(value), err
+}
+
+//KVList returns values of keys starting with the prefix
+func KVList(prefix string) (map[string]interface{}, error) {
+	return kv.Default().List(prefix)
+}
+
+//KVDelete removes the key
+func KVDelete(key string) error {
+	return kv.Default().Delete(key)
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build goja
+// +build goja
+
+package goja
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/xyproto/otto"
+
+	gohan_otto "github.com/cloudwan/gohan/extension/otto"
+)
+
+//bridge makes a function calling the builtin of the otto environment,
+//values are converted between VMs and exceptions thrown by the builtin are thrown again in goja
+func (env *Environment) bridge(name string) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		arguments := make([]otto.Value, len(call.Arguments))
+		for i, argument := range call.Arguments {
+			arguments[i] = env.toOtto(argument)
+		}
+
+		value, interrupted, err := env.callBuiltin(name, arguments)
+		if interrupted {
+			return goja.Undefined()
+		}
+		if err != nil {
+			if exception, ok := err.(*gohan_otto.BuiltinException); ok {
+				panic(env.exception(exception.Fields()))
+			}
+			panic(env.VM.NewGoError(err))
+		}
+		return env.fromOtto(value)
+	}
+}
+
+//callBuiltin calls the builtin, when the builtin is interrupted, e.g. by timeout, goja is interrupted too
+func (env *Environment) callBuiltin(name string, arguments []otto.Value) (value otto.Value, interrupted bool, err error) {
+	defer func() {
+		if caught := recover(); caught != nil {
+			env.VM.Interrupt(caught)
+			interrupted = true
+		}
+	}()
+	value, err = env.backend.CallBuiltin(name, arguments)
+	return value, false, err
+}
+
+//exception creates exception of the same type as the one thrown by a builtin
+func (env *Environment) exception(fields map[string]interface{}) goja.Value {
+	vm := env.VM
+	name, _ := fields["name"].(string)
+	message, _ := fields["message"].(string)
+	constructor := vm.Get(name)
+	if _, ok := goja.AssertFunction(constructor); !ok {
+		constructor = vm.Get("Error")
+	}
+	exception, err := vm.New(constructor, vm.ToValue(message))
+	if err != nil {
+		return vm.ToValue(err)
+	}
+	for key, value := range fields {
+		exception.Set(key, value)
+	}
+	return exception
+}
+
+func (env *Environment) toOtto(value goja.Value) otto.Value {
+	switch {
+	case goja.IsUndefined(value):
+		return otto.UndefinedValue()
+	case goja.IsNull(value):
+		return otto.NullValue()
+	}
+	exported := value.Export()
+	if list, ok := exported.([]interface{}); ok {
+		exported = typedList(list)
+	}
+	result, err := env.backend.VM.ToValue(exported)
+	if err != nil {
+		log.Warning("Can't pass %v to otto: %s", exported, err)
+		return otto.UndefinedValue()
+	}
+	return result
+}
+
+func (env *Environment) fromOtto(value otto.Value) goja.Value {
+	if value.IsUndefined() {
+		return goja.Undefined()
+	}
+	exported, err := value.Export()
+	if err != nil {
+		log.Warning("Can't pass %v to goja: %s", value, err)
+		return goja.Undefined()
+	}
+	return env.VM.ToValue(exported)
+}
+
+//typedList converts list of elements of the same type to a slice of that type like otto does with arrays
+func typedList(list []interface{}) interface{} {
+	if len(list) == 0 || list[0] == nil {
+		return list
+	}
+	elementType := reflect.TypeOf(list[0])
+	for _, element := range list {
+		if reflect.TypeOf(element) != elementType {
+			return list
+		}
+	}
+	result := reflect.MakeSlice(reflect.SliceOf(elementType), len(list), len(list))
+	for i, element := range list {
+		result.Index(i).Set(reflect.ValueOf(element))
+	}
+	return result.Interface()
+}
+
+func (env *Environment) require(call goja.FunctionCall) goja.Value {
+	vm := env.VM
+	if len(call.Arguments) != 1 {
+		panic(vm.NewGoError(fmt.Errorf("Expected 1 arguments in require call, %d arguments given", len(call.Arguments))))
+	}
+	module, err := gohan_otto.RequireModule(call.Argument(0).String())
+	if err != nil {
+		panic(vm.NewGoError(err))
+	}
+	return vm.ToValue(module)
+}
+
+func (env *Environment) loadHook(call goja.FunctionCall) goja.Value {
+	vm := env.VM
+	if len(call.Arguments) != 1 {
+		panic(vm.NewGoError(fmt.Errorf("Expected 1 arguments in gohan_load_hook call, %d arguments given", len(call.Arguments))))
+	}
+	env.loadHooks = append(env.loadHooks, call.Argument(0).String())
+	return vm.ToValue(true)
+}
+
+//fileReadCD reads a file relative to the extension calling it, the otto builtin
+//gets an absolute path as it doesn't know the location of the caller in goja
+func (env *Environment) fileReadCD(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) == 1 {
+		fileName := call.Argument(0).String()
+		if !filepath.IsAbs(fileName) {
+			for _, frame := range env.VM.CaptureCallStack(0, nil) {
+				if source := frame.SrcName(); source != "<native>" {
+					fileName = filepath.Join(filepath.Dir(source), fileName)
+					break
+				}
+			}
+			fileName, _ = filepath.Abs(fileName)
+		}
+		call.Arguments = []goja.Value{env.VM.ToValue(fileName)}
+	}
+	return env.bridge("gohan_file_read_cd")(call)
+}
+
+//console writes messages to the standard output like console of otto
+func (env *Environment) console() map[string]interface{} {
+	write := func(call goja.FunctionCall) goja.Value {
+		messages := make([]string, len(call.Arguments))
+		for i, argument := range call.Arguments {
+			messages[i] = argument.String()
+		}
+		fmt.Fprintln(os.Stdout, strings.Join(messages, " "))
+		return goja.Undefined()
+	}
+	return map[string]interface{}{
+		"log":   write,
+		"debug": write,
+		"info":  write,
+		"warn":  write,
+		"error": write,
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build goja
+// +build goja
+
+package goja
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/xyproto/otto/underscore"
+
+	"github.com/cloudwan/gohan/db"
+	ext "github.com/cloudwan/gohan/extension"
+	gohan_otto "github.com/cloudwan/gohan/extension/otto"
+	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/util"
+)
+
+//CodeType is the code type of extensions run only by this environment
+const CodeType = "goja"
+
+var log = l.NewLogger()
+
+var (
+	compileBuiltins sync.Once
+	builtinPrograms []*goja.Program
+)
+
+//Environment is an ES2015+ javascript based environment for gohan extension.
+//Gohan builtins are shared with the otto environment, so both behave the same.
+type Environment struct {
+	Name       string
+	VM         *goja.Runtime
+	DataStore  db.DB
+	Identity   middleware.IdentityService
+	Sync       gohan_sync.Sync
+	timeLimit  time.Duration
+	timeLimits []*schema.EventTimeLimit
+	loadHooks  []string
+	codeTypes  []string
+	objects    map[string]interface{}
+	programs   []*goja.Program
+	backend    *gohan_otto.Environment
+	// global variables before the first handled event, restored by Reset
+	globals map[string]goja.Value
+	// true when an event failed, the environment isn't reused then
+	failed bool
+}
+
+//NewEnvironment creates new gohan extension environment running extensions of given code types,
+//extensions of CodeType are run when no code type is given
+func NewEnvironment(name string, dataStore db.DB, identity middleware.IdentityService, sync gohan_sync.Sync, codeTypes ...string) *Environment {
+	if len(codeTypes) == 0 {
+		codeTypes = []string{CodeType}
+	}
+	return newEnvironment(gohan_otto.NewEnvironment(name, dataStore, identity, sync), codeTypes)
+}
+
+func newEnvironment(backend *gohan_otto.Environment, codeTypes []string) *Environment {
+	env := &Environment{
+		Name:      backend.Name,
+		VM:        goja.New(),
+		DataStore: backend.DataStore,
+		Identity:  backend.Identity,
+		Sync:      backend.Sync,
+		loadHooks: []string{},
+		codeTypes: codeTypes,
+		objects:   map[string]interface{}{},
+		backend:   backend,
+	}
+	env.setUp()
+	return env
+}
+
+func (env *Environment) setUp() {
+	vm := env.VM
+	for _, name := range env.backend.Builtins() {
+		switch name {
+		case "require", "gohan_load_hook", "gohan_file_read_cd":
+			continue
+		}
+		vm.Set(name, env.bridge(name))
+	}
+	vm.Set("require", env.require)
+	vm.Set("gohan_load_hook", env.loadHook)
+	vm.Set("gohan_file_read_cd", env.fileReadCD)
+	vm.Set("console", env.console())
+	vm.Set("LOG_LEVEL", map[string]interface{}{
+		"CRITICAL": int64(l.CRITICAL),
+		"ERROR":    int64(l.ERROR),
+		"WARNING":  int64(l.WARNING),
+		"NOTICE":   int64(l.NOTICE),
+		"INFO":     int64(l.INFO),
+		"DEBUG":    int64(l.DEBUG),
+	})
+	vm.Set("LOG_MODULE", "gohan.extension."+env.Name)
+
+	compileBuiltins.Do(func() {
+		sources := []struct{ name, code string }{
+			{"<underscore>", underscore.Source()},
+			{"<Gohan built-in exceptions>", gohan_otto.ExceptionsScript},
+			{"<Gohan logging built-ins>", gohan_otto.LoggingScript},
+			{"<Gohan built-ins>", gohan_otto.HandlersScript},
+		}
+		for _, source := range sources {
+			builtinPrograms = append(builtinPrograms, goja.MustCompile(source.name, source.code, false))
+		}
+	})
+	for _, program := range builtinPrograms {
+		if _, err := vm.RunProgram(program); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+//Load loads script for environment
+func (env *Environment) Load(source, code string) error {
+	vm := env.VM
+	for _, hook := range env.loadHooks {
+		function, ok := goja.AssertFunction(vm.Get(hook))
+		if !ok {
+			return fmt.Errorf("Load hook %s is not a function", hook)
+		}
+		transformedCode, err := function(goja.Undefined(), vm.ToValue(code), vm.ToValue(source))
+		if err != nil {
+			return err
+		}
+		code, ok = transformedCode.Export().(string)
+		if !ok {
+			return fmt.Errorf("Load hook %s returned %v instead of code", hook, transformedCode)
+		}
+	}
+
+	program, err := goja.Compile(source, code, false)
+	if err != nil {
+		// syntax errors start with the file name like in otto
+		if syntaxError, ok := err.(*goja.CompilerSyntaxError); ok && syntaxError.File == nil {
+			return errors.New(syntaxError.Message)
+		}
+		return err
+	}
+	if _, err = vm.RunProgram(program); err != nil {
+		return err
+	}
+	env.programs = append(env.programs, program)
+	return nil
+}
+
+//RegisterObject register new object for VM
+func (env *Environment) RegisterObject(objectID string, object interface{}) {
+	env.objects[objectID] = object
+	env.VM.Set(objectID, object)
+}
+
+//LoadExtensionsForPath loads extensions for specific path
+func (env *Environment) LoadExtensionsForPath(extensions []*schema.Extension, timeLimit time.Duration, timeLimits []*schema.PathEventTimeLimit, path string) error {
+	for _, extension := range extensions {
+		if !extension.Match(path) || !util.ContainsString(env.codeTypes, extension.CodeType) {
+			continue
+		}
+		url := strings.TrimPrefix(extension.URL, "file://")
+		if err := env.Load(url, extension.Code); err != nil {
+			return err
+		}
+	}
+	// setup time limits for matching extensions
+	env.timeLimit = timeLimit
+	for _, timeLimit := range timeLimits {
+		if timeLimit.Match(path) {
+			env.timeLimits = append(env.timeLimits, schema.NewEventTimeLimit(timeLimit.EventRegex, timeLimit.TimeDuration))
+		}
+	}
+	return nil
+}
+
+//HandleEvent handles event
+func (env *Environment) HandleEvent(event string, context map[string]interface{}) (err error) {
+	vm := env.VM
+	defer func() {
+		if err != nil {
+			env.failed = true
+		}
+	}()
+	if env.globals == nil {
+		env.globals = env.getGlobals()
+	}
+	var closeNotify <-chan bool
+	if closeNotifier, ok := context["http_response"].(http.CloseNotifier); ok {
+		closeNotify = closeNotifier.CloseNotify()
+	}
+	context["event_type"] = event
+	var timeout = fmt.Errorf("exceed timeout for extension execution for event: %s", event)
+	var disconnected = fmt.Errorf("client disconnected for event: %s", event)
+
+	finishRecording := env.backend.StartRecording(event, context)
+	defer func() {
+		finishRecording(err)
+	}()
+	defer env.backend.CloseClosers()
+
+	// take time limit from first passing regex or default
+	selectedTimeLimit := env.timeLimit
+	for _, timeLimit := range env.timeLimits {
+		if timeLimit.Match(event) {
+			selectedTimeLimit = timeLimit.TimeDuration
+			break
+		}
+	}
+	timer := time.NewTimer(selectedTimeLimit)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var interrupt error
+		select {
+		case <-closeNotify:
+			interrupt = disconnected
+		case <-timer.C:
+			interrupt = timeout
+		case <-done:
+			// extension executed successfully
+			return
+		}
+		vm.Interrupt(interrupt)
+		// wake up builtins waiting for an external event
+		env.backend.Interrupt(func() {
+			panic(interrupt)
+		})
+	}()
+	defer func() {
+		timer.Stop()
+		close(done)
+		<-stopped
+		vm.ClearInterrupt()
+		env.backend.ClearInterrupt()
+	}()
+
+	handleEvent, ok := goja.AssertFunction(vm.Get("gohan_handle_event"))
+	if !ok {
+		return fmt.Errorf("%s: gohan_handle_event is not a function", event)
+	}
+	_, err = handleEvent(goja.Undefined(), vm.ToValue(event), vm.ToValue(context))
+	switch caught := err.(type) {
+	case nil:
+		return nil
+	case *goja.InterruptedError:
+		switch caught.Value() {
+		case timeout, disconnected:
+			log.Warning(caught.Value().(error).Error())
+			return caught.Value().(error)
+		}
+		panic(caught.Value()) // Something else happened, repanic!
+	case *goja.Exception:
+		return fmt.Errorf("%s: %s", event, exceptionStack(caught))
+	default:
+		return fmt.Errorf("%s: %s", event, err.Error())
+	}
+}
+
+//exceptionStack returns the stack of the error thrown by an extension,
+//the exception rethrown by gohan_handle_event has only the stack of the rethrow
+func exceptionStack(exception *goja.Exception) string {
+	if object, ok := exception.Value().(*goja.Object); ok {
+		if stack := object.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+			return stack.String()
+		}
+	}
+	return exception.String()
+}
+
+//SetEventTimeLimit overrides the default time limit for a given event for this environment
+func (env *Environment) SetEventTimeLimit(eventRegex string, timeLimit time.Duration) {
+	env.timeLimits = append(env.timeLimits, schema.NewEventTimeLimit(regexp.MustCompile(eventRegex), timeLimit))
+}
+
+//Reset clears state left by handled events and restores global variables, so the environment can be reused.
+//Objects in global variables modified in place and top-level let or const bindings aren't restored.
+//It returns an error when an event failed or was interrupted, the environment shouldn't be reused then.
+func (env *Environment) Reset() error {
+	env.VM.ClearInterrupt()
+	if err := env.restoreGlobals(); err != nil {
+		return err
+	}
+	env.VM.Set("gohan_caller", "")
+	env.VM.Set("LOG_MODULE", "gohan.extension."+env.Name)
+	if err := env.backend.Reset(); err != nil {
+		return err
+	}
+	if env.failed {
+		return fmt.Errorf("Environment %s failed to handle an event", env.Name)
+	}
+	return nil
+}
+
+//getGlobals returns global variables of the VM
+func (env *Environment) getGlobals() map[string]goja.Value {
+	globals := map[string]goja.Value{}
+	global := env.VM.GlobalObject()
+	for _, key := range global.Keys() {
+		globals[key] = global.Get(key)
+	}
+	return globals
+}
+
+//restoreGlobals deletes global variables set by handled events and restores overwritten ones
+func (env *Environment) restoreGlobals() error {
+	if env.globals == nil {
+		return nil
+	}
+	global := env.VM.GlobalObject()
+	for _, key := range global.Keys() {
+		if _, ok := env.globals[key]; ok {
+			continue
+		}
+		if err := global.Delete(key); err != nil {
+			return err
+		}
+	}
+	for key, value := range env.globals {
+		if err := global.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Clone makes clone of the environment, loaded scripts are run again in the clone
+func (env *Environment) Clone() ext.Environment {
+	clone := newEnvironment(env.backend.Clone().(*gohan_otto.Environment), env.codeTypes)
+	clone.timeLimit = env.timeLimit
+	clone.timeLimits = env.timeLimits
+	for objectID, object := range env.objects {
+		clone.RegisterObject(objectID, object)
+	}
+	for _, program := range env.programs {
+		if _, err := clone.VM.RunProgram(program); err != nil {
+			log.Error("Error when cloning environment %s: %s", env.Name, err)
+		}
+	}
+	clone.programs = append([]*goja.Program{}, env.programs...)
+	return clone
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build goja
+// +build goja
+
+package goja_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	configDir    = "../../server"
+	configFile   = "./server_test_config.yaml"
+	dbType       = "sqlite3"
+	dbFile       = "./goja_test.db"
+	adminTokenID = "admin_token"
+	adminTenant  = "fc394f2ab2df4114bde39905f800dc57"
+)
+
+var testDB db.DB
+
+func TestGojaExtension(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Goja Extension Suite")
+}
+
+var _ = Describe("Suite set up and tear down", func() {
+	var _ = BeforeSuite(func() {
+		var err error
+		Expect(os.Chdir(configDir)).To(Succeed())
+		testDB, err = db.ConnectDB(dbType, dbFile, db.DefaultMaxOpenConn)
+		Expect(err).ToNot(HaveOccurred(), "Failed to connect database.")
+		manager := schema.GetManager()
+		config := util.GetConfig()
+		Expect(config.ReadConfig(configFile)).To(Succeed())
+		schemaFiles := config.GetStringList("schemas", nil)
+		Expect(schemaFiles).NotTo(BeNil())
+		Expect(manager.LoadSchemasFromFiles(schemaFiles...)).To(Succeed())
+		Expect(db.InitDBWithSchemas(dbType, dbFile, true, false, false)).To(Succeed())
+	})
+
+	var _ = AfterSuite(func() {
+		schema.ClearManager()
+		testDB.Close()
+		os.Remove(dbFile)
+	})
+})
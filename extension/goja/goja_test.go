@@ -0,0 +1,340 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build goja
+// +build goja
+
+package goja_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/extension/goja"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+func newEnvironment() *goja.Environment {
+	return goja.NewEnvironment("goja_test", testDB, &middleware.FakeIdentity{}, nil)
+}
+
+type closeNotifyingRecorder struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func (recorder *closeNotifyingRecorder) CloseNotify() <-chan bool {
+	return recorder.closed
+}
+
+var _ = Describe("Goja extension environment", func() {
+	var (
+		timeLimit  time.Duration
+		timeLimits []*schema.PathEventTimeLimit
+	)
+
+	BeforeEach(func() {
+		timeLimit = time.Second
+		timeLimits = []*schema.PathEventTimeLimit{}
+	})
+
+	load := func(env *goja.Environment, code string) error {
+		extension, err := schema.NewExtension(map[string]interface{}{
+			"id":        "test_extension",
+			"code_type": "goja",
+			"code":      code,
+			"path":      ".*",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		extension.URL = "test_extension.js"
+		return env.LoadExtensionsForPath([]*schema.Extension{extension}, timeLimit, timeLimits, "test_path")
+	}
+
+	handle := func(code string, context map[string]interface{}) error {
+		env := newEnvironment()
+		Expect(load(env, code)).To(Succeed())
+		return env.HandleEvent("test_event", context)
+	}
+
+	Describe("Loading an extension", func() {
+		It("Returns compilation error with file name", func() {
+			err := load(newEnvironment(), `gohan_register_handler("test_event", function(context {});`)
+			Expect(err).To(MatchError(ContainSubstring("test_extension.js")))
+		})
+
+		It("Loads only extensions of its code types", func() {
+			extension, err := schema.NewExtension(map[string]interface{}{
+				"id":        "otto_extension",
+				"code_type": "javascript",
+				"code":      `throw new Error("should not be loaded");`,
+				"path":      ".*",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			env := newEnvironment()
+			Expect(env.LoadExtensionsForPath([]*schema.Extension{extension}, timeLimit, timeLimits, "test_path")).To(Succeed())
+
+			env = goja.NewEnvironment("goja_test", testDB, &middleware.FakeIdentity{}, nil, "javascript")
+			Expect(env.LoadExtensionsForPath([]*schema.Extension{extension}, timeLimit, timeLimits, "test_path")).To(
+				MatchError(ContainSubstring("should not be loaded")))
+		})
+
+		It("Runs load hooks", func() {
+			env := newEnvironment()
+			Expect(load(env, `
+				gohan_load_hook("replace_event");
+				function replace_event(code, source) {
+					return code.replace("other_event", "test_event");
+				}`)).To(Succeed())
+			Expect(load(env, `gohan_register_handler("other_event", (context) => { context.resp = "hooked"; });`)).To(Succeed())
+
+			context := map[string]interface{}{}
+			Expect(env.HandleEvent("test_event", context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("resp", "hooked"))
+		})
+	})
+
+	Describe("Running an extension", func() {
+		It("Supports ES2015+ syntax", func() {
+			context := map[string]interface{}{"id": "test"}
+			Expect(handle(`
+				class Greeter {
+					constructor(name) {
+						this.name = name;
+					}
+					greet() {
+						return `+"`Hello ${this.name}`"+`;
+					}
+				}
+				gohan_register_handler("test_event", (context) => {
+					const {id} = context;
+					let values = [1, 2, 3].map((x) => x * 2);
+					context.greeting = new Greeter(id).greet();
+					context.sum = values.reduce((a, b) => a + b, 0);
+					context.keys = [...new Set(["a", "a", "b"])];
+					Promise.resolve(1).then(() => {});
+				});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("greeting", "Hello test"))
+			Expect(context).To(HaveKeyWithValue("sum", BeEquivalentTo(12)))
+			Expect(context).To(HaveKeyWithValue("keys", ConsistOf("a", "b")))
+			Expect(context).To(HaveKeyWithValue("event_type", "test_event"))
+		})
+
+		It("Returns runtime error with event name", func() {
+			err := handle(`gohan_register_handler("test_event", function foo(context) {
+				console.log(b);
+			});`, map[string]interface{}{})
+			Expect(err).To(MatchError(MatchRegexp(`^test_event: ReferenceError: b is not defined`)))
+		})
+
+		It("Represents nil values as null", func() {
+			context := map[string]interface{}{"nulo": nil}
+			Expect(handle(`gohan_register_handler("test_event", function(context) {
+				context.respondo = context.nulo === null ? "verdo" : "ne verdo";
+			});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("respondo", "verdo"))
+		})
+
+		It("Puts thrown gohan exceptions into context", func() {
+			context := map[string]interface{}{}
+			Expect(handle(`gohan_register_handler("test_event", function(context) {
+				throw new CustomException("Bad request", 400);
+			});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("exception", And(
+				HaveKeyWithValue("name", "CustomException"),
+				HaveKeyWithValue("message", "Bad request"),
+				HaveKeyWithValue("code", BeEquivalentTo(400)))))
+			Expect(context).To(HaveKeyWithValue("exception_message", "test_event: CustomException(Bad request)"))
+		})
+
+		It("Aborts extension running too long and closes its transactions", func() {
+			env := newEnvironment()
+			Expect(load(env, `
+				var unclosedTx;
+				gohan_register_handler("test_event", function(context) {
+					unclosedTx = gohan_db_transaction();
+					while(true) {}
+				});`)).To(Succeed())
+			env.SetEventTimeLimit("test_*", 100*time.Millisecond)
+			cloned := env.Clone().(*goja.Environment)
+
+			for _, env := range []*goja.Environment{env, cloned} {
+				timeStart := time.Now()
+				err := env.HandleEvent("test_event", map[string]interface{}{})
+				Expect(err).To(MatchError(ContainSubstring("exceed timeout for extension execution")))
+				Expect(time.Since(timeStart)).To(BeNumerically("<", 500*time.Millisecond))
+				tx, ok := env.VM.Get("unclosedTx").Export().(transaction.Transaction)
+				Expect(ok).To(BeTrue())
+				Expect(tx.Closed()).To(BeTrue())
+			}
+			Expect(env.HandleEvent("other_event", map[string]interface{}{})).To(Succeed())
+		})
+
+		It("Resets state left by aborted extension", func() {
+			env := newEnvironment()
+			Expect(load(env, `gohan_register_handler("test_event", (context) => {
+				while(true) {}
+			});`)).To(Succeed())
+			env.SetEventTimeLimit("test_*", 10*time.Millisecond)
+			Expect(env.HandleEvent("test_event", map[string]interface{}{})).ToNot(Succeed())
+			Expect(env.VM.Get("LOG_MODULE").String()).To(Equal("gohan.extension.goja_test.test_event"))
+
+			Expect(env.Reset()).ToNot(Succeed())
+			Expect(env.VM.Get("LOG_MODULE").String()).To(Equal("gohan.extension.goja_test"))
+		})
+
+		It("Aborts builtins waiting when extension runs too long", func() {
+			env := newEnvironment()
+			Expect(load(env, `gohan_register_handler("test_event", function(context) {
+				gohan_sleep(10000);
+			});`)).To(Succeed())
+			env.SetEventTimeLimit("test_*", 100*time.Millisecond)
+			timeStart := time.Now()
+			Expect(env.HandleEvent("test_event", map[string]interface{}{})).To(
+				MatchError(ContainSubstring("exceed timeout for extension execution")))
+			Expect(time.Since(timeStart)).To(BeNumerically("<", 500*time.Millisecond))
+		})
+
+		It("Aborts extension when client disconnects", func() {
+			response := &closeNotifyingRecorder{httptest.NewRecorder(), make(chan bool, 1)}
+			response.closed <- true
+			err := handle(`gohan_register_handler("test_event", function(context) { while(true) {} });`,
+				map[string]interface{}{"http_response": response})
+			Expect(err).To(MatchError(ContainSubstring("client disconnected")))
+		})
+	})
+
+	Describe("Using builtins", func() {
+		It("Calls gohan_http", func() {
+			server := ghttp.NewServer()
+			defer server.Close()
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/contents"),
+				ghttp.VerifyJSON(`{"names": ["a", "b"]}`),
+				ghttp.RespondWith(http.StatusOK, "HELLO"),
+			))
+			context := map[string]interface{}{}
+			Expect(handle(`gohan_register_handler("test_event", (context) => {
+				context.resp = gohan_http("POST", "`+server.URL()+`/contents", {}, {names: ["a", "b"]});
+			});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("resp", HaveKeyWithValue("status_code", "200")))
+			Expect(context).To(HaveKeyWithValue("resp", HaveKeyWithValue("body", "HELLO")))
+		})
+
+		It("Calls gohan_config", func() {
+			context := map[string]interface{}{}
+			Expect(handle(`gohan_register_handler("test_event", (context) => {
+				context.resp = gohan_config("database", "");
+				context.missing = gohan_config("does not exist", false);
+			});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("resp", HaveKeyWithValue("type", "sqlite3")))
+			Expect(context).To(HaveKeyWithValue("missing", BeFalse()))
+		})
+
+		It("Handles CRUD operations by gohan_db_* builtins", func() {
+			tx, err := testDB.Begin()
+			Expect(err).ToNot(HaveOccurred())
+			defer tx.Close()
+
+			context := map[string]interface{}{"transaction": tx}
+			Expect(handle(`gohan_register_handler("test_event", (context) => {
+				const tx = context.transaction;
+				gohan_db_create(tx, "network", {
+					id: "test1",
+					name: "name",
+					description: "description",
+					providor_networks: {},
+					route_targets: [],
+					shared: false,
+					tenant_id: "admin"});
+				context.network = gohan_db_fetch(tx, "network", "test1", "admin");
+				gohan_db_update(tx, "network", {id: "test1", name: "name_updated", tenant_id: "admin"});
+				context.networks = gohan_db_list(tx, "network", {});
+				context.names = context.networks.map((network) => network.name);
+				gohan_db_delete(tx, "network", "test1");
+				context.networks_after_delete = gohan_db_list(tx, "network", {});
+			});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("network", HaveKeyWithValue("name", "name")))
+			Expect(context).To(HaveKeyWithValue("names", ConsistOf("name_updated")))
+			Expect(context).To(HaveKeyWithValue("networks_after_delete", BeEmpty()))
+		})
+
+		It("Throws exceptions of builtins", func() {
+			context := map[string]interface{}{}
+			Expect(handle(`gohan_register_handler("test_event", (context) => {
+				try {
+					gohan_db_fetch(null, "unknown_schema", "id", "");
+				} catch (e) {
+					context.is_error = e instanceof Error;
+					context.error = e.message;
+				}
+			});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("is_error", BeTrue()))
+			Expect(context).To(HaveKeyWithValue("error", ContainSubstring("unknown_schema")))
+		})
+
+		It("Shares gohan_global between clones", func() {
+			env := newEnvironment()
+			Expect(load(env, `gohan_register_handler("test_event", (context) => {
+				const global = gohan_global("counter");
+				global.count = (global.count || 0) + 1;
+				context.count = global.count;
+			});`)).To(Succeed())
+			cloned := env.Clone()
+
+			context := map[string]interface{}{}
+			Expect(env.HandleEvent("test_event", context)).To(Succeed())
+			Expect(cloned.HandleEvent("test_event", context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("count", BeEquivalentTo(2)))
+		})
+
+		It("Shares state by gohan_kv_* builtins", func() {
+			context := map[string]interface{}{}
+			Expect(handle(`gohan_register_handler("test_event", (context) => {
+				context.missing = gohan_kv_get("goja_test/missing");
+				gohan_kv_set("goja_test/config", {limit: 2}, 60);
+				context.config = gohan_kv_get("goja_test/config");
+				context.first = gohan_kv_increment("goja_test/count");
+				context.second = gohan_kv_increment("goja_test/count", 5, 60);
+				context.swapped = gohan_kv_compare_and_swap("goja_test/count", 6, 0);
+				context.not_swapped = gohan_kv_compare_and_swap("goja_test/count", 6, 1);
+				context.keys = Object.keys(gohan_kv_list("goja_test/")).sort();
+				gohan_kv_delete("goja_test/config");
+				gohan_kv_delete("goja_test/count");
+				context.after_delete = gohan_kv_list("goja_test/");
+				try {
+					gohan_kv_increment("goja_test/config", 1, -1);
+				} catch (e) {
+					context.error = e.message;
+				}
+			});`, context)).To(Succeed())
+			Expect(context).To(HaveKeyWithValue("missing", BeNil()))
+			Expect(context).To(HaveKeyWithValue("config", HaveKeyWithValue("limit", BeEquivalentTo(2))))
+			Expect(context).To(HaveKeyWithValue("first", BeEquivalentTo(1)))
+			Expect(context).To(HaveKeyWithValue("second", BeEquivalentTo(6)))
+			Expect(context).To(HaveKeyWithValue("swapped", BeTrue()))
+			Expect(context).To(HaveKeyWithValue("not_swapped", BeFalse()))
+			Expect(context).To(HaveKeyWithValue("keys", Equal([]interface{}{"goja_test/config", "goja_test/count"})))
+			Expect(context).To(HaveKeyWithValue("after_delete", BeEmpty()))
+			Expect(context).To(HaveKeyWithValue("error", ContainSubstring("ttl")))
+		})
+	})
+})
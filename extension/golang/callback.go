@@ -33,3 +33,24 @@ func GetGoCallback(name string) GoCallback {
 	}
 	return callback
 }
+
+//Handler is type for typed go extension handler
+type Handler func(context *Context) error
+
+type schemaHandler struct {
+	event   Event
+	handler Handler
+}
+
+var schemaHandlers = map[string][]schemaHandler{}
+
+//RegisterHandler registers handler called on the event of resources of the schema.
+//Handlers are bound to environments of the schema when extension/use contains go.
+func RegisterHandler(schemaID string, event Event, handler Handler) {
+	schemaHandlers[schemaID] = append(schemaHandlers[schemaID], schemaHandler{event: event, handler: handler})
+}
+
+//ClearHandlers removes handlers registered for all schemas
+func ClearHandlers() {
+	schemaHandlers = map[string][]schemaHandler{}
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golang
+
+import (
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/sync"
+)
+
+//Context gives typed access to the context of an extension event.
+//Values set by the accessors are visible to other extensions handling the event.
+type Context struct {
+	event string
+	raw   map[string]interface{}
+}
+
+//NewContext wraps the context given to extensions
+func NewContext(event string, context map[string]interface{}) *Context {
+	return &Context{
+		event: event,
+		raw:   context,
+	}
+}
+
+//Event returns the handled event
+func (context *Context) Event() Event {
+	return Event(context.event)
+}
+
+//Raw returns the underlying context shared with other extensions
+func (context *Context) Raw() map[string]interface{} {
+	return context.raw
+}
+
+//Schema returns schema of the resource, nil is returned for events not related to a schema
+func (context *Context) Schema() *schema.Schema {
+	s, _ := context.raw["schema"].(*schema.Schema)
+	return s
+}
+
+//SchemaID returns id of the schema, empty for events not related to a schema
+func (context *Context) SchemaID() string {
+	if s := context.Schema(); s != nil {
+		return s.ID
+	}
+	return ""
+}
+
+//ID returns id of the resource given in the request
+func (context *Context) ID() string {
+	id, _ := context.raw["id"].(string)
+	return id
+}
+
+//Resource returns the resource data, nil is returned when there is none
+func (context *Context) Resource() map[string]interface{} {
+	resource, _ := context.raw["resource"].(map[string]interface{})
+	return resource
+}
+
+//SetResource replaces the resource data
+func (context *Context) SetResource(resource map[string]interface{}) {
+	context.raw["resource"] = resource
+}
+
+//Auth returns authorization of the request, nil is returned when there is none
+func (context *Context) Auth() schema.Authorization {
+	auth, _ := context.raw["auth"].(schema.Authorization)
+	return auth
+}
+
+//Transaction returns the transaction of *_in_transaction events, nil is returned for other events
+func (context *Context) Transaction() transaction.Transaction {
+	tx, _ := context.raw["transaction"].(transaction.Transaction)
+	return tx
+}
+
+//Response returns the response, nil is returned when it isn't set yet
+func (context *Context) Response() map[string]interface{} {
+	response, _ := context.raw["response"].(map[string]interface{})
+	return response
+}
+
+//SetResponse replaces the response
+func (context *Context) SetResponse(response map[string]interface{}) {
+	context.raw["response"] = response
+}
+
+//Sync returns sync of the server, nil is returned when there is none
+func (context *Context) Sync() sync.Sync {
+	s, _ := context.raw["sync"].(sync.Sync)
+	return s
+}
@@ -25,6 +25,7 @@ import (
 //Environment gohan script based environment for gohan extension
 type Environment struct {
 	goCallbacks []GoCallback
+	handlers    []schemaHandler
 }
 
 //NewEnvironment create new gohan extension environment based on context
@@ -37,6 +38,7 @@ func NewEnvironment() *Environment {
 //SetUp initialize environment
 func (env *Environment) SetUp() {
 	env.goCallbacks = []GoCallback{}
+	env.handlers = []schemaHandler{}
 }
 
 //Load loads script for environment
@@ -46,18 +48,35 @@ func (env *Environment) Load(source, code string) error {
 
 //LoadExtensionsForPath for returns extensions for specific path
 func (env *Environment) LoadExtensionsForPath(extensions []*schema.Extension, timeLimit time.Duration, timeLimits []*schema.PathEventTimeLimit, path string) error {
+	schemaIDs := []string{}
+	for _, s := range schema.GetManager().Schemas() {
+		if s.GetPluralURL() == path {
+			schemaIDs = append(schemaIDs, s.ID)
+		}
+	}
 	for _, extension := range extensions {
 		if extension.Match(path) {
-			if extension.CodeType != "go" {
-				continue
-			}
-			code := extension.Code
-			callback := GetGoCallback(code)
-			if callback != nil {
-				env.goCallbacks = append(env.goCallbacks, callback)
+			switch extension.CodeType {
+			case "go":
+				code := extension.Code
+				callback := GetGoCallback(code)
+				if callback != nil {
+					env.goCallbacks = append(env.goCallbacks, callback)
+				}
+			case PluginCodeType:
+				plugin, err := LoadPlugin(extension)
+				if err != nil {
+					return err
+				}
+				for _, schemaID := range schemaIDs {
+					env.handlers = append(env.handlers, plugin.handlers[schemaID]...)
+				}
 			}
 		}
 	}
+	for _, schemaID := range schemaIDs {
+		env.handlers = append(env.handlers, schemaHandlers[schemaID]...)
+	}
 	return nil
 }
 
@@ -70,6 +89,19 @@ func (env *Environment) HandleEvent(event string, context map[string]interface{}
 			return
 		}
 	}
+	if len(env.handlers) == 0 {
+		return
+	}
+	typedContext := NewContext(event, context)
+	for _, handler := range env.handlers {
+		if handler.event != Event(event) {
+			continue
+		}
+		err = handler.handler(typedContext)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -77,5 +109,6 @@ func (env *Environment) HandleEvent(event string, context map[string]interface{}
 func (env *Environment) Clone() ext.Environment {
 	clone := NewEnvironment()
 	clone.goCallbacks = env.goCallbacks
+	clone.handlers = env.handlers
 	return clone
 }
@@ -65,4 +65,77 @@ var _ = Describe("Gohanscript extension manager", func() {
 		})
 	})
 
+	Describe("Handling events by typed handlers", func() {
+		var (
+			networkSchema *schema.Schema
+			handled       []*golang.Context
+		)
+
+		BeforeEach(func() {
+			networkSchema, _ = schema.GetManager().Schema("network")
+			handled = nil
+			golang.RegisterHandler("network", golang.PreCreate, func(context *golang.Context) error {
+				handled = append(handled, context)
+				resource := context.Resource()
+				if resource["name"] == "taken" {
+					return golang.Conflict("Name %s is taken", resource["name"])
+				}
+				resource["name"] = "updated"
+				context.SetResponse(map[string]interface{}{"network": resource})
+				return nil
+			})
+		})
+
+		AfterEach(func() {
+			golang.ClearHandlers()
+		})
+
+		newEnvironment := func(path string) extension.Environment {
+			env := golang.NewEnvironment()
+			Expect(env.LoadExtensionsForPath([]*schema.Extension{}, timeLimit, timeLimits, path)).To(Succeed())
+			return env.Clone()
+		}
+
+		It("Calls handlers of the schema and event with typed context", func() {
+			auth := schema.NewAuthorization("tenant", "tenant", "token", []string{"admin"}, nil)
+			context := map[string]interface{}{
+				"schema":   networkSchema,
+				"resource": map[string]interface{}{"name": "name"},
+				"auth":     auth,
+			}
+			env := newEnvironment(networkSchema.GetPluralURL())
+			Expect(env.HandleEvent("pre_update", context)).To(Succeed())
+			Expect(handled).To(BeEmpty())
+
+			Expect(env.HandleEvent("pre_create", context)).To(Succeed())
+			Expect(handled).To(HaveLen(1))
+			Expect(handled[0].Event()).To(Equal(golang.PreCreate))
+			Expect(handled[0].SchemaID()).To(Equal("network"))
+			Expect(handled[0].Auth()).To(Equal(auth))
+			Expect(handled[0].Transaction()).To(BeNil())
+			Expect(context).To(HaveKeyWithValue("response",
+				HaveKeyWithValue("network", HaveKeyWithValue("name", "updated"))))
+		})
+
+		It("Doesn't call handlers for other schemas", func() {
+			env := newEnvironment("/v2.0/subnets")
+			Expect(env.HandleEvent("pre_create", map[string]interface{}{})).To(Succeed())
+			Expect(handled).To(BeEmpty())
+		})
+
+		It("Returns errors responded with HTTP status code", func() {
+			context := map[string]interface{}{
+				"schema":   networkSchema,
+				"resource": map[string]interface{}{"name": "taken"},
+			}
+			err := newEnvironment(networkSchema.GetPluralURL()).HandleEvent("pre_create", context)
+			Expect(err).To(BeAssignableToTypeOf(extension.Error{}))
+			Expect(err.(extension.Error).ExceptionInfo).To(Equal(map[string]interface{}{
+				"name":    "CustomException",
+				"code":    409,
+				"message": "Name taken is taken",
+			}))
+		})
+	})
+
 })
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golang
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudwan/gohan/extension"
+)
+
+//Errorf returns an error making the API respond with the HTTP status code and the message,
+//like CustomException thrown by javascript extensions
+func Errorf(code int, format string, args ...interface{}) error {
+	return extension.Errorf(code, "CustomException", fmt.Sprintf(format, args...))
+}
+
+//BadRequest returns an error responded with 400 Bad Request
+func BadRequest(format string, args ...interface{}) error {
+	return Errorf(http.StatusBadRequest, format, args...)
+}
+
+//Unauthorized returns an error responded with 401 Unauthorized
+func Unauthorized(format string, args ...interface{}) error {
+	return Errorf(http.StatusUnauthorized, format, args...)
+}
+
+//Forbidden returns an error responded with 403 Forbidden
+func Forbidden(format string, args ...interface{}) error {
+	return Errorf(http.StatusForbidden, format, args...)
+}
+
+//NotFound returns an error responded with 404 Not Found
+func NotFound(format string, args ...interface{}) error {
+	return Errorf(http.StatusNotFound, format, args...)
+}
+
+//Conflict returns an error responded with 409 Conflict
+func Conflict(format string, args ...interface{}) error {
+	return Errorf(http.StatusConflict, format, args...)
+}
+
+//PreconditionFailed returns an error responded with 412 Precondition Failed
+func PreconditionFailed(format string, args ...interface{}) error {
+	return Errorf(http.StatusPreconditionFailed, format, args...)
+}
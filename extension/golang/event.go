@@ -0,0 +1,48 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golang
+
+// Event is a name of an extension event
+type Event string
+
+// Events of resource operations, custom actions use their ids as event names
+const (
+	PreList                           Event = "pre_list"
+	PreListInTransaction              Event = "pre_list_in_transaction"
+	PostListInTransaction             Event = "post_list_in_transaction"
+	PostList                          Event = "post_list"
+	PreShow                           Event = "pre_show"
+	PreShowInTransaction              Event = "pre_show_in_transaction"
+	PostShowInTransaction             Event = "post_show_in_transaction"
+	PostShow                          Event = "post_show"
+	PreCreate                         Event = "pre_create"
+	PreCreateInTransaction            Event = "pre_create_in_transaction"
+	PostCreateInTransaction           Event = "post_create_in_transaction"
+	PostCreate                        Event = "post_create"
+	PreUpdate                         Event = "pre_update"
+	PreUpdateInTransaction            Event = "pre_update_in_transaction"
+	PostUpdateInTransaction           Event = "post_update_in_transaction"
+	PostUpdate                        Event = "post_update"
+	PreDelete                         Event = "pre_delete"
+	PreDeleteInTransaction            Event = "pre_delete_in_transaction"
+	PostDeleteInTransaction           Event = "post_delete_in_transaction"
+	PostDelete                        Event = "post_delete"
+	PreStateUpdateInTransaction       Event = "pre_state_update_in_transaction"
+	PostStateUpdateInTransaction      Event = "post_state_update_in_transaction"
+	PreMonitoringUpdateInTransaction  Event = "pre_monitoring_update_in_transaction"
+	PostMonitoringUpdateInTransaction Event = "post_monitoring_update_in_transaction"
+	Notification                      Event = "notification"
+)
@@ -0,0 +1,51 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golang_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cloudwan/gohan/extension/golang"
+	"github.com/cloudwan/gohan/schema"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//pluginFile is the test plugin built by specs
+const pluginFile = "./testdata/plugin.so"
+
+func TestGolangExtension(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Go Extension Suite")
+}
+
+var _ = Describe("Suite set up and tear down", func() {
+	var _ = BeforeSuite(func() {
+		Expect(schema.GetManager().LoadSchemaFromFile("./test_schema.yaml")).To(Succeed())
+		golang.RegisterGoCallback("test_callback",
+			func(event string, context map[string]interface{}) error {
+				context["person"] = "John"
+				return nil
+			})
+	})
+
+	var _ = AfterSuite(func() {
+		schema.ClearManager()
+		os.Remove(pluginFile)
+	})
+})
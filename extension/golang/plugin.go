@@ -0,0 +1,110 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golang
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+	"sync"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+const (
+	//PluginCodeType is code type of extensions loaded from go plugins
+	PluginCodeType = "goplugin"
+	//PluginSymbol is the name of PluginExtension variable exported by go plugins
+	PluginSymbol = "GohanExtension"
+	//APIVersion is version of the go extension API, go plugins built against other version are rejected
+	APIVersion = "1"
+)
+
+//PluginExtension is exported by go plugins as PluginSymbol variable:
+//
+//	var GohanExtension = golang.PluginExtension{
+//		APIVersion: golang.APIVersion,
+//		Init: func(plugin *golang.Plugin) error {
+//			plugin.RegisterHandler("network", golang.PreCreate, handler)
+//			return nil
+//		},
+//	}
+type PluginExtension struct {
+	APIVersion string
+	Init       func(plugin *Plugin) error
+}
+
+//Plugin collects handlers registered by a go plugin
+type Plugin struct {
+	handlers map[string][]schemaHandler
+}
+
+//RegisterHandler registers handler of the plugin called on the event of resources of the schema
+func (plugin *Plugin) RegisterHandler(schemaID string, event Event, handler Handler) {
+	plugin.handlers[schemaID] = append(plugin.handlers[schemaID], schemaHandler{event: event, handler: handler})
+}
+
+var (
+	pluginsMu sync.Mutex
+	plugins   = map[string]*Plugin{}
+)
+
+//LoadPlugin opens go plugin of the extension and initializes it, each plugin is initialized once
+func LoadPlugin(extension *schema.Extension) (*Plugin, error) {
+	path := strings.TrimPrefix(extension.URL, "file://")
+	if path == extension.URL || path == "" {
+		return nil, fmt.Errorf("go plugin extension %s must have url of a local file, %q given", extension.ID, extension.URL)
+	}
+
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if loaded, ok := plugins[path]; ok {
+		return loaded, nil
+	}
+	loaded, err := openPlugin(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load go plugin extension %s: %s", extension.ID, err)
+	}
+	plugins[path] = loaded
+	return loaded, nil
+}
+
+func openPlugin(path string) (*Plugin, error) {
+	opened, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s, the plugin must be built by the same Go version from the same gohan sources as this gohan binary", err)
+	}
+	symbol, err := opened.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("%s doesn't export %s variable: %s", path, PluginSymbol, err)
+	}
+	extension, ok := symbol.(*PluginExtension)
+	if !ok {
+		return nil, fmt.Errorf("%s exports %s of type %T instead of golang.PluginExtension", path, PluginSymbol, symbol)
+	}
+	if extension.APIVersion != APIVersion {
+		return nil, fmt.Errorf("%s is built against go extension API version %q, this gohan supports version %q",
+			path, extension.APIVersion, APIVersion)
+	}
+	if extension.Init == nil {
+		return nil, fmt.Errorf("%s exports %s without Init function", path, PluginSymbol)
+	}
+	loaded := &Plugin{handlers: map[string][]schemaHandler{}}
+	if err := extension.Init(loaded); err != nil {
+		return nil, fmt.Errorf("%s failed to initialize: %s", path, err)
+	}
+	return loaded, nil
+}
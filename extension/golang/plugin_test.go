@@ -0,0 +1,97 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golang_test
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/extension/golang"
+	"github.com/cloudwan/gohan/schema"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Go plugin extensions", func() {
+	newExtension := func(url string) *schema.Extension {
+		extension, err := schema.NewExtension(map[string]interface{}{
+			"id":        "test_plugin",
+			"code_type": golang.PluginCodeType,
+			"url":       url,
+			"path":      ".*",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return extension
+	}
+
+	load := func(extension *schema.Extension) (*golang.Environment, error) {
+		env := golang.NewEnvironment()
+		networkSchema, _ := schema.GetManager().Schema("network")
+		return env, env.LoadExtensionsForPath([]*schema.Extension{extension}, 0, nil, networkSchema.GetPluralURL())
+	}
+
+	It("Rejects files which aren't go plugins", func() {
+		_, err := load(newExtension("./test_schema.yaml"))
+		Expect(err).To(MatchError(ContainSubstring("must be built by the same Go version")))
+	})
+
+	It("Rejects remote plugins", func() {
+		_, err := load(newExtension("http://localhost/plugin.so"))
+		Expect(err).To(MatchError(ContainSubstring("must have url of a local file")))
+	})
+
+	// go refuses to load another file of the same plugin, so the plugin is built once
+	buildPlugin := func() {
+		if _, err := os.Stat(pluginFile); err == nil {
+			return
+		}
+		build := exec.Command("go", "build", "-buildmode=plugin", "-o", pluginFile, "./testdata/plugin")
+		if output, err := build.CombinedOutput(); err != nil {
+			Skip("go plugins can't be built here: " + string(output))
+		}
+	}
+
+	It("Binds handlers registered by the plugin", func() {
+		buildPlugin()
+
+		env, err := load(newExtension(pluginFile))
+		Expect(err).ToNot(HaveOccurred())
+		networkSchema, _ := schema.GetManager().Schema("network")
+
+		context := map[string]interface{}{
+			"schema":   networkSchema,
+			"resource": map[string]interface{}{"name": "name"},
+		}
+		Expect(env.HandleEvent("pre_create", context)).To(Succeed())
+		Expect(context).To(HaveKeyWithValue("resource", HaveKeyWithValue("description", "created by plugin")))
+
+		context["resource"] = map[string]interface{}{"name": ""}
+		err = env.Clone().HandleEvent("pre_create", context)
+		Expect(err).To(BeAssignableToTypeOf(extension.Error{}))
+		Expect(err.(extension.Error).ExceptionInfo).To(HaveKeyWithValue("code", 400))
+	})
+
+	It("Loads plugins from relative file urls", func() {
+		buildPlugin()
+
+		pluginExtension := newExtension(pluginFile)
+		pluginExtension.URL = "file://" + pluginFile
+		_, err := load(pluginExtension)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
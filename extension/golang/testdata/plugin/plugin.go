@@ -0,0 +1,36 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/cloudwan/gohan/extension/golang"
+)
+
+//GohanExtension registers handlers of this plugin
+var GohanExtension = golang.PluginExtension{
+	APIVersion: golang.APIVersion,
+	Init: func(plugin *golang.Plugin) error {
+		plugin.RegisterHandler("network", golang.PreCreate, func(context *golang.Context) error {
+			resource := context.Resource()
+			if resource["name"] == "" {
+				return golang.BadRequest("network must have a name")
+			}
+			resource["description"] = "created by plugin"
+			return nil
+		})
+		return nil
+	},
+}
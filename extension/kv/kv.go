@@ -0,0 +1,229 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/sync/memory"
+)
+
+//Path is the sync path under which the values are stored
+const Path = "/gohan/kv"
+
+//Store keeps JSON encoded values shared by extensions.
+//Values are kept in a sync backend supporting atomic updates,
+//so extensions running on all gohan processes using the backend see the same values.
+type Store struct {
+	sync    gohan_sync.Sync
+	swapper gohan_sync.Swapper
+}
+
+var (
+	mu           sync.Mutex
+	memoryStore  *Store
+	defaultStore *Store
+)
+
+//NewStore creates store keeping values in the sync backend
+func NewStore(sync gohan_sync.Sync, swapper gohan_sync.Swapper) *Store {
+	return &Store{
+		sync:    sync,
+		swapper: swapper,
+	}
+}
+
+//ForSync returns store backed by the sync when the sync supports atomic updates,
+//otherwise values are kept in memory of this process
+func ForSync(sync gohan_sync.Sync) *Store {
+	if swapper, ok := sync.(gohan_sync.Swapper); ok {
+		return NewStore(sync, swapper)
+	}
+	return Memory()
+}
+
+//Memory returns store keeping values in memory of this process
+func Memory() *Store {
+	mu.Lock()
+	defer mu.Unlock()
+	if memoryStore == nil {
+		sync, _ := memory.NewSync("")
+		memoryStore = NewStore(sync, sync)
+	}
+	return memoryStore
+}
+
+//SetDefault sets store returned by Default
+func SetDefault(store *Store) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultStore = store
+}
+
+//Default returns store set up by the server, memory store is returned when there is none
+func Default() *Store {
+	mu.Lock()
+	store := defaultStore
+	mu.Unlock()
+	if store == nil {
+		return Memory()
+	}
+	return store
+}
+
+func (store *Store) path(key string) string {
+	return Path + "/" + url.PathEscape(key)
+}
+
+//fetch returns encoded value and revision of the key, zero revision means there is no such key
+func (store *Store) fetch(key string) (string, int64, error) {
+	node, err := store.swapper.FetchKey(store.path(key))
+	if err == gohan_sync.ErrNotFound {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return node.Value, node.Revision, nil
+}
+
+func encode(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("Value can't be encoded to JSON: %s", err)
+	}
+	return string(encoded), nil
+}
+
+func decode(encoded string) (value interface{}, err error) {
+	err = json.Unmarshal([]byte(encoded), &value)
+	return
+}
+
+//Get returns value of the key, found is false when there is no such key
+func (store *Store) Get(key string) (value interface{}, found bool, err error) {
+	encoded, revision, err := store.fetch(key)
+	if err != nil || revision == 0 {
+		return nil, false, err
+	}
+	value, err = decode(encoded)
+	return value, err == nil, err
+}
+
+//Set sets value of the key, the key expires after ttl unless ttl is zero
+func (store *Store) Set(key string, value interface{}, ttl time.Duration) error {
+	encoded, err := encode(value)
+	if err != nil {
+		return err
+	}
+	for {
+		_, revision, err := store.fetch(key)
+		if err != nil {
+			return err
+		}
+		swapped, err := store.swapper.CompareAndSwap(store.path(key), encoded, revision, ttl)
+		if err != nil || swapped {
+			return err
+		}
+	}
+}
+
+//CompareAndSwap sets value of the key to newValue when the current value equals to oldValue,
+//nil oldValue means the key must not exist. The key expires after ttl unless ttl is zero.
+//Returns false when the current value differs.
+func (store *Store) CompareAndSwap(key string, oldValue, newValue interface{}, ttl time.Duration) (bool, error) {
+	oldEncoded := ""
+	if oldValue != nil {
+		var err error
+		if oldEncoded, err = encode(oldValue); err != nil {
+			return false, err
+		}
+	}
+	newEncoded, err := encode(newValue)
+	if err != nil {
+		return false, err
+	}
+	for {
+		encoded, revision, err := store.fetch(key)
+		if err != nil || encoded != oldEncoded {
+			return false, err
+		}
+		swapped, err := store.swapper.CompareAndSwap(store.path(key), newEncoded, revision, ttl)
+		if err != nil || swapped {
+			return swapped, err
+		}
+	}
+}
+
+//Increment atomically adds delta to the number kept under the key and returns the result.
+//Missing key is created with value of delta expiring after ttl unless ttl is zero,
+//increments of existing key keep its expiration.
+func (store *Store) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	for {
+		encoded, revision, err := store.fetch(key)
+		if err != nil {
+			return 0, err
+		}
+		value := delta
+		keepTTL := ttl
+		if revision != 0 {
+			var current float64
+			if err := json.Unmarshal([]byte(encoded), &current); err != nil {
+				return 0, fmt.Errorf("Value of %s is not a number", key)
+			}
+			value += int64(current)
+			keepTTL = -1
+		}
+		swapped, err := store.swapper.CompareAndSwap(store.path(key), strconv.FormatInt(value, 10), revision, keepTTL)
+		if err != nil {
+			return 0, err
+		}
+		if swapped {
+			return value, nil
+		}
+	}
+}
+
+//List returns values of keys starting with the prefix
+func (store *Store) List(prefix string) (map[string]interface{}, error) {
+	nodes, err := store.swapper.FetchPrefix(store.path(prefix))
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	for _, node := range nodes {
+		key, err := url.PathUnescape(strings.TrimPrefix(node.Key, Path+"/"))
+		if err != nil {
+			continue
+		}
+		if values[key], err = decode(node.Value); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+//Delete removes the key
+func (store *Store) Delete(key string) error {
+	return store.sync.Delete(store.path(key), false)
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/extension/kv"
+	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/sync/etcd"
+	"github.com/cloudwan/gohan/sync/memory"
+	"github.com/cloudwan/gohan/sync/noop"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KV store", func() {
+	var (
+		backend *memory.Sync
+		store   *kv.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		backend, err = memory.NewSync("")
+		Expect(err).ToNot(HaveOccurred())
+		store = kv.ForSync(backend)
+	})
+
+	AfterEach(func() {
+		backend.Close()
+	})
+
+	It("Gets values set before", func() {
+		_, found, err := store.Get("missing")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeFalse())
+
+		Expect(store.Set("key", map[string]interface{}{"a": []interface{}{1, "b"}}, 0)).To(Succeed())
+		value, found, err := store.Get("key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(value).To(Equal(map[string]interface{}{"a": []interface{}{float64(1), "b"}}))
+
+		Expect(store.Delete("key")).To(Succeed())
+		_, found, _ = store.Get("key")
+		Expect(found).To(BeFalse())
+	})
+
+	It("Keeps values in the sync backend", func() {
+		Expect(store.Set("a/b", "value", 0)).To(Succeed())
+		node, err := backend.Fetch(kv.Path + "/a%2Fb")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(node.Value).To(Equal(`"value"`))
+	})
+
+	It("Expires values after ttl", func() {
+		Expect(store.Set("key", "value", time.Second)).To(Succeed())
+		Eventually(func() bool {
+			_, found, _ := store.Get("key")
+			return found
+		}, 5*time.Second, 100*time.Millisecond).Should(BeFalse())
+	})
+
+	It("Swaps values only when the current one matches", func() {
+		swapped, err := store.CompareAndSwap("key", 1, 2, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(swapped).To(BeFalse())
+
+		swapped, err = store.CompareAndSwap("key", nil, 1, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(swapped).To(BeTrue())
+
+		swapped, _ = store.CompareAndSwap("key", nil, 2, 0)
+		Expect(swapped).To(BeFalse())
+		swapped, _ = store.CompareAndSwap("key", float64(1), 2, 0)
+		Expect(swapped).To(BeTrue())
+
+		value, _, _ := store.Get("key")
+		Expect(value).To(Equal(float64(2)))
+	})
+
+	It("Increments atomically", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					_, err := store.Increment("counter", 1, 0)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}()
+		}
+		wg.Wait()
+		Expect(store.Increment("counter", -50, 0)).To(Equal(int64(50)))
+
+		Expect(store.Set("string", "a", 0)).To(Succeed())
+		_, err := store.Increment("string", 1, 0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Keeps expiration of incremented values", func() {
+		Expect(store.Increment("counter", 1, time.Second)).To(Equal(int64(1)))
+		Expect(store.Increment("counter", 1, 0)).To(Equal(int64(2)))
+		Eventually(func() bool {
+			_, found, _ := store.Get("counter")
+			return found
+		}, 5*time.Second, 100*time.Millisecond).Should(BeFalse())
+	})
+
+	It("Lists values by key prefix", func() {
+		Expect(store.Set("limit/a", 1, 0)).To(Succeed())
+		Expect(store.Set("limit/b/c", 2, 0)).To(Succeed())
+		Expect(store.Set("limits", 3, 0)).To(Succeed())
+		Expect(store.Set("other", 4, 0)).To(Succeed())
+
+		Expect(store.List("limit/")).To(Equal(map[string]interface{}{
+			"limit/a":   float64(1),
+			"limit/b/c": float64(2),
+		}))
+		Expect(store.List("")).To(HaveLen(4))
+		Expect(store.List("missing")).To(BeEmpty())
+	})
+
+	It("Keeps values in memory for sync backends without atomic updates", func() {
+		var noopSync gohan_sync.Sync = noop.NewSync()
+		Expect(kv.ForSync(noopSync)).To(BeIdenticalTo(kv.Memory()))
+		Expect(kv.ForSync(nil)).To(BeIdenticalTo(kv.Memory()))
+		Expect(kv.Default()).To(BeIdenticalTo(kv.Memory()))
+	})
+
+	It("Keeps values in etcd v2 sync", func() {
+		Expect(kv.ForSync(etcd.NewSync([]string{"localhost:2379"}))).ToNot(BeIdenticalTo(kv.Memory()))
+	})
+})
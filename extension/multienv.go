@@ -69,3 +69,15 @@ func (env *MultiEnvironment) Clone() Environment {
 	}
 	return newEnv
 }
+
+//Reset resets child environments before reuse, it returns the first error of child environments
+func (env *MultiEnvironment) Reset() (err error) {
+	for _, env := range env.childEnv {
+		if resetter, ok := env.(Resetter); ok {
+			if resetErr := resetter.Reset(); resetErr != nil && err == nil {
+				err = resetErr
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otto
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/xyproto/otto"
+)
+
+//registerBuiltins sets the builtins in the VM, functions are kept so they can be called by other javascript environments
+func (env *Environment) registerBuiltins(builtins map[string]interface{}) {
+	for name, object := range builtins {
+		object = recordCalls(name, object)
+		if function, ok := object.(func(otto.FunctionCall) otto.Value); ok {
+			env.builtins[name] = function
+		}
+		env.VM.Set(name, object)
+	}
+}
+
+//Builtins returns names of builtin functions implemented in Go
+func (env *Environment) Builtins() []string {
+	names := make([]string, 0, len(env.builtins))
+	for name := range env.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//BuiltinException is a javascript exception thrown by a builtin
+type BuiltinException struct {
+	Value otto.Value
+}
+
+func (exception *BuiltinException) Error() string {
+	return exceptionMessage(exception.Value)
+}
+
+//Fields returns name, message and other fields of the exception,
+//exceptions derived from BaseException return all their fields
+func (exception *BuiltinException) Fields() map[string]interface{} {
+	fields := map[string]interface{}{"name": "Error", "message": exception.Error()}
+	if !exception.Value.IsObject() {
+		return fields
+	}
+	object := exception.Value.Object()
+	if toDict, err := object.Get("toDict"); err == nil && toDict.IsFunction() {
+		dict, _ := toDict.Call(exception.Value)
+		if exported, err := dict.Export(); err == nil {
+			if dictFields, ok := exported.(map[string]interface{}); ok {
+				return dictFields
+			}
+		}
+	}
+	if name, err := object.Get("name"); err == nil && name.IsString() {
+		fields["name"] = name.String()
+	}
+	return fields
+}
+
+//CallBuiltin calls the builtin with the arguments, a javascript exception thrown by the builtin is returned as BuiltinException.
+//Other panics, e.g. caused by interrupting the VM, are not recovered.
+func (env *Environment) CallBuiltin(name string, arguments []otto.Value) (result otto.Value, err error) {
+	function, ok := env.builtins[name]
+	if !ok {
+		return otto.UndefinedValue(), fmt.Errorf("Unknown builtin %s", name)
+	}
+	defer func() {
+		if caught := recover(); caught != nil {
+			exception, ok := caught.(otto.Value)
+			if !ok {
+				panic(caught)
+			}
+			err = &BuiltinException{Value: exception}
+		}
+	}()
+	result = function(otto.FunctionCall{
+		This:         otto.NullValue(),
+		ArgumentList: arguments,
+		Otto:         env.VM.Otto,
+	})
+	return result, nil
+}
+
+//Interrupt makes builtins waiting for an external event, like gohan_http, run the function.
+//It returns false when an interrupt is already pending.
+func (env *Environment) Interrupt(interrupt func()) bool {
+	select {
+	case env.VM.Interrupt <- interrupt:
+		return true
+	default:
+		return false
+	}
+}
+
+//ClearInterrupt drops an interrupt not run by any builtin
+func (env *Environment) ClearInterrupt() {
+	select {
+	case <-env.VM.Interrupt:
+	default:
+	}
+}
+
+//CloseClosers closes objects, like transactions, opened by builtins during handling of an event
+func (env *Environment) CloseClosers() {
+	vm := env.VM.Otto
+	closers, err := getClosers(vm)
+	if err != nil {
+		log.Warning(err.Error())
+		return
+	}
+	log.Debug("Closers for vm %p: %v", vm, closers)
+	for _, closer := range closers {
+		if err = closer.Close(); err != nil {
+			log.Error("Error when closing object %T %p : %s", closer, closer, err)
+		}
+	}
+}
@@ -32,6 +32,104 @@ import (
 
 var log = l.NewLogger()
 
+//ExceptionsScript defines exceptions thrown by extensions, it is shared with other javascript environments
+const ExceptionsScript = `
+	function BaseException() {
+	  this.fields = ["name", "message"]
+	  this.message = "";
+	  this.name = "BaseException";
+
+	  this.toDict = function () {
+	    return _.reduce(this.fields, function(resp, field) {
+	      resp[field] = this[field];
+	      return resp;
+	    }, {}, this);
+	  };
+
+	  this.toString = function () {
+	    return this.name.concat("(").concat(this.message).concat(")");
+	  };
+	}
+
+	function CustomException(msg, code) {
+	  BaseException.call(this);
+	  this.message = msg;
+	  this.name = "CustomException";
+	  this.code = code;
+	  this.fields.push("code");
+	}
+	CustomException.prototype = Object.create(BaseException.prototype);
+
+	function ResourceException(msg, problem) {
+	  BaseException.call(this);
+	  this.message = msg;
+	  this.name = "ResourceException";
+	  this.problem = problem;
+	  this.fields.push("problem");
+	}
+	ResourceException.prototype = Object.create(BaseException.prototype);
+
+	function ExtensionException(msg, inner_exception) {
+	  BaseException.call(this);
+	  this.message = msg;
+	  this.name = "ExtensionException";
+	  this.inner_exception = inner_exception;
+	  this.fields.push("inner_exception");
+	}
+	ExtensionException.prototype = Object.create(BaseException.prototype);
+	`
+
+//HandlersScript defines registering and handling of extension events, it is shared with other javascript environments
+const HandlersScript = `
+	var gohan_handler = {};
+	var gohan_caller = "";
+	function gohan_add_dots(str, lim){
+  		  if(str.length > lim){
+	    str = str.substring(0,lim) + "...";
+	  }
+	  return str;
+	}
+	function gohan_register_handler(event_type, func){
+	  if(_.isUndefined(gohan_handler[event_type])){
+	    gohan_handler[event_type] = [];
+	  }
+	  var handlerUUID = gohan_uuid();
+	  gohan_handler[event_type].push({fn:func,uuid:handlerUUID})
+	  gohan_log_debug("REG: id=" + handlerUUID + ", type=" + event_type.toString() +
+			", index=" + (gohan_handler[event_type].length - 1).toString())
+	}
+	function gohan_handle_event(event_type, context){
+	  if(_.isUndefined(gohan_handler[event_type])){
+	    return;
+	  }
+	  gohan_caller = gohan_uuid();
+	  for (var i = 0; i < gohan_handler[event_type].length; ++i) {
+	    try {
+	      var old_module = gohan_log_module_push(event_type);
+	      var handlerUUID = gohan_handler[event_type][i].uuid;
+	      gohan_log_debug("BEGIN: id=" + handlerUUID + ", type=" + event_type.toString())
+	      var timeStart = new Date().getTime();
+	      gohan_handler[event_type][i].fn(context);
+	      var timeStop = new Date().getTime();
+	      gohan_log_debug("END: id=" + handlerUUID + ", type=" + event_type.toString() + ", time=" + (timeStop - timeStart) + " [ms]")
+	      //backwards compatibility
+	      if (!_.isUndefined(context.response_code)) {
+	        throw new CustomException(context.response, context.response_code);
+	      }
+	    } catch(e) {
+	      if (e instanceof BaseException) {
+	        context.exception = e.toDict();
+	        context.exception_message = event_type.concat(": ").concat(e.toString());
+	      } else {
+	        throw e;
+	      }
+	    } finally {
+	      gohan_log_module_restore(old_module);
+	    }
+	  }
+	}
+	`
+
 func init() {
 	gohanInit := func(env *Environment) {
 		vm := env.VM
@@ -85,111 +183,17 @@ func init() {
 			"gohan_closers": []io.Closer{},
 		}
 
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 
 		loadNPMModules()
 		registerBuiltinModules(vm)
 
-		err := env.Load("<Gohan built-in exceptions>", `
-		function BaseException() {
-		  this.fields = ["name", "message"]
-		  this.message = "";
-		  this.name = "BaseException";
-
-		  this.toDict = function () {
-		    return _.reduce(this.fields, function(resp, field) {
-		      resp[field] = this[field];
-		      return resp;
-		    }, {}, this);
-		  };
-
-		  this.toString = function () {
-		    return this.name.concat("(").concat(this.message).concat(")");
-		  };
-		}
-
-		function CustomException(msg, code) {
-		  BaseException.call(this);
-		  this.message = msg;
-		  this.name = "CustomException";
-		  this.code = code;
-		  this.fields.push("code");
-		}
-		CustomException.prototype = Object.create(BaseException.prototype);
-
-		function ResourceException(msg, problem) {
-		  BaseException.call(this);
-		  this.message = msg;
-		  this.name = "ResourceException";
-		  this.problem = problem;
-		  this.fields.push("problem");
-		}
-		ResourceException.prototype = Object.create(BaseException.prototype);
-
-		function ExtensionException(msg, inner_exception) {
-		  BaseException.call(this);
-		  this.message = msg;
-		  this.name = "ExtensionException";
-		  this.inner_exception = inner_exception;
-		  this.fields.push("inner_exception");
-		}
-		ExtensionException.prototype = Object.create(BaseException.prototype);
-		`)
+		err := env.Load("<Gohan built-in exceptions>", ExceptionsScript)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		err = env.Load("<Gohan built-ins>", `
-		var gohan_handler = {};
-		var gohan_caller = "";
-		function gohan_add_dots(str, lim){
-  		  if(str.length > lim){
-		    str = str.substring(0,lim) + "...";
-		  }
-		  return str;
-		}
-		function gohan_register_handler(event_type, func){
-		  if(_.isUndefined(gohan_handler[event_type])){
-		    gohan_handler[event_type] = [];
-		  }
-		  var handlerUUID = gohan_uuid();
-		  gohan_handler[event_type].push({fn:func,uuid:handlerUUID})
-		  gohan_log_debug("REG: id=" + handlerUUID + ", type=" + event_type.toString() +
-				", index=" + (gohan_handler[event_type].length - 1).toString())
-		}
-		function gohan_handle_event(event_type, context){
-		  if(_.isUndefined(gohan_handler[event_type])){
-		    return;
-		  }
-		  gohan_caller = gohan_uuid();
-		  for (var i = 0; i < gohan_handler[event_type].length; ++i) {
-		    try {
-		      var old_module = gohan_log_module_push(event_type);
-		      var handlerUUID = gohan_handler[event_type][i].uuid;
-		      gohan_log_debug("BEGIN: id=" + handlerUUID + ", type=" + event_type.toString())
-		      var timeStart = new Date().getTime();
-		      gohan_handler[event_type][i].fn(context);
-		      var timeStop = new Date().getTime();
-		      gohan_log_debug("END: id=" + handlerUUID + ", type=" + event_type.toString() + ", time=" + (timeStop - timeStart) + " [ms]")
-		      //backwards compatibility
-		      if (!_.isUndefined(context.response_code)) {
-		        throw new CustomException(context.response, context.response_code);
-		      }
-		    } catch(e) {
-		      if (e instanceof BaseException) {
-		        context.exception = e.toDict();
-		        context.exception_message = event_type.concat(": ").concat(e.toString());
-		      } else {
-		        throw e;
-		      }
-		    } finally {
-		      gohan_log_module_restore(old_module);
-		    }
-		  }
-		}
-		`)
+		err = env.Load("<Gohan built-ins>", HandlersScript)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -312,7 +312,12 @@ func init() {
 				return value
 			},
 			"gohan_db_update": func(call otto.FunctionCall) otto.Value {
-				VerifyCallArguments(&call, "gohan_db_update", 3)
+				maxArgs := 4
+				if len(call.ArgumentList) < 3 || len(call.ArgumentList) > maxArgs {
+					ThrowOttoException(&call,
+						"Expected 3 or %d arguments in %s call, %d arguments given",
+						maxArgs, "gohan_db_update", len(call.ArgumentList))
+				}
 				transaction, needCommit, err := env.GetOrCreateTransaction(call.Argument(0))
 				if err != nil {
 					ThrowOttoException(&call, err.Error())
@@ -328,8 +333,16 @@ func init() {
 				if err != nil {
 					ThrowOttoException(&call, err.Error())
 				}
+				expectedVersions := []string{}
+				if len(call.ArgumentList) == maxArgs {
+					expectedVersion, err := GetString(call.Argument(3))
+					if err != nil {
+						ThrowOttoException(&call, err.Error())
+					}
+					expectedVersions = append(expectedVersions, expectedVersion)
+				}
 
-				resource, err := GohanDbUpdate(transaction, needCommit, schemaID, dataMap)
+				resource, err := GohanDbUpdate(transaction, needCommit, schemaID, dataMap, expectedVersions...)
 				if err != nil {
 					ThrowOttoException(&call, err.Error())
 				}
@@ -434,9 +447,7 @@ func init() {
 			},
 		}
 
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 	}
 	RegisterInit(gohanDBInit)
 }
@@ -448,7 +459,11 @@ func prepareListResources(schemaID string, key string, limit uint64, offset uint
 	}
 
 	if key != "" {
-		paginator, err = pagination.NewPaginator(schema, key, "", limit, offset)
+		var keys []pagination.SortKey
+		keys, err = pagination.ParseSortKeys(key)
+		if err == nil {
+			paginator, err = pagination.NewPaginatorWithKeys(schema, keys, limit, offset)
+		}
 		if err != nil {
 			return nil, nil, fmt.Errorf("Error during gohan_db_list: %s", err.Error())
 		}
@@ -582,20 +597,31 @@ func GohanDbCreate(transaction transaction.Transaction, needCommit bool, schemaI
 	return resource, nil
 }
 
-//GohanDbUpdate updates resource in database
-func GohanDbUpdate(transaction transaction.Transaction, needCommit bool, schemaID string,
-	dataMap map[string]interface{}) (*schema.Resource, error) {
+//GohanDbUpdate updates resource in database.
+//If expected versions are given, the update fails unless the stored resource has one of them.
+func GohanDbUpdate(tx transaction.Transaction, needCommit bool, schemaID string,
+	dataMap map[string]interface{}, expectedVersions ...string) (*schema.Resource, error) {
 
 	manager := schema.GetManager()
 	resource, err := manager.LoadResource(schemaID, dataMap)
 	if err != nil {
 		return nil, fmt.Errorf("Error during gohan_db_update: %s", err.Error())
 	}
-	if err = transaction.Update(resource); err != nil {
+	if len(expectedVersions) > 0 {
+		// lock the resource, so that it isn't modified by others before the update
+		current, err := tx.LockFetch(resource.Schema(), transaction.IDFilter(resource.ID()), schema.LockRelatedResources)
+		if err != nil {
+			return nil, fmt.Errorf("Error during gohan_db_update: %s", err.Error())
+		}
+		if err = transaction.CheckResourceVersion(tx, current, expectedVersions); err != nil {
+			return nil, fmt.Errorf("Error during gohan_db_update: %s", err.Error())
+		}
+	}
+	if err = tx.Update(resource); err != nil {
 		return nil, fmt.Errorf("Error during gohan_db_update: %s", err.Error())
 	}
 	if needCommit {
-		err = transaction.Commit()
+		err = tx.Commit()
 		if err != nil {
 			return nil, fmt.Errorf("Error during gohan_db_update: %s", err.Error())
 		}
@@ -241,6 +241,54 @@ var _ = Describe("GohanDb", func() {
 			)
 		})
 
+		Context("When filter operators are given", func() {
+			DescribeTable("passes the operators to the transaction",
+				func(function, methodName string) {
+					extension, err := schema.NewExtension(map[string]interface{}{
+						"id": "test_extension",
+						"code": fmt.Sprintf(`
+					  gohan_register_handler("test_event", function(context){
+					    var tx = context.transaction;
+					    context.resp = %s(
+					      tx,
+					      "test",
+					      {"test_string": {"like": "str%%"}, "tenant_id": {"in": ["t1", "t2"]}}
+					    );
+					  });`, function),
+						"path": ".*",
+					})
+					Expect(err).ToNot(HaveOccurred())
+					env := newEnvironmentWithExtension(extension, testDB)
+
+					mockTx := tr_mocks.NewMockTransaction(mockCtrl)
+					filter := transaction.Filter{
+						"test_string": map[string]interface{}{"like": "str%"},
+						"tenant_id":   map[string]interface{}{"in": []string{"t1", "t2"}},
+					}
+					listCall(mockTx, methodName, s, filter, nil).Return(
+						[]*schema.Resource{r1},
+						uint64(1),
+						nil,
+					)
+
+					context := map[string]interface{}{
+						"transaction": mockTx,
+					}
+					Expect(env.HandleEvent("test_event", context)).To(Succeed())
+
+					Expect(context["resp"]).To(
+						Equal(
+							[]map[string]interface{}{
+								map[string]interface{}{"tenant_id": "t1", "test_string": "str1", "test_bool": true},
+							},
+						),
+					)
+				},
+				Entry("gohan_db_list", "gohan_db_list", "List"),
+				Entry("gohan_db_lock_list", "gohan_db_lock_list", "LockList"),
+			)
+		})
+
 		Context("When 4 parameters are given", func() {
 			DescribeTable("returns the list ordered by given column",
 				func(function, methodName string) {
@@ -263,8 +311,56 @@ var _ = Describe("GohanDb", func() {
 
 					mockTx := tr_mocks.NewMockTransaction(mockCtrl)
 					pg := &pagination.Paginator{
-						Key:   "test_string",
-						Order: pagination.ASC,
+						Keys: []pagination.SortKey{{Key: "test_string", Order: pagination.ASC}},
+					}
+					listCall(mockTx, methodName, s, transaction.Filter{"tenant_id": "tenant0"}, pg).Return(
+						[]*schema.Resource{r0, r1},
+						uint64(2),
+						nil,
+					)
+
+					context := map[string]interface{}{
+						"transaction": mockTx,
+					}
+					Expect(env.HandleEvent("test_event", context)).To(Succeed())
+
+					Expect(context["resp"]).To(
+						Equal(
+							fakeResources,
+						),
+					)
+				},
+				Entry("gohan_db_list", "gohan_db_list", "List"),
+				Entry("gohan_db_lock_list", "gohan_db_lock_list", "LockList"),
+			)
+		})
+
+		Context("When multiple order keys are given", func() {
+			DescribeTable("returns the list ordered by given columns",
+				func(function, methodName string) {
+					extension, err := schema.NewExtension(map[string]interface{}{
+						"id": "test_extension",
+						"code": fmt.Sprintf(`
+					  gohan_register_handler("test_event", function(context){
+					    var tx = context.transaction;
+					    context.resp = %s(
+					      tx,
+					      "test",
+					      {"tenant_id": "tenant0"},
+					      "test_string,-test_bool"
+					    );
+					  });`, function),
+						"path": ".*",
+					})
+					Expect(err).ToNot(HaveOccurred())
+					env := newEnvironmentWithExtension(extension, testDB)
+
+					mockTx := tr_mocks.NewMockTransaction(mockCtrl)
+					pg := &pagination.Paginator{
+						Keys: []pagination.SortKey{
+							{Key: "test_string", Order: pagination.ASC},
+							{Key: "test_bool", Order: pagination.DESC},
+						},
 					}
 					listCall(mockTx, methodName, s, transaction.Filter{"tenant_id": "tenant0"}, pg).Return(
 						[]*schema.Resource{r0, r1},
@@ -311,8 +407,7 @@ var _ = Describe("GohanDb", func() {
 
 					mockTx := tr_mocks.NewMockTransaction(mockCtrl)
 					pg := &pagination.Paginator{
-						Key:   "test_string",
-						Order: pagination.ASC,
+						Keys:  []pagination.SortKey{{Key: "test_string", Order: pagination.ASC}},
 						Limit: 100,
 					}
 					listCall(mockTx, methodName, s, transaction.Filter{"tenant_id": "tenant0"}, pg).Return(
@@ -361,8 +456,7 @@ var _ = Describe("GohanDb", func() {
 
 					mockTx := tr_mocks.NewMockTransaction(mockCtrl)
 					pg := &pagination.Paginator{
-						Key:    "test_string",
-						Order:  pagination.ASC,
+						Keys:   []pagination.SortKey{{Key: "test_string", Order: pagination.ASC}},
 						Limit:  100,
 						Offset: 10,
 					}
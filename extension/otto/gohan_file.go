@@ -93,9 +93,7 @@ func init() {
 				return value
 			},
 		}
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 	}
 	RegisterInit(gohanFileInit)
 }
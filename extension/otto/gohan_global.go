@@ -21,15 +21,11 @@ import (
 
 func init() {
 	gohanGlobalInit := func(env *Environment) {
-		vm := env.VM
-
 		builtins := map[string]interface{}{
 			"gohan_global":         gohanGlobalBuiltin("gohan_global", env.GohanGlobal),
 			"gohan_process_global": gohanGlobalBuiltin("gohan_process_global", GohanProcessGlobal),
 		}
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 	}
 	RegisterInit(gohanGlobalInit)
 }
@@ -6,7 +6,6 @@ import (
 
 func init() {
 	gohanHookInit := func(env *Environment) {
-		vm := env.VM
 		builtins := map[string]interface{}{
 			"gohan_load_hook": func(call otto.FunctionCall) otto.Value {
 				VerifyCallArguments(&call, "gohan_load_hook", 1)
@@ -19,9 +18,7 @@ func init() {
 			},
 		}
 
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 
 	}
 	RegisterInit(gohanHookInit)
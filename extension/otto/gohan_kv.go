@@ -0,0 +1,173 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otto
+
+import (
+	"time"
+
+	"github.com/cloudwan/gohan/extension/kv"
+	"github.com/xyproto/otto"
+)
+
+func init() {
+	gohanKVInit := func(env *Environment) {
+		vm := env.VM
+
+		builtins := map[string]interface{}{
+			"gohan_kv_get": func(call otto.FunctionCall) otto.Value {
+				VerifyCallArguments(&call, "gohan_kv_get", 1)
+				key := getKVKey(&call)
+
+				var value interface{}
+				var found bool
+				var err error
+				runKVInterruptible(&call, "gohan_kv_get", func() {
+					value, found, err = kv.ForSync(env.Sync).Get(key)
+				})
+				ThrowWithMessageIfHappened(&call, err, "Failed to get %s: %s", key, err)
+				if !found {
+					return otto.NullValue()
+				}
+				result, _ := vm.ToValue(value)
+				return result
+			},
+			"gohan_kv_set": func(call otto.FunctionCall) otto.Value {
+				appendDefaultTTL(&call, 3)
+				VerifyCallArguments(&call, "gohan_kv_set", 3)
+				key := getKVKey(&call)
+				value := ConvertOttoToGo(call.Argument(1))
+				ttl := getKVTTL(&call, 2)
+
+				var err error
+				runKVInterruptible(&call, "gohan_kv_set", func() {
+					err = kv.ForSync(env.Sync).Set(key, value, ttl)
+				})
+				ThrowWithMessageIfHappened(&call, err, "Failed to set %s: %s", key, err)
+				return otto.NullValue()
+			},
+			"gohan_kv_compare_and_swap": func(call otto.FunctionCall) otto.Value {
+				appendDefaultTTL(&call, 4)
+				VerifyCallArguments(&call, "gohan_kv_compare_and_swap", 4)
+				key := getKVKey(&call)
+				oldValue := ConvertOttoToGo(call.Argument(1))
+				newValue := ConvertOttoToGo(call.Argument(2))
+				ttl := getKVTTL(&call, 3)
+
+				var swapped bool
+				var err error
+				runKVInterruptible(&call, "gohan_kv_compare_and_swap", func() {
+					swapped, err = kv.ForSync(env.Sync).CompareAndSwap(key, oldValue, newValue, ttl)
+				})
+				ThrowWithMessageIfHappened(&call, err, "Failed to compare and swap %s: %s", key, err)
+				result, _ := vm.ToValue(swapped)
+				return result
+			},
+			"gohan_kv_increment": func(call otto.FunctionCall) otto.Value {
+				if len(call.ArgumentList) == 1 {
+					defaultDelta, _ := otto.ToValue(1)
+					call.ArgumentList = append(call.ArgumentList, defaultDelta)
+				}
+				appendDefaultTTL(&call, 3)
+				VerifyCallArguments(&call, "gohan_kv_increment", 3)
+				key := getKVKey(&call)
+				delta, err := GetInt64(call.Argument(1))
+				if err != nil {
+					ThrowOttoException(&call, "Invalid type of second argument: expected an int64")
+				}
+				ttl := getKVTTL(&call, 2)
+
+				var value int64
+				runKVInterruptible(&call, "gohan_kv_increment", func() {
+					value, err = kv.ForSync(env.Sync).Increment(key, delta, ttl)
+				})
+				ThrowWithMessageIfHappened(&call, err, "Failed to increment %s: %s", key, err)
+				result, _ := vm.ToValue(value)
+				return result
+			},
+			"gohan_kv_list": func(call otto.FunctionCall) otto.Value {
+				if len(call.ArgumentList) == 0 {
+					emptyPrefix, _ := otto.ToValue("")
+					call.ArgumentList = append(call.ArgumentList, emptyPrefix)
+				}
+				VerifyCallArguments(&call, "gohan_kv_list", 1)
+				prefix := getKVKey(&call)
+
+				var values map[string]interface{}
+				var err error
+				runKVInterruptible(&call, "gohan_kv_list", func() {
+					values, err = kv.ForSync(env.Sync).List(prefix)
+				})
+				ThrowWithMessageIfHappened(&call, err, "Failed to list %s: %s", prefix, err)
+				result, _ := vm.ToValue(values)
+				return result
+			},
+			"gohan_kv_delete": func(call otto.FunctionCall) otto.Value {
+				VerifyCallArguments(&call, "gohan_kv_delete", 1)
+				key := getKVKey(&call)
+
+				var err error
+				runKVInterruptible(&call, "gohan_kv_delete", func() {
+					err = kv.ForSync(env.Sync).Delete(key)
+				})
+				ThrowWithMessageIfHappened(&call, err, "Failed to delete %s: %s", key, err)
+				return otto.NullValue()
+			},
+		}
+		env.registerBuiltins(builtins)
+	}
+	RegisterInit(gohanKVInit)
+}
+
+func getKVKey(call *otto.FunctionCall) string {
+	key, err := GetString(call.Argument(0))
+	if err != nil {
+		ThrowOttoException(call, "Invalid type of first argument: expected a string")
+	}
+	return key
+}
+
+//appendDefaultTTL appends zero ttl when the optional ttl argument is omitted
+func appendDefaultTTL(call *otto.FunctionCall, argumentsCount int) {
+	if len(call.ArgumentList) == argumentsCount-1 {
+		defaultTTL, _ := otto.ToValue(0)
+		call.ArgumentList = append(call.ArgumentList, defaultTTL)
+	}
+}
+
+//getKVTTL gets ttl given in seconds
+func getKVTTL(call *otto.FunctionCall, index int) time.Duration {
+	ttl, err := GetInt64(call.Argument(index))
+	if err != nil || ttl < 0 {
+		ThrowOttoException(call, "Invalid ttl: expected a non negative number of seconds")
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+//runKVInterruptible runs the operation unless the extension is interrupted meanwhile
+func runKVInterruptible(call *otto.FunctionCall, name string, operation func()) {
+	done := make(chan struct{})
+	go func() {
+		operation()
+		close(done)
+	}()
+
+	select {
+	case interrupt := <-call.Otto.Interrupt:
+		log.Debug("Received otto interrupt in %s", name)
+		interrupt()
+	case <-done:
+	}
+}
@@ -28,6 +28,47 @@ const (
 	wrongTypeErrorMessageFormat = "%s must be %s: %v"
 )
 
+//LoggingScript defines logging functions of extensions, it is shared with other javascript environments
+const LoggingScript = `
+	function gohan_log_module_push(new_module){
+	    var old_module = LOG_MODULE;
+	    LOG_MODULE += "." + new_module;
+	    return old_module;
+	}
+
+	function gohan_log_module_restore(old_module){
+	    LOG_MODULE = old_module;
+	}
+
+	function gohan_log(module, level, msg) {
+	    gohan_log_impl(module, level, gohan_caller, msg);
+	}
+
+	function gohan_log_critical(msg) {
+	    gohan_log(LOG_MODULE, LOG_LEVEL.CRITICAL, msg);
+	}
+
+	function gohan_log_error(msg) {
+	    gohan_log(LOG_MODULE, LOG_LEVEL.ERROR, msg);
+	}
+
+	function gohan_log_warning(msg) {
+	    gohan_log(LOG_MODULE, LOG_LEVEL.WARNING, msg);
+	}
+
+	function gohan_log_notice(msg) {
+	    gohan_log(LOG_MODULE, LOG_LEVEL.NOTICE, msg);
+	}
+
+	function gohan_log_info(msg) {
+	    gohan_log(LOG_MODULE, LOG_LEVEL.INFO, msg);
+	}
+
+	function gohan_log_debug(msg) {
+	    gohan_log(LOG_MODULE, LOG_LEVEL.DEBUG, msg);
+	}
+	`
+
 func init() {
 	gohanLoggingInit := func(env *Environment) {
 		vm := env.VM
@@ -75,9 +116,7 @@ func init() {
 				return otto.Value{}
 			},
 		}
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 
 		// op/go-logging/level.go has levelNames[], but it's unexported
 		logLevels := map[string]l.Level{
@@ -92,45 +131,7 @@ func init() {
 
 		vm.Set("LOG_MODULE", "gohan.extension."+env.Name)
 
-		err := env.Load("<Gohan logging built-ins>", `
-		function gohan_log_module_push(new_module){
-		    var old_module = LOG_MODULE;
-		    LOG_MODULE += "." + new_module;
-		    return old_module;
-		}
-
-		function gohan_log_module_restore(old_module){
-		    LOG_MODULE = old_module;
-		}
-
-		function gohan_log(module, level, msg) {
-		    gohan_log_impl(module, level, gohan_caller, msg);
-		}
-
-		function gohan_log_critical(msg) {
-		    gohan_log(LOG_MODULE, LOG_LEVEL.CRITICAL, msg);
-		}
-
-		function gohan_log_error(msg) {
-		    gohan_log(LOG_MODULE, LOG_LEVEL.ERROR, msg);
-		}
-
-		function gohan_log_warning(msg) {
-		    gohan_log(LOG_MODULE, LOG_LEVEL.WARNING, msg);
-		}
-
-		function gohan_log_notice(msg) {
-		    gohan_log(LOG_MODULE, LOG_LEVEL.NOTICE, msg);
-		}
-
-		function gohan_log_info(msg) {
-		    gohan_log(LOG_MODULE, LOG_LEVEL.INFO, msg);
-		}
-
-		function gohan_log_debug(msg) {
-		    gohan_log(LOG_MODULE, LOG_LEVEL.DEBUG, msg);
-		}
-		`)
+		err := env.Load("<Gohan logging built-ins>", LoggingScript)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -181,9 +181,7 @@ func init() {
 				return value
 			},
 		}
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 	}
 	RegisterInit(gohanRemoteInit)
 }
@@ -175,9 +175,7 @@ func init() {
 			},
 		}
 
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 	}
 	RegisterInit(gohanChainingInit)
 }
@@ -189,9 +189,7 @@ func init() {
 				return otto.NullValue()
 			},
 		}
-		for name, object := range builtins {
-			vm.Set(name, object)
-		}
+		env.registerBuiltins(builtins)
 	}
 	RegisterInit(gohanSyncInit)
 }
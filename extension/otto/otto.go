@@ -69,6 +69,11 @@ type Environment struct {
 	Sync        sync.Sync
 	globalStore *GlobalStore
 	loadHooks   []string
+	builtins    map[string]func(otto.FunctionCall) otto.Value
+	// global variables before the first handled event, restored by Reset
+	globals map[string]otto.Value
+	// true when an event failed, the environment isn't reused then
+	failed bool
 }
 
 //NewEnvironment create new gohan extension environment based on context
@@ -83,6 +88,7 @@ func NewEnvironment(name string, dataStore db.DB, identity middleware.IdentitySe
 		Sync:        sync,
 		globalStore: NewGlobalStore(),
 		loadHooks:   make([]string, 0),
+		builtins:    map[string]func(otto.FunctionCall) otto.Value{},
 	}
 	env.SetUp()
 	return env
@@ -188,6 +194,14 @@ func convertNilsToNulls(object interface{}) {
 //HandleEvent handles event
 func (env *Environment) HandleEvent(event string, context map[string]interface{}) (err error) {
 	vm := env.VM
+	defer func() {
+		if err != nil {
+			env.failed = true
+		}
+	}()
+	if env.globals == nil {
+		env.globals = env.getGlobals()
+	}
 	var closeNotifier http.CloseNotifier
 	var closeNotify <-chan bool
 	if httpResponse, ok := context["http_response"]; ok {
@@ -199,6 +213,11 @@ func (env *Environment) HandleEvent(event string, context map[string]interface{}
 	var timeout = fmt.Errorf("exceed timeout for extension execution for event: %s", event)
 	var disconnected = fmt.Errorf("client disconnected for event: %s", event)
 
+	finishRecording := env.StartRecording(event, context)
+	defer func() {
+		finishRecording(err)
+	}()
+
 	defer func() {
 		if caught := recover(); caught != nil {
 			if caughtError, ok := caught.(error); ok {
@@ -248,19 +267,7 @@ func (env *Environment) HandleEvent(event string, context map[string]interface{}
 	if err != nil {
 		return err
 	}
-	defer func() {
-		// cleanup Closers
-		if closers, err := getClosers(vm.Otto); err == nil {
-			log.Debug("Closers for vm %p: %v", vm.Otto, closers)
-			for _, closer := range closers {
-				if err = closer.Close(); err != nil {
-					log.Error("Error when closing object %T %p : %s", closer, closer, err)
-				}
-			}
-		} else {
-			log.Warning(err.Error())
-		}
-	}()
+	defer env.CloseClosers()
 	_, err = vm.Call("gohan_handle_event", nil, event, contextInVM)
 	for key, value := range context {
 		context[key] = ConvertOttoToGo(value)
@@ -335,6 +342,64 @@ func (env *Environment) Clone() ext.Environment {
 	return clone
 }
 
+//Reset clears state left by handled events and restores global variables, so the environment can be reused.
+//Objects in global variables modified in place aren't restored.
+//It returns an error when an event failed or was interrupted, the environment shouldn't be reused then.
+func (env *Environment) Reset() error {
+	vm := env.VM.Otto
+	env.ClearInterrupt()
+	if err := env.restoreGlobals(); err != nil {
+		return err
+	}
+	vm.Set("gohan_closers", []io.Closer{})
+	vm.Set(recordingVar, otto.NullValue())
+	vm.Set("gohan_caller", "")
+	vm.Set("LOG_MODULE", "gohan.extension."+env.Name)
+	if env.failed {
+		return fmt.Errorf("Environment %s failed to handle an event", env.Name)
+	}
+	return nil
+}
+
+//getGlobals returns global variables of the VM
+func (env *Environment) getGlobals() map[string]otto.Value {
+	globals := map[string]otto.Value{}
+	global, err := env.VM.Object("this")
+	if err != nil {
+		log.Error("Failed to get global object of environment %s: %s", env.Name, err)
+		return globals
+	}
+	for _, key := range global.Keys() {
+		globals[key], _ = global.Get(key)
+	}
+	return globals
+}
+
+//restoreGlobals deletes global variables set by handled events and restores overwritten ones
+func (env *Environment) restoreGlobals() error {
+	if env.globals == nil {
+		return nil
+	}
+	global, err := env.VM.Object("this")
+	if err != nil {
+		return err
+	}
+	for _, key := range global.Keys() {
+		if _, ok := env.globals[key]; ok {
+			continue
+		}
+		if _, err := env.VM.Call("(function(key) { delete this[key]; })", nil, key); err != nil {
+			return err
+		}
+	}
+	for key, value := range env.globals {
+		if err := global.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //GetOrCreateTransaction gets transaction from otto value or creates new is otto value is null
 func (env *Environment) GetOrCreateTransaction(value otto.Value) (transaction.Transaction, bool, error) {
 	if !value.IsNull() {
@@ -0,0 +1,36 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build goja
+// +build goja
+
+package otto_test
+
+import (
+	"github.com/cloudwan/gohan/extension/goja"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+var gojaEnvironmentTypes = []environmentType{
+	{
+		name: "goja",
+		newEnvironment: func() testEnvironment {
+			return goja.NewEnvironment("otto_test", testDB, &middleware.FakeIdentity{}, testSync, "javascript")
+		},
+		global: func(env testEnvironment, name string) interface{} {
+			return env.(*goja.Environment).VM.Get(name).Export()
+		},
+	},
+}
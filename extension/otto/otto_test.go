@@ -39,11 +39,56 @@ import (
 	"github.com/cloudwan/gohan/util"
 )
 
-func newEnvironment() *otto.Environment {
-	return otto.NewEnvironment("otto_test", testDB, &middleware.FakeIdentity{}, testSync)
+//testEnvironment is implemented by the javascript environments the scenarios are run against
+type testEnvironment interface {
+	extension.Environment
+	Load(source, code string) error
+	SetEventTimeLimit(eventRegex string, timeLimit time.Duration)
+	Reset() error
 }
 
+//environmentType creates environments of a javascript engine and exports their global variables
+type environmentType struct {
+	name           string
+	newEnvironment func() testEnvironment
+	global         func(env testEnvironment, name string) interface{}
+}
+
+var environmentTypes = append([]environmentType{
+	{
+		name: "otto",
+		newEnvironment: func() testEnvironment {
+			return otto.NewEnvironment("otto_test", testDB, &middleware.FakeIdentity{}, testSync)
+		},
+		global: func(env testEnvironment, name string) interface{} {
+			value, err := env.(*otto.Environment).VM.Get(name)
+			Expect(err).ToNot(HaveOccurred())
+			exported, _ := value.Export()
+			return exported
+		},
+	},
+}, gojaEnvironmentTypes...)
+
 var _ = Describe("Otto extension manager", func() {
+	for _, environmentType := range environmentTypes {
+		environmentType := environmentType
+		Context("With "+environmentType.name+" environment", func() {
+			describeExtensionManager(environmentType)
+		})
+	}
+})
+
+var _ = Describe("Using gohan_file builtin", func() {
+	for _, environmentType := range environmentTypes {
+		environmentType := environmentType
+		Context("With "+environmentType.name+" environment", func() {
+			describeFileBuiltins(environmentType)
+		})
+	}
+})
+
+func describeExtensionManager(environmentType environmentType) {
+	newEnvironment := environmentType.newEnvironment
 	var (
 		manager            *schema.Manager
 		environmentManager *extension.Manager
@@ -201,7 +246,7 @@ var _ = Describe("Otto extension manager", func() {
 				err = env.HandleEvent("test_event", context)
 				Expect(err).To(HaveOccurred())
 
-				Expect(regexp.MatchString(`ReferenceError:\s'b'`, err.Error())).To(BeTrue())
+				Expect(regexp.MatchString(`ReferenceError:\s'?b'? is not defined`, err.Error())).To(BeTrue())
 
 				pattern := regexp.MustCompile(`at\s(?P<function>\w+)\s\((?P<file>.*?):(?P<line>\d+).*?\)`)
 				match := pattern.FindStringSubmatch(err.Error())
@@ -260,7 +305,7 @@ var _ = Describe("Otto extension manager", func() {
 				extensions := []*schema.Extension{timeoutExtension}
 				env := newEnvironment()
 				env.LoadExtensionsForPath(extensions, timeLimit, timeLimits, "test_path")
-				cloned := env.Clone().(*otto.Environment)
+				cloned := env.Clone().(testEnvironment)
 
 				context := map[string]interface{}{
 					"id": "test",
@@ -268,18 +313,14 @@ var _ = Describe("Otto extension manager", func() {
 
 				err = env.HandleEvent("test_event", context)
 				Expect(err).To(MatchError(ContainSubstring("exceed timeout for extension execution")))
-				txValue1, err := env.VM.Get("unclosedTx")
-				Expect(err).ToNot(HaveOccurred())
-				tx1, err := otto.GetTransaction(txValue1)
-				Expect(err).ToNot(HaveOccurred())
+				tx1, ok := environmentType.global(env, "unclosedTx").(transaction.Transaction)
+				Expect(ok).To(BeTrue())
 				Expect(tx1.Closed()).To(BeTrue())
 
 				err = cloned.HandleEvent("test_event", context)
 				Expect(err).To(MatchError(ContainSubstring("exceed timeout for extension execution")))
-				txValue2, err := cloned.VM.Get("unclosedTx")
-				Expect(err).ToNot(HaveOccurred())
-				tx2, err := otto.GetTransaction(txValue2)
-				Expect(err).ToNot(HaveOccurred())
+				tx2, ok := environmentType.global(cloned, "unclosedTx").(transaction.Transaction)
+				Expect(ok).To(BeTrue())
 				Expect(tx1.Closed()).To(BeTrue())
 
 				Expect(tx1).NotTo(BeIdenticalTo(tx2))
@@ -359,6 +400,42 @@ var _ = Describe("Otto extension manager", func() {
 				Expect(timeDuration).Should(BeNumerically(">", time.Millisecond*200))
 			})
 		})
+
+		Context("When environment is reset for reuse", func() {
+			var env testEnvironment
+
+			BeforeEach(func() {
+				loaded := newEnvironment()
+				Expect(loaded.Load("reused_extension.js", `
+					var counter = 0;
+					gohan_register_handler("test_event", function(context) {
+						context.leaked = typeof leaked === "undefined" ? null : leaked;
+						context.counter = counter;
+						leaked = context.tenant;
+						counter = counter + 1;
+					});
+					gohan_register_handler("failing_event", function(context) {
+						throw new Error("failed");
+					});`)).To(Succeed())
+				loaded.SetEventTimeLimit(".*", timeLimit)
+				env = loaded.Clone().(testEnvironment)
+			})
+
+			It("should not keep global variables set by the previous event", func() {
+				for _, tenant := range []string{"red", "blue"} {
+					context := map[string]interface{}{"tenant": tenant}
+					Expect(env.HandleEvent("test_event", context)).To(Succeed())
+					Expect(context["leaked"]).To(BeNil())
+					Expect(context["counter"]).To(BeEquivalentTo(0))
+					Expect(env.Reset()).To(Succeed())
+				}
+			})
+
+			It("should fail to reset after a failed event", func() {
+				Expect(env.HandleEvent("failing_event", map[string]interface{}{})).ToNot(Succeed())
+				Expect(env.Reset()).ToNot(Succeed())
+			})
+		})
 	})
 
 	Describe("Using gohan_http builtin", func() {
@@ -812,6 +889,52 @@ var _ = Describe("Otto extension manager", func() {
 					Expect(context["networks"]).ToNot(BeNil())
 				})
 			})
+
+			Context("When given an expected version", func() {
+				It("Updates only resources with matching version", func() {
+					tx, err := testDB.Begin()
+					Expect(err).ToNot(HaveOccurred(), "Failed to create transaction.")
+					defer tx.Commit()
+
+					extension, err := schema.NewExtension(map[string]interface{}{
+						"id": "test_extension",
+						"code": `
+						gohan_register_handler("test_event", function(context){
+						  gohan_db_create(context.transaction,
+						    'network', {
+								'id':'test1',
+								'name': 'name',
+								'description': 'description',
+								'providor_networks': {},
+								'route_targets': [],
+								'shared': false,
+								'tenant_id': 'admin'});
+						  gohan_db_update(context.transaction,
+						    'network', {'id':'test1', 'name': 'name_updated', 'tenant_id': 'admin'}, '*');
+						  try {
+						    gohan_db_update(context.transaction,
+						      'network', {'id':'test1', 'name': 'name_stale', 'tenant_id': 'admin'}, 'stale');
+						  } catch (e) {
+						    context.error = e.message;
+						  }
+						  context.network = gohan_db_fetch(context.transaction, 'network', 'test1', 'admin');
+						});`,
+						"path": ".*",
+					})
+					Expect(err).ToNot(HaveOccurred())
+					extensions := []*schema.Extension{extension}
+					env := newEnvironment()
+					env.LoadExtensionsForPath(extensions, timeLimit, timeLimits, "test_path")
+
+					context := map[string]interface{}{
+						"id":          "test",
+						"transaction": tx,
+					}
+					Expect(env.HandleEvent("test_event", context)).To(Succeed())
+					Expect(context["error"]).To(ContainSubstring(transaction.ErrVersionMismatch.Error()))
+					Expect(context["network"]).To(HaveKeyWithValue("name", "name_updated"))
+				})
+			})
 		})
 
 		Describe("Using gohan_db_transaction", func() {
@@ -1077,7 +1200,7 @@ var _ = Describe("Otto extension manager", func() {
 							defer tx.Close()
 							context["transaction"] = tx
 							Expect(env.HandleEvent("test", context)).To(Succeed())
-							Expect(context["exception"]).To(HaveKeyWithValue("problem", int(resources.NotFound)))
+							Expect(context["exception"]).To(HaveKeyWithValue("problem", BeEquivalentTo(resources.NotFound)))
 							Expect(context["exception_message"]).To(ContainSubstring("ResourceException"))
 						})
 					})
@@ -1896,8 +2019,8 @@ var _ = Describe("Otto extension manager", func() {
 			env := newEnvironment()
 			Expect(env.LoadExtensionsForPath(extensions, timeLimit, timeLimits, "test_path")).To(Succeed())
 			context := map[string]interface{}{}
-			env.Sync.Delete("/gohan_sync_fetch_test", false)
-			env.Sync.Update("/gohan_sync_fetch_test", "{}")
+			testSync.Delete("/gohan_sync_fetch_test", false)
+			testSync.Update("/gohan_sync_fetch_test", "{}")
 			Expect(env.HandleEvent("test_event", context)).To(Succeed())
 			Expect(context).To(HaveKeyWithValue("resp", HaveKeyWithValue("value", "{}")))
 		})
@@ -1922,7 +2045,7 @@ var _ = Describe("Otto extension manager", func() {
 			Expect(env.LoadExtensionsForPath(extensions, timeLimit, timeLimits, "test_path")).To(Succeed())
 
 			context := map[string]interface{}{}
-			env.Sync.Delete("/gohan_sync_watch_test", false)
+			testSync.Delete("/gohan_sync_watch_test", false)
 			Expect(env.HandleEvent("test_event", context)).To(Succeed())
 			Expect(context).To(HaveKeyWithValue("resp", HaveLen(0)))
 		})
@@ -1946,10 +2069,10 @@ var _ = Describe("Otto extension manager", func() {
 			Expect(env.LoadExtensionsForPath(extensions, timeLimit, timeLimits, "test_path")).To(Succeed())
 
 			context := map[string]interface{}{}
-			env.Sync.Delete("/gohan_sync_watch_test", false)
+			testSync.Delete("/gohan_sync_watch_test", false)
 			go func() {
 				time.Sleep(time.Duration(200) * time.Millisecond)
-				env.Sync.Update("/gohan_sync_watch_test", "{}")
+				testSync.Update("/gohan_sync_watch_test", "{}")
 			}()
 			Expect(env.HandleEvent("test_event", context)).To(Succeed())
 			Expect(context).To(HaveKeyWithValue("resp", HaveKeyWithValue("action", "set")))
@@ -1977,10 +2100,10 @@ var _ = Describe("Otto extension manager", func() {
 			env := newEnvironment()
 			Expect(env.LoadExtensionsForPath(extensions, timeLimit, timeLimits, "test_path")).To(Succeed())
 			context := map[string]interface{}{}
-			env.Sync.Delete("/gohan_sync_delete_test", false)
-			env.Sync.Update("/gohan_sync_delete_test", "{}")
+			testSync.Delete("/gohan_sync_delete_test", false)
+			testSync.Update("/gohan_sync_delete_test", "{}")
 			Expect(env.HandleEvent("test_event", context)).To(Succeed())
-			node, err := env.Sync.Fetch("/gohan_sync_delete_test")
+			node, err := testSync.Fetch("/gohan_sync_delete_test")
 			Expect(node).To(BeNil())
 		})
 	})
@@ -2004,11 +2127,11 @@ var _ = Describe("Otto extension manager", func() {
 			env := newEnvironment()
 			Expect(env.LoadExtensionsForPath(extensions, timeLimit, timeLimits, "test_path")).To(Succeed())
 			context := map[string]interface{}{}
-			env.Sync.Delete("/gohan_sync_delete_test", true)
-			env.Sync.Update("/gohan_sync_delete_test/child1", "bla")
-			env.Sync.Update("/gohan_sync_delete_test/child2", "bar")
+			testSync.Delete("/gohan_sync_delete_test", true)
+			testSync.Update("/gohan_sync_delete_test/child1", "bla")
+			testSync.Update("/gohan_sync_delete_test/child2", "bar")
 			Expect(env.HandleEvent("test_event", context)).To(Succeed())
-			node, err := env.Sync.Fetch("/gohan_sync_delete_test")
+			node, err := testSync.Fetch("/gohan_sync_delete_test")
 			Expect(node).To(BeNil())
 		})
 	})
@@ -2019,7 +2142,11 @@ var _ = Describe("Otto extension manager", func() {
 		channel := make(chan string)
 		Context("Given environment", func() {
 			BeforeEach(func() {
-				env = newEnvironment()
+				var ok bool
+				env, ok = newEnvironment().(*otto.Environment)
+				if !ok {
+					Skip("goja runtime can't be used by several goroutines at once")
+				}
 				env.SetUp()
 				vm := env.VM
 				builtins := map[string]interface{}{
@@ -2102,7 +2229,7 @@ var _ = Describe("Otto extension manager", func() {
 				})
 				Expect(err).ToNot(HaveOccurred())
 				extensions := []*schema.Extension{extension}
-				env := otto.NewEnvironment("otto_test", testDB, &middleware.FakeIdentity{}, testSync)
+				env := newEnvironment()
 				Expect(env.LoadExtensionsForPath(extensions, time.Duration(100), timeLimits, "test_path")).To(Succeed())
 
 				context := map[string]interface{}{
@@ -2112,12 +2239,13 @@ var _ = Describe("Otto extension manager", func() {
 			})
 		})
 	})
-})
+}
 
-var _ = Describe("Using gohan_file builtin", func() {
+func describeFileBuiltins(environmentType environmentType) {
+	newEnvironment := environmentType.newEnvironment
 	var (
 		context map[string]interface{}
-		env     *otto.Environment
+		env     testEnvironment
 
 		timeLimit  time.Duration
 		timeLimits []*schema.PathEventTimeLimit
@@ -2288,4 +2416,4 @@ var _ = Describe("Using gohan_file builtin", func() {
 			Expect(context).ToNot(HaveKey("dir"))
 		})
 	})
-})
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otto
+
+import (
+	"fmt"
+
+	"github.com/xyproto/otto"
+
+	"github.com/cloudwan/gohan/extension/recording"
+)
+
+//recordingVar holds the recording of the request being handled in the VM
+const recordingVar = "gohan_recording"
+
+//recordCalls wraps the builtin, so its calls are added to the recording of the request being handled
+func recordCalls(name string, builtin interface{}) interface{} {
+	function, ok := builtin.(func(otto.FunctionCall) otto.Value)
+	if !ok || !recording.IsRecorded(name) {
+		return builtin
+	}
+	return func(call otto.FunctionCall) otto.Value {
+		rec := getRecording(call.Otto)
+		if rec == nil {
+			return function(call)
+		}
+		arguments := make([]interface{}, len(call.ArgumentList))
+		for i, argument := range call.ArgumentList {
+			arguments[i] = ConvertOttoToGo(argument)
+		}
+		defer func() {
+			if caught := recover(); caught != nil {
+				rec.AddCall(name, arguments, nil, exceptionMessage(caught))
+				panic(caught)
+			}
+		}()
+		result := function(call)
+		rec.AddCall(name, arguments, ConvertOttoToGo(result), "")
+		return result
+	}
+}
+
+func exceptionMessage(caught interface{}) string {
+	if exception, ok := caught.(otto.Value); ok && exception.IsObject() {
+		if message, err := exception.Object().Get("message"); err == nil && message.IsDefined() {
+			return message.String()
+		}
+		return exception.String()
+	}
+	return fmt.Sprint(caught)
+}
+
+func getRecording(vm *otto.Otto) *recording.Recording {
+	value, err := vm.Get(recordingVar)
+	if err != nil || !value.IsObject() {
+		return nil
+	}
+	exported, _ := value.Export()
+	rec, _ := exported.(*recording.Recording)
+	return rec
+}
+
+//StartRecording makes builtins add their calls to the recording given in the context,
+//the returned function adds the event and stops recording
+func (env *Environment) StartRecording(event string, context map[string]interface{}) func(err error) {
+	vm := env.VM.Otto
+	rec, ok := context[recording.ContextKey].(*recording.Recording)
+	if !ok {
+		return func(error) {}
+	}
+	delete(context, recording.ContextKey)
+	contextIn := copyContext(context)
+	vm.Set(recordingVar, rec)
+	return func(err error) {
+		vm.Set(recordingVar, otto.NullValue())
+		rec.AddEvent(event, contextIn, context, err)
+		context[recording.ContextKey] = rec
+	}
+}
+
+func copyContext(context map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(context))
+	for key, value := range context {
+		copied[key] = recording.Sanitize(value)
+	}
+	return copied
+}
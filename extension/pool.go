@@ -0,0 +1,188 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/metrics"
+	"github.com/cloudwan/gohan/util"
+)
+
+var log = l.NewLogger()
+
+const (
+	//PoolClone makes a new environment, not returned to the pool, when the pool is exhausted
+	PoolClone = "clone"
+	//PoolWait waits for an environment to be returned to the exhausted pool,
+	//a new environment is made when none is returned before the wait timeout
+	PoolWait = "wait"
+)
+
+//Resetter is implemented by environments clearing per-request state before they are reused,
+//Reset returns an error when the environment can't be reused, e.g. its event handling was interrupted
+type Resetter interface {
+	Reset() error
+}
+
+//PoolConfig configures pools of environments, pools are disabled when Size is 0
+type PoolConfig struct {
+	Size        int
+	Exhausted   string
+	WaitTimeout time.Duration
+}
+
+//NewPoolConfigFromConfig reads pool configuration from extension/pool section
+func NewPoolConfigFromConfig(config *util.Config) (PoolConfig, error) {
+	poolConfig := PoolConfig{
+		Size:      config.GetInt("extension/pool/size", 0),
+		Exhausted: config.GetString("extension/pool/exhausted", PoolClone),
+	}
+	if poolConfig.Size < 0 {
+		return poolConfig, fmt.Errorf("Invalid extension/pool/size: %d", poolConfig.Size)
+	}
+	if poolConfig.Exhausted != PoolClone && poolConfig.Exhausted != PoolWait {
+		return poolConfig, fmt.Errorf("Invalid extension/pool/exhausted: %s, expected %s or %s",
+			poolConfig.Exhausted, PoolClone, PoolWait)
+	}
+	waitTimeout, err := time.ParseDuration(config.GetString("extension/pool/wait_timeout", "1s"))
+	if err != nil {
+		return poolConfig, fmt.Errorf("Invalid extension/pool/wait_timeout: %s", err)
+	}
+	poolConfig.WaitTimeout = waitTimeout
+	return poolConfig, nil
+}
+
+//Pool keeps at most Size clones of an environment ready for handling events.
+//Environments taken from the pool by Get should be given back by Put.
+type Pool struct {
+	schemaID string
+	env      Environment
+	config   PoolConfig
+	idle     chan Environment
+
+	mu      sync.Mutex
+	created int
+	// pooled environments, true when the environment is taken
+	taken map[Environment]bool
+}
+
+//NewPool is a constructor for Pool, environments are cloned on demand until the pool is warmed up
+func NewPool(schemaID string, env Environment, config PoolConfig) *Pool {
+	return &Pool{
+		schemaID: schemaID,
+		env:      env,
+		config:   config,
+		idle:     make(chan Environment, config.Size),
+		taken:    map[Environment]bool{},
+	}
+}
+
+//Warm fills the pool with clones of the environment
+func (pool *Pool) Warm() {
+	for {
+		env, ok := pool.grow()
+		if !ok {
+			return
+		}
+		pool.Put(env)
+	}
+}
+
+//Get takes an environment from the pool
+func (pool *Pool) Get() Environment {
+	select {
+	case env := <-pool.idle:
+		return pool.take(env, "hit")
+	default:
+	}
+	if env, ok := pool.grow(); ok {
+		return pool.take(env, "miss")
+	}
+	if pool.config.Exhausted == PoolWait {
+		timeStarted := time.Now()
+		timer := time.NewTimer(pool.config.WaitTimeout)
+		defer timer.Stop()
+		select {
+		case env := <-pool.idle:
+			metrics.UpdateTimer(timeStarted, "extension_pool_wait.%s", pool.schemaID)
+			return pool.take(env, "wait")
+		case <-timer.C:
+			metrics.UpdateTimer(timeStarted, "extension_pool_wait.%s", pool.schemaID)
+		}
+	}
+	metrics.UpdateCounter(1, "extension_pool.%s.exhausted", pool.schemaID)
+	return pool.env.Clone()
+}
+
+//Put gives back the environment to the pool, environments not taken from the pool are ignored.
+//Environments failing to reset are dropped, so the pool clones a new one.
+func (pool *Pool) Put(env Environment) {
+	pool.mu.Lock()
+	taken, pooled := pool.taken[env]
+	if pooled {
+		pool.taken[env] = false
+	}
+	pool.mu.Unlock()
+	if !pooled || !taken {
+		return
+	}
+	if resetter, ok := env.(Resetter); ok {
+		if err := resetter.Reset(); err != nil {
+			log.Debug("Dropping environment from pool of %s: %s", pool.schemaID, err)
+			pool.drop(env)
+			return
+		}
+	}
+	pool.idle <- env
+}
+
+//drop removes the environment from the pool, so the pool can grow again
+func (pool *Pool) drop(env Environment) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	delete(pool.taken, env)
+	pool.created--
+}
+
+//grow clones the environment for the pool unless the pool is full
+func (pool *Pool) grow() (Environment, bool) {
+	pool.mu.Lock()
+	if pool.created >= pool.config.Size {
+		pool.mu.Unlock()
+		return nil, false
+	}
+	pool.created++
+	pool.mu.Unlock()
+
+	env := pool.env.Clone()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.taken[env] = true
+	return env, true
+}
+
+func (pool *Pool) take(env Environment, result string) Environment {
+	metrics.UpdateCounter(1, "extension_pool.%s.%s", pool.schemaID, result)
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.taken[env] = true
+	return env
+}
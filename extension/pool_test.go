@@ -0,0 +1,171 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/schema"
+)
+
+type countingEnvironment struct {
+	clones *int32
+	resets int
+	failed bool
+}
+
+func (env *countingEnvironment) LoadExtensionsForPath(extensions []*schema.Extension, timeLimit time.Duration, timeLimits []*schema.PathEventTimeLimit, path string) error {
+	return nil
+}
+
+func (env *countingEnvironment) HandleEvent(event string, context map[string]interface{}) error {
+	return nil
+}
+
+func (env *countingEnvironment) Clone() extension.Environment {
+	atomic.AddInt32(env.clones, 1)
+	return &countingEnvironment{clones: env.clones}
+}
+
+func (env *countingEnvironment) Reset() error {
+	env.resets++
+	if env.failed {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+var _ = Describe("Environment pool", func() {
+	var (
+		clones int32
+		env    *countingEnvironment
+		config extension.PoolConfig
+	)
+
+	BeforeEach(func() {
+		clones = 0
+		env = &countingEnvironment{clones: &clones}
+		config = extension.PoolConfig{Size: 2, Exhausted: extension.PoolClone, WaitTimeout: time.Second}
+	})
+
+	It("Reuses returned environments", func() {
+		pool := extension.NewPool("test", env, config)
+		pool.Warm()
+		Expect(clones).To(BeEquivalentTo(2))
+
+		first := pool.Get()
+		pool.Put(first)
+		Expect(first.(*countingEnvironment).resets).To(Equal(2))
+		second := pool.Get()
+		third := pool.Get()
+		Expect([]extension.Environment{second, third}).To(ContainElement(BeIdenticalTo(first)))
+		Expect(clones).To(BeEquivalentTo(2))
+	})
+
+	It("Clones environments on demand before warming up", func() {
+		pool := extension.NewPool("test", env, config)
+		pool.Get()
+		Expect(clones).To(BeEquivalentTo(1))
+		pool.Warm()
+		Expect(clones).To(BeEquivalentTo(2))
+	})
+
+	It("Clones environments not returned to the pool when exhausted", func() {
+		pool := extension.NewPool("test", env, config)
+		pool.Get()
+		pool.Get()
+		extra := pool.Get()
+		Expect(clones).To(BeEquivalentTo(3))
+
+		pool.Put(extra)
+		Expect(extra.(*countingEnvironment).resets).To(Equal(0))
+	})
+
+	It("Ignores environments returned twice", func() {
+		config.Size = 1
+		pool := extension.NewPool("test", env, config)
+		taken := pool.Get()
+		pool.Put(taken)
+		pool.Put(taken)
+		Expect(pool.Get()).To(BeIdenticalTo(taken))
+		Expect(pool.Get()).ToNot(BeIdenticalTo(taken))
+	})
+
+	It("Drops environments failing to reset", func() {
+		config.Size = 1
+		pool := extension.NewPool("test", env, config)
+		failed := pool.Get()
+		failed.(*countingEnvironment).failed = true
+		pool.Put(failed)
+
+		taken := pool.Get()
+		Expect(taken).ToNot(BeIdenticalTo(failed))
+		pool.Put(taken)
+		Expect(pool.Get()).To(BeIdenticalTo(taken))
+		Expect(clones).To(BeEquivalentTo(2))
+	})
+
+	Context("When waiting for exhausted pool", func() {
+		BeforeEach(func() {
+			config.Size = 1
+			config.Exhausted = extension.PoolWait
+		})
+
+		It("Takes environment returned during wait", func() {
+			pool := extension.NewPool("test", env, config)
+			taken := pool.Get()
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				pool.Put(taken)
+			}()
+			Expect(pool.Get()).To(BeIdenticalTo(taken))
+			Expect(clones).To(BeEquivalentTo(1))
+		})
+
+		It("Clones environment after wait timeout", func() {
+			config.WaitTimeout = 50 * time.Millisecond
+			pool := extension.NewPool("test", env, config)
+			taken := pool.Get()
+			Expect(pool.Get()).ToNot(BeIdenticalTo(taken))
+			Expect(clones).To(BeEquivalentTo(2))
+		})
+	})
+
+	Context("When pool is configured in manager", func() {
+		AfterEach(func() {
+			extension.ClearManager()
+		})
+
+		It("Takes environments from the pool", func() {
+			manager := extension.GetManager()
+			manager.SetPoolConfig(config)
+			Expect(manager.RegisterEnvironment("test", env)).To(Succeed())
+			Eventually(func() int32 { return atomic.LoadInt32(&clones) }).Should(BeEquivalentTo(2))
+
+			taken, ok := manager.GetEnvironment("test")
+			Expect(ok).To(BeTrue())
+			manager.ReturnEnvironment("test", taken)
+			Expect(taken.(*countingEnvironment).resets).To(Equal(2))
+			Expect(atomic.LoadInt32(&clones)).To(BeEquivalentTo(2))
+		})
+	})
+})
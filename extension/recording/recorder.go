@@ -0,0 +1,156 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwan/gohan/util"
+)
+
+var fileNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+//Recorder saves recordings of API requests matching configured paths as extension tests
+type Recorder struct {
+	dir         string
+	paths       []*regexp.Regexp
+	methods     []string
+	schemaFiles []string
+	count       int64
+}
+
+//NewRecorder is a constructor for Recorder. Requests with paths matching one of the paths
+//and one of the methods are recorded, all methods are recorded when none is given.
+func NewRecorder(dir string, paths []*regexp.Regexp, methods []string, schemaFiles []string) *Recorder {
+	upperMethods := make([]string, len(methods))
+	for i, method := range methods {
+		upperMethods[i] = strings.ToUpper(method)
+	}
+	return &Recorder{
+		dir:         dir,
+		paths:       paths,
+		methods:     upperMethods,
+		schemaFiles: schemaFiles,
+	}
+}
+
+//NewRecorderFromConfig creates Recorder configured by recording section,
+//nil is returned when no paths to record are configured
+func NewRecorderFromConfig(config *util.Config) (*Recorder, error) {
+	rawPaths := config.GetStringList("recording/paths", nil)
+	if len(rawPaths) == 0 {
+		return nil, nil
+	}
+	paths := make([]*regexp.Regexp, len(rawPaths))
+	for i, rawPath := range rawPaths {
+		path, err := regexp.Compile(rawPath)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid recording/paths: %s", err)
+		}
+		paths[i] = path
+	}
+	dir := config.GetString("recording/dir", "recordings")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create recording/dir: %s", err)
+	}
+	schemaFiles := []string{}
+	for _, schemaFile := range config.GetStringList("schemas", nil) {
+		if !strings.Contains(schemaFile, "://") {
+			absolute, err := filepath.Abs(schemaFile)
+			if err == nil {
+				schemaFile = absolute
+			}
+		}
+		schemaFiles = append(schemaFiles, schemaFile)
+	}
+	return NewRecorder(dir, paths, config.GetStringList("recording/methods", nil), schemaFiles), nil
+}
+
+//Match returns true when requests with the method and path should be recorded
+func (recorder *Recorder) Match(method, path string) bool {
+	if len(recorder.methods) > 0 && !util.ContainsString(recorder.methods, strings.ToUpper(method)) {
+		return false
+	}
+	for _, pattern := range recorder.paths {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+//Save writes the recording as an extension test to the recordings directory and returns path of the test file
+func (recorder *Recorder) Save(recording *Recording) (string, error) {
+	count := atomic.AddInt64(&recorder.count, 1)
+	name := fmt.Sprintf("test_%s_%d_%s%s.js",
+		time.Now().UTC().Format("20060102_150405"), count, strings.ToLower(recording.Method),
+		strings.TrimSuffix(fileNameUnsafe.ReplaceAllString(recording.URL, "_"), "_"))
+	filePath := filepath.Join(recorder.dir, name)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteTest(file, recording, recorder.schemaFiles); err != nil {
+		file.Close()
+		return "", err
+	}
+	return filePath, file.Close()
+}
+
+//WriteTest writes an extension test replaying the recording with extensions loaded from the schema files
+func WriteTest(w io.Writer, recording *Recording, schemaFiles []string) error {
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+
+	encodedRecording, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return err
+	}
+	encodedSchemas, err := json.Marshal(schemaFiles)
+	if err != nil {
+		return err
+	}
+	encodedPath, err := json.Marshal(recording.Path)
+	if err != nil {
+		return err
+	}
+	status := 0
+	if recording.Response != nil {
+		status = recording.Response.Status
+	}
+	_, err = fmt.Fprintf(w, `// Recorded %s %s with response status %d.
+// Extension events of the request are replayed with calls to gohan_http, gohan_raw_http,
+// gohan_exec, gohan_uuid and gohan_db_* served from the recording.
+
+var SCHEMA_INCLUDES = [];
+var SCHEMAS = %s;
+var PATH = %s;
+var RECORDING = %s;
+
+function testReplay() {
+  Replay(RECORDING);
+}
+`, recording.Method, recording.URL, status, encodedSchemas, encodedPath, encodedRecording)
+	return err
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+//ContextKey is the key of the recording in the context of a recorded request
+const ContextKey = "recording"
+
+//redacted replaces values of secret keys in recordings
+const redacted = "<redacted>"
+
+var secretKeys = []string{"x-auth-token", "x-subject-token", "auth_token", "password"}
+
+//Recording holds extension events of a single API request together with calls
+//to builtins having side effects or external dependencies, so the request can be replayed in tests
+type Recording struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Path     string      `json:"path"`
+	Request  interface{} `json:"request,omitempty"`
+	Events   []*Event    `json:"events"`
+	Calls    []*Call     `json:"calls"`
+	Response *Response   `json:"response,omitempty"`
+
+	mu sync.Mutex
+}
+
+//Event is an extension event handled during the request
+type Event struct {
+	Event      string                 `json:"event"`
+	ContextIn  map[string]interface{} `json:"context_in"`
+	ContextOut map[string]interface{} `json:"context_out"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+//Call is a call to a recorded builtin
+type Call struct {
+	Function  string        `json:"function"`
+	Arguments []interface{} `json:"arguments"`
+	Result    interface{}   `json:"result"`
+	Error     string        `json:"error,omitempty"`
+}
+
+//Response is the response to the request
+type Response struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+//NewRecording is a constructor for Recording
+func NewRecording(method, url string, request interface{}) *Recording {
+	return &Recording{
+		Method:  method,
+		URL:     url,
+		Request: Sanitize(request),
+		Events:  []*Event{},
+		Calls:   []*Call{},
+	}
+}
+
+//IsRecorded returns true when calls to the builtin are recorded
+func IsRecorded(function string) bool {
+	switch function {
+	case "gohan_http", "gohan_raw_http", "gohan_exec", "gohan_uuid":
+		return true
+	}
+	return strings.HasPrefix(function, "gohan_db_")
+}
+
+//AddEvent adds handled event with the context before and after handling it
+func (recording *Recording) AddEvent(event string, contextIn, contextOut map[string]interface{}, err error) {
+	recorded := &Event{
+		Event:      event,
+		ContextIn:  sanitizeContext(contextIn),
+		ContextOut: sanitizeContext(contextOut),
+	}
+	if err != nil {
+		recorded.Error = err.Error()
+	}
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	recording.Events = append(recording.Events, recorded)
+}
+
+//AddCall adds a call to a recorded builtin
+func (recording *Recording) AddCall(function string, arguments []interface{}, result interface{}, callErr string) {
+	call := &Call{
+		Function:  function,
+		Arguments: make([]interface{}, len(arguments)),
+		Result:    Sanitize(result),
+		Error:     callErr,
+	}
+	for i, argument := range arguments {
+		call.Arguments[i] = Sanitize(argument)
+	}
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	recording.Calls = append(recording.Calls, call)
+}
+
+//SetResponse sets the response to the request
+func (recording *Recording) SetResponse(status int, body interface{}) {
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	recording.Response = &Response{Status: status, Body: Sanitize(body)}
+}
+
+func sanitizeContext(context map[string]interface{}) map[string]interface{} {
+	sanitized := map[string]interface{}{}
+	for key, value := range context {
+		if key == ContextKey {
+			continue
+		}
+		if isSecretKey(key) {
+			sanitized[key] = redacted
+			continue
+		}
+		if value = Sanitize(value); value != nil {
+			sanitized[key] = value
+		}
+	}
+	return sanitized
+}
+
+//Sanitize returns a copy of the value with JSON data only. Authorizations are replaced
+//by their tenant and roles, values of secret keys are redacted and other objects,
+//like transactions, are replaced by nil.
+func Sanitize(value interface{}) interface{} {
+	switch value := value.(type) {
+	case nil, bool, string, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return value
+	case map[string]interface{}:
+		sanitized := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			if isSecretKey(key) {
+				sanitized[key] = redacted
+				continue
+			}
+			sanitized[key] = Sanitize(item)
+		}
+		return sanitized
+	case []interface{}:
+		sanitized := make([]interface{}, len(value))
+		for i, item := range value {
+			sanitized[i] = Sanitize(item)
+		}
+		return sanitized
+	case http.Header:
+		sanitized := make(map[string]interface{}, len(value))
+		for key := range value {
+			if isSecretKey(key) {
+				sanitized[key] = redacted
+				continue
+			}
+			sanitized[key] = value.Get(key)
+		}
+		return sanitized
+	case schema.Authorization:
+		roles := []interface{}{}
+		for _, role := range value.Roles() {
+			roles = append(roles, role.Name)
+		}
+		return map[string]interface{}{
+			"tenant_id":   value.TenantID(),
+			"tenant_name": value.TenantName(),
+			"roles":       roles,
+		}
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		// typed collections of plain data, e.g. []string or []map[string]interface{}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return nil
+		}
+		return Sanitize(decoded)
+	}
+	return nil
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if key == secret {
+			return true
+		}
+	}
+	return false
+}
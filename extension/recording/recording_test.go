@@ -0,0 +1,114 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recording_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/cloudwan/gohan/extension/recording"
+	"github.com/cloudwan/gohan/schema"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recording", func() {
+	Describe("Sanitize", func() {
+		It("Keeps JSON data", func() {
+			data := map[string]interface{}{
+				"name":  "net1",
+				"count": 3,
+				"tags":  []interface{}{"a", true, nil},
+			}
+			Expect(recording.Sanitize(data)).To(Equal(data))
+		})
+
+		It("Redacts secrets", func() {
+			header := http.Header{}
+			header.Set("X-Auth-Token", "secret")
+			header.Set("Content-Type", "application/json")
+			Expect(recording.Sanitize(map[string]interface{}{
+				"headers":  header,
+				"password": "secret",
+			})).To(Equal(map[string]interface{}{
+				"headers": map[string]interface{}{
+					"X-Auth-Token": "<redacted>",
+					"Content-Type": "application/json",
+				},
+				"password": "<redacted>",
+			}))
+		})
+
+		It("Replaces authorizations by tenant and roles", func() {
+			auth := schema.NewAuthorization("t1", "tenant", "token", []string{"admin"}, nil)
+			Expect(recording.Sanitize(auth)).To(Equal(map[string]interface{}{
+				"tenant_id":   "t1",
+				"tenant_name": "tenant",
+				"roles":       []interface{}{"admin"},
+			}))
+		})
+
+		It("Converts typed collections and drops other objects", func() {
+			Expect(recording.Sanitize([]string{"a", "b"})).To(Equal([]interface{}{"a", "b"}))
+			Expect(recording.Sanitize(&bytes.Buffer{})).To(BeNil())
+		})
+	})
+
+	Describe("Recorder", func() {
+		var recorder *recording.Recorder
+
+		BeforeEach(func() {
+			recorder = recording.NewRecorder("recordings",
+				[]*regexp.Regexp{regexp.MustCompile("^/v2.0/networks")}, []string{"post"}, nil)
+		})
+
+		It("Matches configured paths and methods", func() {
+			Expect(recorder.Match("POST", "/v2.0/networks")).To(BeTrue())
+			Expect(recorder.Match("GET", "/v2.0/networks")).To(BeFalse())
+			Expect(recorder.Match("POST", "/v2.0/subnets")).To(BeFalse())
+		})
+	})
+
+	Describe("WriteTest", func() {
+		It("Writes an extension test replaying the recording", func() {
+			rec := recording.NewRecording("POST", "/v2.0/networks", map[string]interface{}{"name": "net1"})
+			rec.Path = "/v2.0/networks"
+			rec.AddCall("gohan_uuid", []interface{}{}, "uuid1", "")
+			rec.AddEvent("pre_create",
+				map[string]interface{}{
+					"resource":           map[string]interface{}{"name": "net1"},
+					"auth_token":         "secret",
+					recording.ContextKey: rec,
+				},
+				map[string]interface{}{"resource": map[string]interface{}{"name": "net1", "id": "uuid1"}},
+				fmt.Errorf("failed"))
+			rec.SetResponse(201, map[string]interface{}{"id": "uuid1"})
+
+			buffer := &bytes.Buffer{}
+			Expect(recording.WriteTest(buffer, rec, []string{"/etc/gohan/schema.yaml"})).To(Succeed())
+			test := buffer.String()
+			Expect(test).To(ContainSubstring(`var SCHEMAS = ["/etc/gohan/schema.yaml"];`))
+			Expect(test).To(ContainSubstring(`var PATH = "/v2.0/networks";`))
+			Expect(test).To(ContainSubstring(`"function": "gohan_uuid"`))
+			Expect(test).To(ContainSubstring(`"error": "failed"`))
+			Expect(test).ToNot(ContainSubstring(`"recording"`))
+			Expect(test).ToNot(ContainSubstring("secret"))
+			Expect(test).To(ContainSubstring("Replay(RECORDING);"))
+		})
+	})
+})
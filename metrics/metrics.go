@@ -18,13 +18,13 @@ var (
 	log               = l.NewLogger()
 )
 
-func getGraphitePercentiles(config *util.Config) (percentiles []float64, err error) {
+func getPercentiles(config *util.Config, key string) (percentiles []float64, err error) {
 	defaultPercentiles := []string{"0.5", "0.75", "0.95", "0.99", "0.999"}
-	percentilesStr := config.GetStringList("metrics/graphite/percentiles", defaultPercentiles)
+	percentilesStr := config.GetStringList(key, defaultPercentiles)
 	percentiles = make([]float64, len(percentilesStr))
 	for i, v := range percentilesStr {
 		if percentiles[i], err = strconv.ParseFloat(v, 64); err != nil {
-			return nil, fmt.Errorf("Error '%s' when parsing metrics/graphite/percentiles, expecting a float, '%s' given", err, v)
+			return nil, fmt.Errorf("Error '%s' when parsing %s, expecting a float, '%s' given", err, key, v)
 		}
 	}
 
@@ -40,7 +40,7 @@ func getGraphiteConfig(config *util.Config) (graphiteConfigs []graphite.Config,
 
 	var baseconfig graphite.Config
 
-	if baseconfig.Percentiles, err = getGraphitePercentiles(config); err != nil {
+	if baseconfig.Percentiles, err = getPercentiles(config, "metrics/graphite/percentiles"); err != nil {
 		return nil, err
 	}
 	baseconfig.FlushInterval = time.Duration(config.GetInt("metrics/graphite/flush_interval_sec", 60)) * time.Second
@@ -63,7 +63,13 @@ func getGraphiteConfig(config *util.Config) (graphiteConfigs []graphite.Config,
 
 func SetupMetrics(config *util.Config) (err error) {
 	monitoringEnabled = config.GetBool("metrics/enabled", false)
-	graphiteConfigs, err = getGraphiteConfig(config)
+	if graphiteConfigs, err = getGraphiteConfig(config); err != nil {
+		return
+	}
+	prometheusEnabled = monitoringEnabled && config.GetBool("metrics/prometheus/enabled", false)
+	if prometheusEnabled {
+		prometheusPercentiles, err = getPercentiles(config, "metrics/prometheus/percentiles")
+	}
 	return
 }
 
@@ -85,3 +91,10 @@ func UpdateTimer(since time.Time, format string, args ...interface{}) {
 		m.UpdateSince(since)
 	}
 }
+
+func UpdateCounter(delta int64, format string, args ...interface{}) {
+	if monitoringEnabled {
+		m := metrics.GetOrRegisterCounter(fmt.Sprintf(format, args...), metrics.DefaultRegistry)
+		m.Inc(delta)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rcrowley/go-metrics"
+)
+
+//PrometheusPath is the HTTP path the metrics are exposed at in Prometheus text format
+const PrometheusPath = "/metrics"
+
+var (
+	prometheusEnabled     bool
+	prometheusPercentiles []float64
+	registerPrometheus    sync.Once
+)
+
+//prometheusFamily maps metrics with given prefix to a Prometheus metric family,
+//the rest of the metric name is split by dots into label values, the last label gets the remainder
+type prometheusFamily struct {
+	prefix    string
+	isCounter bool
+	labels    []string
+	desc      *prometheus.Desc
+}
+
+var prometheusFamilies = []*prometheusFamily{
+	newPrometheusFamily("req.", "gohan_request_duration_seconds",
+		"Time of handling API requests.", false, "schema", "type"),
+	newPrometheusFamily("ext.", "gohan_extension_duration_seconds",
+		"Time of handling extension events.", false, "schema", "event"),
+	newPrometheusFamily("sync.", "gohan_sync_watch_duration_seconds",
+		"Time of processing sync watch events.", false, "action"),
+	newPrometheusFamily("state.", "gohan_state_watch_duration_seconds",
+		"Time of processing state watch events.", false, "schema", "event"),
+	newPrometheusFamily("watch.compaction.", "gohan_sync_watch_compactions_total",
+		"Number of sync watches resumed from a snapshot after compaction.", true, "path"),
+	newPrometheusFamily("watch.compaction_gap.", "gohan_sync_watch_compaction_gap_revisions_total",
+		"Number of revisions skipped by sync watches resumed after compaction.", true, "path"),
+	newPrometheusFamily("auth.token_cache.", "gohan_token_cache_requests_total",
+		"Number of token verifications by token cache result.", true, "result"),
+	newPrometheusFamily("extension_pool_wait.", "gohan_extension_pool_wait_seconds",
+		"Time of waiting for an extension environment returned to the exhausted pool.", false, "schema"),
+	newPrometheusFamily("extension_pool.", "gohan_extension_pool_checkouts_total",
+		"Number of extension environments taken from the pool by result.", true, "schema", "result"),
+}
+
+func newPrometheusFamily(prefix, name, help string, isCounter bool, labels ...string) *prometheusFamily {
+	return &prometheusFamily{
+		prefix:    prefix,
+		isCounter: isCounter,
+		labels:    labels,
+		desc:      prometheus.NewDesc(name, help, labels, nil),
+	}
+}
+
+//PrometheusEnabled returns true when metrics should be exposed at PrometheusPath
+func PrometheusEnabled() bool {
+	return prometheusEnabled
+}
+
+//PrometheusHandler returns the HTTP handler exposing gohan metrics together with
+//Go runtime and process statistics in Prometheus text format
+func PrometheusHandler() http.Handler {
+	registerPrometheus.Do(func() {
+		prometheus.MustRegister(newPrometheusCollector(metrics.DefaultRegistry, prometheusPercentiles))
+	})
+	return prometheus.UninstrumentedHandler()
+}
+
+//prometheusCollector translates metrics from go-metrics registry on each scrape
+type prometheusCollector struct {
+	registry    metrics.Registry
+	percentiles []float64
+}
+
+func newPrometheusCollector(registry metrics.Registry, percentiles []float64) *prometheusCollector {
+	return &prometheusCollector{
+		registry:    registry,
+		percentiles: percentiles,
+	}
+}
+
+//Describe implements prometheus.Collector
+func (collector *prometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, family := range prometheusFamilies {
+		ch <- family.desc
+	}
+}
+
+//Collect implements prometheus.Collector
+func (collector *prometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.registry.Each(func(name string, i interface{}) {
+		family, labels, ok := findPrometheusFamily(name)
+		if !ok {
+			return
+		}
+		switch metric := i.(type) {
+		case metrics.Timer:
+			if family.isCounter {
+				return
+			}
+			snapshot := metric.Snapshot()
+			values := snapshot.Percentiles(collector.percentiles)
+			quantiles := make(map[float64]float64, len(values))
+			for i, percentile := range collector.percentiles {
+				quantiles[percentile] = values[i] / 1e9
+			}
+			ch <- prometheus.MustNewConstSummary(family.desc,
+				uint64(snapshot.Count()), float64(snapshot.Sum())/1e9, quantiles, labels...)
+		case metrics.Counter:
+			if !family.isCounter {
+				return
+			}
+			ch <- prometheus.MustNewConstMetric(family.desc, prometheus.CounterValue, float64(metric.Count()), labels...)
+		}
+	})
+}
+
+func findPrometheusFamily(name string) (*prometheusFamily, []string, bool) {
+	for _, family := range prometheusFamilies {
+		if !strings.HasPrefix(name, family.prefix) {
+			continue
+		}
+		labels := strings.SplitN(strings.TrimPrefix(name, family.prefix), ".", len(family.labels))
+		if len(labels) != len(family.labels) {
+			return nil, nil, false
+		}
+		return family, labels, true
+	}
+	return nil, nil, false
+}
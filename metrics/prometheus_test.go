@@ -0,0 +1,113 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rcrowley/go-metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prometheus collector", func() {
+	var (
+		registry metrics.Registry
+		gatherer *prometheus.Registry
+	)
+
+	BeforeEach(func() {
+		registry = metrics.NewRegistry()
+		gatherer = prometheus.NewPedanticRegistry()
+		gatherer.MustRegister(newPrometheusCollector(registry, []float64{0.5, 0.99}))
+	})
+
+	gather := func() map[string]*dto.MetricFamily {
+		families, err := gatherer.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		result := map[string]*dto.MetricFamily{}
+		for _, family := range families {
+			result[family.GetName()] = family
+		}
+		return result
+	}
+
+	labels := func(metric *dto.Metric) map[string]string {
+		result := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			result[label.GetName()] = label.GetValue()
+		}
+		return result
+	}
+
+	It("Exposes timers as summaries labeled by schema and event", func() {
+		metrics.GetOrRegisterTimer("req.network.restore.in_tx", registry).Update(2 * time.Second)
+		metrics.GetOrRegisterTimer("ext.network.pre_create", registry).Update(time.Second)
+		metrics.GetOrRegisterTimer("sync.update", registry).Update(time.Second)
+
+		families := gather()
+		request := families["gohan_request_duration_seconds"]
+		Expect(request).ToNot(BeNil())
+		Expect(request.GetType()).To(Equal(dto.MetricType_SUMMARY))
+		Expect(labels(request.GetMetric()[0])).To(Equal(map[string]string{"schema": "network", "type": "restore.in_tx"}))
+		summary := request.GetMetric()[0].GetSummary()
+		Expect(summary.GetSampleCount()).To(Equal(uint64(1)))
+		Expect(summary.GetSampleSum()).To(Equal(2.0))
+		Expect(summary.GetQuantile()).To(HaveLen(2))
+
+		extension := families["gohan_extension_duration_seconds"]
+		Expect(extension).ToNot(BeNil())
+		Expect(labels(extension.GetMetric()[0])).To(Equal(map[string]string{"schema": "network", "event": "pre_create"}))
+
+		sync := families["gohan_sync_watch_duration_seconds"]
+		Expect(sync).ToNot(BeNil())
+		Expect(labels(sync.GetMetric()[0])).To(Equal(map[string]string{"action": "update"}))
+	})
+
+	It("Exposes token cache counters", func() {
+		metrics.GetOrRegisterCounter("auth.token_cache.hit", registry).Inc(3)
+
+		family := gather()["gohan_token_cache_requests_total"]
+		Expect(family).ToNot(BeNil())
+		Expect(family.GetType()).To(Equal(dto.MetricType_COUNTER))
+		Expect(labels(family.GetMetric()[0])).To(Equal(map[string]string{"result": "hit"}))
+		Expect(family.GetMetric()[0].GetCounter().GetValue()).To(Equal(3.0))
+	})
+
+	It("Exposes extension pool metrics", func() {
+		metrics.GetOrRegisterCounter("extension_pool.network.hit", registry).Inc(2)
+		metrics.GetOrRegisterTimer("extension_pool_wait.network", registry).Update(time.Second)
+
+		families := gather()
+		checkouts := families["gohan_extension_pool_checkouts_total"]
+		Expect(checkouts).ToNot(BeNil())
+		Expect(labels(checkouts.GetMetric()[0])).To(Equal(map[string]string{"schema": "network", "result": "hit"}))
+		Expect(checkouts.GetMetric()[0].GetCounter().GetValue()).To(Equal(2.0))
+
+		wait := families["gohan_extension_pool_wait_seconds"]
+		Expect(wait).ToNot(BeNil())
+		Expect(labels(wait.GetMetric()[0])).To(Equal(map[string]string{"schema": "network"}))
+	})
+
+	It("Skips unknown metrics", func() {
+		metrics.GetOrRegisterTimer("unknown.metric", registry).Update(time.Second)
+		metrics.GetOrRegisterTimer("req.network", registry).Update(time.Second)
+		Expect(gather()).To(BeEmpty())
+	})
+})
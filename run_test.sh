@@ -8,6 +8,18 @@ if [[ $MYSQL_TEST == "true" ]]; then
   mysql -uroot -e "drop database if exists gohan_test; create database gohan_test;"
 fi
 
+if [[ $POSTGRES_TEST == "true" ]]; then
+  # set POSTGRES_TEST true if you want to run test against PostgreSQL.
+  # you need postgres binaries (initdb, pg_ctl, createdb) in PATH.
+  PG_DATA_DIR=`mktemp -d 2>/dev/null || mktemp -d -t 'pgdatadir'`
+  initdb -D $PG_DATA_DIR -U gohan --auth=trust > /dev/null
+  pg_ctl -D $PG_DATA_DIR -o "-h localhost -k $PG_DATA_DIR" -w start
+  trap "pg_ctl -D $PG_DATA_DIR -m fast stop; rm -rf $PG_DATA_DIR" EXIT
+  createdb -h localhost -U gohan gohan_test
+fi
+
+# server test uses etcd unless MEMORY_SYNC_TEST is true, then it uses in-memory sync.
+# etcd is started anyway, as tests of etcd sync and extensions need it.
 DATA_DIR=`mktemp -d 2>/dev/null || mktemp -d -t 'mytmpdir'`
 etcd -data-dir $DATA_DIR --listen-peer-urls http://:2380 --listen-client-urls http://:2379 --advertise-client-urls http://127.0.0.1:2379 &
 ETCD_PID=$!
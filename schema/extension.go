@@ -61,7 +61,8 @@ func NewExtension(raw interface{}) (*Extension, error) {
 	}
 
 	extension.Path = match
-	if extension.URL != "" {
+	// go plugins are opened from the url when extensions are loaded
+	if extension.URL != "" && extension.CodeType != "goplugin" {
 		remoteCode, err := util.GetContent(extension.URL)
 		extension.Code += string(remoteCode)
 		if err != nil {
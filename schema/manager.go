@@ -534,6 +534,38 @@ func ClearManager() {
 	singleton.Clear("schema/manager")
 }
 
+//SetManager replaces manager with the given one
+func SetManager(manager *Manager) {
+	singleton.Clear("schema/manager")
+	singleton.Get("schema/manager", func() interface{} {
+		return manager
+	})
+}
+
+//Clone returns a copy of the manager sharing loaded schemas, policies, extensions and namespaces,
+//later changes to either manager's set of loaded items are not visible in the other one
+func (manager *Manager) Clone() *Manager {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	clone := &Manager{
+		schemas:     make(Map, len(manager.schemas)),
+		schemaOrder: append([]string{}, manager.schemaOrder...),
+		policies:    append([]*Policy{}, manager.policies...),
+		Extensions:  append([]*Extension{}, manager.Extensions...),
+		TimeLimit:   manager.TimeLimit,
+		TimeLimits:  append([]*PathEventTimeLimit{}, manager.TimeLimits...),
+		namespaces:  make(map[string]*Namespace, len(manager.namespaces)),
+	}
+	for id, schema := range manager.schemas {
+		clone.schemas[id] = schema
+	}
+	for id, namespace := range manager.namespaces {
+		clone.namespaces[id] = namespace
+	}
+	return clone
+}
+
 //PolicyValidate API request using policy statements
 func (manager *Manager) PolicyValidate(action, path string, auth Authorization) (*Policy, *Role) {
 	return PolicyValidate(action, path, auth, manager.policies)
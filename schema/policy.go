@@ -18,6 +18,7 @@ package schema
 import (
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/cloudwan/gohan/util"
 )
@@ -99,22 +100,38 @@ type Authorization interface {
 	Catalog() []*Catalog
 }
 
+//UserAuthorization is implemented by authorizations which know the authorized user
+type UserAuthorization interface {
+	UserID() string
+	UserName() string
+}
+
 //BaseAuthorization is base struct for Authorization
 type BaseAuthorization struct {
+	userID     string
+	userName   string
 	tenantID   string
 	tenantName string
 	authToken  string
 	roles      []*Role
 	catalog    []*Catalog
+	expiresAt  time.Time
 }
 
 //NewAuthorization is a constructor for auth info
 func NewAuthorization(tenantID, tenantName, authToken string, roleIDs []string, catalog []*Catalog) Authorization {
+	return NewUserAuthorization("", "", tenantID, tenantName, authToken, roleIDs, catalog)
+}
+
+//NewUserAuthorization is a constructor for auth info of the user
+func NewUserAuthorization(userID, userName, tenantID, tenantName, authToken string, roleIDs []string, catalog []*Catalog) *BaseAuthorization {
 	roles := []*Role{}
 	for _, roleID := range roleIDs {
 		roles = append(roles, &Role{Name: roleID})
 	}
 	return &BaseAuthorization{
+		userID:     userID,
+		userName:   userName,
 		tenantID:   tenantID,
 		roles:      roles,
 		tenantName: tenantName,
@@ -128,6 +145,16 @@ func (auth *BaseAuthorization) Roles() []*Role {
 	return auth.roles
 }
 
+//UserID returns authorized user
+func (auth *BaseAuthorization) UserID() string {
+	return auth.userID
+}
+
+//UserName returns authorized user name
+func (auth *BaseAuthorization) UserName() string {
+	return auth.userName
+}
+
 //TenantID returns authorized tenant
 func (auth *BaseAuthorization) TenantID() string {
 	return auth.tenantID
@@ -148,6 +175,17 @@ func (auth *BaseAuthorization) Catalog() []*Catalog {
 	return auth.catalog
 }
 
+//ExpiresAt returns expiration time of the token, zero if it is unknown
+func (auth *BaseAuthorization) ExpiresAt() time.Time {
+	return auth.expiresAt
+}
+
+//WithExpiry sets expiration time of the token
+func (auth *BaseAuthorization) WithExpiry(expiresAt time.Time) *BaseAuthorization {
+	auth.expiresAt = expiresAt
+	return auth
+}
+
 //Role describes user role
 type Role struct {
 	Name string
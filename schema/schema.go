@@ -50,12 +50,16 @@ type Schema struct {
 	RawData                        interface{}
 	IsolationLevel                 map[string]interface{}
 	OnParentDeleteCascade          bool
+	SoftDelete                     bool
 }
 
 const (
 	abstract string = "abstract"
 )
 
+//DeletedAtPropertyID is ID of the property storing deletion time of soft deleted resources
+const DeletedAtPropertyID = "deleted_at"
+
 type LockPolicy int
 
 const (
@@ -138,6 +142,7 @@ func newSchemaFromObj(rawTypeData interface{}, metaschema *Schema) (*Schema, err
 	schema.Type = util.MaybeString(typeData["type"])
 	schema.Parent = util.MaybeString(typeData["parent"])
 	schema.OnParentDeleteCascade, _ = typeData["on_parent_delete_cascade"].(bool)
+	schema.SoftDelete, _ = typeData["soft_delete"].(bool)
 	schema.NamespaceID = util.MaybeString(typeData["namespace"])
 	schema.IsolationLevel = util.MaybeMap(typeData["isolation_level"])
 	jsonSchema, ok := typeData["schema"].(map[string]interface{})
@@ -240,6 +245,10 @@ func (schema *Schema) Init() error {
 		propertiesOrder = append(propertiesOrder, FormatParentID(parent))
 		required = append(required, FormatParentID(parent))
 	}
+	if schema.SoftDelete && properties[DeletedAtPropertyID] == nil {
+		properties[DeletedAtPropertyID] = getDeletedAtPropertyObj()
+		propertiesOrder = append(propertiesOrder, DeletedAtPropertyID)
+	}
 
 	jsonSchema["required"] = required
 
@@ -368,6 +377,15 @@ func filterSchemaByPermission(schema map[string]interface{}, permission string)
 	return filteredSchema
 }
 
+func getDeletedAtPropertyObj() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        []interface{}{"string", "null"},
+		"title":       "Deleted at",
+		"description": "time of soft deletion",
+		"permission":  []interface{}{},
+	}
+}
+
 func getParentPropertyObj(title, parent string) map[string]interface{} {
 	return map[string]interface{}{
 		"type":        "string",
@@ -448,6 +466,22 @@ func (schema *Schema) StateVersioning() bool {
 	return stateful
 }
 
+//ReadOnly whether resources of this schema can only be listed and shown through the API
+func (schema *Schema) ReadOnly() bool {
+	readOnly, _ := schema.Metadata["read_only"].(bool)
+	return readOnly
+}
+
+//Audited whether changes of resources of this schema should be recorded in the audit log,
+//defaultValue is used unless schema metadata sets it
+func (schema *Schema) Audited(defaultValue bool) bool {
+	audited, ok := schema.Metadata["audit"].(bool)
+	if !ok {
+		return defaultValue
+	}
+	return audited
+}
+
 //SyncKeyTemplate - for custom paths in etcd
 func (schema *Schema) SyncKeyTemplate() (syncKeyTemplate string, ok bool) {
 	syncKeyTemplateRaw, ok := schema.Metadata["sync_key_template"]
@@ -566,6 +600,9 @@ func (schema *Schema) Extend(fromSchema *Schema) error {
 	if schema.NamespaceID == "" {
 		schema.NamespaceID = fromSchema.NamespaceID
 	}
+	if fromSchema.SoftDelete {
+		schema.SoftDelete = true
+	}
 	schema.JSONSchema["properties"] = util.ExtendMap(
 		util.MaybeMap(schema.JSONSchema["properties"]),
 		util.MaybeMap(fromSchema.JSONSchema["properties"]))
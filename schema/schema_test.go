@@ -44,6 +44,23 @@ var _ = Describe("Schema", func() {
 			Expect(manager.LoadSchemaFromFile(schemaPath)).To(Succeed())
 		})
 
+		It("should clone manager", func() {
+			manager := GetManager()
+			schemaPath := "../tests/test_schema_dag_dependency.yaml"
+			Expect(manager.LoadSchemaFromFile(schemaPath)).To(Succeed())
+
+			clone := manager.Clone()
+			Expect(clone.OrderedSchemas()).To(Equal(manager.OrderedSchemas()))
+
+			red, _ := clone.Schema("red_resource")
+			Expect(clone.UnRegisterSchema(red)).To(Succeed())
+			_, ok := manager.Schema("red_resource")
+			Expect(ok).To(BeTrue())
+
+			SetManager(clone)
+			Expect(GetManager()).To(BeIdenticalTo(clone))
+		})
+
 		AfterEach(func() {
 			ClearManager()
 		})
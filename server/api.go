@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/extension"
@@ -54,6 +55,38 @@ func addParamToQuery(r *http.Request, key, value string) {
 	r.URL.RawQuery += "&" + key + "=" + value
 }
 
+//addNextPageHeaders adds cursor of the next page and a link to it
+func addNextPageHeaders(w http.ResponseWriter, r *http.Request, cursor string) {
+	query := r.URL.Query()
+	query.Del("offset")
+	query.Set("cursor", cursor)
+	next := *r.URL
+	next.RawQuery = query.Encode()
+	w.Header().Add("X-Next-Cursor", cursor)
+	w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+}
+
+//addETagHeader adds version of the resource stored in the context as ETag
+func addETagHeader(w http.ResponseWriter, context middleware.Context) {
+	if version, ok := context["resource_version"].(string); ok {
+		w.Header().Add("ETag", fmt.Sprintf("\"%s\"", version))
+	}
+}
+
+//addIfMatchToContext stores resource versions from If-Match header in the context
+func addIfMatchToContext(r *http.Request, context middleware.Context) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return
+	}
+	versions := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		versions = append(versions, strings.Trim(tag, "\""))
+	}
+	context["if_match"] = versions
+}
+
 func addJSONContentTypeHeader(w http.ResponseWriter) {
 	w.Header().Add("Content-Type", "application/json")
 }
@@ -80,6 +113,10 @@ func problemToResponseCode(problem resources.ResourceProblem) int {
 		return http.StatusConflict
 	case resources.Unauthorized:
 		return http.StatusUnauthorized
+	case resources.PreconditionFailed:
+		return http.StatusPreconditionFailed
+	case resources.Aborted:
+		return http.StatusFailedDependency
 	}
 	return http.StatusInternalServerError
 }
@@ -141,20 +178,76 @@ func unwrapExtensionException(exceptionInfo map[string]interface{}) (message map
 	return message, code
 }
 
-func handleError(writer http.ResponseWriter, err error) {
+//errorToResponse returns response message and HTTP status code for the error
+func errorToResponse(err error) (message map[string]interface{}, code int) {
 	switch err := err.(type) {
-	default:
-		middleware.HTTPJSONError(writer, err.Error(), http.StatusInternalServerError)
 	case resources.ResourceError:
-		code := problemToResponseCode(err.Problem)
-		middleware.HTTPJSONError(writer, err.Message, code)
+		return map[string]interface{}{"error": err.Message}, problemToResponseCode(err.Problem)
 	case extension.Error:
-		message, code := unwrapExtensionException(err.ExceptionInfo)
-		if 200 <= code && code < 300 {
-			writer.WriteHeader(code)
-			routes.ServeJson(writer, message)
+		return unwrapExtensionException(err.ExceptionInfo)
+	}
+	return map[string]interface{}{"error": err.Error()}, http.StatusInternalServerError
+}
+
+func handleError(writer http.ResponseWriter, err error) {
+	message, code := errorToResponse(err)
+	if 200 <= code && code < 300 {
+		writer.WriteHeader(code)
+		routes.ServeJson(writer, message)
+		return
+	}
+	middleware.HTTPJSONError(writer, message["error"].(string), code)
+}
+
+//bulkResultsToResponse makes response of the bulk request with status and data of each operation
+func bulkResultsToResponse(results []resources.BulkResult) map[string]interface{} {
+	responses := make([]map[string]interface{}, len(results))
+	for i, result := range results {
+		response := map[string]interface{}{
+			"action": result.Action,
+			"id":     result.ID,
+		}
+		var message map[string]interface{}
+		var code int
+		if result.Err != nil {
+			message, code = errorToResponse(result.Err)
+			if code == http.StatusInternalServerError {
+				log.Error("Bulk operation failed: %s", message["error"])
+				message["error"] = ""
+			}
 		} else {
-			middleware.HTTPJSONError(writer, message["error"].(string), code)
+			message, _ = result.Response.(map[string]interface{})
+			code = bulkActionToResponseCode(result.Action)
+		}
+		response["status"] = code
+		for key, value := range message {
+			response[key] = value
+		}
+		responses[i] = response
+	}
+	return map[string]interface{}{"results": responses}
+}
+
+func bulkActionToResponseCode(action string) int {
+	switch action {
+	case schema.ActionCreate:
+		return http.StatusCreated
+	case schema.ActionDelete:
+		return http.StatusNoContent
+	}
+	return http.StatusOK
+}
+
+//addParentIDFromQuery sets parent ID of created resource from query if it is missing
+func addParentIDFromQuery(s *schema.Schema, r *http.Request, dataMap map[string]interface{}) {
+	if s.Parent == "" {
+		return
+	}
+	if _, ok := dataMap[s.ParentID()]; !ok {
+		queryParams := r.URL.Query()
+		parentIDParam := queryParams.Get(s.ParentID())
+		if parentIDParam != "" {
+			dataMap[s.ParentID()] = parentIDParam
 		}
 	}
 }
@@ -195,7 +288,7 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 
 	//load extension environments
 	environmentManager := extension.GetManager()
-	if _, ok := environmentManager.GetEnvironment(s.ID); !ok {
+	if !environmentManager.HasEnvironment(s.ID) {
 		env, err := server.NewEnvironmentForPath(s.ID, pluralURL)
 		if err != nil {
 			log.Fatal(fmt.Sprintf("[%s] %v", pluralURL, err))
@@ -216,7 +309,12 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			handleError(w, err)
 			return
 		}
-		w.Header().Add("X-Total-Count", fmt.Sprint(context["total"]))
+		if total, ok := context["total"]; ok {
+			w.Header().Add("X-Total-Count", fmt.Sprint(total))
+		}
+		if cursor, ok := context["next_cursor"].(string); ok {
+			addNextPageHeaders(w, r, cursor)
+		}
 		routes.ServeJson(w, context["response"])
 	}
 	route.Get(pluralURL, middleware.Authorization(schema.ActionRead), getPluralFunc)
@@ -234,6 +332,7 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			handleError(w, err)
 			return
 		}
+		addETagHeader(w, context)
 		routes.ServeJson(w, context["response"])
 	}
 	route.Get(singleURL, middleware.Authorization(schema.ActionRead), getSingleFunc)
@@ -242,6 +341,10 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 		getSingleFunc(w, r, p, identityService, context)
 	})
 
+	if s.ReadOnly() {
+		return
+	}
+
 	//setup delete route
 	deleteSingleFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
 		addJSONContentTypeHeader(w)
@@ -259,6 +362,26 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 		deleteSingleFunc(w, r, p, identityService, context)
 	})
 
+	//setup restore route
+	if s.SoftDelete {
+		restoreSingleFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addJSONContentTypeHeader(w)
+			fillInContext(context, dataStore, r, w, s, p, server.sync, identityService, server.queue)
+			id := p["id"]
+			if err := resources.RestoreResource(context, dataStore, s, id); err != nil {
+				handleError(w, err)
+				return
+			}
+			routes.ServeJson(w, context["response"])
+		}
+		route.Post(singleURL+"/restore", middleware.Authorization(schema.ActionDelete), restoreSingleFunc)
+		route.Post(singleURLWithParents+"/restore", middleware.Authorization(schema.ActionDelete),
+			func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+				addParamToQuery(r, schema.FormatParentID(s.Parent), p[s.Parent])
+				restoreSingleFunc(w, r, p, identityService, context)
+			})
+	}
+
 	//setup create route
 	postPluralFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
 		addJSONContentTypeHeader(w)
@@ -269,19 +392,12 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			return
 		}
 		dataMap = removeResourceWrapper(s, dataMap)
-		if s.Parent != "" {
-			if _, ok := dataMap[s.ParentID()]; !ok {
-				queryParams := r.URL.Query()
-				parentIDParam := queryParams.Get(s.ParentID())
-				if parentIDParam != "" {
-					dataMap[s.ParentID()] = parentIDParam
-				}
-			}
-		}
+		addParentIDFromQuery(s, r, dataMap)
 		if err := resources.CreateResource(context, dataStore, identityService, s, dataMap); err != nil {
 			handleError(w, err)
 			return
 		}
+		addETagHeader(w, context)
 		w.WriteHeader(http.StatusCreated)
 		routes.ServeJson(w, context["response"])
 	}
@@ -292,6 +408,40 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			postPluralFunc(w, r, p, identityService, context)
 		})
 
+	//setup bulk route
+	postBulkFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+		addJSONContentTypeHeader(w)
+		fillInContext(context, dataStore, r, w, s, p, server.sync, identityService, server.queue)
+		dataMap, err := middleware.ReadJSON(r)
+		if err != nil {
+			handleError(w, resources.NewResourceError(err, fmt.Sprintf("Failed to parse data: %s", err), resources.WrongData))
+			return
+		}
+		mode, operations, err := resources.ParseBulkRequest(dataMap)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		for _, operation := range operations {
+			if operation.Action == schema.ActionCreate {
+				addParentIDFromQuery(s, r, operation.Data)
+			}
+		}
+		results, err := resources.BulkResources(context, dataStore, identityService, s, mode, operations)
+		if err != nil {
+			_, code := errorToResponse(err)
+			w.WriteHeader(code)
+		}
+		routes.ServeJson(w, bulkResultsToResponse(results))
+	}
+	// each operation is authorized with the policy of its own action
+	route.Post(pluralURL+"/_bulk", middleware.Authorization(schema.ActionGlob), postBulkFunc)
+	route.Post(pluralURLWithParents+"/_bulk", middleware.Authorization(schema.ActionGlob),
+		func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addParamToQuery(r, schema.FormatParentID(s.Parent), p[s.Parent])
+			postBulkFunc(w, r, p, identityService, context)
+		})
+
 	//setup create or update route
 	putSingleFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
 		addJSONContentTypeHeader(w)
@@ -303,11 +453,15 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			return
 		}
 		dataMap = removeResourceWrapper(s, dataMap)
-		if isCreated, err := resources.CreateOrUpdateResource(
-			context, dataStore, identityService, s, id, dataMap); err != nil {
+		addIfMatchToContext(r, context)
+		isCreated, err := resources.CreateOrUpdateResource(
+			context, dataStore, identityService, s, id, dataMap)
+		if err != nil {
 			handleError(w, err)
 			return
-		} else if isCreated {
+		}
+		addETagHeader(w, context)
+		if isCreated {
 			w.WriteHeader(http.StatusCreated)
 		}
 		routes.ServeJson(w, context["response"])
@@ -330,11 +484,13 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			return
 		}
 		dataMap = removeResourceWrapper(s, dataMap)
+		addIfMatchToContext(r, context)
 		if err := resources.UpdateResource(
 			context, dataStore, identityService, s, id, dataMap); err != nil {
 			handleError(w, err)
 			return
 		}
+		addETagHeader(w, context)
 		routes.ServeJson(w, context["response"])
 	}
 	route.Patch(singleURL, middleware.Authorization(schema.ActionUpdate), patchSingleFunc)
@@ -414,10 +570,15 @@ func MapRouteBySchemas(server *Server, dataStore db.DB) {
 			context["auth"] = auth
 			context["sync"] = server.sync
 
+			filter, err := resources.FilterFromQueryParameter(s, r.URL.Query())
+			if err != nil {
+				handleError(w, resources.NewResourceError(err, err.Error(), resources.WrongQuery))
+				return
+			}
 			if err := resources.GetResources(
 				context, dataStore,
 				s,
-				resources.FilterFromQueryParameter(s, r.URL.Query()),
+				filter,
 				nil,
 			); err != nil {
 				handleError(w, err)
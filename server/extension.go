@@ -41,12 +41,17 @@ import (
 	"github.com/cloudwan/gohan/schema"
 )
 
+//newGojaEnvironment creates a goja environment, it is nil unless gohan is built with the goja tag
+var newGojaEnvironment func(name string, server *Server) extension.Environment
+
 func (server *Server) newEnvironment(name string) extension.Environment {
 	envs := []extension.Environment{}
 	for _, extension := range server.extensions {
 		switch extension {
 		case "javascript":
 			envs = append(envs, otto.NewEnvironment(name, server.db, server.keystoneIdentity, server.sync))
+		case "goja":
+			envs = append(envs, newGojaEnvironment(name, server))
 		case "gohanscript":
 			envs = append(envs, gohanscript.NewEnvironment())
 		case "go":
@@ -0,0 +1,36 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build goja
+// +build goja
+
+package server
+
+import (
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/extension/goja"
+	"github.com/cloudwan/gohan/util"
+)
+
+func init() {
+	newGojaEnvironment = func(name string, server *Server) extension.Environment {
+		codeTypes := []string{goja.CodeType}
+		// goja runs javascript extensions when it replaces otto
+		if !util.ContainsString(server.extensions, "javascript") {
+			codeTypes = append(codeTypes, "javascript")
+		}
+		return goja.NewEnvironment(name, server.db, server.keystoneIdentity, server.sync, codeTypes...)
+	}
+}
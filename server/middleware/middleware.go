@@ -27,6 +27,7 @@ import (
 	"fmt"
 
 	"github.com/cloudwan/gohan/cloud"
+	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/util"
 	"github.com/go-martini/martini"
@@ -263,6 +264,11 @@ func Authentication() martini.Handler {
 			return
 		}
 
+		if req.URL.Path == metrics.PrometheusPath && metrics.PrometheusEnabled() {
+			c.Next()
+			return
+		}
+
 		authToken := req.Header.Get("X-Auth-Token")
 
 		var targetIdentityService IdentityService
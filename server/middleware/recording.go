@@ -0,0 +1,66 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudwan/gohan/extension/recording"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/go-martini/martini"
+)
+
+//Recording records requests selected by the recorder, together with extension events
+//handled and builtins called during them, and saves them as extension tests
+func Recording(recorder *recording.Recorder) martini.Handler {
+	return func(res http.ResponseWriter, req *http.Request, c martini.Context, context Context) {
+		if !recorder.Match(req.Method, req.URL.Path) {
+			c.Next()
+			return
+		}
+
+		reqData, _ := ioutil.ReadAll(req.Body)
+		req.Body = ioutil.NopCloser(bytes.NewBuffer(reqData))
+		var request interface{}
+		json.Unmarshal(reqData, &request)
+		rec := recording.NewRecording(req.Method, req.URL.RequestURI(), request)
+		context[recording.ContextKey] = rec
+
+		rw := res.(martini.ResponseWriter)
+		rh := newResponseHijacker(rw)
+		c.MapTo(rh, (*http.ResponseWriter)(nil))
+		c.MapTo(rh, (*martini.ResponseWriter)(nil))
+
+		c.Next()
+
+		if s, ok := context["schema"].(*schema.Schema); ok {
+			rec.Path = s.GetPluralURL()
+		}
+		var response interface{}
+		json.Unmarshal(rh.Response.Bytes(), &response)
+		rec.SetResponse(rw.Status(), response)
+
+		filePath, err := recorder.Save(rec)
+		if err != nil {
+			log.Error("Failed to save recording of %s %s: %s", req.Method, req.URL.Path, err)
+			return
+		}
+		log.Info("Recorded %s %s to %s", req.Method, req.URL.Path, filePath)
+	}
+}
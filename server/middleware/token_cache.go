@@ -0,0 +1,200 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/cloud"
+	"github.com/cloudwan/gohan/metrics"
+	"github.com/cloudwan/gohan/schema"
+	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/util"
+)
+
+//TokenRevocationPath is the sync path under which revoked tokens are put as keys
+const TokenRevocationPath = "/gohan/revoked_tokens"
+
+//expiringAuthorization is implemented by authorizations knowing when their token expires
+type expiringAuthorization interface {
+	ExpiresAt() time.Time
+}
+
+type tokenCacheEntry struct {
+	token     string
+	auth      schema.Authorization
+	err       error
+	expiresAt time.Time
+}
+
+//CachedIdentityService caches token verification results of the identity service.
+//The cache keeps at most size tokens, least recently used tokens are evicted first.
+//Tokens are cached until ttl passes or the token expires, whichever is sooner,
+//tokens rejected by the identity service are cached for negativeTTL.
+type CachedIdentityService struct {
+	IdentityService
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+//NewCachedIdentityService is a constructor for CachedIdentityService
+func NewCachedIdentityService(identityService IdentityService, size int, ttl, negativeTTL time.Duration) *CachedIdentityService {
+	return &CachedIdentityService{
+		IdentityService: identityService,
+		size:            size,
+		ttl:             ttl,
+		negativeTTL:     negativeTTL,
+		now:             time.Now,
+		entries:         map[string]*list.Element{},
+		lru:             list.New(),
+	}
+}
+
+//NewCachedIdentityServiceFromConfig wraps the identity service with cache configured by keystone/token_cache section.
+//The identity service is returned unchanged unless the cache is enabled.
+func NewCachedIdentityServiceFromConfig(identityService IdentityService, config *util.Config) (IdentityService, error) {
+	if !config.GetBool("keystone/token_cache/enabled", false) {
+		return identityService, nil
+	}
+	ttl, err := time.ParseDuration(config.GetString("keystone/token_cache/ttl", "5m"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid keystone/token_cache/ttl: %s", err)
+	}
+	negativeTTL, err := time.ParseDuration(config.GetString("keystone/token_cache/negative_ttl", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid keystone/token_cache/negative_ttl: %s", err)
+	}
+	size := config.GetInt("keystone/token_cache/size", 10000)
+	return NewCachedIdentityService(identityService, size, ttl, negativeTTL), nil
+}
+
+//VerifyToken returns cached verification result or verifies the token by the identity service
+func (cache *CachedIdentityService) VerifyToken(token string) (schema.Authorization, error) {
+	if entry, ok := cache.get(token); ok {
+		metrics.UpdateCounter(1, "auth.token_cache.hit")
+		return entry.auth, entry.err
+	}
+	metrics.UpdateCounter(1, "auth.token_cache.miss")
+
+	auth, err := cache.IdentityService.VerifyToken(token)
+	if err == nil {
+		expiresAt := cache.now().Add(cache.ttl)
+		if expiring, ok := auth.(expiringAuthorization); ok {
+			tokenExpiresAt := expiring.ExpiresAt()
+			if !tokenExpiresAt.IsZero() && tokenExpiresAt.Before(expiresAt) {
+				expiresAt = tokenExpiresAt
+			}
+		}
+		cache.put(&tokenCacheEntry{token: token, auth: auth, expiresAt: expiresAt})
+	} else if err == cloud.ErrInvalidToken && cache.negativeTTL > 0 {
+		cache.put(&tokenCacheEntry{token: token, err: err, expiresAt: cache.now().Add(cache.negativeTTL)})
+	}
+	return auth, err
+}
+
+//Invalidate removes the token from the cache
+func (cache *CachedIdentityService) Invalidate(token string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if element, ok := cache.entries[token]; ok {
+		cache.remove(element)
+	}
+}
+
+//Len returns number of cached tokens
+func (cache *CachedIdentityService) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.lru.Len()
+}
+
+//WatchRevocations invalidates tokens put under TokenRevocationPath in the sync backend.
+//This method blocks until canceled by the ctx, watch errors are logged and watching is restarted.
+func (cache *CachedIdentityService) WatchRevocations(ctx context.Context, sync gohan_sync.Sync) {
+	for {
+		err := cache.watchRevocations(ctx, sync)
+		if err != nil {
+			log.Error("token revocation watch error: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (cache *CachedIdentityService) watchRevocations(ctx context.Context, sync gohan_sync.Sync) error {
+	events, err := sync.WatchContext(ctx, TokenRevocationPath, gohan_sync.RevisionCurrent)
+	if err != nil {
+		return err
+	}
+	for event := range events {
+		if event.Err != nil {
+			return event.Err
+		}
+		token := strings.TrimPrefix(strings.TrimPrefix(event.Key, TokenRevocationPath), "/")
+		if token != "" {
+			log.Debug("Token revoked, removing it from cache")
+			cache.Invalidate(token)
+		}
+	}
+	return nil
+}
+
+func (cache *CachedIdentityService) get(token string) (*tokenCacheEntry, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	element, ok := cache.entries[token]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*tokenCacheEntry)
+	if !cache.now().Before(entry.expiresAt) {
+		cache.remove(element)
+		return nil, false
+	}
+	cache.lru.MoveToFront(element)
+	return entry, true
+}
+
+func (cache *CachedIdentityService) put(entry *tokenCacheEntry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if element, ok := cache.entries[entry.token]; ok {
+		cache.remove(element)
+	}
+	cache.entries[entry.token] = cache.lru.PushFront(entry)
+	for cache.lru.Len() > cache.size {
+		cache.remove(cache.lru.Back())
+	}
+}
+
+func (cache *CachedIdentityService) remove(element *list.Element) {
+	cache.lru.Remove(element)
+	delete(cache.entries, element.Value.(*tokenCacheEntry).token)
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudwan/gohan/cloud"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type countingIdentity struct {
+	middleware.NoIdentityService
+	calls     map[string]int
+	expiresAt time.Time
+}
+
+func (identity *countingIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	identity.calls[token]++
+	switch token {
+	case "invalid":
+		return nil, cloud.ErrInvalidToken
+	case "broken":
+		return nil, fmt.Errorf("connection refused")
+	}
+	return schema.NewUserAuthorization("user", "user", "tenant", "tenant", token, []string{"member"}, nil).WithExpiry(identity.expiresAt), nil
+}
+
+var _ = Describe("Token cache", func() {
+	var (
+		identity *countingIdentity
+		cache    *middleware.CachedIdentityService
+		now      time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		identity = &countingIdentity{calls: map[string]int{}}
+		cache = middleware.NewCachedIdentityService(identity, 2, time.Minute, 10*time.Second)
+		middleware.SetTokenCacheClock(cache, func() time.Time { return now })
+	})
+
+	It("Verifies token once until ttl passes", func() {
+		for i := 0; i < 3; i++ {
+			auth, err := cache.VerifyToken("token")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(auth.AuthToken()).To(Equal("token"))
+		}
+		Expect(identity.calls["token"]).To(Equal(1))
+
+		now = now.Add(time.Minute)
+		_, err := cache.VerifyToken("token")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(identity.calls["token"]).To(Equal(2))
+	})
+
+	It("Doesn't keep tokens after they expire", func() {
+		identity.expiresAt = now.Add(10 * time.Second)
+		cache.VerifyToken("token")
+		now = now.Add(10 * time.Second)
+		cache.VerifyToken("token")
+		Expect(identity.calls["token"]).To(Equal(2))
+	})
+
+	It("Evicts least recently used tokens", func() {
+		cache.VerifyToken("token1")
+		cache.VerifyToken("token2")
+		cache.VerifyToken("token1")
+		cache.VerifyToken("token3")
+		Expect(cache.Len()).To(Equal(2))
+
+		cache.VerifyToken("token1")
+		Expect(identity.calls["token1"]).To(Equal(1))
+		cache.VerifyToken("token2")
+		Expect(identity.calls["token2"]).To(Equal(2))
+	})
+
+	It("Caches invalid tokens for negative ttl", func() {
+		_, err := cache.VerifyToken("invalid")
+		Expect(err).To(Equal(cloud.ErrInvalidToken))
+		_, err = cache.VerifyToken("invalid")
+		Expect(err).To(Equal(cloud.ErrInvalidToken))
+		Expect(identity.calls["invalid"]).To(Equal(1))
+
+		now = now.Add(10 * time.Second)
+		cache.VerifyToken("invalid")
+		Expect(identity.calls["invalid"]).To(Equal(2))
+	})
+
+	It("Doesn't cache other errors", func() {
+		cache.VerifyToken("broken")
+		cache.VerifyToken("broken")
+		Expect(identity.calls["broken"]).To(Equal(2))
+	})
+
+	It("Verifies invalidated tokens again", func() {
+		cache.VerifyToken("token")
+		cache.Invalidate("token")
+		cache.VerifyToken("token")
+		Expect(identity.calls["token"]).To(Equal(2))
+	})
+})
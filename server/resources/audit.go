@@ -0,0 +1,129 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+	"github.com/twinj/uuid"
+)
+
+//AuditLogSchemaID is ID of the schema of audit log entries
+const AuditLogSchemaID = "audit_log"
+
+//ValidateAuditLog checks that the audit log schema is loaded if any of the schemas is audited,
+//enabled tells whether schemas are audited unless their metadata says otherwise
+func ValidateAuditLog(manager *schema.Manager, enabled bool) error {
+	if _, ok := manager.Schema(AuditLogSchemaID); ok {
+		return nil
+	}
+	for _, s := range manager.OrderedSchemas() {
+		if s.Audited(enabled) {
+			return fmt.Errorf("Schema %s is audited, but audit log schema %s is not loaded", s.ID, AuditLogSchemaID)
+		}
+	}
+	return nil
+}
+
+//recordAuditLog stores the change of the resource in the audit log in the context transaction.
+//before is nil for created resources and after is nil for deleted ones.
+func recordAuditLog(
+	context middleware.Context, action string,
+	resourceSchema *schema.Schema, resourceID string,
+	before, after map[string]interface{},
+) error {
+	if !resourceSchema.Audited(util.GetConfig().GetBool("audit/enabled", false)) {
+		return nil
+	}
+	auditLogSchema, ok := schema.GetManager().Schema(AuditLogSchemaID)
+	if !ok {
+		return fmt.Errorf("Audit log schema %s not found", AuditLogSchemaID)
+	}
+	data := map[string]interface{}{
+		"id":          uuid.NewV4().String(),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"action":      action,
+		"schema_id":   resourceSchema.ID,
+		"resource_id": resourceID,
+		"diff":        auditDiff(before, after),
+	}
+	if auth, ok := context["auth"].(schema.Authorization); ok {
+		roles := []string{}
+		for _, role := range auth.Roles() {
+			roles = append(roles, role.Name)
+		}
+		data["tenant_id"] = auth.TenantID()
+		data["tenant_name"] = auth.TenantName()
+		data["roles"] = roles
+	}
+	if user, ok := context["auth"].(schema.UserAuthorization); ok {
+		data["user_id"] = user.UserID()
+		data["user_name"] = user.UserName()
+	}
+	auditLog, err := schema.NewResource(auditLogSchema, data)
+	if err != nil {
+		return err
+	}
+	mainTransaction := context["transaction"].(transaction.Transaction)
+	if err := mainTransaction.Create(auditLog); err != nil {
+		return fmt.Errorf("Failed to store audit log: %s", err)
+	}
+	return nil
+}
+
+//auditDiff returns changed properties with their values before and after the change
+func auditDiff(before, after map[string]interface{}) map[string]interface{} {
+	diff := map[string]interface{}{}
+	for key, value := range after {
+		if oldValue, ok := before[key]; ok && equalJSON(oldValue, value) {
+			continue
+		}
+		diff[key] = map[string]interface{}{"before": before[key], "after": value}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			diff[key] = map[string]interface{}{"before": value, "after": nil}
+		}
+	}
+	return diff
+}
+
+//equalJSON compares values by their JSON form, so numbers read from db and request are equal
+func equalJSON(a, b interface{}) bool {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(aJSON) == string(bJSON)
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		result[key] = value
+	}
+	return result
+}
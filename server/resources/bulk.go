@@ -0,0 +1,296 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+//BulkMode tells how failures of bulk operations are handled
+type BulkMode string
+
+const (
+	//BulkAllOrNothing runs all operations in one transaction, nothing is applied if any of them fails
+	BulkAllOrNothing BulkMode = "all_or_nothing"
+	//BulkBestEffort runs each operation in its own transaction, failed operations don't stop the others
+	BulkBestEffort BulkMode = "best_effort"
+)
+
+//ErrBulkAborted is the result of operations which were not applied because other operation failed
+var ErrBulkAborted = ResourceError{
+	errors.New("bulk request aborted"),
+	"Not applied because other operation of the bulk request failed",
+	Aborted,
+}
+
+//BulkOperation is a single create, update or delete operation of a bulk request
+type BulkOperation struct {
+	Action string
+	ID     string
+	Data   map[string]interface{}
+}
+
+//BulkResult is the result of a single bulk operation
+type BulkResult struct {
+	Action   string
+	ID       string
+	Response interface{}
+	Err      error
+}
+
+//ParseBulkRequest reads mode and operations from the bulk request body
+func ParseBulkRequest(dataMap map[string]interface{}) (BulkMode, []BulkOperation, error) {
+	mode := BulkAllOrNothing
+	if rawMode, ok := dataMap["mode"]; ok {
+		mode = BulkMode(fmt.Sprint(rawMode))
+		if mode != BulkAllOrNothing && mode != BulkBestEffort {
+			err := fmt.Errorf("Unknown bulk mode %s", mode)
+			return "", nil, ResourceError{err, err.Error(), WrongData}
+		}
+	}
+	rawOperations, ok := dataMap["operations"].([]interface{})
+	if !ok || len(rawOperations) == 0 {
+		err := fmt.Errorf("Bulk request should contain a list of operations")
+		return "", nil, ResourceError{err, err.Error(), WrongData}
+	}
+	operations := make([]BulkOperation, len(rawOperations))
+	for i, rawOperation := range rawOperations {
+		operation, err := parseBulkOperation(rawOperation)
+		if err != nil {
+			err = fmt.Errorf("Invalid operation %d: %s", i, err)
+			return "", nil, ResourceError{err, err.Error(), WrongData}
+		}
+		operations[i] = operation
+	}
+	return mode, operations, nil
+}
+
+func parseBulkOperation(rawOperation interface{}) (BulkOperation, error) {
+	operationMap, ok := rawOperation.(map[string]interface{})
+	if !ok {
+		return BulkOperation{}, fmt.Errorf("operation should be an object")
+	}
+	operation := BulkOperation{}
+	operation.Action, _ = operationMap["action"].(string)
+	operation.ID, _ = operationMap["id"].(string)
+	operation.Data, _ = operationMap["resource"].(map[string]interface{})
+	switch operation.Action {
+	case schema.ActionCreate:
+		if operation.Data == nil {
+			return BulkOperation{}, fmt.Errorf("resource is required")
+		}
+		if operation.ID != "" {
+			operation.Data["id"] = operation.ID
+		}
+	case schema.ActionUpdate:
+		if operation.ID == "" || operation.Data == nil {
+			return BulkOperation{}, fmt.Errorf("id and resource are required")
+		}
+	case schema.ActionDelete:
+		if operation.ID == "" {
+			return BulkOperation{}, fmt.Errorf("id is required")
+		}
+	default:
+		return BulkOperation{}, fmt.Errorf("unknown action %s", operation.Action)
+	}
+	return operation, nil
+}
+
+//BulkResources runs create, update and delete operations on resources of the schema.
+//Every operation handles the same extension events and policy checks as a single resource request.
+//In all or nothing mode operations are prepared and applied one by one in a single transaction,
+//so they see changes of the preceding operations, and post events are handled after it is committed.
+//The error causing all or nothing request to be aborted is returned as well.
+func BulkResources(
+	ctx middleware.Context,
+	dataStore db.DB, identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	mode BulkMode, operations []BulkOperation,
+) ([]BulkResult, error) {
+	defer measureRequestTime(time.Now(), "bulk", resourceSchema.ID)
+	if mode == BulkBestEffort {
+		return bulkBestEffort(ctx, dataStore, identityService, resourceSchema, operations), nil
+	}
+	return bulkAllOrNothing(ctx, dataStore, identityService, resourceSchema, operations)
+}
+
+func bulkBestEffort(
+	ctx middleware.Context,
+	dataStore db.DB, identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	operations []BulkOperation,
+) []BulkResult {
+	results := make([]BulkResult, len(operations))
+	for i, operation := range operations {
+		operationContext := newBulkContext(ctx)
+		err := func() error {
+			apply, err := prepareBulkOperation(operationContext, dataStore, identityService, resourceSchema, operation)
+			if err != nil {
+				return err
+			}
+			if err := InTransaction(
+				operationContext, dataStore,
+				transaction.GetIsolationLevel(resourceSchema, operation.Action),
+				apply,
+			); err != nil {
+				return err
+			}
+			return finishBulkOperation(operationContext, resourceSchema, operation)
+		}()
+		results[i] = bulkResult(operationContext, operation, err)
+	}
+	return results
+}
+
+func bulkAllOrNothing(
+	ctx middleware.Context,
+	dataStore db.DB, identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	operations []BulkOperation,
+) ([]BulkResult, error) {
+	contexts := make([]middleware.Context, len(operations))
+	failed := 0
+	err := InTransaction(
+		ctx, dataStore,
+		bulkIsolationLevel(resourceSchema, operations),
+		func() error {
+			for i, operation := range operations {
+				failed = i
+				contexts[i] = newBulkContext(ctx)
+				apply, err := prepareBulkOperation(contexts[i], dataStore, identityService, resourceSchema, operation)
+				if err == nil {
+					err = apply()
+				}
+				delete(contexts[i], "transaction")
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return abortBulk(contexts, operations, failed, err), err
+	}
+
+	results := make([]BulkResult, len(operations))
+	for i, operation := range operations {
+		err := finishBulkOperation(contexts[i], resourceSchema, operation)
+		results[i] = bulkResult(contexts[i], operation, err)
+	}
+	return results, nil
+}
+
+//prepareBulkOperation handles pre event of the operation and returns function applying it in transaction
+func prepareBulkOperation(
+	context middleware.Context,
+	dataStore db.DB, identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	operation BulkOperation,
+) (func() error, error) {
+	switch operation.Action {
+	case schema.ActionCreate:
+		resource, err := prepareCreateResource(context, identityService, resourceSchema, operation.Data)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			return CreateResourceInTransaction(context, resource)
+		}, nil
+	case schema.ActionUpdate:
+		dataMap, tenantIDs, err := prepareUpdateResource(context, identityService, resourceSchema, operation.ID, operation.Data)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			return UpdateResourceInTransaction(context, resourceSchema, operation.ID, dataMap, tenantIDs)
+		}, nil
+	case schema.ActionDelete:
+		if err := prepareDeleteResource(context, dataStore, resourceSchema, operation.ID); err != nil {
+			return nil, err
+		}
+		return func() error {
+			return DeleteResourceInTransaction(context, resourceSchema, operation.ID)
+		}, nil
+	}
+	err := fmt.Errorf("Unknown bulk action %s", operation.Action)
+	return nil, ResourceError{err, err.Error(), WrongData}
+}
+
+//finishBulkOperation handles post event of the applied operation
+func finishBulkOperation(context middleware.Context, resourceSchema *schema.Schema, operation BulkOperation) error {
+	switch operation.Action {
+	case schema.ActionCreate:
+		return finishCreateResource(context, resourceSchema)
+	case schema.ActionUpdate:
+		return finishUpdateResource(context, resourceSchema)
+	}
+	return finishDeleteResource(context, resourceSchema)
+}
+
+//newBulkContext makes separate context for an operation, sharing request data with other operations
+func newBulkContext(context middleware.Context) middleware.Context {
+	operationContext := middleware.Context{}
+	for key, value := range context {
+		operationContext[key] = value
+	}
+	return operationContext
+}
+
+//bulkIsolationLevel returns isolation level of all operations or serializable if they differ
+func bulkIsolationLevel(resourceSchema *schema.Schema, operations []BulkOperation) transaction.Type {
+	level := transaction.GetIsolationLevel(resourceSchema, operations[0].Action)
+	for _, operation := range operations[1:] {
+		if transaction.GetIsolationLevel(resourceSchema, operation.Action) != level {
+			return transaction.Serializable
+		}
+	}
+	return level
+}
+
+func bulkResult(context middleware.Context, operation BulkOperation, err error) BulkResult {
+	result := BulkResult{Action: operation.Action, ID: operation.ID, Err: err}
+	if id, ok := context["id"].(string); ok {
+		result.ID = id
+	}
+	if err == nil {
+		result.Response = context["response"]
+	}
+	return result
+}
+
+func abortBulk(contexts []middleware.Context, operations []BulkOperation, failed int, err error) []BulkResult {
+	results := make([]BulkResult, len(operations))
+	for i, operation := range operations {
+		context := contexts[i]
+		if context == nil {
+			context = middleware.Context{}
+		}
+		result := bulkResult(context, operation, ErrBulkAborted)
+		if i == failed {
+			result.Err = err
+		}
+		results[i] = result
+	}
+	return results
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
 	"github.com/twinj/uuid"
 )
 
@@ -52,6 +53,8 @@ const (
 	hlsearch
 
 	Unauthorized
+	PreconditionFailed
+	Aborted
 )
 
 // ResourceError is created when an anticipated problem has occurred during resource manipulations.
@@ -179,6 +182,7 @@ func GetResourcesInTransaction(context middleware.Context, resourceSchema *schem
 	if !ok {
 		return fmt.Errorf("no environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 
 	if err := extension.HandleEvent(context, environment, "pre_list_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -189,6 +193,7 @@ func GetResourcesInTransaction(context middleware.Context, resourceSchema *schem
 	if ok {
 		o = listOptionsFromQueryParameter(r.URL.Query())
 	}
+	cursorFields := addCursorFields(resourceSchema, o, paginator)
 
 	list, total, err := mainTransaction.List(
 		resourceSchema,
@@ -202,14 +207,29 @@ func GetResourcesInTransaction(context middleware.Context, resourceSchema *schem
 		return err
 	}
 
-	data := []interface{}{}
+	listData := []map[string]interface{}{}
 	for _, resource := range list {
-		data = append(data, resource.Data())
+		listData = append(listData, resource.Data())
+	}
+	if paginator != nil {
+		if cursor := paginator.NextCursor(listData); cursor != nil {
+			context["next_cursor"] = cursor.Encode()
+		}
+	}
+
+	data := []interface{}{}
+	for _, resourceData := range listData {
+		for _, field := range cursorFields {
+			delete(resourceData, field)
+		}
+		data = append(data, resourceData)
 	}
 	response[resourceSchema.Plural] = data
 
 	context["response"] = response
-	context["total"] = total
+	if o == nil || !o.SkipCount {
+		context["total"] = total
+	}
 
 	if err := extension.HandleEvent(context, environment, "post_list_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -217,23 +237,98 @@ func GetResourcesInTransaction(context middleware.Context, resourceSchema *schem
 	return nil
 }
 
+//addCursorFields adds sort keys and id to the listed fields, as the next cursor is made of them.
+//Returns the added fields, which aren't returned in the response.
+func addCursorFields(resourceSchema *schema.Schema, o *transaction.ListOptions, paginator *pagination.Paginator) []string {
+	if o == nil || o.Fields == nil || paginator == nil || paginator.Limit == 0 {
+		return nil
+	}
+	keys := []string{"id"}
+	for _, key := range paginator.Keys {
+		keys = append(keys, key.Key)
+	}
+	fields := append([]string{}, o.Fields...)
+	added := []string{}
+	for _, key := range keys {
+		if util.ContainsString(fields, key) || util.ContainsString(fields, resourceSchema.ID+"."+key) {
+			continue
+		}
+		fields = append(fields, key)
+		added = append(added, key)
+	}
+	o.Fields = fields
+	return added
+}
+
 //FilterFromQueryParameter makes list filter from query.
-func FilterFromQueryParameter(resourceSchema *schema.Schema, queryParameters map[string][]string) transaction.Filter {
+//Besides exact match on property_id=value, operators can be used as property_id[operator]=value,
+//e.g. created_at[gt]=2017-01-01 or name[like]=web%.
+func FilterFromQueryParameter(resourceSchema *schema.Schema, queryParameters map[string][]string) (transaction.Filter, error) {
 	filter := transaction.Filter{}
+	conditions := map[string][]transaction.Condition{}
 	for key, value := range queryParameters {
-		if _, err := resourceSchema.GetPropertyByID(key); err != nil {
-			log.Debug("Resource '%s' does not have %q property, ignoring filter", resourceSchema.ID, key)
-		} else {
-			filter[key] = value
+		propertyID, operator := parseFilterKey(key)
+		if _, err := resourceSchema.GetPropertyByID(propertyID); err != nil {
+			log.Debug("Resource '%s' does not have %q property, ignoring filter", resourceSchema.ID, propertyID)
+			continue
+		}
+		if operator == "" {
+			filter[propertyID] = value
+			continue
+		}
+		propertyConditions, err := conditionsFromQueryValues(operator, value)
+		if err != nil {
+			return nil, err
+		}
+		conditions[propertyID] = append(conditions[propertyID], propertyConditions...)
+	}
+	for propertyID, propertyConditions := range conditions {
+		if value, ok := filter[propertyID]; ok {
+			propertyConditions = append(propertyConditions, transaction.Condition{Operator: transaction.Equal, Value: value})
 		}
+		filter[propertyID] = propertyConditions
 	}
-	return filter
+	return filter, nil
+}
+
+func parseFilterKey(key string) (propertyID, operator string) {
+	start := strings.Index(key, "[")
+	if start <= 0 || !strings.HasSuffix(key, "]") {
+		return key, ""
+	}
+	return key[:start], key[start+1 : len(key)-1]
+}
+
+func conditionsFromQueryValues(operator string, values []string) ([]transaction.Condition, error) {
+	switch transaction.Operator(operator) {
+	case transaction.In, transaction.Equal, transaction.NotEqual:
+		var list []string
+		for _, value := range values {
+			list = append(list, strings.Split(value, ",")...)
+		}
+		condition, err := transaction.NewCondition(operator, list)
+		if err != nil {
+			return nil, err
+		}
+		return []transaction.Condition{condition}, nil
+	}
+	conditions := make([]transaction.Condition, 0, len(values))
+	for _, value := range values {
+		condition, err := transaction.NewCondition(operator, value)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
 }
 
 func listOptionsFromQueryParameter(v url.Values) *transaction.ListOptions {
 	return &transaction.ListOptions{
-		Details: parseBool(v.Get("_details"), true),
-		Fields:  v["_fields"],
+		Details:   parseBool(v.Get("_details"), true),
+		Fields:    v["_fields"],
+		SkipCount: !parseBool(v.Get("_count"), true),
+		Deleted:   parseBool(v.Get("_deleted"), false),
 	}
 }
 
@@ -260,7 +355,14 @@ func GetMultipleResources(context middleware.Context, dataStore db.DB, resourceS
 		return err
 	}
 
-	filter := FilterFromQueryParameter(resourceSchema, queryParameters)
+	if err := checkDeletedQuery(resourceSchema, auth, queryParameters); err != nil {
+		return err
+	}
+
+	filter, err := FilterFromQueryParameter(resourceSchema, queryParameters)
+	if err != nil {
+		return ResourceError{err, err.Error(), WrongQuery}
+	}
 
 	if policy.RequireOwner() {
 		filter["tenant_id"] = policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID())
@@ -278,6 +380,7 @@ func GetMultipleResources(context middleware.Context, dataStore db.DB, resourceS
 	if !ok {
 		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 	if err := extension.HandleEvent(context, environment, "pre_list", resourceSchema.ID); err != nil {
 		return err
 	}
@@ -320,6 +423,7 @@ func GetSingleResource(context middleware.Context, dataStore db.DB, resourceSche
 	if !ok {
 		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 	if err := extension.HandleEvent(context, environment, "pre_show", resourceSchema.ID); err != nil {
 		return err
 	}
@@ -359,6 +463,7 @@ func GetSingleResourceInTransaction(context middleware.Context, resourceSchema *
 	if !ok {
 		return fmt.Errorf("no environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 
 	if err := extension.HandleEvent(context, environment, "pre_show_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -389,6 +494,7 @@ func GetSingleResourceInTransaction(context middleware.Context, resourceSchema *
 	response := map[string]interface{}{}
 	response[resourceSchema.Singular] = object.Data()
 	context["response"] = response
+	setResourceVersion(context, mainTransaction, object)
 
 	if err := extension.HandleEvent(context, environment, "post_show_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -427,6 +533,9 @@ func CreateOrUpdateResource(
 	preTransaction.Close()
 
 	if fetchErr != nil {
+		if _, ok := context["if_match"]; ok {
+			return false, ResourceError{transaction.ErrVersionMismatch, "Resource doesn't exist", PreconditionFailed}
+		}
 		dataMap["id"] = resourceID
 		if err := CreateResource(context, dataStore, identityService, resourceSchema, dataMap); err != nil {
 			return false, err
@@ -446,20 +555,46 @@ func CreateResource(
 	dataMap map[string]interface{},
 ) error {
 	defer measureRequestTime(time.Now(), "create", resourceSchema.ID)
+	resource, err := prepareCreateResource(context, identityService, resourceSchema, dataMap)
+	if err != nil {
+		return err
+	}
+
+	if err := InTransaction(
+		context, dataStore,
+		transaction.GetIsolationLevel(resourceSchema, schema.ActionCreate),
+		func() error {
+			return CreateResourceInTransaction(context, resource)
+		},
+	); err != nil {
+		return err
+	}
+
+	return finishCreateResource(context, resourceSchema)
+}
+
+//prepareCreateResource checks policy, handles pre_create event and loads the resource to be created
+func prepareCreateResource(
+	context middleware.Context,
+	identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	dataMap map[string]interface{},
+) (*schema.Resource, error) {
 	manager := schema.GetManager()
 	// Load environment
 	environmentManager := extension.GetManager()
 	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
 
 	if !ok {
-		return fmt.Errorf("No environment for schema")
+		return nil, fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 	auth := context["auth"].(schema.Authorization)
 
 	//LoadPolicy
 	policy, err := loadPolicy(context, "create", resourceSchema.GetPluralURL(), auth)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	_, err = resourceSchema.GetPropertyByID("tenant_id")
@@ -470,21 +605,21 @@ func CreateResource(
 	if tenantID, ok := dataMap["tenant_id"]; ok && tenantID != nil {
 		dataMap["tenant_name"], err = identityService.GetTenantName(tenantID.(string))
 		if err != nil {
-			return ResourceError{err, err.Error(), Unauthorized}
+			return nil, ResourceError{err, err.Error(), Unauthorized}
 		}
 	}
 
 	//Apply policy for api input
 	err = policy.Check(schema.ActionCreate, auth, dataMap)
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 	delete(dataMap, "tenant_name")
 
 	// apply property filter
 	err = policy.ApplyPropertyConditionFilter(schema.ActionCreate, dataMap, nil)
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 	context["resource"] = dataMap
 	if id, ok := dataMap["id"]; !ok || id == "" {
@@ -493,7 +628,7 @@ func CreateResource(
 	context["id"] = dataMap["id"]
 
 	if err := extension.HandleEvent(context, environment, "pre_create", resourceSchema.ID); err != nil {
-		return err
+		return nil, err
 	}
 
 	if resourceData, ok := context["resource"].(map[string]interface{}); ok {
@@ -503,31 +638,32 @@ func CreateResource(
 	//Validation
 	err = resourceSchema.ValidateOnCreate(dataMap)
 	if err != nil {
-		return ResourceError{err, fmt.Sprintf("Validation error: %s", err), WrongData}
+		return nil, ResourceError{err, fmt.Sprintf("Validation error: %s", err), WrongData}
 	}
 
 	resource, err := manager.LoadResource(resourceSchema.ID, dataMap)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	//Fillup default
 	err = resource.PopulateDefaults()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	context["resource"] = resource.Data()
+	return resource, nil
+}
 
-	if err := InTransaction(
-		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionCreate),
-		func() error {
-			return CreateResourceInTransaction(context, resource)
-		},
-	); err != nil {
-		return err
+//finishCreateResource handles post_create event and applies policy for the response
+func finishCreateResource(context middleware.Context, resourceSchema *schema.Schema) error {
+	environmentManager := extension.GetManager()
+	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
+	if !ok {
+		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 
 	if err := extension.HandleEvent(context, environment, "post_create", resourceSchema.ID); err != nil {
 		return err
@@ -549,6 +685,7 @@ func CreateResourceInTransaction(context middleware.Context, resource *schema.Re
 	if !ok {
 		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 	if err := extension.HandleEvent(context, environment, "pre_create_in_transaction", resourceSchema.ID); err != nil {
 		return err
 	}
@@ -559,10 +696,14 @@ func CreateResourceInTransaction(context middleware.Context, resource *schema.Re
 			fmt.Sprintf("Failed to store data in database: %v", err),
 			CreateFailed}
 	}
+	if err := recordAuditLog(context, schema.ActionCreate, resourceSchema, resource.ID(), nil, resource.Data()); err != nil {
+		return err
+	}
 
 	response := map[string]interface{}{}
 	response[resourceSchema.Singular] = resource.Data()
 	context["response"] = response
+	setResourceVersion(context, mainTransaction, resource)
 
 	if err := extension.HandleEvent(context, environment, "post_create_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -579,21 +720,48 @@ func UpdateResource(
 	resourceID string, dataMap map[string]interface{},
 ) error {
 	defer measureRequestTime(time.Now(), "update", resourceSchema.ID)
+	dataMap, tenantIDs, err := prepareUpdateResource(context, identityService, resourceSchema, resourceID, dataMap)
+	if err != nil {
+		return err
+	}
+
+	if err := InTransaction(
+		context, dataStore,
+		transaction.GetIsolationLevel(resourceSchema, schema.ActionUpdate),
+		func() error {
+			return UpdateResourceInTransaction(context, resourceSchema, resourceID, dataMap, tenantIDs)
+		},
+	); err != nil {
+		return err
+	}
+
+	return finishUpdateResource(context, resourceSchema)
+}
+
+//prepareUpdateResource checks policy and handles pre_update event.
+//It returns data to update the resource with and tenant IDs the update is limited to.
+func prepareUpdateResource(
+	context middleware.Context,
+	identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	resourceID string, dataMap map[string]interface{},
+) (map[string]interface{}, []string, error) {
 	context["id"] = resourceID
 
 	//load environment
 	environmentManager := extension.GetManager()
 	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
 	if !ok {
-		return fmt.Errorf("No environment for schema")
+		return nil, nil, fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 
 	auth := context["auth"].(schema.Authorization)
 
 	//load policy
 	policy, err := loadPolicy(context, "update", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	context["policy"] = policy
 
@@ -602,34 +770,35 @@ func UpdateResource(
 		dataMap["tenant_name"], err = identityService.GetTenantName(tenantID.(string))
 	}
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 
 	//check policy
 	err = policy.Check(schema.ActionUpdate, auth, dataMap)
 	delete(dataMap, "tenant_name")
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 	context["resource"] = dataMap
 
 	if err := extension.HandleEvent(context, environment, "pre_update", resourceSchema.ID); err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if resourceData, ok := context["resource"].(map[string]interface{}); ok {
 		dataMap = resourceData
 	}
+	return dataMap, policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID()), nil
+}
 
-	if err := InTransaction(
-		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionUpdate),
-		func() error {
-			return UpdateResourceInTransaction(context, resourceSchema, resourceID, dataMap, policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID()))
-		},
-	); err != nil {
-		return err
+//finishUpdateResource handles post_update event and applies policy for the response
+func finishUpdateResource(context middleware.Context, resourceSchema *schema.Schema) error {
+	environmentManager := extension.GetManager()
+	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
+	if !ok {
+		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 
 	if err := extension.HandleEvent(context, environment, "post_update", resourceSchema.ID); err != nil {
 		return err
@@ -655,6 +824,7 @@ func UpdateResourceInTransaction(
 	if !ok {
 		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 	filter := transaction.IDFilter(resourceID)
 	if tenantIDs != nil {
 		filter["tenant_id"] = tenantIDs
@@ -662,7 +832,12 @@ func UpdateResourceInTransaction(
 
 	var resource *schema.Resource
 	var err error
-	switch resourceSchema.GetLockingPolicy("update") {
+	lockPolicy := resourceSchema.GetLockingPolicy("update")
+	if _, ok := context["if_match"]; ok && lockPolicy == schema.NoLocking {
+		// resource mustn't be modified by others between the version check and the update
+		lockPolicy = schema.LockRelatedResources
+	}
+	switch lockPolicy {
 	case schema.NoLocking:
 		resource, err = mainTransaction.Fetch(resourceSchema, filter)
 	case schema.LockRelatedResources:
@@ -675,6 +850,11 @@ func UpdateResourceInTransaction(
 		return ResourceError{err, err.Error(), WrongQuery}
 	}
 
+	if err := checkResourceVersion(context, mainTransaction, resource); err != nil {
+		return err
+	}
+	before := copyData(resource.Data())
+
 	policy := context["policy"].(*schema.Policy)
 	// apply property filter
 	err = policy.ApplyPropertyConditionFilter(schema.ActionUpdate, resource.Data(), dataMap)
@@ -705,10 +885,14 @@ func UpdateResourceInTransaction(
 	if err != nil {
 		return ResourceError{err, fmt.Sprintf("Failed to store data in database: %v", err), UpdateFailed}
 	}
+	if err := recordAuditLog(context, schema.ActionUpdate, resourceSchema, resourceID, before, resource.Data()); err != nil {
+		return err
+	}
 
 	response := map[string]interface{}{}
 	response[resourceSchema.Singular] = resource.Data()
 	context["response"] = response
+	setResourceVersion(context, mainTransaction, resource)
 
 	if err := extension.HandleEvent(context, environment, "post_update_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -717,6 +901,32 @@ func UpdateResourceInTransaction(
 	return nil
 }
 
+//setResourceVersion stores version of the resource in the context, it is returned as ETag
+func setResourceVersion(context middleware.Context, mainTransaction transaction.Transaction, resource *schema.Resource) {
+	version, err := transaction.ResourceVersion(mainTransaction, resource)
+	if err != nil {
+		log.Warning("Failed to get version of %s: %s", resource.ID(), err)
+		return
+	}
+	context["resource_version"] = version
+}
+
+//checkResourceVersion checks resource version against versions expected by If-Match header
+func checkResourceVersion(context middleware.Context, mainTransaction transaction.Transaction, resource *schema.Resource) error {
+	expected, ok := context["if_match"].([]string)
+	if !ok {
+		return nil
+	}
+	err := transaction.CheckResourceVersion(mainTransaction, resource, expected)
+	switch err {
+	case nil:
+		return nil
+	case transaction.ErrVersionMismatch:
+		return ResourceError{err, "Resource was modified, version doesn't match", PreconditionFailed}
+	}
+	return ResourceError{err, fmt.Sprintf("Failed to check resource version: %s", err), InternalServerError}
+}
+
 // DeleteResource deletes the resource specified by the schema and ID
 func DeleteResource(context middleware.Context,
 	dataStore db.DB,
@@ -724,21 +934,47 @@ func DeleteResource(context middleware.Context,
 	resourceID string,
 ) error {
 	defer measureRequestTime(time.Now(), "delete", resourceSchema.ID)
+	if err := prepareDeleteResource(context, dataStore, resourceSchema, resourceID); err != nil {
+		return err
+	}
+	if err := InTransaction(
+		context, dataStore,
+		transaction.GetIsolationLevel(resourceSchema, schema.ActionDelete),
+		func() error {
+			return DeleteResourceInTransaction(context, resourceSchema, resourceID)
+		},
+	); err != nil {
+		return err
+	}
+	return finishDeleteResource(context, resourceSchema)
+}
+
+//prepareDeleteResource checks policy, fetches the resource and handles pre_delete event
+func prepareDeleteResource(context middleware.Context,
+	dataStore db.DB,
+	resourceSchema *schema.Schema,
+	resourceID string,
+) error {
 	context["id"] = resourceID
 	environmentManager := extension.GetManager()
 	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
 	if !ok {
 		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 	auth := context["auth"].(schema.Authorization)
 	policy, err := loadPolicy(context, "delete", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
 	if err != nil {
 		return err
 	}
 	context["policy"] = policy
-	preTransaction, err := dataStore.Begin()
-	if err != nil {
-		return fmt.Errorf("cannot create transaction: %v", err)
+	//operations of a bulk request are prepared in the transaction they are applied in
+	preTransaction, inTransaction := context["transaction"].(transaction.Transaction)
+	if !inTransaction {
+		preTransaction, err = dataStore.Begin()
+		if err != nil {
+			return fmt.Errorf("cannot create transaction: %v", err)
+		}
 	}
 	tenantIDs := policy.GetTenantIDFilter(schema.ActionDelete, auth.TenantID())
 	filter := transaction.IDFilter(resourceID)
@@ -746,7 +982,9 @@ func DeleteResource(context middleware.Context,
 		filter["tenant_id"] = tenantIDs
 	}
 	resource, fetchErr := preTransaction.Fetch(resourceSchema, filter)
-	preTransaction.Close()
+	if !inTransaction {
+		preTransaction.Close()
+	}
 
 	if resource != nil {
 		context["resource"] = resource.Data()
@@ -765,21 +1003,20 @@ func DeleteResource(context middleware.Context,
 			return ResourceError{fetchErr, "Error when fetching resource", InternalServerError}
 		}
 	}
-	if err := InTransaction(
-		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionDelete),
-		func() error {
-			return DeleteResourceInTransaction(context, resourceSchema, resourceID)
-		},
-	); err != nil {
-		return err
-	}
-	if err := extension.HandleEvent(context, environment, "post_delete", resourceSchema.ID); err != nil {
-		return err
-	}
 	return nil
 }
 
+//finishDeleteResource handles post_delete event
+func finishDeleteResource(context middleware.Context, resourceSchema *schema.Schema) error {
+	environmentManager := extension.GetManager()
+	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
+	if !ok {
+		return fmt.Errorf("No environment for schema")
+	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
+	return extension.HandleEvent(context, environment, "post_delete", resourceSchema.ID)
+}
+
 //DeleteResourceInTransaction deletes resources in a transaction
 func DeleteResourceInTransaction(context middleware.Context, resourceSchema *schema.Schema, resourceID string) error {
 	defer measureRequestTime(time.Now(), "delete.in_tx", resourceSchema.ID)
@@ -789,6 +1026,7 @@ func DeleteResourceInTransaction(context middleware.Context, resourceSchema *sch
 	if !ok {
 		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 
 	auth := context["auth"].(schema.Authorization)
 	policy := context["policy"].(*schema.Policy)
@@ -830,6 +1068,9 @@ func DeleteResourceInTransaction(context middleware.Context, resourceSchema *sch
 	if err != nil {
 		return ResourceError{err, "", DeleteFailed}
 	}
+	if err := recordAuditLog(context, schema.ActionDelete, resourceSchema, resourceID, resource.Data(), nil); err != nil {
+		return err
+	}
 
 	if err := extension.HandleEvent(context, environment, "post_delete_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -851,6 +1092,7 @@ func ActionResource(context middleware.Context, dataStore db.DB, identityService
 	if !ok {
 		return fmt.Errorf("No environment for schema")
 	}
+	defer environmentManager.ReturnEnvironment(resourceSchema.ID, environment)
 
 	if actionSchema != nil {
 		err := resourceSchema.Validate(actionSchema, data)
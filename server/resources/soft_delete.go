@@ -0,0 +1,138 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+//ActionListDeleted is the policy action allowing to list soft deleted resources
+const ActionListDeleted = "list_deleted"
+
+//ActionRestore is the audit log action of restored resources
+const ActionRestore = "restore"
+
+//checkDeletedQuery allows listing soft deleted resources only if a policy allows list_deleted action
+func checkDeletedQuery(resourceSchema *schema.Schema, auth schema.Authorization, queryParameters map[string][]string) error {
+	deleted := queryParameters["_deleted"]
+	if len(deleted) == 0 || !parseBool(deleted[0], false) {
+		return nil
+	}
+	if !resourceSchema.SoftDelete {
+		err := fmt.Errorf("Schema %s does not support soft delete", resourceSchema.ID)
+		return ResourceError{err, err.Error(), WrongQuery}
+	}
+	if policy, _ := schema.GetManager().PolicyValidate(ActionListDeleted, resourceSchema.GetPluralURL(), auth); policy == nil {
+		err := fmt.Errorf("No matching policy: %s %s", ActionListDeleted, resourceSchema.GetPluralURL())
+		return ResourceError{err, err.Error(), Unauthorized}
+	}
+	return nil
+}
+
+//RestoreResource restores soft deleted resource and resources deleted by cascade with it
+func RestoreResource(context middleware.Context,
+	dataStore db.DB,
+	resourceSchema *schema.Schema,
+	resourceID string,
+) error {
+	defer measureRequestTime(time.Now(), "restore", resourceSchema.ID)
+	if !resourceSchema.SoftDelete {
+		err := fmt.Errorf("Schema %s does not support soft delete", resourceSchema.ID)
+		return ResourceError{err, err.Error(), NotFound}
+	}
+	context["id"] = resourceID
+	auth := context["auth"].(schema.Authorization)
+	policy, err := loadPolicy(context, "delete", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
+	if err != nil {
+		return err
+	}
+	return InTransaction(
+		context, dataStore,
+		transaction.GetIsolationLevel(resourceSchema, schema.ActionDelete),
+		func() error {
+			return RestoreResourceInTransaction(context, resourceSchema, resourceID, policy.GetTenantIDFilter(schema.ActionDelete, auth.TenantID()))
+		},
+	)
+}
+
+//RestoreResourceInTransaction restores soft deleted resource in a transaction
+func RestoreResourceInTransaction(context middleware.Context, resourceSchema *schema.Schema, resourceID string, tenantIDs []string) error {
+	defer measureRequestTime(time.Now(), "restore.in_tx", resourceSchema.ID)
+	mainTransaction := context["transaction"].(transaction.Transaction)
+	filter := transaction.IDFilter(resourceID)
+	if tenantIDs != nil {
+		filter["tenant_id"] = tenantIDs
+	}
+	list, _, err := mainTransaction.List(resourceSchema, filter, &transaction.ListOptions{Deleted: true, SkipCount: true}, nil)
+	if err != nil {
+		return ResourceError{err, "Error when fetching resource", InternalServerError}
+	}
+	if len(list) == 0 || list[0].Get(schema.DeletedAtPropertyID) == nil {
+		err := transaction.ErrResourceNotFound
+		return ResourceError{err, "Deleted resource not found", NotFound}
+	}
+	before := list[0].Data()
+
+	if err := mainTransaction.Restore(resourceSchema, resourceID); err != nil {
+		return ResourceError{err, "", UpdateFailed}
+	}
+	resource, err := mainTransaction.Fetch(resourceSchema, transaction.IDFilter(resourceID))
+	if err != nil {
+		return ResourceError{err, "Error when fetching resource", InternalServerError}
+	}
+	if err := recordAuditLog(context, ActionRestore, resourceSchema, resourceID, before, resource.Data()); err != nil {
+		return err
+	}
+	response := map[string]interface{}{}
+	response[resourceSchema.Singular] = resource.Data()
+	context["response"] = response
+	return nil
+}
+
+//PurgeDeletedResources removes resources of all soft deleted schemas which were deleted before given time
+func PurgeDeletedResources(dataStore db.DB, before time.Time) error {
+	schemas := schema.GetManager().OrderedSchemas()
+	// children go first, so relations without cascade don't block purging their parents
+	for i := len(schemas) - 1; i >= 0; i-- {
+		s := schemas[i]
+		if !s.SoftDelete || s.IsAbstract() {
+			continue
+		}
+		if err := purgeSchema(dataStore, s, before); err != nil {
+			return fmt.Errorf("Failed to purge deleted %s: %s", s.Plural, err)
+		}
+	}
+	return nil
+}
+
+func purgeSchema(dataStore db.DB, s *schema.Schema, before time.Time) error {
+	tx, err := dataStore.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+	if err := tx.Purge(s, before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
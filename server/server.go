@@ -22,13 +22,16 @@ import (
 	"github.com/braintree/manners"
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/db/migration"
-
 	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/extension/kv"
+	"github.com/cloudwan/gohan/extension/recording"
+
 	"github.com/cloudwan/gohan/job"
 	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/server/resources"
 	"github.com/cloudwan/gohan/sync"
 	sync_util "github.com/cloudwan/gohan/sync/util"
 	"github.com/cloudwan/gohan/util"
@@ -128,6 +131,10 @@ func (server *Server) addOptionsRoute() {
 	})
 }
 
+func (server *Server) addPrometheusRoute() {
+	server.martini.Get(metrics.PrometheusPath, metrics.PrometheusHandler().ServeHTTP)
+}
+
 func (server *Server) addPprofRoutes() {
 	server.martini.Group("/debug/pprof", func(r martini.Router) {
 		r.Any("/", pprof.Index)
@@ -212,6 +219,14 @@ func NewServer(configFile string) (*Server, error) {
 	m.Use(middleware.JSONURLs())
 	m.Use(middleware.WithContext())
 
+	recorder, err := recording.NewRecorderFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if recorder != nil {
+		m.Use(middleware.Recording(recorder))
+	}
+
 	server.martini = m
 
 	port := os.Getenv("PORT")
@@ -227,6 +242,9 @@ func NewServer(configFile string) (*Server, error) {
 		"gohanscript",
 		"go",
 	})
+	if util.ContainsString(server.extensions, "goja") && newGojaEnvironment == nil {
+		return nil, fmt.Errorf("goja extension is enabled but gohan is built without the goja tag")
+	}
 	schema.DefaultExtension = config.GetString("extension/default", "javascript")
 
 	manager.TimeLimit = time.Duration(config.GetInt("extension/timelimit", 30)) * time.Second
@@ -247,6 +265,12 @@ func NewServer(configFile string) (*Server, error) {
 		}
 	}
 
+	poolConfig, err := extension.NewPoolConfigFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	extension.GetManager().SetPoolConfig(poolConfig)
+
 	server.address = config.GetString("address", ":"+port)
 	if config.GetBool("tls/enabled", false) {
 		log.Info("TLS enabled")
@@ -261,6 +285,10 @@ func NewServer(configFile string) (*Server, error) {
 		log.Error("Failed to create sync, err: %s", err)
 		return nil, err
 	}
+	if _, ok := server.sync.(sync.Swapper); server.sync != nil && !ok {
+		log.Warning("Sync doesn't support atomic updates, gohan_kv values are kept in memory of this process")
+	}
+	kv.SetDefault(kv.ForSync(server.sync))
 
 	if dbErr := server.connectDB(); dbErr != nil {
 		log.Fatalf("Error while connecting to DB: %s", dbErr)
@@ -275,6 +303,9 @@ func NewServer(configFile string) (*Server, error) {
 			return nil, fmt.Errorf("invalid schema: %s", err)
 		}
 	}
+	if err = resources.ValidateAuditLog(manager, config.GetBool("audit/enabled", false)); err != nil {
+		return nil, err
+	}
 
 	if !config.GetBool("database/no_init", false) {
 		server.initDB()
@@ -303,6 +334,13 @@ func NewServer(configFile string) (*Server, error) {
 
 	if config.GetBool("keystone/use_keystone", false) {
 		server.keystoneIdentity, err = middleware.CreateIdentityServiceFromConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		server.keystoneIdentity, err = middleware.NewCachedIdentityServiceFromConfig(server.keystoneIdentity, config)
+		if err != nil {
+			return nil, err
+		}
 		m.MapTo(server.keystoneIdentity, (*middleware.IdentityService)(nil))
 		m.Use(middleware.Authentication())
 	} else {
@@ -317,6 +355,9 @@ func NewServer(configFile string) (*Server, error) {
 	if config.GetBool("profiling/enabled", false) {
 		server.addPprofRoutes()
 	}
+	if metrics.PrometheusEnabled() {
+		server.addPrometheusRoute()
+	}
 	server.addOptionsRoute()
 	cors := config.GetString("cors", "")
 	if cors != "" {
@@ -326,8 +367,8 @@ func NewServer(configFile string) (*Server, error) {
 		}
 		server.martini.Use(func(rw http.ResponseWriter, r *http.Request) {
 			rw.Header().Add("Access-Control-Allow-Origin", cors)
-			rw.Header().Add("Access-Control-Allow-Headers", "X-Auth-Token, Content-Type")
-			rw.Header().Add("Access-Control-Expose-Headers", "X-Total-Count")
+			rw.Header().Add("Access-Control-Allow-Headers", "X-Auth-Token, Content-Type, If-Match")
+			rw.Header().Add("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, Link, ETag")
 			rw.Header().Add("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE")
 		})
 	}
@@ -496,21 +537,20 @@ func RunServer(configFile string) {
 		syncWriter := NewSyncWriter(server.sync, server.db)
 		go syncWriter.Run(server.masterCtx)
 
-		config := util.GetConfig()
-		keys := config.GetStringList("watch/keys", []string{})
-		events := config.GetStringList("watch/events", []string{})
-		extensions := map[string]extension.Environment{}
-		for _, event := range events {
-			path := "sync://" + event
-			env, err := server.NewEnvironmentForPath("sync."+event, path)
-			if err != nil {
-				log.Fatal(err.Error())
-			}
-			extensions[event] = env
-		}
-		syncWatcher := NewSyncWatcher(server.sync, server.queue, keys, events, extensions)
+		syncWatcher := NewSyncWatcherFromServer(server)
 		go syncWatcher.Run(server.masterCtx)
 
+		if tokenCache, ok := server.keystoneIdentity.(*middleware.CachedIdentityService); ok {
+			go tokenCache.WatchRevocations(server.masterCtx, server.sync)
+		}
+
+	}
+	purger, err := NewSoftDeletePurgerFromConfig(server.db, util.GetConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if purger != nil {
+		go purger.Run(server.masterCtx)
 	}
 	startAMQPProcess(server)
 	startSNMPProcess(server)
@@ -36,6 +36,7 @@ import (
 	"github.com/cloudwan/gohan/schema"
 	srv "github.com/cloudwan/gohan/server"
 	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/server/resources"
 	"github.com/cloudwan/gohan/sync"
 	sync_util "github.com/cloudwan/gohan/sync/util"
 	"github.com/cloudwan/gohan/util"
@@ -190,6 +191,51 @@ var _ = Describe("Server package test", func() {
 					result = testURL("GET", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusOK)
 					Expect(result).To(HaveKeyWithValue("network", util.MatchAsJSON(networkUpdated)))
 				})
+
+				It("should update network only if If-Match header matches its ETag", func() {
+					networkRename := map[string]interface{}{"name": "NetworkRed3"}
+					_, resp := httpRequest("GET", getNetworkSingularURL("red"), adminTokenID, nil)
+					etag := resp.Header.Get("ETag")
+					Expect(etag).NotTo(BeEmpty())
+
+					_, resp = httpRequestWithHeaders("PATCH", getNetworkSingularURL("red"), adminTokenID, networkRename,
+						map[string]string{"If-Match": `"stale"`})
+					Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+
+					_, resp = httpRequestWithHeaders("PATCH", getNetworkSingularURL("red"), adminTokenID, networkRename,
+						map[string]string{"If-Match": etag})
+					Expect(resp.StatusCode).To(Equal(http.StatusOK))
+					Expect(resp.Header.Get("ETag")).NotTo(Equal(etag))
+
+					_, resp = httpRequestWithHeaders("PATCH", getNetworkSingularURL("red"), adminTokenID, networkRename,
+						map[string]string{"If-Match": etag})
+					Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+				})
+
+				It("should apply only one of concurrent updates with the same If-Match header", func() {
+					_, resp := httpRequest("GET", getNetworkSingularURL("red"), adminTokenID, nil)
+					etag := resp.Header.Get("ETag")
+					Expect(etag).NotTo(BeEmpty())
+
+					const updates = 5
+					statusCodes := make(chan int, updates)
+					for i := 0; i < updates; i++ {
+						go func(i int) {
+							defer GinkgoRecover()
+							networkRename := map[string]interface{}{"name": fmt.Sprintf("NetworkRed%d", i)}
+							_, resp := httpRequestWithHeaders("PATCH", getNetworkSingularURL("red"), adminTokenID, networkRename,
+								map[string]string{"If-Match": etag})
+							statusCodes <- resp.StatusCode
+						}(i)
+					}
+					succeeded := 0
+					for i := 0; i < updates; i++ {
+						if <-statusCodes == http.StatusOK {
+							succeeded++
+						}
+					}
+					Expect(succeeded).To(Equal(1))
+				})
 			})
 		})
 
@@ -255,11 +301,217 @@ var _ = Describe("Server package test", func() {
 			testURL("GET", networkPluralURL+"?sort_order=bad_order", adminTokenID, nil, http.StatusBadRequest)
 
 			Expect(resp.Header.Get("X-Total-Count")).To(Equal("2"))
+
+			By("assuring cursor pagination works")
+			result, resp = httpRequest("GET", networkPluralURL+"?limit=1&_count=false", adminTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("X-Total-Count")).To(BeEmpty())
+			cursor := resp.Header.Get("X-Next-Cursor")
+			Expect(cursor).NotTo(BeEmpty())
+			Expect(resp.Header.Get("Link")).To(ContainSubstring("cursor=" + cursor))
+			res = result.(map[string]interface{})
+			networks = res["networks"].([]interface{})
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0]).To(HaveKeyWithValue("id", "networkblue"))
+
+			result = testURL("GET", networkPluralURL+"?limit=1&cursor="+cursor, adminTokenID, nil, http.StatusOK)
+			res = result.(map[string]interface{})
+			networks = res["networks"].([]interface{})
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0]).To(HaveKeyWithValue("id", "networkred"))
+
+			By("assuring cursor is made of fields not returned")
+			result, resp = httpRequest("GET", networkPluralURL+"?limit=1&sort=-name&_fields=description", adminTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			networks = result.(map[string]interface{})["networks"].([]interface{})
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0]).NotTo(HaveKey("id"))
+			Expect(networks[0]).NotTo(HaveKey("name"))
+			fieldsCursor := resp.Header.Get("X-Next-Cursor")
+			Expect(fieldsCursor).NotTo(BeEmpty())
+			result = testURL("GET", networkPluralURL+"?limit=1&sort=-name&cursor="+fieldsCursor, adminTokenID, nil, http.StatusOK)
+			networks = result.(map[string]interface{})["networks"].([]interface{})
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0]).To(HaveKeyWithValue("id", "networkblue"))
+
+			testURL("GET", networkPluralURL+"?limit=1&offset=1&cursor="+cursor, adminTokenID, nil, http.StatusBadRequest)
+			testURL("GET", networkPluralURL+"?cursor=bad_cursor", adminTokenID, nil, http.StatusBadRequest)
+
 			testURL("DELETE", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNoContent)
 			testURL("DELETE", getNetworkSingularURL("blue"), adminTokenID, nil, http.StatusNoContent)
 		})
 	})
 
+	Describe("Bulk", func() {
+		bulkURL := networkPluralURL + "/_bulk"
+
+		It("should apply all operations in one request", func() {
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("blue", "red"), http.StatusCreated)
+
+			result := testURL("POST", bulkURL, adminTokenID, map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{"action": "create", "resource": getNetwork("red", "red")},
+					map[string]interface{}{"action": "update", "id": "networkblue", "resource": map[string]interface{}{"name": "NetworkBlue2"}},
+					map[string]interface{}{"action": "delete", "id": "networkred"},
+				},
+			}, http.StatusOK)
+			results := result.(map[string]interface{})["results"].([]interface{})
+			Expect(results).To(HaveLen(3))
+			Expect(results[0]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusCreated)))
+			Expect(results[0]).To(HaveKeyWithValue("id", "networkred"))
+			Expect(results[1]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusOK)))
+			Expect(results[1]).To(HaveKeyWithValue("network", HaveKeyWithValue("name", "NetworkBlue2")))
+			Expect(results[2]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusNoContent)))
+
+			testURL("GET", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNotFound)
+			testURL("DELETE", getNetworkSingularURL("blue"), adminTokenID, nil, http.StatusNoContent)
+		})
+
+		It("should not apply any operation if one fails in all or nothing mode", func() {
+			result := testURL("POST", bulkURL, adminTokenID, map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{"action": "create", "resource": getNetwork("red", "red")},
+					map[string]interface{}{"action": "update", "id": "networkblue", "resource": map[string]interface{}{"name": "NetworkBlue2"}},
+				},
+			}, http.StatusBadRequest)
+			results := result.(map[string]interface{})["results"].([]interface{})
+			Expect(results).To(HaveLen(2))
+			Expect(results[0]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusFailedDependency)))
+			Expect(results[1]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusBadRequest)))
+
+			testURL("GET", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNotFound)
+		})
+
+		It("should apply successful operations in best effort mode", func() {
+			result := testURL("POST", bulkURL, adminTokenID, map[string]interface{}{
+				"mode": "best_effort",
+				"operations": []interface{}{
+					map[string]interface{}{"action": "create", "resource": getNetwork("red", "red")},
+					map[string]interface{}{"action": "delete", "id": "networkblue"},
+				},
+			}, http.StatusOK)
+			results := result.(map[string]interface{})["results"].([]interface{})
+			Expect(results).To(HaveLen(2))
+			Expect(results[0]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusCreated)))
+			Expect(results[1]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusNotFound)))
+
+			testURL("DELETE", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNoContent)
+		})
+
+		It("should authorize each operation with the policy of its action", func() {
+			testURL("POST", networkPluralURL, memberTokenID, map[string]interface{}{"id": "networkred", "name": "Networkred"}, http.StatusCreated)
+			otherTenantNetwork := getNetwork("blue", "demo")
+
+			result := testURL("POST", bulkURL, memberTokenID, map[string]interface{}{
+				"mode": "best_effort",
+				"operations": []interface{}{
+					map[string]interface{}{"action": "update", "id": "networkred", "resource": map[string]interface{}{"name": "Networkred2"}},
+					map[string]interface{}{"action": "create", "resource": otherTenantNetwork},
+				},
+			}, http.StatusOK)
+			results := result.(map[string]interface{})["results"].([]interface{})
+			Expect(results).To(HaveLen(2))
+			Expect(results[0]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusOK)))
+			Expect(results[0]).To(HaveKeyWithValue("network", HaveKeyWithValue("name", "Networkred2")))
+			Expect(results[1]).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusUnauthorized)))
+
+			testURL("GET", getNetworkSingularURL("blue"), adminTokenID, nil, http.StatusNotFound)
+			testURL("DELETE", getNetworkSingularURL("red"), memberTokenID, nil, http.StatusNoContent)
+		})
+
+		It("should reject invalid requests", func() {
+			testURL("POST", bulkURL, adminTokenID, map[string]interface{}{}, http.StatusBadRequest)
+			testURL("POST", bulkURL, adminTokenID, map[string]interface{}{
+				"mode":       "unknown",
+				"operations": []interface{}{map[string]interface{}{"action": "delete", "id": "networkred"}},
+			}, http.StatusBadRequest)
+			testURL("POST", bulkURL, adminTokenID, map[string]interface{}{
+				"operations": []interface{}{map[string]interface{}{"action": "delete"}},
+			}, http.StatusBadRequest)
+		})
+	})
+
+	Describe("AuditLogs", func() {
+		auditLogsURL := baseURL + "/v1.0/audit_logs"
+
+		It("should record changes of resources", func() {
+			network := getNetwork("red", "red")
+			testURL("POST", networkPluralURL, adminTokenID, network, http.StatusCreated)
+			testURL("PUT", getNetworkSingularURL("red"), adminTokenID, map[string]interface{}{"name": "NetworkRed2"}, http.StatusOK)
+			testURL("DELETE", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNoContent)
+
+			result := testURL("GET", auditLogsURL+"?resource_id=networkred&sort_key=timestamp", adminTokenID, nil, http.StatusOK)
+			auditLogs := result.(map[string]interface{})["audit_logs"].([]interface{})
+			Expect(auditLogs).To(HaveLen(3))
+			actions := []interface{}{}
+			for _, auditLog := range auditLogs {
+				Expect(auditLog).To(HaveKeyWithValue("schema_id", "network"))
+				Expect(auditLog).To(HaveKeyWithValue("user_id", "admin"))
+				Expect(auditLog).To(HaveKeyWithValue("tenant_id", adminTenantID))
+				Expect(auditLog).To(HaveKeyWithValue("roles", ConsistOf("admin")))
+				actions = append(actions, auditLog.(map[string]interface{})["action"])
+			}
+			Expect(actions).To(ConsistOf("create", "update", "delete"))
+
+			result = testURL("GET", auditLogsURL+"?resource_id=networkred&action=update", adminTokenID, nil, http.StatusOK)
+			auditLogs = result.(map[string]interface{})["audit_logs"].([]interface{})
+			Expect(auditLogs).To(HaveLen(1))
+			Expect(auditLogs[0]).To(HaveKeyWithValue("diff", Equal(map[string]interface{}{
+				"name": map[string]interface{}{"before": "Networkred", "after": "NetworkRed2"},
+			})))
+		})
+
+		It("should not allow changing audit logs", func() {
+			testURL("POST", auditLogsURL, adminTokenID, map[string]interface{}{"action": "create"}, http.StatusNotFound)
+		})
+
+		It("should require audit log schema if schemas are audited", func() {
+			manager := schema.GetManager().Clone()
+			Expect(resources.ValidateAuditLog(manager, true)).To(Succeed())
+			auditLogSchema, _ := manager.Schema(resources.AuditLogSchemaID)
+			manager.UnRegisterSchema(auditLogSchema)
+			Expect(resources.ValidateAuditLog(manager, true)).NotTo(Succeed())
+			Expect(resources.ValidateAuditLog(manager, false)).To(Succeed())
+		})
+	})
+
+	Describe("SoftDelete", func() {
+		foldersURL := baseURL + "/v1.0/folders"
+		documentsURL := baseURL + "/v1.0/documents"
+
+		BeforeEach(func() {
+			testURL("POST", foldersURL, adminTokenID, map[string]interface{}{
+				"id": "folder1", "name": "Folder 1", "tenant_id": adminTenantID,
+			}, http.StatusCreated)
+			testURL("POST", documentsURL, adminTokenID, map[string]interface{}{
+				"id": "document1", "name": "Document 1", "tenant_id": adminTenantID, "folder_id": "folder1",
+			}, http.StatusCreated)
+		})
+
+		It("should hide deleted resources and restore them", func() {
+			testURL("DELETE", foldersURL+"/folder1", adminTokenID, nil, http.StatusNoContent)
+			testURL("GET", foldersURL+"/folder1", adminTokenID, nil, http.StatusNotFound)
+			result := testURL("GET", documentsURL, adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("documents", BeEmpty()))
+
+			result = testURL("GET", foldersURL+"?_deleted=true", adminTokenID, nil, http.StatusOK)
+			folders := result.(map[string]interface{})["folders"].([]interface{})
+			Expect(folders).To(HaveLen(1))
+			Expect(folders[0]).To(HaveKeyWithValue("deleted_at", Not(BeNil())))
+
+			result = testURL("POST", foldersURL+"/folder1/restore", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("folder", HaveKeyWithValue("deleted_at", BeNil())))
+			testURL("GET", foldersURL+"/folder1", adminTokenID, nil, http.StatusOK)
+			testURL("GET", documentsURL+"/document1", adminTokenID, nil, http.StatusOK)
+			testURL("POST", foldersURL+"/folder1/restore", adminTokenID, nil, http.StatusNotFound)
+		})
+
+		It("should not list deleted resources without list_deleted policy", func() {
+			testURL("GET", foldersURL, powerUserTokenID, nil, http.StatusOK)
+			testURL("GET", foldersURL+"?_deleted=true", powerUserTokenID, nil, http.StatusUnauthorized)
+		})
+	})
+
 	Describe("TwoSameResourceRelations", func() {
 		It("should work", func() {
 			By("creating 2 cities")
@@ -997,6 +1249,10 @@ func testURL(method, url, token string, postData interface{}, expectedCode int)
 }
 
 func httpRequest(method, url, token string, postData interface{}) (interface{}, *http.Response) {
+	return httpRequestWithHeaders(method, url, token, postData, nil)
+}
+
+func httpRequestWithHeaders(method, url, token string, postData interface{}, headers map[string]string) (interface{}, *http.Response) {
 	client := &http.Client{}
 	var reader io.Reader
 	if postData != nil {
@@ -1007,6 +1263,9 @@ func httpRequest(method, url, token string, postData interface{}) (interface{},
 	request, err := http.NewRequest(method, url, reader)
 	Expect(err).ToNot(HaveOccurred())
 	request.Header.Set("X-Auth-Token", token)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
 	var data interface{}
 	resp, err := client.Do(request)
 	Expect(err).ToNot(HaveOccurred())
@@ -1047,5 +1306,8 @@ func clearTable(tx transaction.Transaction, s *schema.Schema) error {
 			return err
 		}
 	}
+	if s.SoftDelete {
+		return tx.Purge(s, time.Now().Add(time.Hour))
+	}
 	return nil
 }
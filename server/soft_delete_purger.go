@@ -0,0 +1,83 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/server/resources"
+	"github.com/cloudwan/gohan/util"
+)
+
+// SoftDeletePurger periodically removes soft deleted resources
+// which were deleted longer than the retention period ago.
+type SoftDeletePurger struct {
+	db        db.DB
+	retention time.Duration
+	interval  time.Duration
+}
+
+// NewSoftDeletePurger creates a new instance of SoftDeletePurger.
+func NewSoftDeletePurger(db db.DB, retention, interval time.Duration) *SoftDeletePurger {
+	return &SoftDeletePurger{
+		db:        db,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// NewSoftDeletePurgerFromConfig creates SoftDeletePurger configured by soft_delete section,
+// nil is returned when retention is not configured.
+func NewSoftDeletePurgerFromConfig(db db.DB, config *util.Config) (*SoftDeletePurger, error) {
+	rawRetention := config.GetString("soft_delete/retention", "")
+	if rawRetention == "" {
+		return nil, nil
+	}
+	retention, err := time.ParseDuration(rawRetention)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid soft_delete/retention: %s", err)
+	}
+	interval, err := time.ParseDuration(config.GetString("soft_delete/purge_interval", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid soft_delete/purge_interval: %s", err)
+	}
+	return NewSoftDeletePurger(db, retention, interval), nil
+}
+
+// Run purges deleted resources every interval.
+// This method blocks until canceled by the ctx.
+// Errors are logged, but do not interupt the loop.
+func (purger *SoftDeletePurger) Run(ctx context.Context) error {
+	for {
+		if err := purger.Purge(); err != nil {
+			log.Error("soft delete purge error: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(purger.interval):
+		}
+	}
+}
+
+// Purge removes resources deleted before the retention period.
+func (purger *SoftDeletePurger) Purge() error {
+	return resources.PurgeDeletedResources(purger.db, time.Now().Add(-purger.retention))
+}
@@ -194,6 +194,9 @@ func (watcher *StateWatcher) StateUpdate(event *gohan_sync.Event) error {
 
 	environmentManager := extension.GetManager()
 	environment, haveEnvironment := environmentManager.GetEnvironment(curSchema.ID)
+	if haveEnvironment {
+		defer environmentManager.ReturnEnvironment(curSchema.ID, environment)
+	}
 	context := map[string]interface{}{}
 
 	if haveEnvironment {
@@ -282,6 +285,9 @@ func (watcher *StateWatcher) MonitoringUpdate(event *gohan_sync.Event) error {
 
 	environmentManager := extension.GetManager()
 	environment, haveEnvironment := environmentManager.GetEnvironment(curSchema.ID)
+	if haveEnvironment {
+		defer environmentManager.ReturnEnvironment(curSchema.ID, environment)
+	}
 	context := map[string]interface{}{}
 	context["resource"] = curResource.Data()
 	context["schema"] = curSchema
@@ -0,0 +1,118 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	gohan_sync "github.com/cloudwan/gohan/sync"
+)
+
+const (
+	//SyncWatchDeadLetterPrefix is the sync path under which events failed by at-least-once watches are put
+	SyncWatchDeadLetterPrefix = "/gohan/watch/dead_letter"
+	//SyncWatchReplayPrefix is the sync path watched for dead letters requested to be handled again
+	SyncWatchReplayPrefix = "/gohan/watch/replay"
+)
+
+//SyncDeadLetter is a sync event which kept failing after all retries
+type SyncDeadLetter struct {
+	ID       string                 `json:"id"`
+	Key      string                 `json:"key"`
+	Action   string                 `json:"action"`
+	Data     map[string]interface{} `json:"data"`
+	Revision int64                  `json:"revision"`
+	Error    string                 `json:"error"`
+	Attempts int                    `json:"attempts"`
+	FailedAt time.Time              `json:"failed_at"`
+}
+
+func newSyncDeadLetter(event *gohan_sync.Event, err error, attempts int) *SyncDeadLetter {
+	return &SyncDeadLetter{
+		ID:       strconv.FormatInt(event.Revision, 10),
+		Key:      event.Key,
+		Action:   event.Action,
+		Data:     event.Data,
+		Revision: event.Revision,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+}
+
+//Event returns the original sync event of the dead letter
+func (deadLetter *SyncDeadLetter) Event() *gohan_sync.Event {
+	return &gohan_sync.Event{
+		Action:   deadLetter.Action,
+		Key:      deadLetter.Key,
+		Data:     deadLetter.Data,
+		Revision: deadLetter.Revision,
+	}
+}
+
+func decodeSyncDeadLetter(value string) (*SyncDeadLetter, error) {
+	deadLetter := &SyncDeadLetter{}
+	if err := json.Unmarshal([]byte(value), deadLetter); err != nil {
+		return nil, fmt.Errorf("Invalid dead letter: %s", err)
+	}
+	return deadLetter, nil
+}
+
+func putSyncDeadLetter(sync gohan_sync.Sync, deadLetter *SyncDeadLetter) error {
+	value, err := json.Marshal(deadLetter)
+	if err != nil {
+		return err
+	}
+	if err := sync.Update(SyncWatchDeadLetterPrefix+"/"+deadLetter.ID, string(value)); err != nil {
+		return fmt.Errorf("Failed to put dead letter for key `%s`: %s", deadLetter.Key, err)
+	}
+	return nil
+}
+
+//ListSyncDeadLetters returns dead letters stored in the sync backend.
+//Sync backends report missing paths as errors, so fetch errors are treated as no dead letters.
+func ListSyncDeadLetters(sync gohan_sync.Sync) ([]*SyncDeadLetter, error) {
+	deadLetters := []*SyncDeadLetter{}
+	node, err := sync.Fetch(SyncWatchDeadLetterPrefix)
+	if err != nil {
+		log.Debug("No dead letters fetched: %s", err)
+		return deadLetters, nil
+	}
+	for _, child := range node.Children {
+		deadLetter, err := decodeSyncDeadLetter(child.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", child.Key, err)
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	return deadLetters, nil
+}
+
+//ReplaySyncDeadLetter moves the dead letter to SyncWatchReplayPrefix,
+//so a running sync watcher handles the original event again
+func ReplaySyncDeadLetter(sync gohan_sync.Sync, id string) error {
+	node, err := sync.Fetch(SyncWatchDeadLetterPrefix + "/" + id)
+	if err != nil {
+		return fmt.Errorf("Dead letter %s not found: %s", id, err)
+	}
+	if err := sync.Update(SyncWatchReplayPrefix+"/"+id, node.Value); err != nil {
+		return err
+	}
+	return sync.Delete(SyncWatchDeadLetterPrefix+"/"+id, false)
+}
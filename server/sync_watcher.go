@@ -17,8 +17,10 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -34,6 +36,7 @@ import (
 
 const (
 	SyncWatchRevisionPrefix = "/gohan/watch/revision"
+	knownKeysPathPrefix     = "/gohan/watch/known_keys"
 	processPathPrefix       = "/gohan/cluster/process"
 	masterTTL               = 10
 )
@@ -48,15 +51,87 @@ type SyncWatcher struct {
 	queue *job.Queue
 	// list of key names to watch
 	watchKeys []string
-	// list of event names
-	watchEvents []string
+	// list of events to handle
+	watchEvents []*SyncWatchEvent
 	// map from event naems to VM environments
 	watchExtensions map[string]extension.Environment
 	backoff         time.Duration
 }
 
+// SyncWatchEvent configures handling of events with keys starting with the path.
+// In the at-least-once mode, the revision of a watched path advances only after
+// the handler succeeds. Failed events are retried with an exponential backoff
+// and put under SyncWatchDeadLetterPrefix when all the retries fail.
+type SyncWatchEvent struct {
+	Path        string
+	AtLeastOnce bool
+	Retries     int
+	Backoff     time.Duration
+}
+
+// NewSyncWatchEventsFromConfig reads watch/events entries.
+// An entry is either a path or a map with path, at_least_once, retries and backoff keys.
+func NewSyncWatchEventsFromConfig(config *util.Config) ([]*SyncWatchEvent, error) {
+	events := []*SyncWatchEvent{}
+	for _, rawEvent := range config.GetList("watch/events", []interface{}{}) {
+		switch rawEvent := rawEvent.(type) {
+		case string:
+			events = append(events, &SyncWatchEvent{Path: rawEvent})
+		case map[string]interface{}:
+			event, err := newSyncWatchEvent(rawEvent)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		default:
+			return nil, fmt.Errorf("Invalid watch/events entry: %v", rawEvent)
+		}
+	}
+	return events, nil
+}
+
+func newSyncWatchEvent(rawEvent map[string]interface{}) (*SyncWatchEvent, error) {
+	path, ok := rawEvent["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("Missing path in watch/events entry: %v", rawEvent)
+	}
+	event := &SyncWatchEvent{Path: path, Retries: 3, Backoff: time.Second}
+	if atLeastOnce, ok := rawEvent["at_least_once"].(bool); ok {
+		event.AtLeastOnce = atLeastOnce
+	}
+	if rawRetries, ok := rawEvent["retries"]; ok {
+		retries, err := configInt(rawRetries)
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("Invalid retries of watch/events entry %s: %v", path, rawRetries)
+		}
+		event.Retries = retries
+	}
+	if backoff, ok := rawEvent["backoff"].(string); ok {
+		var err error
+		if event.Backoff, err = time.ParseDuration(backoff); err != nil {
+			return nil, fmt.Errorf("Invalid backoff of watch/events entry %s: %s", path, err)
+		}
+	}
+	return event, nil
+}
+
+// configInt converts a number read from yaml or json config to int
+func configInt(value interface{}) (int, error) {
+	switch value := value.(type) {
+	case int:
+		return value, nil
+	case int64:
+		return int(value), nil
+	case float64:
+		if value == math.Trunc(value) {
+			return int(value), nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not an integer", value)
+}
+
 // NewSyncWatcher creates a new instance of syncWatcher
-func NewSyncWatcher(sync gohan_sync.Sync, queue *job.Queue, keys []string, events []string, extensions map[string]extension.Environment) *SyncWatcher {
+func NewSyncWatcher(sync gohan_sync.Sync, queue *job.Queue, keys []string, events []*SyncWatchEvent, extensions map[string]extension.Environment) *SyncWatcher {
 	return &SyncWatcher{
 		sync:            sync,
 		queue:           queue,
@@ -70,15 +145,18 @@ func NewSyncWatcher(sync gohan_sync.Sync, queue *job.Queue, keys []string, event
 func NewSyncWatcherFromServer(server *Server) *SyncWatcher {
 	config := util.GetConfig()
 	keys := config.GetStringList("watch/keys", []string{})
-	events := config.GetStringList("watch/events", []string{})
+	events, err := NewSyncWatchEventsFromConfig(config)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 	extensions := map[string]extension.Environment{}
 	for _, event := range events {
-		path := "sync://" + event
-		env, err := server.NewEnvironmentForPath("sync."+event, path)
+		path := "sync://" + event.Path
+		env, err := server.NewEnvironmentForPath("sync."+event.Path, path)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
-		extensions[event] = env
+		extensions[event.Path] = env
 	}
 
 	return NewSyncWatcher(server.sync, server.queue, keys, events, extensions)
@@ -216,10 +294,12 @@ func (watcher *SyncWatcher) runSyncWatches(ctx context.Context, size int, positi
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
-	for idx, path := range watcher.watchKeys {
+	watchKeys := append([]string{}, watcher.watchKeys...)
+	watchKeys = append(watchKeys, SyncWatchReplayPrefix)
+	for idx, path := range watchKeys {
 		wg.Add(1)
 		prio := (position - (idx % size) + size) % size
-		log.Debug("SyncWatch Priority of `%s`: `%d`", watcher.watchKeys, prio)
+		log.Debug("SyncWatch Priority of `%s`: `%d`", path, prio)
 
 		go func(ctx context.Context, idx int, path string, prio int) {
 			defer wg.Done()
@@ -259,6 +339,10 @@ func (watcher *SyncWatcher) processSyncWatch(ctx context.Context, path string) e
 
 	watchCtx, watchCancel := context.WithCancel(ctx)
 	fromRevision := watcher.fetchStoredRevision(path)
+	knownKeys, err := watcher.fetchKnownKeys(path, fromRevision)
+	if err != nil {
+		return err
+	}
 	respCh, err := watcher.sync.WatchContext(watchCtx, path, fromRevision)
 	if err != nil {
 		return err
@@ -268,23 +352,20 @@ func (watcher *SyncWatcher) processSyncWatch(ctx context.Context, path string) e
 	watchErr := make(chan error, 1)
 	go func() {
 		watchErr <- func() error {
-			for response := range respCh {
-				if response.Err != nil {
-					return response.Err
+			revision := fromRevision
+			for {
+				var err error
+				revision, err = watcher.handleWatchEvents(ctx, path, revision, respCh, knownKeys)
+				if err != gohan_sync.ErrCompacted {
+					return err
 				}
-
-				watcher.queue.Add(job.NewJob(
-					func() {
-						resp := response
-						watcher.watchExtensionHandler(resp)
-					},
-				))
-				err := watcher.storeRevision(path, response.Revision)
-				if err != nil {
+				if revision, err = watcher.recoverFromCompaction(ctx, path, revision, knownKeys); err != nil {
+					return err
+				}
+				if respCh, err = watcher.sync.WatchContext(watchCtx, path, revision); err != nil {
 					return err
 				}
 			}
-			return nil
 		}()
 	}()
 
@@ -301,15 +382,287 @@ func (watcher *SyncWatcher) processSyncWatch(ctx context.Context, path string) e
 	}
 }
 
-func (watcher *SyncWatcher) watchExtensionHandler(response *gohan_sync.Event) {
+// handleWatchEvents handles events of a watch on the path until the channel is closed or gets an error.
+// Returns the revision of the last handled event.
+func (watcher *SyncWatcher) handleWatchEvents(ctx context.Context, path string, revision int64,
+	respCh <-chan *gohan_sync.Event, knownKeys map[string]struct{}) (int64, error) {
+	for response := range respCh {
+		if response.Err != nil {
+			return revision, response.Err
+		}
+		if err := watcher.handleWatchEvent(ctx, response, knownKeys); err != nil {
+			return revision, err
+		}
+		if err := watcher.storeRevision(path, response.Revision); err != nil {
+			return revision, err
+		}
+		revision = response.Revision
+	}
+	return revision, nil
+}
+
+func (watcher *SyncWatcher) handleWatchEvent(ctx context.Context, response *gohan_sync.Event, knownKeys map[string]struct{}) error {
+	if err := watcher.updateKnownKeys(response, knownKeys); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(response.Key, SyncWatchReplayPrefix+"/") {
+		return watcher.replayDeadLetter(ctx, response)
+	}
+	if event := watcher.findWatchEvent(response.Key); event != nil && event.AtLeastOnce {
+		return watcher.handleAtLeastOnce(ctx, event, response)
+	}
+	watcher.queue.Add(job.NewJob(
+		func() {
+			watcher.watchExtensionHandler(response)
+		},
+	))
+	return nil
+}
+
+// updateKnownKeys adds the key of the event to the known keys or removes it when deleted.
+// Known keys are persisted in the sync backend, so that deletes done while no watcher runs are noticed
+// when the revision is compacted.
+func (watcher *SyncWatcher) updateKnownKeys(response *gohan_sync.Event, knownKeys map[string]struct{}) error {
+	_, known := knownKeys[response.Key]
+	var err error
+	if response.Action == "delete" {
+		if !known {
+			return nil
+		}
+		delete(knownKeys, response.Key)
+		err = watcher.sync.Delete(knownKeysPathPrefix+response.Key, false)
+	} else {
+		if known {
+			return nil
+		}
+		knownKeys[response.Key] = struct{}{}
+		err = watcher.sync.Update(knownKeysPathPrefix+response.Key, "{}")
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to update known key `%s` in sync storage: %s", response.Key, err)
+	}
+	return nil
+}
+
+// fetchKnownKeys returns keys under the path which were handled before the revision.
+// These are the keys which can be deleted without the watcher noticing when the revision is compacted.
+// When no keys are persisted, e.g. by an older version, they are derived from the current snapshot,
+// which misses keys deleted since the revision.
+func (watcher *SyncWatcher) fetchKnownKeys(path string, revision int64) (map[string]struct{}, error) {
+	knownKeys := map[string]struct{}{}
+	if revision == gohan_sync.RevisionCurrent {
+		// the watch sends all the current keys again
+		if err := watcher.sync.Delete(knownKeysPathPrefix+path, true); err != nil {
+			return nil, err
+		}
+		return knownKeys, nil
+	}
+	persisted, _, err := watcher.fetchSnapshot(knownKeysPathPrefix + path)
+	if err != nil {
+		return nil, err
+	}
+	for key := range persisted {
+		knownKeys[strings.TrimPrefix(key, knownKeysPathPrefix)] = struct{}{}
+	}
+	if len(knownKeys) > 0 {
+		return knownKeys, nil
+	}
+	snapshot, _, err := watcher.fetchSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	for key, node := range snapshot {
+		if node.Revision <= revision {
+			if err := watcher.updateKnownKeys(&gohan_sync.Event{Action: "get", Key: key}, knownKeys); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return knownKeys, nil
+}
+
+// fetchSnapshot returns all the keys under the path and the revision they are read at.
+// Backends which can't tell the revision of a read return the latest revision of the keys,
+// which misses deletes done after the last update.
+func (watcher *SyncWatcher) fetchSnapshot(path string) (map[string]*gohan_sync.Node, int64, error) {
+	var node *gohan_sync.Node
+	var revision int64
+	var err error
+	snapshotter, isSnapshotter := watcher.sync.(gohan_sync.Snapshotter)
+	if isSnapshotter {
+		node, revision, err = snapshotter.Snapshot(path)
+	} else {
+		node, err = watcher.sync.Fetch(path)
+	}
+	snapshot := map[string]*gohan_sync.Node{}
+	if err == gohan_sync.ErrNotFound {
+		return snapshot, revision, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var flatten func(node *gohan_sync.Node)
+	flatten = func(node *gohan_sync.Node) {
+		if node.Revision > 0 {
+			snapshot[node.Key] = node
+			if !isSnapshotter && node.Revision > revision {
+				revision = node.Revision
+			}
+		}
+		for _, child := range node.Children {
+			flatten(child)
+		}
+	}
+	flatten(node)
+	return snapshot, revision, nil
+}
+
+// recoverFromCompaction handles changes on the path since the revision which is no longer
+// available in the sync backend. Set events are synthesised for keys changed after the revision
+// and delete events for known keys missing in the current snapshot.
+// Returns the snapshot revision the watch should continue from.
+func (watcher *SyncWatcher) recoverFromCompaction(ctx context.Context, path string, revision int64, knownKeys map[string]struct{}) (int64, error) {
+	snapshot, snapshotRevision, err := watcher.fetchSnapshot(path)
+	if err != nil {
+		return revision, err
+	}
+	if snapshotRevision < revision {
+		snapshotRevision = revision
+	}
+
+	events := []*gohan_sync.Event{}
+	for key, node := range snapshot {
+		if _, known := knownKeys[key]; known && node.Revision <= revision {
+			continue
+		}
+		event := &gohan_sync.Event{Action: "set", Key: key, Revision: node.Revision}
+		if err := json.Unmarshal([]byte(node.Value), &event.Data); err != nil {
+			log.Warning("failed to unmarshal value of `%s`: %s", key, err)
+		}
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Revision < events[j].Revision
+	})
+	deleted := []string{}
+	for key := range knownKeys {
+		if _, ok := snapshot[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+	sort.Strings(deleted)
+	for _, key := range deleted {
+		events = append(events, &gohan_sync.Event{Action: "delete", Key: key, Revision: snapshotRevision})
+	}
+
+	log.Warning("Revision %d of watch path `%s` is compacted, continuing from snapshot revision %d with %d synthesised events (%d deleted keys)",
+		revision, path, snapshotRevision, len(events), len(deleted))
+	metrics.UpdateCounter(1, "watch.compaction.%s", path)
+	metrics.UpdateCounter(snapshotRevision-revision, "watch.compaction_gap.%s", path)
+
+	for _, event := range events {
+		if err := watcher.handleWatchEvent(ctx, event, knownKeys); err != nil {
+			return revision, err
+		}
+	}
+	if err := watcher.storeRevision(path, snapshotRevision); err != nil {
+		return revision, err
+	}
+	return snapshotRevision, nil
+}
+
+func (watcher *SyncWatcher) findWatchEvent(key string) *SyncWatchEvent {
 	for _, event := range watcher.watchEvents {
 		//match extensions
-		if strings.HasPrefix(response.Key, "/"+event) {
-			env := watcher.watchExtensions[event]
-			watcher.runExtensionOnSync(response, env.Clone())
-			return
+		if strings.HasPrefix(key, "/"+event.Path) {
+			return event
+		}
+	}
+	return nil
+}
+
+func (watcher *SyncWatcher) watchExtensionHandler(response *gohan_sync.Event) error {
+	event := watcher.findWatchEvent(response.Key)
+	if event == nil {
+		return nil
+	}
+	env := watcher.watchExtensions[event.Path]
+	return watcher.runExtensionOnSync(response, env.Clone())
+}
+
+// handleAtLeastOnce runs the handler on the server queue and waits for the result.
+// Failed events are retried and put to the dead letters when all the retries fail.
+// Returns an error only when the event is neither handled nor put to the dead letters.
+func (watcher *SyncWatcher) handleAtLeastOnce(ctx context.Context, event *SyncWatchEvent, response *gohan_sync.Event) error {
+	var err error
+	attempts := 0
+	for attempts <= event.Retries {
+		if attempts > 0 {
+			select {
+			case <-time.After(event.Backoff << uint(attempts-1)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
+		attempts++
+		if err = watcher.runJob(ctx, response); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warning("Handling event on `%s` failed, attempt %d of %d: %s", response.Key, attempts, event.Retries+1, err)
 	}
+	log.Error("Putting event on `%s` to dead letters: %s", response.Key, err)
+	return putSyncDeadLetter(watcher.sync, newSyncDeadLetter(response, err, attempts))
+}
+
+// runJob runs the handler on the server queue and returns its result,
+// or the error of the ctx if it's canceled before the handler finishes
+func (watcher *SyncWatcher) runJob(ctx context.Context, response *gohan_sync.Event) error {
+	done := make(chan error, 1)
+	// adding blocks while all the workers are busy
+	go watcher.queue.Add(job.NewJob(
+		func() {
+			err := fmt.Errorf("extension panicked")
+			defer func() {
+				done <- err
+			}()
+			err = watcher.watchExtensionHandler(response)
+		},
+	))
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// replayDeadLetter handles the event of a dead letter put under SyncWatchReplayPrefix
+// and removes the dead letter afterwards.
+func (watcher *SyncWatcher) replayDeadLetter(ctx context.Context, response *gohan_sync.Event) error {
+	if response.Action == "delete" {
+		return nil
+	}
+	rawDeadLetter, err := json.Marshal(response.Data)
+	if err != nil {
+		return err
+	}
+	deadLetter, err := decodeSyncDeadLetter(string(rawDeadLetter))
+	if err != nil {
+		log.Error("Ignoring dead letter replay `%s`: %s", response.Key, err)
+		return watcher.sync.Delete(response.Key, false)
+	}
+	log.Info("Replaying dead letter %s for key `%s`", deadLetter.ID, deadLetter.Key)
+	event := watcher.findWatchEvent(deadLetter.Key)
+	if event == nil {
+		log.Warning("No watch event matches dead letter key `%s`", deadLetter.Key)
+	} else if err := watcher.handleAtLeastOnce(ctx, event, deadLetter.Event()); err != nil {
+		return err
+	}
+	return watcher.sync.Delete(response.Key, false)
 }
 
 // fetchStoredRevision returns the revision number stored in the sync backend for a path.
@@ -341,7 +694,7 @@ func (watcher *SyncWatcher) measureSyncTime(timeStarted time.Time, action string
 }
 
 //Run extension on sync
-func (watcher *SyncWatcher) runExtensionOnSync(response *gohan_sync.Event, env extension.Environment) {
+func (watcher *SyncWatcher) runExtensionOnSync(response *gohan_sync.Event, env extension.Environment) error {
 	defer watcher.measureSyncTime(time.Now(), response.Action)
 
 	context := map[string]interface{}{
@@ -351,7 +704,7 @@ func (watcher *SyncWatcher) runExtensionOnSync(response *gohan_sync.Event, env e
 	}
 	if err := env.HandleEvent("notification", context); err != nil {
 		log.Warning(fmt.Sprintf("extension error: %s", err))
-		return
+		return err
 	}
-	return
+	return nil
 }
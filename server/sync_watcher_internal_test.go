@@ -0,0 +1,51 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwan/gohan/job"
+	gohan_sync "github.com/cloudwan/gohan/sync"
+)
+
+func TestNewSyncWatchEventRetries(t *testing.T) {
+	for _, retries := range []interface{}{5, int64(5), float64(5)} {
+		event, err := newSyncWatchEvent(map[string]interface{}{"path": "/watch/key", "retries": retries})
+		if err != nil {
+			t.Fatalf("retries %#v: %s", retries, err)
+		}
+		if event.Retries != 5 {
+			t.Errorf("retries %#v: expected 5, got %d", retries, event.Retries)
+		}
+	}
+	for _, retries := range []interface{}{"5", 2.5, -1} {
+		if _, err := newSyncWatchEvent(map[string]interface{}{"path": "/watch/key", "retries": retries}); err == nil {
+			t.Errorf("retries %#v: expected an error", retries)
+		}
+	}
+}
+
+func TestRunJobCanceled(t *testing.T) {
+	// no workers, so the job never runs
+	watcher := &SyncWatcher{queue: job.NewQueue(0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := watcher.runJob(ctx, &gohan_sync.Event{Key: "/watch/key"}); err != context.Canceled {
+		t.Errorf("expected %s, got %v", context.Canceled, err)
+	}
+}
@@ -17,13 +17,18 @@ package server_test
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/job"
 	"github.com/cloudwan/gohan/schema"
 	srv "github.com/cloudwan/gohan/server"
+	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/sync/memory"
 )
 
 const (
@@ -32,6 +37,68 @@ const (
 	masterTTL         = 10
 )
 
+type recordingEnvironment struct {
+	events chan string
+}
+
+func (env *recordingEnvironment) LoadExtensionsForPath(extensions []*schema.Extension, timeLimit time.Duration, timeLimits []*schema.PathEventTimeLimit, path string) error {
+	return nil
+}
+
+func (env *recordingEnvironment) HandleEvent(event string, context map[string]interface{}) error {
+	env.events <- context["action"].(string) + " " + context["key"].(string)
+	return nil
+}
+
+func (env *recordingEnvironment) Clone() extension.Environment {
+	return env
+}
+
+// compactingSync fails a watch on the path with ErrCompacted when asked to,
+// changes done before resume are not delivered by the failed watch
+type compactingSync struct {
+	gohan_sync.Sync
+	path    string
+	compact chan struct{}
+	resume  chan struct{}
+}
+
+func (s *compactingSync) Snapshot(path string) (*gohan_sync.Node, int64, error) {
+	return s.Sync.(gohan_sync.Snapshotter).Snapshot(path)
+}
+
+func (s *compactingSync) WatchContext(ctx context.Context, path string, revision int64) (<-chan *gohan_sync.Event, error) {
+	if path != s.path {
+		return s.Sync.WatchContext(ctx, path, revision)
+	}
+	watchCtx, watchCancel := context.WithCancel(ctx)
+	events, err := s.Sync.WatchContext(watchCtx, path, revision)
+	if err != nil {
+		watchCancel()
+		return nil, err
+	}
+	responseChan := make(chan *gohan_sync.Event)
+	go func() {
+		defer close(responseChan)
+		defer watchCancel()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				responseChan <- event
+			case <-s.compact:
+				watchCancel()
+				<-s.resume
+				responseChan <- &gohan_sync.Event{Err: gohan_sync.ErrCompacted}
+				return
+			}
+		}
+	}()
+	return responseChan, nil
+}
+
 var _ = Describe("Sync watcher test", func() {
 	BeforeEach(func() {
 		watcher := srv.NewSyncWatcherFromServer(server)
@@ -133,4 +200,136 @@ var _ = Describe("Sync watcher test", func() {
 			Expect(len(wrn.Children)).To(Equal(3))
 		})
 	})
+	Describe("Compaction recovery", func() {
+		It("should synthesise events for changes missed by compacted watch", func() {
+			memorySync, err := memory.NewSync("")
+			Expect(err).ToNot(HaveOccurred())
+			defer memorySync.Close()
+			sync := &compactingSync{
+				Sync:    memorySync,
+				path:    "/compact",
+				compact: make(chan struct{}),
+				resume:  make(chan struct{}),
+			}
+			env := &recordingEnvironment{events: make(chan string, 10)}
+			watcher := srv.NewSyncWatcher(sync, job.NewQueue(1), []string{"/compact"},
+				[]*srv.SyncWatchEvent{{Path: "compact"}}, map[string]extension.Environment{"compact": env})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go watcher.Run(ctx)
+
+			// the key is received as get or set depending on when the watch starts
+			Expect(sync.Update("/compact/a", `{"id": "a"}`)).To(Succeed())
+			Eventually(env.events, masterTTL*time.Second).Should(Receive(HaveSuffix(" /compact/a")))
+			Expect(sync.Update("/compact/b", `{"id": "b"}`)).To(Succeed())
+			Eventually(env.events).Should(Receive(Equal("set /compact/b")))
+
+			sync.compact <- struct{}{}
+			Expect(sync.Update("/compact/b", `{"id": "b", "name": "updated"}`)).To(Succeed())
+			Expect(sync.Update("/compact/c", `{"id": "c"}`)).To(Succeed())
+			Expect(sync.Delete("/compact/a", false)).To(Succeed())
+			_, deleteRevision, err := sync.Snapshot("/compact")
+			Expect(err).ToNot(HaveOccurred())
+			close(sync.resume)
+
+			Eventually(env.events).Should(Receive(Equal("set /compact/b")))
+			Eventually(env.events).Should(Receive(Equal("set /compact/c")))
+			Eventually(env.events).Should(Receive(Equal("delete /compact/a")))
+
+			// the snapshot revision includes the delete done after the last update
+			Eventually(func() (int64, error) {
+				node, err := sync.Fetch(srv.SyncWatchRevisionPrefix + "/compact")
+				if err != nil {
+					return 0, err
+				}
+				return strconv.ParseInt(node.Value, 10, 64)
+			}).Should(BeNumerically(">=", deleteRevision))
+
+			// the watch continues from the snapshot revision
+			Expect(sync.Update("/compact/d", `{"id": "d"}`)).To(Succeed())
+			Eventually(env.events).Should(Receive(Equal("set /compact/d")))
+			Consistently(env.events).ShouldNot(Receive())
+		})
+	})
+
+	Describe("Downtime", func() {
+		It("should synthesise deletes done while no watcher runs when the revision is compacted", func() {
+			sync, err := memory.NewSync("")
+			Expect(err).ToNot(HaveOccurred())
+			defer sync.Close()
+			env := &recordingEnvironment{events: make(chan string, 10)}
+			runWatcher := func(ctx context.Context) <-chan error {
+				watcher := srv.NewSyncWatcher(sync, job.NewQueue(1), []string{"/downtime"},
+					[]*srv.SyncWatchEvent{{Path: "downtime"}}, map[string]extension.Environment{"downtime": env})
+				done := make(chan error, 1)
+				go func() {
+					done <- watcher.Run(ctx)
+				}()
+				return done
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := runWatcher(ctx)
+			// the keys are received as get or set depending on when the watch starts
+			Expect(sync.Update("/downtime/a", `{"id": "a"}`)).To(Succeed())
+			Eventually(env.events, masterTTL*time.Second).Should(Receive(HaveSuffix(" /downtime/a")))
+			Expect(sync.Update("/downtime/b", `{"id": "b"}`)).To(Succeed())
+			Eventually(env.events).Should(Receive(HaveSuffix(" /downtime/b")))
+			Eventually(func() (int64, error) {
+				node, err := sync.Fetch(srv.SyncWatchRevisionPrefix + "/downtime")
+				if err != nil {
+					return 0, err
+				}
+				return strconv.ParseInt(node.Value, 10, 64)
+			}).Should(BeNumerically(">=", func() int64 {
+				node, err := sync.Fetch("/downtime/b")
+				Expect(err).ToNot(HaveOccurred())
+				return node.Revision
+			}()))
+			cancel()
+			<-done
+
+			Expect(sync.Delete("/downtime/a", false)).To(Succeed())
+			Expect(sync.Update("/downtime/c", `{"id": "c"}`)).To(Succeed())
+			_, revision, err := sync.Snapshot("/downtime")
+			Expect(err).ToNot(HaveOccurred())
+			sync.Compact(revision)
+
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			runWatcher(ctx)
+			Eventually(env.events, masterTTL*time.Second).Should(Receive(Equal("set /downtime/c")))
+			Eventually(env.events).Should(Receive(Equal("delete /downtime/a")))
+			Consistently(env.events).ShouldNot(Receive())
+		})
+	})
+
+	Describe("Dead letters", func() {
+		It("should list and replay dead letters", func() {
+			sync := server.GetSync()
+			deadLetter := `{"id": "1", "key": "/watch/key/1/resource", "action": "set", "data": {"id": "resource"}, "revision": 1, "error": "extension error", "attempts": 4}`
+			Expect(sync.Update(srv.SyncWatchDeadLetterPrefix+"/1", deadLetter)).To(Succeed())
+
+			deadLetters, err := srv.ListSyncDeadLetters(sync)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deadLetters).To(HaveLen(1))
+			Expect(deadLetters[0].Key).To(Equal("/watch/key/1/resource"))
+			Expect(deadLetters[0].Attempts).To(Equal(4))
+
+			Expect(srv.ReplaySyncDeadLetter(sync, "1")).To(Succeed())
+			deadLetters, err = srv.ListSyncDeadLetters(sync)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deadLetters).To(BeEmpty())
+
+			// the watcher handles the replayed event and removes it
+			Eventually(func() error {
+				_, err := sync.Fetch(srv.SyncWatchReplayPrefix + "/1")
+				return err
+			}, 5*masterTTL*time.Second).Should(HaveOccurred())
+		})
+
+		It("should fail to replay unknown dead letter", func() {
+			Expect(srv.ReplaySyncDeadLetter(server.GetSync(), "unknown")).ToNot(Succeed())
+		})
+	})
 })
@@ -19,6 +19,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/cloudwan/gohan/db"
@@ -35,6 +36,9 @@ const (
 
 	eventPollingTime  = 30 * time.Second
 	eventPollingLimit = 10000
+
+	eventSyncConcurrency = 16
+	eventDeleteBatchSize = 500
 )
 
 // SyncWriter copies data from the RDBMS to the sync layer.
@@ -112,18 +116,31 @@ func (writer *SyncWriter) Run(ctx context.Context) error {
 
 // Sync runs a synchronization iteration, which
 // executes requests in the event table.
+// Events are coalesced by their sync path, so only the final state of a path is
+// written to the sync backend. Paths are written in parallel and events of
+// successfully written paths are deleted afterwards in batches.
 func (writer *SyncWriter) Sync() (synced int, err error) {
 	resourceList, err := writer.listEvents()
 	if err != nil {
 		return
 	}
-	for _, resource := range resourceList {
-		err = writer.syncEvent(resource)
-		if err != nil {
-			return
+	writes := coalesceEvents(resourceList)
+	writer.writeAll(writes)
+
+	ids := []interface{}{}
+	for _, write := range writes {
+		if write.err != nil {
+			if err == nil {
+				err = write.err
+			}
+			continue
 		}
-		synced += 1
+		ids = append(ids, write.eventIDs...)
+	}
+	if deleteErr := writer.deleteEvents(ids); deleteErr != nil {
+		return 0, deleteErr
 	}
+	synced = len(ids)
 	return
 }
 
@@ -143,22 +160,71 @@ func (writer *SyncWriter) listEvents() ([]*schema.Resource, error) {
 	return resourceList, nil
 }
 
-func (writer *SyncWriter) syncEvent(resource *schema.Resource) error {
-	schemaManager := schema.GetManager()
-	eventSchema, _ := schemaManager.Schema("event")
-	tx, err := writer.db.Begin()
-	if err != nil {
-		return err
+// syncWrite is the final state of a sync path coalesced from events
+type syncWrite struct {
+	path string
+	// the last event of the path
+	event *schema.Resource
+	// delete events followed by other events of the path
+	deletes  []*schema.Resource
+	eventIDs []interface{}
+	err      error
+}
+
+// coalesceEvents groups events by their sync path keeping the order of first events of paths
+func coalesceEvents(resourceList []*schema.Resource) []*syncWrite {
+	writes := []*syncWrite{}
+	writesByPath := map[string]*syncWrite{}
+	for _, resource := range resourceList {
+		path := generatePath(resource.Get("path").(string), resource.Get("body").(string))
+		write, ok := writesByPath[path]
+		if !ok {
+			write = &syncWrite{path: path}
+			writesByPath[path] = write
+			writes = append(writes, write)
+		} else if write.event.Get("type") == "delete" {
+			write.deletes = append(write.deletes, write.event)
+		}
+		write.event = resource
+		write.eventIDs = append(write.eventIDs, resource.Get("id"))
 	}
-	defer tx.Close()
+	return writes
+}
+
+// writeAll writes paths to the sync backend using at most eventSyncConcurrency goroutines
+func (writer *SyncWriter) writeAll(writes []*syncWrite) {
+	queue := make(chan *syncWrite)
+	var wg sync.WaitGroup
+	for i := 0; i < eventSyncConcurrency && i < len(writes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for write := range queue {
+				write.err = writer.write(write)
+			}
+		}()
+	}
+	for _, write := range writes {
+		queue <- write
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (writer *SyncWriter) write(write *syncWrite) error {
+	for _, deleted := range write.deletes {
+		writer.deleteState(deleted)
+	}
+	return writer.syncEvent(write.path, write.event)
+}
+
+func (writer *SyncWriter) syncEvent(path string, resource *schema.Resource) error {
 	eventType := resource.Get("type").(string)
 	resourcePath := resource.Get("path").(string)
 	body := resource.Get("body").(string)
 	syncPlain := resource.Get("sync_plain").(bool)
 	syncProperty := resource.Get("sync_property").(string)
 
-	path := generatePath(resourcePath, body)
-
 	version, ok := resource.Get("version").(int)
 	if !ok {
 		log.Debug("cannot cast version value in int for %s", path)
@@ -172,7 +238,7 @@ func (writer *SyncWriter) syncEvent(resource *schema.Resource) error {
 
 		var data map[string]interface{}
 		if syncProperty != "" {
-			err = json.Unmarshal(([]byte)(body), &data)
+			err := json.Unmarshal(([]byte)(body), &data)
 			if err != nil {
 				return fmt.Errorf("failed to unmarshal body on sync: %s", err)
 			}
@@ -205,45 +271,76 @@ func (writer *SyncWriter) syncEvent(resource *schema.Resource) error {
 			content = string(data)
 		}
 
-		err = writer.sync.Update(path, content)
+		err := writer.sync.Update(path, content)
 		if err != nil {
 			return fmt.Errorf("Update() failed on sync: %s", err)
 		}
 	} else if eventType == "delete" {
-		log.Debug("delete %s", resourcePath)
-		deletePath := resourcePath
-		resourceSchema := schema.GetSchemaByURLPath(resourcePath)
-		if _, ok := resourceSchema.SyncKeyTemplate(); ok {
-			var data map[string]interface{}
-			json.Unmarshal(([]byte)(body), &data)
-			deletePath, err = resourceSchema.GenerateCustomPath(data)
-			if err != nil {
-				return fmt.Errorf("Delete from sync failed %s - generating of custom path failed", err)
-			}
-		}
-		log.Debug("deleting %s", statePrefix+deletePath)
-		err = writer.sync.Delete(statePrefix+deletePath, false)
-		if err != nil {
-			log.Error(fmt.Sprintf("Delete from sync failed %s", err))
-		}
-		log.Debug("deleting %s", monitoringPrefix+deletePath)
-		err = writer.sync.Delete(monitoringPrefix+deletePath, false)
-		if err != nil {
-			log.Error(fmt.Sprintf("Delete from sync failed %s", err))
+		if err := writer.deleteState(resource); err != nil {
+			return err
 		}
 		log.Debug("deleting %s", resourcePath)
-		err = writer.sync.Delete(path, false)
+		err := writer.sync.Delete(path, false)
 		if err != nil {
 			return fmt.Errorf("delete from sync failed %s", err)
 		}
 	}
-	log.Debug("delete event %d", resource.Get("id"))
-	id := resource.Get("id")
-	err = tx.Delete(eventSchema, id)
+	return nil
+}
+
+// deleteState removes state and monitoring of a deleted resource from the sync backend
+func (writer *SyncWriter) deleteState(resource *schema.Resource) error {
+	resourcePath := resource.Get("path").(string)
+	body := resource.Get("body").(string)
+	log.Debug("delete %s", resourcePath)
+	deletePath := resourcePath
+	resourceSchema := schema.GetSchemaByURLPath(resourcePath)
+	if _, ok := resourceSchema.SyncKeyTemplate(); ok {
+		var data map[string]interface{}
+		json.Unmarshal(([]byte)(body), &data)
+		var err error
+		deletePath, err = resourceSchema.GenerateCustomPath(data)
+		if err != nil {
+			return fmt.Errorf("Delete from sync failed %s - generating of custom path failed", err)
+		}
+	}
+	log.Debug("deleting %s", statePrefix+deletePath)
+	err := writer.sync.Delete(statePrefix+deletePath, false)
 	if err != nil {
-		return fmt.Errorf("delete failed: %s", err)
+		log.Error(fmt.Sprintf("Delete from sync failed %s", err))
 	}
+	log.Debug("deleting %s", monitoringPrefix+deletePath)
+	err = writer.sync.Delete(monitoringPrefix+deletePath, false)
+	if err != nil {
+		log.Error(fmt.Sprintf("Delete from sync failed %s", err))
+	}
+	return nil
+}
 
+// deleteEvents deletes synced events from the event table in a single transaction,
+// using one batch delete per eventDeleteBatchSize events
+func (writer *SyncWriter) deleteEvents(ids []interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	schemaManager := schema.GetManager()
+	eventSchema, _ := schemaManager.Schema("event")
+	tx, err := writer.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > eventDeleteBatchSize {
+			batch = ids[:eventDeleteBatchSize]
+		}
+		ids = ids[len(batch):]
+		log.Debug("delete events %v", batch)
+		if err := tx.BatchDelete(eventSchema, batch); err != nil {
+			return fmt.Errorf("delete failed: %s", err)
+		}
+	}
 	err = tx.Commit()
 	if err != nil {
 		log.Error(fmt.Sprintf("commit failed: %s", err))
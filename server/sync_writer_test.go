@@ -17,14 +17,14 @@ package server_test
 
 import (
 	"encoding/json"
-	"time"
+	"os"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/schema"
 	srv "github.com/cloudwan/gohan/server"
-	gohan_etcd "github.com/cloudwan/gohan/sync/etcdv3"
 	"github.com/cloudwan/gohan/util"
 )
 
@@ -46,8 +46,7 @@ var _ = Describe("Server package test", func() {
 			writer := srv.NewSyncWriterFromServer(server)
 			Expect(writer.Sync()).To(Equal(1))
 
-			sync, err := gohan_etcd.NewSync([]string{"http://127.0.0.1:2379"}, time.Second)
-			Expect(err).ToNot(HaveOccurred())
+			sync := server.GetSync()
 
 			writtenConfig, err := sync.Fetch("/config" + networkResource.Path())
 			Expect(err).ToNot(HaveOccurred())
@@ -75,6 +74,52 @@ var _ = Describe("Server package test", func() {
 			Expect(err).To(HaveOccurred(), "Failed to sync db resource deletion to sync backend")
 		})
 
+		Context("With multiple events of the same resource", func() {
+			It("should write only the final state", func() {
+				manager := schema.GetManager()
+				networkSchema, _ := manager.Schema("network")
+				red, err := manager.LoadResource("network", getNetwork("Red", "red"))
+				Expect(err).ToNot(HaveOccurred())
+				blue, err := manager.LoadResource("network", getNetwork("Blue", "red"))
+				Expect(err).ToNot(HaveOccurred())
+				testDB1 := &srv.DbSyncWrapper{DB: testDB}
+				tx, err := testDB1.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tx.Create(red)).To(Succeed())
+				Expect(tx.Create(blue)).To(Succeed())
+				Expect(red.Update(map[string]interface{}{"name": "Red2"})).To(Succeed())
+				Expect(tx.Update(red)).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+				tx.Close()
+
+				writer := srv.NewSyncWriterFromServer(server)
+				Expect(writer.Sync()).To(Equal(3))
+				Expect(writer.Sync()).To(Equal(0))
+
+				sync := server.GetSync()
+				writtenConfig, err := sync.Fetch("/config" + red.Path())
+				Expect(err).ToNot(HaveOccurred())
+				var configContents map[string]interface{}
+				Expect(json.Unmarshal([]byte(writtenConfig.Value), &configContents)).To(Succeed())
+				Expect(configContents["body"]).To(ContainSubstring("Red2"))
+				_, err = sync.Fetch("/config" + blue.Path())
+				Expect(err).ToNot(HaveOccurred())
+
+				tx, err = testDB1.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tx.Delete(networkSchema, red.ID())).To(Succeed())
+				Expect(tx.Delete(networkSchema, blue.ID())).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+				tx.Close()
+
+				Expect(writer.Sync()).To(Equal(2))
+				_, err = sync.Fetch("/config" + red.Path())
+				Expect(err).To(HaveOccurred())
+				_, err = sync.Fetch("/config" + blue.Path())
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
 		Context("With sync_property", func() {
 			It("should write only speficied property", func() {
 				manager := schema.GetManager()
@@ -94,8 +139,7 @@ var _ = Describe("Server package test", func() {
 				writer := srv.NewSyncWriterFromServer(server)
 				Expect(writer.Sync()).To(Equal(1))
 
-				sync, err := gohan_etcd.NewSync([]string{"http://127.0.0.1:2379"}, time.Second)
-				Expect(err).ToNot(HaveOccurred())
+				sync := server.GetSync()
 
 				writtenConfig, err := sync.Fetch("/config" + resource.Path())
 				Expect(err).ToNot(HaveOccurred())
@@ -143,8 +187,7 @@ var _ = Describe("Server package test", func() {
 				writer := srv.NewSyncWriterFromServer(server)
 				Expect(writer.Sync()).To(Equal(1))
 
-				sync, err := gohan_etcd.NewSync([]string{"http://127.0.0.1:2379"}, time.Second)
-				Expect(err).ToNot(HaveOccurred())
+				sync := server.GetSync()
 
 				writtenConfig, err := sync.Fetch("/config" + resource.Path())
 				Expect(err).ToNot(HaveOccurred())
@@ -186,8 +229,7 @@ var _ = Describe("Server package test", func() {
 				writer := srv.NewSyncWriterFromServer(server)
 				Expect(writer.Sync()).To(Equal(1))
 
-				sync, err := gohan_etcd.NewSync([]string{"http://127.0.0.1:2379"}, time.Second)
-				Expect(err).ToNot(HaveOccurred())
+				sync := server.GetSync()
 
 				writtenConfig, err := sync.Fetch("/config" + resource.Path())
 				Expect(err).ToNot(HaveOccurred())
@@ -205,5 +247,32 @@ var _ = Describe("Server package test", func() {
 				Expect(err).To(HaveOccurred(), "Failed to sync db resource deletion to sync backend")
 			})
 		})
+
+		Context("With file database", func() {
+			It("should delete synced events", func() {
+				fileDB, err := db.ConnectDB("yaml", "./test_sync_writer.yaml", db.DefaultMaxOpenConn)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove("./test_sync_writer.yaml")
+
+				manager := schema.GetManager()
+				networkResource, err := manager.LoadResource("network", getNetwork("Red", "red"))
+				Expect(err).ToNot(HaveOccurred())
+				fileDB1 := &srv.DbSyncWrapper{DB: fileDB}
+				tx, err := fileDB1.Begin()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tx.Create(networkResource)).To(Succeed())
+				Expect(tx.Commit()).To(Succeed())
+				tx.Close()
+
+				writer := srv.NewSyncWriter(server.GetSync(), fileDB)
+				Expect(writer.Sync()).To(Equal(1))
+				_, err = server.GetSync().Fetch("/config" + networkResource.Path())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(server.GetSync().Delete("/config"+networkResource.Path(), false)).To(Succeed())
+
+				// synced events are deleted
+				Expect(writer.Sync()).To(Equal(0))
+			})
+		})
 	})
 })
@@ -171,6 +171,18 @@ func (tl *transactionEventLogger) Delete(s *schema.Schema, resourceID interface{
 	return tl.logEvent("delete", resource, configVersion)
 }
 
+func (tl *transactionEventLogger) Restore(s *schema.Schema, resourceID interface{}) error {
+	err := tl.Transaction.Restore(s, resourceID)
+	if err != nil {
+		return err
+	}
+	resource, err := tl.Fetch(s, transaction.IDFilter(resourceID))
+	if err != nil {
+		return err
+	}
+	return tl.Resync(resource)
+}
+
 func (tl *transactionEventLogger) Commit() error {
 	err := tl.Transaction.Commit()
 	if err != nil {
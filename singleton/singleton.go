@@ -33,8 +33,9 @@ const (
 )
 
 var (
-	c  cache
-	mu sync.Mutex
+	c     cache
+	scope Scope
+	mu    sync.Mutex
 )
 
 func init() {
@@ -43,6 +44,7 @@ func init() {
 
 // SetScope changes singletons scope, see scopes documentation.
 func SetScope(s Scope) {
+	scope = s
 	switch s {
 	case ScopeSingleton:
 		c = make(mapCache)
@@ -51,6 +53,11 @@ func SetScope(s Scope) {
 	}
 }
 
+// GetScope returns current singletons scope.
+func GetScope() Scope {
+	return scope
+}
+
 // Get returns singleton for a given key, value does not exist if will be
 // created by factory.
 func Get(key string, factory func() interface{}) interface{} {
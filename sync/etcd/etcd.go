@@ -20,6 +20,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/cloudwan/gohan/sync"
@@ -33,6 +35,13 @@ const (
 	masterTTL   = 10
 )
 
+//etcd v2 error codes
+const (
+	errorCodeKeyNotFound = 100
+	errorCodeTestFailed  = 101
+	errorCodeNodeExist   = 105
+)
+
 //Sync is struct for etcd based sync
 type Sync struct {
 	locks      cmap.ConcurrentMap
@@ -112,6 +121,95 @@ func (s *Sync) recursiveFetch(node *etcd.Node) (*sync.Node, error) {
 	return n, nil
 }
 
+//FetchKey fetches the key without its children
+func (s *Sync) FetchKey(key string) (*sync.Node, error) {
+	resp, err := s.etcdClient.Get(key, false, false)
+	if err != nil {
+		if isErrorCode(err, errorCodeKeyNotFound) {
+			return nil, sync.ErrNotFound
+		}
+		return nil, err
+	}
+	return &sync.Node{
+		Key:      resp.Node.Key,
+		Value:    resp.Node.Value,
+		Revision: int64(resp.Node.ModifiedIndex),
+	}, nil
+}
+
+//FetchPrefix fetches keys starting with the prefix.
+//Etcd v2 lists directories only, so keys of the directory containing the prefix are filtered.
+func (s *Sync) FetchPrefix(prefix string) ([]*sync.Node, error) {
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	nodes := []*sync.Node{}
+	resp, err := s.etcdClient.Get(dir, true, true)
+	if err != nil {
+		if isErrorCode(err, errorCodeKeyNotFound) {
+			return nodes, nil
+		}
+		return nil, err
+	}
+	var collect func(node *etcd.Node)
+	collect = func(node *etcd.Node) {
+		if !node.Dir && strings.HasPrefix(node.Key, prefix) {
+			nodes = append(nodes, &sync.Node{
+				Key:      node.Key,
+				Value:    node.Value,
+				Revision: int64(node.ModifiedIndex),
+			})
+		}
+		for _, child := range node.Nodes {
+			collect(child)
+		}
+	}
+	collect(resp.Node)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Key < nodes[j].Key
+	})
+	return nodes, nil
+}
+
+//CompareAndSwap puts the value when the key is at the given revision, revision 0 means the key must not exist.
+//Etcd v2 can't keep expiration of the key, so negative ttl sets the remaining ttl of the current key
+func (s *Sync) CompareAndSwap(key, value string, revision int64, ttl time.Duration) (bool, error) {
+	var ttlSeconds uint64
+	if ttl > 0 {
+		ttlSeconds = uint64((ttl + time.Second - 1) / time.Second)
+	}
+	if revision == 0 {
+		_, err := s.etcdClient.Create(key, value, ttlSeconds)
+		if isErrorCode(err, errorCodeNodeExist) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if ttl < 0 {
+		resp, err := s.etcdClient.Get(key, false, false)
+		if isErrorCode(err, errorCodeKeyNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if int64(resp.Node.ModifiedIndex) != revision {
+			return false, nil
+		}
+		if resp.Node.TTL > 0 {
+			ttlSeconds = uint64(resp.Node.TTL)
+		}
+	}
+	_, err := s.etcdClient.CompareAndSwap(key, value, ttlSeconds, "", uint64(revision))
+	if isErrorCode(err, errorCodeTestFailed) || isErrorCode(err, errorCodeKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func isErrorCode(err error, code int) bool {
+	etcdError, ok := err.(*etcd.EtcdError)
+	return ok && etcdError.ErrorCode == code
+}
+
 //HasLock checks current process owns lock or not
 func (s *Sync) HasLock(path string) bool {
 	value, ok := s.locks.Get(path)
@@ -193,7 +291,7 @@ func (s *Sync) Watch(path string, responseChan chan *sync.Event, stopChan chan b
 	if err != nil {
 		if etcdError, ok := err.(*etcd.EtcdError); ok {
 			switch etcdError.ErrorCode {
-			case 100:
+			case errorCodeKeyNotFound:
 				response, err = s.etcdClient.CreateDir(path, 0)
 				if err != nil {
 					log.Error(fmt.Sprintf("failed to create dir: %s", err))
@@ -28,6 +28,7 @@ import (
 	"github.com/cloudwan/gohan/sync"
 	etcd "github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	pb "github.com/coreos/etcd/mvcc/mvccpb"
 	cmap "github.com/streamrail/concurrent-map"
 	"github.com/twinj/uuid"
@@ -107,21 +108,61 @@ func (s *Sync) Delete(key string, prefix bool) error {
 
 //Fetch data from sync
 func (s *Sync) Fetch(key string) (*sync.Node, error) {
-	node, err := s.etcdClient.Get(s.withTimeout(), key, etcd.WithSort(etcd.SortByKey, etcd.SortAscend))
+	node, _, err := s.Snapshot(key)
+	return node, err
+}
+
+//Snapshot fetches data from sync with one request and returns the etcd revision it is read at
+func (s *Sync) Snapshot(key string) (*sync.Node, int64, error) {
+	dir, err := s.etcdClient.Get(s.withTimeout(), key, etcd.WithPrefix(), etcd.WithSort(etcd.SortByKey, etcd.SortAscend))
+	if err != nil {
+		return nil, 0, err
+	}
+	node, children := []*pb.KeyValue{}, dir.Kvs
+	// the key itself goes first if it exists
+	if len(children) > 0 && string(children[0].Key) == key {
+		node, children = children[:1], children[1:]
+	}
+	root, err := s.recursiveFetch(key, node, children)
+	return root, dir.Header.Revision, err
+}
+
+//FetchKey fetches the key without its children
+func (s *Sync) FetchKey(key string) (*sync.Node, error) {
+	resp, err := s.etcdClient.Get(s.withTimeout(), key)
 	if err != nil {
 		return nil, err
 	}
-	dir, err := s.etcdClient.Get(s.withTimeout(), key, etcd.WithPrefix(), etcd.WithSort(etcd.SortByKey, etcd.SortAscend))
+	if len(resp.Kvs) == 0 {
+		return nil, sync.ErrNotFound
+	}
+	return nodeFromKeyValue(resp.Kvs[0]), nil
+}
+
+//FetchPrefix fetches keys starting with the prefix
+func (s *Sync) FetchPrefix(prefix string) ([]*sync.Node, error) {
+	resp, err := s.etcdClient.Get(s.withTimeout(), prefix, etcd.WithPrefix(), etcd.WithSort(etcd.SortByKey, etcd.SortAscend))
 	if err != nil {
 		return nil, err
 	}
+	nodes := make([]*sync.Node, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		nodes = append(nodes, nodeFromKeyValue(kv))
+	}
+	return nodes, nil
+}
 
-	return s.recursiveFetch(key, node.Kvs, dir.Kvs)
+func nodeFromKeyValue(kv *pb.KeyValue) *sync.Node {
+	return &sync.Node{
+		Key:      string(kv.Key),
+		Value:    string(kv.Value),
+		Revision: kv.ModRevision,
+	}
 }
 
 func (s *Sync) recursiveFetch(rootKey string, node []*pb.KeyValue, children []*pb.KeyValue) (*sync.Node, error) {
 	if len(node) == 0 && len(children) == 0 {
-		return nil, errors.New("Not found")
+		return nil, sync.ErrNotFound
 	}
 
 	subMap := make(map[string]*sync.Node, len(children))
@@ -244,6 +285,32 @@ func (s *Sync) Unlock(path string) error {
 	return nil
 }
 
+//CompareAndSwap puts the value when the key is at the given revision
+func (s *Sync) CompareAndSwap(key, value string, revision int64, ttl time.Duration) (bool, error) {
+	opts := []etcd.OpOption{}
+	leaseID := etcd.NoLease
+	if ttl > 0 {
+		lease, err := s.etcdClient.Grant(s.withTimeout(), int64((ttl+time.Second-1)/time.Second))
+		if err != nil {
+			return false, err
+		}
+		leaseID = lease.ID
+		opts = append(opts, etcd.WithLease(leaseID))
+	} else if ttl < 0 && revision != 0 {
+		opts = append(opts, etcd.WithIgnoreLease())
+	}
+	cmp := etcd.Compare(etcd.ModRevision(key), "=", revision)
+	put := etcd.OpPut(key, value, opts...)
+	resp, err := s.etcdClient.Txn(s.withTimeout()).If(cmp).Then(put).Commit()
+	if leaseID != etcd.NoLease && (err != nil || !resp.Succeeded) {
+		s.etcdClient.Revoke(s.withTimeout(), leaseID)
+	}
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
 func eventsFromNode(action string, kvs []*pb.KeyValue, responseChan chan *sync.Event) {
 	for _, kv := range kvs {
 		event := &sync.Event{
@@ -261,18 +328,20 @@ func eventsFromNode(action string, kvs []*pb.KeyValue, responseChan chan *sync.E
 	}
 }
 
-//Watch keep watch update under the path
+//Watch keep watch update under the path.
+//Current keys are sent as get events unless the revision is given, then changes after the revision are sent,
+//including deletes, or ErrCompacted when the revision is no longer available
 func (s *Sync) Watch(path string, responseChan chan *sync.Event, stopChan chan bool, revision int64) error {
-	options := []etcd.OpOption{etcd.WithPrefix(), etcd.WithSort(etcd.SortByModRevision, etcd.SortAscend)}
-	if revision != sync.RevisionCurrent {
-		options = append(options, etcd.WithMinModRev(revision+1))
-	}
-	node, err := s.etcdClient.Get(s.withTimeout(), path, options...)
-	if err != nil {
-		return err
+	if revision == sync.RevisionCurrent {
+		node, err := s.etcdClient.Get(s.withTimeout(), path,
+			etcd.WithPrefix(), etcd.WithSort(etcd.SortByModRevision, etcd.SortAscend))
+		if err != nil {
+			return err
+		}
+		eventsFromNode("get", node.Kvs, responseChan)
+		revision = node.Header.Revision
 	}
-	eventsFromNode("get", node.Kvs, responseChan)
-	revision = node.Header.Revision + 1
+	revision++
 
 	ctx, cancel := context.WithCancel(context.Background())
 	errors := make(chan error, 1)
@@ -285,6 +354,9 @@ func (s *Sync) Watch(path string, responseChan chan *sync.Event, stopChan chan b
 
 			for wresp := range rch {
 				err := wresp.Err()
+				if err == rpctypes.ErrCompacted {
+					return sync.ErrCompacted
+				}
 				if err != nil {
 					return err
 				}
@@ -75,6 +75,67 @@ func TestEmptyUpdate(t *testing.T) {
 	}
 }
 
+func TestCompareAndSwap(t *testing.T) {
+	sync := newSync(t)
+	sync.etcdClient.Delete(context.Background(), "/", etcd.WithPrefix())
+
+	path := "/path/to/swap"
+	if ok, err := sync.CompareAndSwap(path, "1", 1, 0); ok || err != nil {
+		t.Errorf("unexpected swap of missing key: %t, %s", ok, err)
+	}
+	if ok, err := sync.CompareAndSwap(path, "1", 0, 0); !ok || err != nil {
+		t.Fatalf("unexpected failure: %t, %s", ok, err)
+	}
+	node, err := sync.Fetch(path)
+	if err != nil || node.Value != "1" {
+		t.Fatalf("unexpected node: %+v, %s", node, err)
+	}
+	if ok, _ := sync.CompareAndSwap(path, "2", 0, 0); ok {
+		t.Errorf("unexpected swap of existing key")
+	}
+	if ok, _ := sync.CompareAndSwap(path, "2", node.Revision, time.Second); !ok {
+		t.Errorf("unexpected failure")
+	}
+	if ok, _ := sync.CompareAndSwap(path, "3", node.Revision, 0); ok {
+		t.Errorf("unexpected swap of outdated revision")
+	}
+
+	node, _ = sync.Fetch(path)
+	if ok, _ := sync.CompareAndSwap(path, "3", node.Revision, -1); !ok {
+		t.Errorf("unexpected failure")
+	}
+	time.Sleep(3 * time.Second)
+	if _, err := sync.Fetch(path); err == nil {
+		t.Errorf("ttl not kept by swap")
+	}
+}
+
+func TestFetchKeyAndPrefix(t *testing.T) {
+	sync := newSync(t)
+	sync.etcdClient.Delete(context.Background(), "/", etcd.WithPrefix())
+
+	for _, path := range []string{"/kv/a", "/kv/a/b", "/kv/ab", "/other"} {
+		sync.Update(path, path)
+	}
+	node, err := sync.FetchKey("/kv/a")
+	if err != nil || node.Value != "/kv/a" || len(node.Children) != 0 {
+		t.Errorf("unexpected node: %+v, %v", node, err)
+	}
+	if _, err := sync.FetchKey("/kv"); err != gohan_sync.ErrNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	nodes, err := sync.FetchPrefix("/kv/a")
+	if err != nil || len(nodes) != 3 {
+		t.Fatalf("unexpected nodes: %+v, %v", nodes, err)
+	}
+	for i, key := range []string{"/kv/a", "/kv/a/b", "/kv/ab"} {
+		if nodes[i].Key != key || nodes[i].Value != key {
+			t.Errorf("unexpected node %d: %+v", i, nodes[i])
+		}
+	}
+}
+
 func TestRecursiveUpdate(t *testing.T) {
 	sync := newSync(t)
 	sync.etcdClient.Delete(context.Background(), "/", etcd.WithPrefix())
@@ -240,6 +301,35 @@ func TestWatch(t *testing.T) {
 	}
 }
 
+func TestWatchFromCompactedRevision(t *testing.T) {
+	sync := newSync(t)
+	sync.etcdClient.Delete(context.Background(), "/", etcd.WithPrefix())
+
+	path := "/path/to/watch"
+	first, _ := sync.etcdClient.Put(context.Background(), path+"/first", `{"id": "first"}`)
+	second, _ := sync.etcdClient.Put(context.Background(), path+"/second", `{"id": "second"}`)
+	sync.etcdClient.Delete(context.Background(), path+"/first")
+	sync.etcdClient.Compact(context.Background(), second.Header.Revision)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := sync.WatchContext(ctx, path, first.Header.Revision-1)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	if resp := <-events; resp.Err != gohan_sync.ErrCompacted {
+		t.Errorf("expected compacted error, got: %+v", resp)
+	}
+
+	events, err = sync.WatchContext(ctx, path, second.Header.Revision)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	if resp := <-events; resp.Action != "delete" || resp.Key != path+"/first" {
+		t.Errorf("mismatch response: %+v", resp)
+	}
+}
+
 func newSync(t *testing.T) *Sync {
 	sync, err := NewSync(endpoints, time.Millisecond*100)
 	if err != nil {
@@ -0,0 +1,611 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	syn "sync"
+	"time"
+
+	"github.com/cloudwan/gohan/sync"
+	"github.com/twinj/uuid"
+)
+
+const (
+	masterTTL         = 10
+	lockRetryInterval = time.Second
+	//historyLimit is the number of changes kept for watches from past revisions, older ones are compacted
+	historyLimit = 1000
+)
+
+var errClosed = errors.New("sync is closed")
+
+type entry struct {
+	value    string
+	revision int64
+	lease    *lease
+}
+
+//lease keeps a lock key alive until the lock is released or the ttl passes without keepalive
+type lease struct {
+	path      string
+	expiresAt time.Time
+	lost      chan struct{}
+	ended     bool
+}
+
+//change is a change of a key kept in the history for watches from past revisions
+type change struct {
+	action   string
+	key      string
+	value    string
+	revision int64
+}
+
+func (c *change) event() *sync.Event {
+	if c.action == "delete" {
+		return &sync.Event{Action: c.action, Key: c.key, Revision: c.revision}
+	}
+	return newEvent(c.action, c.key, c.value, c.revision)
+}
+
+type watcher struct {
+	prefix string
+	mu     syn.Mutex
+	events []*sync.Event
+	notify chan struct{}
+}
+
+func (w *watcher) push(events ...*sync.Event) {
+	w.mu.Lock()
+	w.events = append(w.events, events...)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) take() []*sync.Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	events := w.events
+	w.events = nil
+	return events
+}
+
+//Sync is an in-memory sync backend for single node deployments and tests.
+//Keys are optionally persisted to a file, lock keys and keys with ttl are never persisted.
+type Sync struct {
+	mu        syn.Mutex
+	revision  int64
+	entries   map[string]*entry
+	history   []*change
+	compacted int64
+	watchers  map[*watcher]struct{}
+	locks     map[string]*lease
+	ttl       time.Duration
+	file      string
+	processID string
+	closed    chan struct{}
+	closeOnce syn.Once
+}
+
+type persistedEntry struct {
+	Value    string `json:"value"`
+	Revision int64  `json:"revision"`
+}
+
+type persistedState struct {
+	Revision int64                     `json:"revision"`
+	Entries  map[string]persistedEntry `json:"entries"`
+}
+
+//NewSync creates in-memory sync, keys are persisted to the file unless it is empty
+func NewSync(file string) (*Sync, error) {
+	s := &Sync{
+		entries:  map[string]*entry{},
+		watchers: map[*watcher]struct{}{},
+		locks:    map[string]*lease{},
+		ttl:      masterTTL * time.Second,
+		file:     file,
+		closed:   make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	s.processID = hostname + uuid.NewV4().String()
+	go s.expireLeases()
+	return s, nil
+}
+
+func (s *Sync) load() error {
+	if s.file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := persistedState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to load sync file %s: %s", s.file, err)
+	}
+	s.revision = state.Revision
+	// history isn't persisted
+	s.compacted = state.Revision
+	for key, persisted := range state.Entries {
+		s.entries[key] = &entry{value: persisted.Value, revision: persisted.Revision}
+	}
+	return nil
+}
+
+func (s *Sync) persist() {
+	if s.file == "" {
+		return
+	}
+	state := persistedState{Revision: s.revision, Entries: map[string]persistedEntry{}}
+	for key, e := range s.entries {
+		if e.lease == nil {
+			state.Entries[key] = persistedEntry{Value: e.value, Revision: e.revision}
+		}
+	}
+	data, err := json.Marshal(state)
+	if err == nil {
+		tmpFile := s.file + ".tmp"
+		if err = ioutil.WriteFile(tmpFile, data, 0600); err == nil {
+			err = os.Rename(tmpFile, s.file)
+		}
+	}
+	if err != nil {
+		log.Error("failed to persist sync to %s: %s", s.file, err)
+	}
+}
+
+//GetProcessID returns processID
+func (s *Sync) GetProcessID() string {
+	return s.processID
+}
+
+//Update sync update sync
+//When jsonString is empty, this method do nothing like etcd v3 backend does.
+func (s *Sync) Update(key, jsonString string) error {
+	if jsonString == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key, jsonString, nil)
+	return nil
+}
+
+//CompareAndSwap puts the value when the key is at the given revision
+func (s *Sync) CompareAndSwap(key, value string, revision int64, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.entries[key]
+	current := int64(0)
+	if ok {
+		current = old.revision
+	}
+	if current != revision {
+		return false, nil
+	}
+	var l *lease
+	if ttl > 0 {
+		l = &lease{path: key, expiresAt: time.Now().Add(ttl), lost: make(chan struct{})}
+	} else if ttl < 0 && ok {
+		l = old.lease
+	}
+	s.put(key, value, l)
+	return true, nil
+}
+
+//Delete sync update sync
+func (s *Sync) Delete(key string, prefix bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for k := range s.entries {
+		if k == key || prefix && strings.HasPrefix(k, key) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	s.remove(keys)
+	return nil
+}
+
+//Fetch data from sync
+func (s *Sync) Fetch(key string) (*sync.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetch(key)
+}
+
+//Snapshot fetches data from sync and returns the revision it is read at
+func (s *Sync) Snapshot(key string) (*sync.Node, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node, err := s.fetch(key)
+	return node, s.revision, err
+}
+
+//FetchKey fetches the key without its children
+func (s *Sync) FetchKey(key string) (*sync.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, sync.ErrNotFound
+	}
+	return &sync.Node{Key: key, Value: e.value, Revision: e.revision}, nil
+}
+
+//FetchPrefix fetches keys starting with the prefix
+func (s *Sync) FetchPrefix(prefix string) ([]*sync.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for k := range s.entries {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	nodes := make([]*sync.Node, 0, len(keys))
+	for _, k := range keys {
+		e := s.entries[k]
+		nodes = append(nodes, &sync.Node{Key: k, Value: e.value, Revision: e.revision})
+	}
+	return nodes, nil
+}
+
+func (s *Sync) fetch(key string) (*sync.Node, error) {
+	root := &sync.Node{Key: key}
+	found := false
+	if e, ok := s.entries[key]; ok {
+		root.Value = e.value
+		root.Revision = e.revision
+		found = true
+	}
+
+	keys := []string{}
+	for k := range s.entries {
+		if k != key && strings.HasPrefix(k, key) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	dirs := map[string]*sync.Node{"": root}
+	for _, k := range keys {
+		path := strings.TrimPrefix(strings.TrimPrefix(k, key), "/")
+		if path == "" || !strings.HasSuffix(key, "/") && !strings.HasPrefix(k, key+"/") {
+			continue
+		}
+		found = true
+		steps := strings.Split(path, "/")
+		parent := root
+		for i := 1; i < len(steps); i++ {
+			dirPath := strings.Join(steps[:i], "/")
+			dir, ok := dirs[dirPath]
+			if !ok {
+				dir = &sync.Node{Key: strings.TrimSuffix(key, "/") + "/" + dirPath}
+				dirs[dirPath] = dir
+				parent.Children = append(parent.Children, dir)
+			}
+			parent = dir
+		}
+		e := s.entries[k]
+		node := &sync.Node{Key: k, Value: e.value, Revision: e.revision}
+		dirs[path] = node
+		parent.Children = append(parent.Children, node)
+	}
+	if !found {
+		return nil, sync.ErrNotFound
+	}
+	return root, nil
+}
+
+//HasLock checks current process owns lock or not
+func (s *Sync) HasLock(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.locks[path]
+	return ok
+}
+
+//Lock locks resources on sync
+//The returned channel is closed when the lock is released or lost,
+//the lock is lost when its key is modified by someone else or expires.
+func (s *Sync) Lock(path string, block bool) (chan struct{}, error) {
+	for {
+		s.mu.Lock()
+		if _, ok := s.entries[path]; !ok {
+			l := &lease{path: path, expiresAt: time.Now().Add(s.ttl), lost: make(chan struct{})}
+			s.locks[path] = l
+			s.put(path, s.processID, l)
+			s.mu.Unlock()
+			log.Info("Locked %s", path)
+			go s.keepAlive(l)
+			return l.lost, nil
+		}
+		s.mu.Unlock()
+
+		msg := fmt.Sprintf("failed to lock path %s", path)
+		log.Notice(msg)
+		if !block {
+			return nil, errors.New(msg)
+		}
+		select {
+		case <-time.After(lockRetryInterval):
+		case <-s.closed:
+			return nil, errClosed
+		}
+	}
+}
+
+func (s *Sync) keepAlive(l *lease) {
+	for {
+		select {
+		case <-l.lost:
+			return
+		case <-s.closed:
+			return
+		case <-time.After(s.ttl / 2):
+		}
+		s.mu.Lock()
+		if !l.ended {
+			l.expiresAt = time.Now().Add(s.ttl)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Sync) expireLeases() {
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-time.After(time.Second):
+		}
+		s.mu.Lock()
+		now := time.Now()
+		expired := []string{}
+		for k, e := range s.entries {
+			if e.lease != nil && now.After(e.lease.expiresAt) {
+				if s.locks[k] == e.lease {
+					log.Notice("lock for %s expired", k)
+				}
+				expired = append(expired, k)
+			}
+		}
+		sort.Strings(expired)
+		s.remove(expired)
+		s.mu.Unlock()
+	}
+}
+
+//Unlock path
+func (s *Sync) Unlock(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.locks[path]
+	if !ok {
+		return nil
+	}
+	s.endLease(l)
+	if e, ok := s.entries[path]; ok && e.lease == l {
+		s.remove([]string{path})
+	}
+	log.Info("Unlocked path %s", path)
+	return nil
+}
+
+//Watch keep watch update under the path
+func (s *Sync) Watch(path string, responseChan chan *sync.Event, stopChan chan bool, revision int64) error {
+	w := &watcher{prefix: path, notify: make(chan struct{}, 1)}
+
+	s.mu.Lock()
+	if revision == sync.RevisionCurrent {
+		keys := []string{}
+		for k := range s.entries {
+			if strings.HasPrefix(k, path) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return s.entries[keys[i]].revision < s.entries[keys[j]].revision
+		})
+		for _, k := range keys {
+			e := s.entries[k]
+			w.push(newEvent("get", k, e.value, e.revision))
+		}
+	} else {
+		if revision < s.compacted {
+			s.mu.Unlock()
+			return sync.ErrCompacted
+		}
+		for _, c := range s.history {
+			if c.revision > revision && strings.HasPrefix(c.key, path) {
+				w.push(c.event())
+			}
+		}
+	}
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers, w)
+		s.mu.Unlock()
+	}()
+
+	for {
+		for _, event := range w.take() {
+			select {
+			case responseChan <- event:
+			case <-stopChan:
+				return nil
+			case <-s.closed:
+				return errClosed
+			}
+		}
+		select {
+		case <-w.notify:
+		case <-stopChan:
+			return nil
+		case <-s.closed:
+			return errClosed
+		}
+	}
+}
+
+//WatchContext keep watch update under the path until context is canceled
+func (s *Sync) WatchContext(ctx context.Context, path string, revision int64) (<-chan *sync.Event, error) {
+	stopChan := make(chan bool)
+	go func() {
+		<-ctx.Done()
+		close(stopChan)
+	}()
+
+	responseChan := make(chan *sync.Event)
+
+	go func() {
+		defer close(responseChan)
+		err := s.Watch(path, responseChan, stopChan, revision)
+		if err != nil {
+			responseChan <- &sync.Event{
+				Err: err,
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+//Close releases locks of this process and stops watches
+func (s *Sync) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		keys := []string{}
+		for path, l := range s.locks {
+			s.endLease(l)
+			keys = append(keys, path)
+		}
+		sort.Strings(keys)
+		s.remove(keys)
+		s.mu.Unlock()
+		close(s.closed)
+	})
+}
+
+//put sets the key, s.mu must be held
+func (s *Sync) put(key, value string, l *lease) {
+	s.revision++
+	if old, ok := s.entries[key]; ok && old.lease != nil && old.lease != l {
+		s.endLease(old.lease)
+	}
+	s.entries[key] = &entry{value: value, revision: s.revision, lease: l}
+	s.notify(&change{action: "set", key: key, value: value, revision: s.revision})
+	s.persist()
+}
+
+//remove deletes keys in a single revision, s.mu must be held
+func (s *Sync) remove(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	s.revision++
+	for _, key := range keys {
+		if old, ok := s.entries[key]; ok && old.lease != nil {
+			s.endLease(old.lease)
+		}
+		delete(s.entries, key)
+		s.notify(&change{action: "delete", key: key, revision: s.revision})
+	}
+	s.persist()
+}
+
+//notify records the change and pushes its event to each watcher of the key, s.mu must be held
+func (s *Sync) notify(c *change) {
+	s.history = append(s.history, c)
+	if len(s.history) > 2*historyLimit {
+		s.compact(s.history[len(s.history)-historyLimit-1].revision)
+	}
+	for w := range s.watchers {
+		if strings.HasPrefix(c.key, w.prefix) {
+			w.push(c.event())
+		}
+	}
+}
+
+//Compact drops changes up to the revision from the history, as etcd compaction does.
+//Watches from compacted revisions fail with ErrCompacted
+func (s *Sync) Compact(revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compact(revision)
+}
+
+//compact drops changes up to the revision from the history, s.mu must be held
+func (s *Sync) compact(revision int64) {
+	if revision <= s.compacted {
+		return
+	}
+	dropped := 0
+	for dropped < len(s.history) && s.history[dropped].revision <= revision {
+		dropped++
+	}
+	s.history = append([]*change{}, s.history[dropped:]...)
+	s.compacted = revision
+}
+
+//endLease notifies the lock owner about the lost lock, s.mu must be held
+func (s *Sync) endLease(l *lease) {
+	if l.ended {
+		return
+	}
+	l.ended = true
+	if s.locks[l.path] == l {
+		delete(s.locks, l.path)
+	}
+	close(l.lost)
+}
+
+func newEvent(action, key, value string, revision int64) *sync.Event {
+	event := &sync.Event{
+		Action:   action,
+		Key:      key,
+		Revision: revision,
+	}
+	if err := json.Unmarshal([]byte(value), &event.Data); err != nil {
+		log.Warning("failed to unmarshal watch response value %s: %s", value, err)
+	}
+	return event
+}
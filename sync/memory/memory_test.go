@@ -0,0 +1,420 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gohan_sync "github.com/cloudwan/gohan/sync"
+)
+
+func TestUpdateAndDelete(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/to/somewhere"
+	if err := sync.Update(path, "blabla"); err != nil {
+		t.Errorf("unexpected error")
+	}
+	node, err := sync.Fetch(path)
+	if err != nil {
+		t.Errorf("unexpected error")
+	}
+	if node.Key != path || node.Value != "blabla" || len(node.Children) != 0 {
+		t.Errorf("unexpected node: %+v", node)
+	}
+
+	if err := sync.Delete(path, false); err != nil {
+		t.Errorf("unexpected error")
+	}
+	if _, err := sync.Fetch(path); err == nil {
+		t.Errorf("unexpected non error")
+	}
+
+	// empty values are ignored like in etcd v3
+	if err := sync.Update(path, ""); err != nil {
+		t.Errorf("unexpected error")
+	}
+	if _, err := sync.Fetch(path); err == nil {
+		t.Errorf("unexpected non error")
+	}
+}
+
+func TestRecursiveFetch(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	base := "/path/to/somewhere"
+	items := map[string]string{
+		base:                 "base",
+		base + "/inside":     "inside",
+		base + "/else/child": "child",
+		base + "invalid":     "should not be included",
+	}
+	for path, data := range items {
+		if err := sync.Update(path, data); err != nil {
+			t.Errorf("unexpected error")
+		}
+	}
+
+	node, err := sync.Fetch(base)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	if node.Key != base || node.Value != "base" || len(node.Children) != 2 {
+		t.Fatalf("unexpected node: %+v", node)
+	}
+	if node.Children[0].Key != base+"/else" || node.Children[0].Value != "" || len(node.Children[0].Children) != 1 {
+		t.Errorf("unexpected node: %+v", node.Children[0])
+	}
+	if node.Children[0].Children[0].Key != base+"/else/child" || node.Children[0].Children[0].Value != "child" {
+		t.Errorf("unexpected node: %+v", node.Children[0].Children[0])
+	}
+	if node.Children[1].Key != base+"/inside" || node.Children[1].Value != "inside" {
+		t.Errorf("unexpected node: %+v", node.Children[1])
+	}
+
+	if err := sync.Delete(base, true); err != nil {
+		t.Errorf("unexpected error")
+	}
+	if _, err := sync.Fetch(base); err == nil {
+		t.Errorf("unexpected non error")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	if err := sync.Update("/snapshot/a", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sync.Update("/snapshot/b", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sync.Delete("/snapshot/b", false); err != nil {
+		t.Fatal(err)
+	}
+	node, revision, err := sync.Snapshot("/snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Children) != 1 || node.Children[0].Key != "/snapshot/a" {
+		t.Errorf("unexpected node: %+v", node)
+	}
+	if revision <= node.Children[0].Revision {
+		t.Errorf("expected revision of the delete, got %d", revision)
+	}
+	if _, missingRevision, err := sync.Snapshot("/missing"); err != gohan_sync.ErrNotFound || missingRevision != revision {
+		t.Errorf("unexpected result for missing key: %d, %v", missingRevision, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/lock"
+	lost, err := sync.Lock(path, false)
+	if err != nil {
+		t.Errorf("unexpected error")
+	}
+	if _, err := sync.Lock(path, false); err == nil {
+		t.Errorf("unexpected non error")
+	}
+	if sync.HasLock(path) != true {
+		t.Errorf("unexpected false")
+	}
+	node, err := sync.Fetch(path)
+	if err != nil || node.Value != sync.GetProcessID() {
+		t.Errorf("unexpected lock node: %+v, %s", node, err)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		if _, err := sync.Lock(path, true); err != nil {
+			t.Errorf("unexpected error")
+		}
+		close(locked)
+	}()
+	time.Sleep(time.Millisecond * 100)
+	select {
+	case <-locked:
+		t.Errorf("blocking failed")
+	default:
+	}
+
+	if err := sync.Unlock(path); err != nil {
+		t.Errorf("unexpected error")
+	}
+	select {
+	case <-lost:
+	default:
+		t.Errorf("lost channel not closed by unlock")
+	}
+	select {
+	case <-locked:
+	case <-time.After(lockRetryInterval * 2):
+		t.Errorf("blocked lock not acquired")
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/lock"
+	lost, err := sync.Lock(path, false)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	sync.Delete(path, false)
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Errorf("lock not lost by delete")
+	}
+	if sync.HasLock(path) != false {
+		t.Errorf("unexpected true")
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/lock"
+	lost, err := sync.Lock(path, false)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	// simulate a stuck process not keeping the lock alive
+	sync.mu.Lock()
+	sync.entries[path].lease.expiresAt = time.Now()
+	sync.mu.Unlock()
+
+	select {
+	case <-lost:
+	case <-time.After(3 * time.Second):
+		t.Errorf("lock not expired")
+	}
+	if _, err := sync.Fetch(path); err == nil {
+		t.Errorf("unexpected non error")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/to/swap"
+	if ok, err := sync.CompareAndSwap(path, "1", 1, 0); ok || err != nil {
+		t.Errorf("unexpected swap of missing key: %t, %s", ok, err)
+	}
+	if ok, err := sync.CompareAndSwap(path, "1", 0, 0); !ok || err != nil {
+		t.Fatalf("unexpected failure: %t, %s", ok, err)
+	}
+	node, err := sync.Fetch(path)
+	if err != nil || node.Value != "1" {
+		t.Fatalf("unexpected node: %+v, %s", node, err)
+	}
+	if ok, _ := sync.CompareAndSwap(path, "2", 0, 0); ok {
+		t.Errorf("unexpected swap of existing key")
+	}
+	if ok, _ := sync.CompareAndSwap(path, "2", node.Revision, time.Hour); !ok {
+		t.Errorf("unexpected failure")
+	}
+	if ok, _ := sync.CompareAndSwap(path, "3", node.Revision, 0); ok {
+		t.Errorf("unexpected swap of outdated revision")
+	}
+
+	node, _ = sync.Fetch(path)
+	if ok, _ := sync.CompareAndSwap(path, "3", node.Revision, -1); !ok {
+		t.Errorf("unexpected failure")
+	}
+	sync.mu.Lock()
+	sync.entries[path].lease.expiresAt = time.Now()
+	sync.mu.Unlock()
+	time.Sleep(2 * time.Second)
+	if _, err := sync.Fetch(path); err == nil {
+		t.Errorf("ttl not kept by swap")
+	}
+}
+
+func TestFetchKeyAndPrefix(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	for _, path := range []string{"/kv/a", "/kv/a/b", "/kv/ab", "/other"} {
+		sync.Update(path, path)
+	}
+	node, err := sync.FetchKey("/kv/a")
+	if err != nil || node.Value != "/kv/a" || len(node.Children) != 0 {
+		t.Errorf("unexpected node: %+v, %v", node, err)
+	}
+	if _, err := sync.FetchKey("/kv"); err != gohan_sync.ErrNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	nodes, err := sync.FetchPrefix("/kv/a")
+	if err != nil || len(nodes) != 3 {
+		t.Fatalf("unexpected nodes: %+v, %v", nodes, err)
+	}
+	for i, key := range []string{"/kv/a", "/kv/a/b", "/kv/ab"} {
+		if nodes[i].Key != key || nodes[i].Value != key {
+			t.Errorf("unexpected node %d: %+v", i, nodes[i])
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/to/watch"
+	responseChan := make(chan *gohan_sync.Event)
+	stopChan := make(chan bool)
+
+	sync.Update(path+"/existing", `{"existing": true}`)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- sync.Watch(path, responseChan, stopChan, gohan_sync.RevisionCurrent)
+	}()
+
+	resp := <-responseChan
+	if resp.Action != "get" || resp.Key != path+"/existing" || resp.Data["existing"].(bool) != true {
+		t.Errorf("mismatch response: %+v", resp)
+	}
+
+	sync.Update(path+"/new", `{"existing": false}`)
+	resp = <-responseChan
+	if resp.Action != "set" || resp.Key != path+"/new" || resp.Data["existing"].(bool) != false {
+		t.Errorf("mismatch response: %+v", resp)
+	}
+
+	sync.Delete(path+"/existing", false)
+	resp = <-responseChan
+	if resp.Action != "delete" || resp.Key != path+"/existing" || len(resp.Data) != 0 {
+		t.Errorf("mismatch response: %+v", resp)
+	}
+
+	close(stopChan)
+	if err := <-watchErr; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestWatchFromRevision(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/to/watch"
+	sync.Update(path+"/first", `{"id": "first"}`)
+	node, _ := sync.Fetch(path + "/first")
+	sync.Update(path+"/second", `{"id": "second"}`)
+	sync.Update(path+"/third", `{"id": "third"}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := sync.WatchContext(ctx, path, node.Revision)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	for _, id := range []string{"second", "third"} {
+		resp := <-events
+		if resp.Action != "set" || resp.Data["id"] != id {
+			t.Errorf("mismatch response: %+v", resp)
+		}
+	}
+	cancel()
+	for resp := range events {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestWatchFromCompactedRevision(t *testing.T) {
+	sync := newSync(t, "")
+	defer sync.Close()
+
+	path := "/path/to/watch"
+	sync.Update(path+"/first", `{"id": "first"}`)
+	first, _ := sync.Fetch(path + "/first")
+	sync.Update(path+"/second", `{"id": "second"}`)
+	second, _ := sync.Fetch(path + "/second")
+	sync.Delete(path+"/first", false)
+	sync.Compact(second.Revision)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := sync.WatchContext(ctx, path, first.Revision)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	if resp := <-events; resp.Err != gohan_sync.ErrCompacted {
+		t.Errorf("expected compacted error, got: %+v", resp)
+	}
+
+	events, err = sync.WatchContext(ctx, path, second.Revision)
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	if resp := <-events; resp.Action != "delete" || resp.Key != path+"/first" {
+		t.Errorf("mismatch response: %+v", resp)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohan_sync")
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sync.json")
+
+	sync := newSync(t, file)
+	sync.Update("/persisted", `{"id": "persisted"}`)
+	sync.Lock("/lock", false)
+	node, _ := sync.Fetch("/persisted")
+	sync.Close()
+
+	sync = newSync(t, file)
+	defer sync.Close()
+	restored, err := sync.Fetch("/persisted")
+	if err != nil || restored.Value != node.Value || restored.Revision != node.Revision {
+		t.Errorf("unexpected node: %+v, %s", restored, err)
+	}
+	if _, err := sync.Fetch("/lock"); err == nil {
+		t.Errorf("lock should not be persisted")
+	}
+	sync.Update("/next", `{}`)
+	next, _ := sync.Fetch("/next")
+	if next.Revision <= node.Revision {
+		t.Errorf("revision not restored: %d", next.Revision)
+	}
+}
+
+func newSync(t *testing.T, file string) *Sync {
+	sync, err := NewSync(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return sync
+}
@@ -17,12 +17,21 @@ package sync
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	l "github.com/cloudwan/gohan/log"
 )
 
 const RevisionCurrent = -1
 
+var (
+	//ErrNotFound is returned by Fetch when there is no key under the path
+	ErrNotFound = errors.New("Not found")
+	//ErrCompacted is sent by Watch when the requested revision is no longer available
+	ErrCompacted = errors.New("Requested revision is compacted")
+)
+
 var log = l.NewLogger()
 
 //Sync is a interface for sync servers
@@ -45,6 +54,25 @@ type Sync interface {
 	Close()
 }
 
+//Swapper is implemented by sync backends able to read single keys and update them atomically
+type Swapper interface {
+	//FetchKey fetches only the key without its children, ErrNotFound is returned when there is no such key
+	FetchKey(key string) (*Node, error)
+	//FetchPrefix fetches keys starting with the prefix sorted by key, the nodes have no children
+	FetchPrefix(prefix string) ([]*Node, error)
+	//CompareAndSwap puts the value when the key is at the given revision, revision 0 means the key must not exist.
+	//The key expires after ttl, zero ttl never expires and negative ttl keeps expiration of the current key.
+	//Returns false when the key is at other revision.
+	CompareAndSwap(key, value string, revision int64, ttl time.Duration) (bool, error)
+}
+
+//Snapshotter is implemented by sync backends able to read keys under a path at a single revision
+type Snapshotter interface {
+	//Snapshot fetches data like Fetch does and returns the revision of the sync backend it is read at,
+	//the revision is returned with ErrNotFound as well
+	Snapshot(key string) (*Node, int64, error)
+}
+
 //Event is a struct for Watch response
 type Event struct {
 	Action   string
@@ -8,6 +8,7 @@ import (
 	"github.com/cloudwan/gohan/sync"
 	"github.com/cloudwan/gohan/sync/etcd"
 	"github.com/cloudwan/gohan/sync/etcdv3"
+	"github.com/cloudwan/gohan/sync/memory"
 	"github.com/cloudwan/gohan/util"
 )
 
@@ -32,6 +33,15 @@ func CreateFromConfig(config *util.Config) (s sync.Sync, err error) {
 				return
 			}
 		}
+	case "memory":
+		file := config.GetString("memory_sync/file", "")
+		log.Info("in-memory sync, persisted to: %s", file)
+		memorySync, memoryErr := memory.NewSync(file)
+		if memoryErr != nil {
+			err = fmt.Errorf("failed to create in-memory sync: %s", memoryErr)
+			return
+		}
+		s = memorySync
 	default:
 		err = fmt.Errorf("invalid sync type: %s", syncType)
 		return